@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"shared/telemetry"
+)
+
+// defaultAdminAddr is where the operator endpoints listen when ADMIN_ADDR isn't set. Only
+// localhost can reach them, as they change how the service behaves and describe its configuration.
+const defaultAdminAddr = "localhost:9000"
+
+// newAdminServer returns the server for the operator endpoints. It's separate from the checkout
+// listener, so the endpoints aren't exposed along with the service.
+func newAdminServer(addr string, providers *telemetry.Providers) *http.Server {
+	mux := http.NewServeMux()
+
+	// Operators can force-sample a specific transaction, e.g. PUT /admin/sample?attr=basket.id&value=123
+	mux.Handle("PUT /admin/sample", sampleHandler(providers.Sampler))
+	mux.Handle("DELETE /admin/sample", sampleHandler(providers.Sampler))
+	mux.Handle("GET /admin/otel", telemetry.DescribeHandler(providers))
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+// sampleHandler sets or clears the sampler's target. PUT with the attr and value query
+// parameters force-samples every trace whose root span has that attribute value, or whose
+// request arrived with it as baggage, e.g. "baggage: basket.id=123"; DELETE goes back to the
+// normal sampling.
+func sampleHandler(sampler *telemetry.TargetSampler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			sampler.ClearTarget()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		query := r.URL.Query()
+		key := query.Get("attr")
+		value := query.Get("value")
+
+		if key == "" || value == "" {
+			http.Error(w, "attr and value are required", http.StatusBadRequest)
+			return
+		}
+
+		sampler.SetTarget(key, value)
+
+		_, _ = fmt.Fprintf(w, "sampling all traces where %s=%s\n", key, value)
+	}
+}
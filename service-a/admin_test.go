@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shared/telemetry"
+)
+
+func TestAdminServer(t *testing.T) {
+	settings, err := telemetry.LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providers, shutdown, err := telemetry.Init(telemetry.Config{
+		ServiceName:               serviceName,
+		Settings:                  &settings,
+		DisableGlobalRegistration: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+
+	handler := newAdminServer("localhost:0", providers).Handler
+
+	tests := []struct {
+		method     string
+		target     string
+		wantCode   int
+		wantTarget string
+	}{
+		{method: http.MethodPut, target: "/admin/sample?attr=basket.id&value=123", wantCode: http.StatusOK, wantTarget: "basket.id=123"},
+		{method: http.MethodPut, target: "/admin/sample?attr=basket.id", wantCode: http.StatusBadRequest, wantTarget: "basket.id=123"},
+		{method: http.MethodGet, target: "/admin/sample", wantCode: http.StatusMethodNotAllowed, wantTarget: "basket.id=123"},
+		{method: http.MethodDelete, target: "/admin/sample", wantCode: http.StatusNoContent},
+		{method: http.MethodGet, target: "/admin/otel", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.target, rec.Code, tt.wantCode)
+		}
+
+		var got string
+		if target, ok := providers.Sampler.Target(); ok {
+			got = string(target.Key) + "=" + target.Value.Emit()
+		}
+
+		if got != tt.wantTarget {
+			t.Errorf("%s %s: got target %q, want %q", tt.method, tt.target, got, tt.wantTarget)
+		}
+	}
+}
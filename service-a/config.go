@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared/delay"
+	"shared/middleware"
+	"shared/telemetry"
+)
+
+// Config is the configuration of service-a, resolved from the environment by LoadConfig.
+type Config struct {
+	// Telemetry configures the OpenTelemetry SDK.
+	Telemetry telemetry.Settings `json:"telemetry"`
+
+	// Region is the AWS region the service runs in. service-a makes no AWS calls, so it comes
+	// straight from AWS_REGION.
+	Region string `json:"region"`
+
+	// PaymentHosts are the payment backends a checkout fans out to, from PAYMENT_SERVICE_HOSTS,
+	// comma separated, or otherwise PAYMENT_SERVICE_HOST.
+	PaymentHosts []string `json:"paymentHosts"`
+
+	// MaxRequestBodyBytes bounds the size of request bodies (MAX_REQUEST_BODY_BYTES).
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes"`
+
+	// HTTP4xxIsError counts 4xx responses, as well as 5xx, as errors (HTTP_4XX_IS_ERROR).
+	HTTP4xxIsError bool `json:"http4xxIsError"`
+
+	// PropagateUserAgent and PropagateDeadline propagate the client's user agent and each
+	// checkout's deadline to the downstream services in the baggage (PROPAGATE_USER_AGENT and
+	// PROPAGATE_DEADLINE).
+	PropagateUserAgent bool `json:"propagateUserAgent"`
+	PropagateDeadline  bool `json:"propagateDeadline"`
+
+	// ErrorInjectionRate is the fraction of requests failed on purpose (ERROR_INJECTION_RATE).
+	ErrorInjectionRate float64 `json:"errorInjectionRate"`
+
+	// CheckoutDelay is injected into each checkout (CHECKOUT_DELAY).
+	CheckoutDelay delay.Delay `json:"checkoutDelay"`
+
+	// XRayConsoleURL is the base URL of the X-Ray console the checkouts link to
+	// (XRAY_CONSOLE_URL).
+	XRayConsoleURL string `json:"xrayConsoleUrl"`
+
+	// AdminAddr is where the operator endpoints, /admin/sample and /admin/otel, are served
+	// (ADMIN_ADDR). They're kept off the checkout listener, and only listen on localhost unless
+	// set.
+	AdminAddr string `json:"adminAddr"`
+
+	// DemoSeed seeds the basket IDs generated by /demo (DEMO_SEED). It's random unless set, when
+	// the basket IDs are reproducible.
+	DemoSeed int64 `json:"demoSeed"`
+}
+
+// LoadConfig resolves the service's configuration from the environment, applying the defaults
+// for anything that isn't set. It returns an error naming the first invalid setting.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Region:              os.Getenv("AWS_REGION"),
+		PaymentHosts:        []string{os.Getenv("PAYMENT_SERVICE_HOST")},
+		MaxRequestBodyBytes: middleware.DefaultMaxBodySize,
+		HTTP4xxIsError:      os.Getenv("HTTP_4XX_IS_ERROR") == "true",
+		PropagateUserAgent:  os.Getenv("PROPAGATE_USER_AGENT") == "true",
+		PropagateDeadline:   os.Getenv("PROPAGATE_DEADLINE") == "true",
+		XRayConsoleURL:      defaultXRayConsoleURL,
+		AdminAddr:           defaultAdminAddr,
+		DemoSeed:            time.Now().UnixNano(),
+	}
+
+	if v := os.Getenv("PAYMENT_SERVICE_HOSTS"); v != "" {
+		cfg.PaymentHosts = strings.Split(v, ",")
+		for i, host := range cfg.PaymentHosts {
+			cfg.PaymentHosts[i] = strings.TrimSpace(host)
+		}
+	}
+
+	if v, ok := os.LookupEnv("MAX_REQUEST_BODY_BYTES"); ok {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return Config{}, fmt.Errorf("invalid MAX_REQUEST_BODY_BYTES: %q", v)
+		}
+
+		cfg.MaxRequestBodyBytes = limit
+	}
+
+	if v, ok := os.LookupEnv("ERROR_INJECTION_RATE"); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Config{}, fmt.Errorf("invalid ERROR_INJECTION_RATE: %q", v)
+		}
+
+		cfg.ErrorInjectionRate = rate
+	}
+
+	var err error
+	if cfg.Telemetry, err = telemetry.LoadSettings(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.CheckoutDelay, err = delay.Parse(os.Getenv("CHECKOUT_DELAY")); err != nil {
+		return Config{}, fmt.Errorf("invalid CHECKOUT_DELAY: %w", err)
+	}
+
+	if v, ok := os.LookupEnv("XRAY_CONSOLE_URL"); ok {
+		cfg.XRayConsoleURL = v
+	}
+
+	if v, ok := os.LookupEnv("ADMIN_ADDR"); ok {
+		cfg.AdminAddr = v
+	}
+
+	if v, ok := os.LookupEnv("DEMO_SEED"); ok {
+		if cfg.DemoSeed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Config{}, fmt.Errorf("invalid DEMO_SEED: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
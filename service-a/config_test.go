@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"shared/middleware"
+)
+
+func TestLoadConfigErrorInjectionRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     *string
+		want    float64
+		wantErr bool
+	}{
+		{name: "disabled by default"},
+		{name: "rate", env: ptr("0.1"), want: 0.1},
+		{name: "every request", env: ptr("1"), want: 1},
+		{name: "not a number", env: ptr("often"), wantErr: true},
+		{name: "more than every request", env: ptr("1.5"), wantErr: true},
+		{name: "negative", env: ptr("-0.1"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ERROR_INJECTION_RATE", "")
+			if tt.env == nil {
+				os.Unsetenv("ERROR_INJECTION_RATE")
+			} else {
+				t.Setenv("ERROR_INJECTION_RATE", *tt.env)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got rate %v", cfg.ErrorInjectionRate)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.ErrorInjectionRate != tt.want {
+				t.Errorf("got rate %v, want %v", cfg.ErrorInjectionRate, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestLoadConfigPaymentHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		host  string
+		hosts string
+		want  []string
+	}{
+		{name: "single host", host: "http://service-b:8001", want: []string{"http://service-b:8001"}},
+		{
+			name:  "several hosts",
+			host:  "http://service-b:8001",
+			hosts: "http://service-b:8001, http://service-b2:8001",
+			want:  []string{"http://service-b:8001", "http://service-b2:8001"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAYMENT_SERVICE_HOST", tt.host)
+			t.Setenv("PAYMENT_SERVICE_HOSTS", tt.hosts)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(cfg.PaymentHosts, tt.want) {
+				t.Errorf("got hosts %q, want %q", cfg.PaymentHosts, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMaxRequestBodyBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     *string
+		want    int64
+		wantErr bool
+	}{
+		{name: "default", want: middleware.DefaultMaxBodySize},
+		{name: "set", env: ptr("2048"), want: 2048},
+		{name: "not a number", env: ptr("lots"), wantErr: true},
+		{name: "zero", env: ptr("0"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_REQUEST_BODY_BYTES", "")
+			if tt.env == nil {
+				os.Unsetenv("MAX_REQUEST_BODY_BYTES")
+			} else {
+				t.Setenv("MAX_REQUEST_BODY_BYTES", *tt.env)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got limit %d", cfg.MaxRequestBodyBytes)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.MaxRequestBodyBytes != tt.want {
+				t.Errorf("got limit %d, want %d", cfg.MaxRequestBodyBytes, tt.want)
+			}
+		})
+	}
+}
@@ -2,33 +2,86 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
+	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"shared/appattr"
+	"shared/config"
+	"shared/logging"
+	"shared/middleware"
+	"shared/telemetry"
 )
 
 const (
 	serviceName    = "service-a"
 	serviceVersion = "1.3.6"
+
+	// checkoutTimeout bounds the whole checkout, including the downstream payment call.
+	checkoutTimeout = 10 * time.Second
+
+	// defaultCurrency is used when a checkout doesn't specify one.
+	defaultCurrency = "GBP"
 )
 
 func main() {
 
-	shutdown := initialiseOpenTelemetry()
+	slog.SetDefault(logging.New())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	// With --print-config, or PRINT_CONFIG=true, the configuration is printed without starting.
+	if config.PrintRequested() {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	// Optionally trace the startup, with TRACE_STARTUP=true, to measure the cold start.
+	startup := telemetry.NewStartupTrace()
+
+	// service-a makes no AWS calls, so the region comes straight from the environment.
+	endPhase := startup.Phase("Init Telemetry")
+	providers, shutdown := initialiseOpenTelemetry(cfg.Region, cfg.Telemetry)
 	defer shutdown()
+	endPhase()
+
+	startup.Export(context.Background(), providers)
 
 	r := mux.NewRouter()
 
+	// Mark requests with X-Synthetic: true as synthetic traffic in the baggage. It must come before
+	// otelmux, which extracts the baggage.
+	r.Use(middleware.Synthetic())
+
+	// Carry the basket ID into the baggage, also before otelmux, so the sampler can force-sample a
+	// checkout targeted by PUT /admin/sample?attr=basket.id&value=123 when its server span starts.
+	r.Use(middleware.QueryBaggage("basketId", "basket.id"))
+
 	// mux is not an instrumented library (currently), therefore we need to use
 	// the instrumentation library to instrument mux for us. This is true for all libraries
 	// that are not natively instrumented.
@@ -36,18 +89,132 @@ func main() {
 	// github.com/open-telemetry/opentelemetry-go-contrib/blob/main/instrumentation/github.com/gorilla/mux/otelmux/
 	r.Use(otelmux.Middleware(serviceName))
 
-	r.HandleFunc("/checkout", checkoutHandler)
+	// Name server spans after the route template rather than the raw path, so path parameters
+	// don't leak into (and explode the cardinality of) span names.
+	r.Use(middleware.RouteSpanName())
+
+	// Identify each request, honouring an X-Request-Id set by the client.
+	r.Use(middleware.RequestID())
+
+	// Record the service that made the request, and name this one as the caller downstream.
+	r.Use(middleware.Caller(serviceName))
+
+	// Only 5xx responses mark spans as errored, unless HTTP_4XX_IS_ERROR=true counts 4xx too.
+	// The same policy applies to the server spans and the payment client's spans.
+	statusPolicy := telemetry.StatusPolicy{ClientErrors: cfg.HTTP4xxIsError}
+	r.Use(middleware.SpanStatus(statusPolicy))
+
+	// Recover from panics, logging them with the trace they happened in.
+	r.Use(middleware.Recover())
+	r.Use(middleware.ColdStart(providers.ColdStart))
+	r.Use(middleware.BodySize())
+
+	// Bound the size of request bodies, configurable in bytes via MAX_REQUEST_BODY_BYTES.
+	r.Use(middleware.MaxBodySize(cfg.MaxRequestBodyBytes))
+
+	// Optionally propagate the client's user agent to the downstream services in the baggage.
+	if cfg.PropagateUserAgent {
+		r.Use(middleware.UserAgent())
+	}
+
+	// Optionally fail a fraction of requests, to demo errored traces.
+	if cfg.ErrorInjectionRate > 0 {
+		r.Use(middleware.ErrorInjection(cfg.ErrorInjectionRate, time.Now().UnixNano()))
+	}
+
+	// Each checkout logs and returns a link to its trace in the X-Ray console. X-Ray only accepts
+	// its own trace IDs, so there's no link when they're generated in another format.
+	var console *xrayConsole
+	if providers.TraceIDFormat == telemetry.TraceIDFormatXRay {
+		console = &xrayConsole{baseURL: cfg.XRayConsoleURL, region: cfg.Region}
+	}
+
+	// A checkout can optionally fan out to several payment backends, listed comma separated in
+	// PAYMENT_SERVICE_HOSTS, to demo concurrent downstream calls on the request path.
+	paymentHosts := cfg.PaymentHosts
+
+	// Every checkout is bounded by the checkout timeout, which the optional CHECKOUT_DELAY counts
+	// towards. With PROPAGATE_DEADLINE=true the deadline is propagated to the downstream services
+	// in the baggage, so they can stop working on a checkout that has already timed out.
+	checkout := func(h http.Handler) http.Handler {
+		h = middleware.Delay(cfg.CheckoutDelay)(h)
+		if cfg.PropagateDeadline {
+			h = middleware.PropagateDeadline()(h)
+		}
+
+		return TimeoutHandler(checkoutTimeout)(h)
+	}
+
+	// Like the mux router, the standard library HTTP client is not instrumented. Therefore, we
+	// need the instrumentation library to instrument the HTTP client for us.
+	//
+	// github.com/open-telemetry/opentelemetry-go-contrib/tree/main/instrumentation/net/http/otelhttp
+	client := http.Client{Transport: otelhttp.NewTransport(statusPolicy.Transport(http.DefaultTransport))}
+
+	r.Handle("/checkout", checkout(checkoutHandler(console, client, paymentHosts)))
+
+	// The basket IDs generated by /demo are reproducible when DEMO_SEED is set.
+	r.Handle("/demo", checkout(demoHandler(console, client, paymentHosts, newBasketIDGenerator(cfg.DemoSeed))))
 	http.Handle("/", r)
 
-	fmt.Println("starting server on port 8000")
-	fmt.Printf("-> http://localhost:8000/checkout?basketId=%d\n", rand.Int())
+	adminServer := newAdminServer(cfg.AdminAddr, providers)
+	go func() {
+		slog.Info("starting admin server", "addr", cfg.AdminAddr)
+
+		if err := adminServer.ListenAndServe(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	slog.Info("starting server on port 8000", "url", fmt.Sprintf("http://localhost:8000/checkout?basketId=%d", rand.Int()))
 
 	if err := http.ListenAndServe(":8000", nil); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func checkoutHandler(w http.ResponseWriter, r *http.Request) {
+func checkoutHandler(console *xrayConsole, client http.Client, paymentHosts []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract the basket ID value from the query string.
+		query := r.URL.Query()
+		basketID := query.Get("basketId")
+
+		p, err := paymentFromQuery(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		checkout(w, r, console, client, paymentHosts, basketID, p)
+	}
+}
+
+// demoHandler runs a checkout for a generated basket ID, so presenters can trigger a trace
+// without constructing the query string.
+func demoHandler(console *xrayConsole, client http.Client, paymentHosts []string, nextBasketID func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		checkout(w, r, console, client, paymentHosts, nextBasketID(), payment{amount: randomAmount(), currency: defaultCurrency})
+	}
+}
+
+// newBasketIDGenerator returns a func generating random basket IDs from the given seed. It is
+// safe for concurrent use.
+func newBasketIDGenerator(seed int64) func() string {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+
+	return func() string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return strconv.Itoa(rng.Int())
+	}
+}
+
+// checkout takes payment for the basket and responds with the trace ID.
+func checkout(w http.ResponseWriter, r *http.Request, console *xrayConsole, client http.Client, paymentHosts []string, basketID string, p payment) {
+	start := time.Now()
+
 	// Trace information is propagated using the context value.
 	// To access the current Span, we use the OTel Trace API to extract this.
 	span := trace.SpanFromContext(r.Context())
@@ -56,51 +223,126 @@ func checkoutHandler(w http.ResponseWriter, r *http.Request) {
 	// The SpanContext is serialised and propagated across program boundaries.
 	//
 	// opentelemetry.io/docs/reference/specification/overview/#spancontext
-	traceID := span.SpanContext().TraceID().String()
-
-	// Like the mux router, the standard library HTTP client is not instrumented. Therefore, we
-	// need the instrumentation library to instrument the HTTP client for us.
-	//
-	// github.com/open-telemetry/opentelemetry-go-contrib/tree/main/instrumentation/net/http/otelhttp
-	client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
-
-	// Extract the basket ID value from the query string.
-	query := r.URL.Query()
-	basketID := query.Get("basketId")
+	traceID := span.SpanContext().TraceID()
 
 	// Create a new transaction ID for this order.
 	transactionID := uuid.New().String()
 
-	if err := makePayment(r.Context(), client, basketID, transactionID); err != nil {
+	// The checkout's start time travels with the payment through to service-c, which measures
+	// how long the order took to process end to end.
+	ctx := telemetry.ContextWithCheckoutStart(r.Context(), start)
+
+	if err := makePayments(ctx, client, paymentHosts, basketID, transactionID, p); err != nil {
+		slog.ErrorContext(r.Context(), "error making payment", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	var xrayID, consoleURL string
+	if console != nil {
+		xrayID, _ = xrayTraceID(traceID)
+
+		var err error
+		consoleURL, err = console.traceURL(traceID)
+		if err != nil {
+			slog.WarnContext(r.Context(), "unable to build x-ray console url", "error", err)
+		} else {
+			slog.InfoContext(r.Context(), "checkout complete", "xray.console_url", consoleURL)
+		}
+	} else {
+		slog.InfoContext(r.Context(), "checkout complete")
+	}
+
+	writeResponse(r.Context(), w, checkoutResponse{
+		TraceID:        traceID.String(),
+		XRay:           xrayID,
+		XRayConsoleURL: consoleURL,
+	})
+}
+
+// checkoutResponse is the JSON body of a successful checkout. The X-Ray fields are omitted when
+// the trace IDs aren't generated in X-Ray's format.
+type checkoutResponse struct {
+	TraceID        string `json:"traceId"`
+	XRay           string `json:"xray,omitempty"`
+	XRayConsoleURL string `json:"xrayConsoleUrl,omitempty"`
+}
+
+// writeResponse encodes the response as JSON and writes it in its own span, so the final stage
+// of the request completes the trace's waterfall. The span records the size of the body.
+func writeResponse(ctx context.Context, w http.ResponseWriter, response checkoutResponse) {
+	_, span := tracer("checkout").Start(ctx, "Write Response")
+	defer span.End()
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error encoding response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	response := fmt.Sprintf(`{"traceId": "%s", "xray":"%s"}`, traceID, "1-"+traceID[0:8]+"-"+traceID[8:])
-	w.Header().Add("ContentType", "application/json")
-	_, _ = w.Write(([]byte)(response))
+	n, err := w.Write(body)
+	span.SetAttributes(attribute.Int("http.response.body.size", n))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error writing response")
+	}
+}
+
+// makePayments takes the payment from every host concurrently, each in its own span. It only
+// succeeds if all of them do; the first failure cancels the remaining requests.
+func makePayments(ctx context.Context, client http.Client, hosts []string, basketID string, transactionID string, p payment) error {
+	// Baggage lets us propagate key/value pairs alongside the trace context. The transaction ID
+	// travels with the payment request to service-b and across the SQS boundary to service-c,
+	// alongside any baggage already set, such as the user agent.
+	if member, err := baggage.NewMember("transaction.id", transactionID); err == nil {
+		if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, host := range hosts {
+		host := strings.TrimSpace(host)
+		g.Go(func() error {
+			return makePayment(ctx, client, host, basketID, transactionID, p)
+		})
+	}
+
+	return g.Wait()
 }
 
-func makePayment(ctx context.Context, client http.Client, basketID string, transactionID string) error {
-	// To create a new child span we must first retrieve the global TraceProvider. We registered
-	// this earlier. Next, we can get a Tracer, using the service name to identify our service.
-	// Finally, we can start a new span describing the current operation.
+func makePayment(ctx context.Context, client http.Client, host string, basketID string, transactionID string, p payment) error {
+	// To create a new child span we must first get a Tracer from the global TraceProvider we
+	// registered earlier, scoped to the part of our service doing the work. Then we can start
+	// a new span describing the current operation.
 	// An updated Context value is returned containing the updated trace state,
-	ctx, span := otel.GetTracerProvider().
-		Tracer(serviceName).
+	ctx, span := tracer("payment").
 		Start(ctx, "Make Payment",
 			trace.WithAttributes(
-				attribute.String("basket.id", basketID),
-				attribute.String("transaction.id", transactionID),
+				appattr.Key("basket.id").String(basketID),
+				appattr.Key("transaction.id").String(transactionID),
+				appattr.Key("payment.amount").Float64(p.amount),
+				appattr.Key("payment.currency").String(p.currency),
+				appattr.Key("payment.host").String(host),
 			))
 
 	defer span.End()
 
-	url := fmt.Sprintf("%s/payment?transactionId=%s", os.Getenv("PAYMENT_SERVICE_HOST"), transactionID)
+	query := url.Values{
+		"transactionId": {transactionID},
+		"amount":        {strconv.FormatFloat(p.amount, 'f', 2, 64)},
+		"currency":      {p.currency},
+	}
+
+	paymentURL := fmt.Sprintf("%s/payment?%s", host, query.Encode())
 
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, paymentURL, nil)
 
 	res, err := client.Do(req)
 	if err != nil {
@@ -108,5 +350,41 @@ func makePayment(ctx context.Context, client http.Client, basketID string, trans
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("service-b request to %s failed with status %d", host, res.StatusCode)
+	}
+
 	return nil
 }
+
+// payment is the amount charged for a basket.
+type payment struct {
+	amount   float64
+	currency string
+}
+
+// paymentFromQuery reads the optional amount and currency query parameters. A random amount is
+// generated when none is given, so the demo works without any parameters.
+func paymentFromQuery(query url.Values) (payment, error) {
+	p := payment{amount: randomAmount(), currency: defaultCurrency}
+
+	if v := query.Get("amount"); v != "" {
+		amount, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(amount > 0) || math.IsInf(amount, 0) {
+			return payment{}, fmt.Errorf("invalid amount %q: must be a positive number", v)
+		}
+
+		p.amount = amount
+	}
+
+	if v := query.Get("currency"); v != "" {
+		p.currency = strings.ToUpper(v)
+	}
+
+	return p, nil
+}
+
+// randomAmount returns an amount between 1.00 and 100.00.
+func randomAmount() float64 {
+	return float64(rand.Intn(9901)+100) / 100
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPaymentFromQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    payment
+		wantErr bool
+	}{
+		{name: "amount and currency", query: url.Values{"amount": {"12.50"}, "currency": {"usd"}}, want: payment{amount: 12.5, currency: "USD"}},
+		{name: "default currency", query: url.Values{"amount": {"3"}}, want: payment{amount: 3, currency: defaultCurrency}},
+		{name: "zero", query: url.Values{"amount": {"0"}}, wantErr: true},
+		{name: "negative", query: url.Values{"amount": {"-1"}}, wantErr: true},
+		{name: "not a number", query: url.Values{"amount": {"NaN"}}, wantErr: true},
+		{name: "infinite", query: url.Values{"amount": {"+Inf"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := paymentFromQuery(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Without an amount, a random one is generated.
+	if p, err := paymentFromQuery(url.Values{}); err != nil || p.amount < 1 || p.amount > 100 {
+		t.Errorf("got %+v, %v, want a random amount", p, err)
+	}
+}
+
+func TestMakePaymentPropagatesAmount(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	queries := make(chan url.Values, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query()
+	}))
+	defer server.Close()
+
+	if err := makePayment(context.Background(), http.Client{}, server.URL, "basket", "txn", payment{amount: 42.5, currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+
+	query := <-queries
+	if query.Get("amount") != "42.50" || query.Get("currency") != "EUR" || query.Get("transactionId") != "txn" {
+		t.Errorf("got query %v", query)
+	}
+
+	attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+	if v, _ := attrs.Value("payment.amount"); v.AsFloat64() != 42.5 {
+		t.Errorf("got payment.amount %v, want 42.5", v.Emit())
+	}
+
+	if v, _ := attrs.Value("payment.currency"); v.AsString() != "EUR" {
+		t.Errorf("got payment.currency %q, want EUR", v.AsString())
+	}
+}
+
+func TestNewBasketIDGenerator(t *testing.T) {
+	a, b, other := newBasketIDGenerator(1), newBasketIDGenerator(1), newBasketIDGenerator(2)
+
+	for i := range 3 {
+		want := a()
+		if got := b(); got != want {
+			t.Errorf("basket %d: got %q from the same seed, want %q", i, got, want)
+		}
+
+		if got := other(); got == want {
+			t.Errorf("basket %d: got %q from another seed, want a different ID", i, got)
+		}
+	}
+}
+
+func TestDemoHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		console  *xrayConsole
+		wantXRay bool
+	}{
+		{name: "without the console"},
+		{name: "with the console", console: &xrayConsole{baseURL: "https://console.aws.amazon.com/xray/home", region: "eu-west-1"}, wantXRay: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payments.Close()
+
+			r := mux.NewRouter()
+			r.Use(otelmux.Middleware(serviceName))
+			r.Handle("/demo", demoHandler(tt.console, http.Client{}, []string{payments.URL}, newBasketIDGenerator(1)))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/demo", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+
+			var response checkoutResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			traceID, err := trace.TraceIDFromHex(response.TraceID)
+			if err != nil {
+				t.Fatalf("got trace ID %q: %v", response.TraceID, err)
+			}
+
+			var basketID string
+			for _, span := range recorder.Ended() {
+				if span.SpanContext().TraceID() != traceID {
+					t.Errorf("got span %q in trace %s, want %s", span.Name(), span.SpanContext().TraceID(), traceID)
+				}
+
+				if span.Name() == "Make Payment" {
+					attrs := attribute.NewSet(span.Attributes()...)
+					v, _ := attrs.Value("basket.id")
+					basketID = v.AsString()
+				}
+			}
+
+			if want := newBasketIDGenerator(1)(); basketID != want {
+				t.Errorf("got basket.id %q, want %q from the seed", basketID, want)
+			}
+
+			if got := response.XRay != ""; got != tt.wantXRay {
+				t.Errorf("got X-Ray trace ID %q, want one %t", response.XRay, tt.wantXRay)
+			}
+
+			// Without the console, the trace IDs aren't in X-Ray's format, so the fields are omitted.
+			var fields map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, key := range []string{"xray", "xrayConsoleUrl"} {
+				if _, got := fields[key]; got != tt.wantXRay {
+					t.Errorf("got the %s field %t, want %t", key, got, tt.wantXRay)
+				}
+			}
+		})
+	}
+}
+
+func TestMakePayments(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	fail := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }
+
+	tests := []struct {
+		name     string
+		backends []http.HandlerFunc
+		slow     bool
+		wantErr  bool
+	}{
+		{name: "single backend", backends: []http.HandlerFunc{ok}},
+		{name: "both succeed", backends: []http.HandlerFunc{ok, ok}},
+		{name: "one fails", backends: []http.HandlerFunc{ok, fail}, wantErr: true},
+		// The failure cancels the request still waiting on the slow backend.
+		{name: "failure cancels the rest", backends: []http.HandlerFunc{fail}, slow: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(tp)
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			var hosts []string
+			for _, backend := range tt.backends {
+				server := httptest.NewServer(backend)
+				t.Cleanup(server.Close)
+				hosts = append(hosts, server.URL)
+			}
+
+			if tt.slow {
+				release := make(chan struct{})
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-release:
+					}
+				}))
+				t.Cleanup(server.Close)
+				t.Cleanup(func() { close(release) })
+				hosts = append(hosts, server.URL)
+			}
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "GET /checkout")
+
+			start := time.Now()
+			err := makePayments(ctx, http.Client{}, hosts, "basket", "txn", payment{amount: 10, currency: "GBP"})
+			parent.End()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("got the payments taking %s, want the failure to cancel the rest", elapsed)
+			}
+
+			paid := map[string]bool{}
+			for _, span := range recorder.Ended() {
+				if span.Name() != "Make Payment" {
+					continue
+				}
+
+				if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+					t.Errorf("got a Make Payment span with parent %s, want %s", span.Parent().SpanID(), parent.SpanContext().SpanID())
+				}
+
+				attrs := attribute.NewSet(span.Attributes()...)
+				host, _ := attrs.Value("payment.host")
+				paid[host.AsString()] = true
+			}
+
+			for _, host := range hosts {
+				if !paid[host] {
+					t.Errorf("got no Make Payment span for %s", host)
+				}
+			}
+		})
+	}
+}
+
+// failingWriter is a ResponseWriter whose writes fail, as if the client went away.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestWriteResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response checkoutResponse
+		failing  bool
+	}{
+		{name: "without the console", response: checkoutResponse{TraceID: "5759e988bd862e3fe1be46a994272793"}},
+		{
+			name: "with the console",
+			response: checkoutResponse{
+				TraceID:        "5759e988bd862e3fe1be46a994272793",
+				XRay:           "1-5759e988-bd862e3fe1be46a994272793",
+				XRayConsoleURL: "https://console.aws.amazon.com/xray/home?region=eu-west-1#/traces/1-5759e988-bd862e3fe1be46a994272793",
+			},
+		},
+		{name: "client gone", response: checkoutResponse{TraceID: "5759e988bd862e3fe1be46a994272793"}, failing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "/checkout")
+
+			rec := httptest.NewRecorder()
+			var w http.ResponseWriter = rec
+			if tt.failing {
+				w = failingWriter{rec}
+			}
+
+			writeResponse(ctx, w, tt.response)
+			parent.End()
+
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", got)
+			}
+
+			if !tt.failing {
+				var got checkoutResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatal(err)
+				}
+
+				if got != tt.response {
+					t.Errorf("got response %+v, want %+v", got, tt.response)
+				}
+			}
+
+			span := recorder.Ended()[0]
+			if span.Name() != "Write Response" {
+				t.Fatalf("got span %q, want Write Response", span.Name())
+			}
+
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("got the Write Response span outside the request's span, want it a child")
+			}
+
+			attrs := attribute.NewSet(span.Attributes()...)
+			size, _ := attrs.Value("http.response.body.size")
+			if want := int64(rec.Body.Len()); size.AsInt64() != want || (!tt.failing && want == 0) {
+				t.Errorf("got http.response.body.size %d, want %d", size.AsInt64(), want)
+			}
+
+			if got := span.Status().Code == codes.Error; got != tt.failing {
+				t.Errorf("got errored %t, want %t", got, tt.failing)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// TimeoutHandler returns a middleware that bounds each request with a context deadline.
+//
+// Unlike the standard library's http.TimeoutHandler, the deadline is set on the request
+// context itself, so any downstream work started with that context (HTTP calls, AWS SDK
+// calls) is cancelled when the timeout fires. On timeout the client receives a 503 and
+// the server span is marked as errored.
+func TimeoutHandler(d time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer close(done)
+
+				// A panic in the handler's goroutine can't be recovered by the middleware further up
+				// the chain, so it's handed back to be re-raised on the request's goroutine, along
+				// with the stack it was raised on.
+				defer func() {
+					switch p := recover(); p {
+					case nil:
+					case http.ErrAbortHandler:
+						panicked <- p
+					default:
+						panicked <- fmt.Sprintf("%v\n\n%s", p, debug.Stack())
+					}
+				}()
+
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+
+			// finish re-raises a panic from the handler, or otherwise sends its response.
+			finish := func() {
+				select {
+				case p := <-panicked:
+					panic(p)
+				default:
+				}
+
+				tw.flushTo(w)
+			}
+
+			select {
+			case <-done:
+				finish()
+			case <-ctx.Done():
+				// The context is also cancelled when the client disconnects, which isn't a timeout.
+				// The handler is left to wind down as it would without the middleware.
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					<-done
+					finish()
+					return
+				}
+
+				tw.timeout()
+
+				// The span was started by the otelmux middleware further up the chain,
+				// so it is still available from the request context.
+				span := trace.SpanFromContext(ctx)
+				span.SetAttributes(appattr.Key("timeout").Bool(true))
+				span.SetStatus(codes.Error, "request timed out")
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the wrapped handler's response so that it can be discarded if
+// the handler is still running when the deadline is reached.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+
+	tw.code = code
+}
+
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.timedOut = true
+}
+
+func (tw *timeoutWriter) flushTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	for k, v := range tw.header {
+		w.Header()[k] = v
+	}
+
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+
+	w.WriteHeader(tw.code)
+	_, _ = w.Write(tw.buf.Bytes())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		delay       time.Duration
+		disconnect  bool
+		wantCode    int
+		wantTimeout bool
+	}{
+		{name: "fast", wantCode: http.StatusAccepted},
+		{name: "slow", delay: time.Second, wantCode: http.StatusServiceUnavailable, wantTimeout: true},
+		{name: "client disconnects", delay: time.Second, disconnect: true, wantCode: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// The handler stands in for the payment call, stopping as soon as its context is done.
+			handler := TimeoutHandler(timeout)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+				}
+
+				w.WriteHeader(http.StatusAccepted)
+			}))
+
+			// The server span is started further up the chain, as by otelmux.
+			ctx, span := tracer.Start(context.Background(), "/checkout")
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			if tt.disconnect {
+				time.AfterFunc(timeout/5, cancel)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/checkout", nil).WithContext(ctx))
+			span.End()
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			ended := recorder.Ended()[0]
+
+			wantStatus := codes.Unset
+			if tt.wantTimeout {
+				wantStatus = codes.Error
+			}
+
+			if got := ended.Status().Code; got != wantStatus {
+				t.Errorf("got span status %s, want %s", got, wantStatus)
+			}
+
+			var timedOut bool
+			for _, kv := range ended.Attributes() {
+				if kv.Key == "timeout" && kv.Value == attribute.BoolValue(true) {
+					timedOut = true
+				}
+			}
+
+			if timedOut != tt.wantTimeout {
+				t.Errorf("got timeout attribute %t, want %t", timedOut, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+// TestTimeoutHandlerPanic checks a panic in the handler's goroutine is re-raised on the request's
+// goroutine, so the recovery middleware further up the chain can recover it.
+func TestTimeoutHandlerPanic(t *testing.T) {
+	tests := []struct {
+		name      string
+		panic     any
+		wantPanic string
+	}{
+		{name: "panic", panic: "payment backend exploded", wantPanic: "payment backend exploded"},
+		{name: "abort", panic: http.ErrAbortHandler, wantPanic: http.ErrAbortHandler.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := TimeoutHandler(time.Second)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic(tt.panic)
+			}))
+
+			defer func() {
+				if got := fmt.Sprint(recover()); !strings.HasPrefix(got, tt.wantPanic) {
+					t.Errorf("got panic %q, want it to start with %q", got, tt.wantPanic)
+				}
+			}()
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkout", nil))
+		})
+	}
+}
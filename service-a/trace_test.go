@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/middleware"
+	"shared/telemetry"
+	"shared/tracetree"
+)
+
+// TestCheckoutTraceShape locks in the spans of a checkout, with their kinds, parents and
+// attributes. Run it with -update to rewrite the golden file once a change to the trace is
+// intended.
+func TestCheckoutTraceShape(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer payments.Close()
+
+	// The checkout is routed and instrumented as in main.
+	client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+	r := mux.NewRouter()
+	r.Use(otelmux.Middleware(serviceName))
+	r.Use(middleware.RouteSpanName())
+	r.Handle("/checkout", checkoutHandler(nil, client, []string{payments.URL}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/checkout?basketId=42&amount=12.50&currency=EUR", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("checkout responded %d", w.Code)
+	}
+
+	values := []attribute.Key{
+		"http.request.method",
+		"http.route",
+		"http.response.status_code",
+		appattr.Key("basket.id"),
+		appattr.Key("payment.amount"),
+		appattr.Key("payment.currency"),
+	}
+
+	tracetree.Golden(t, filepath.Join("testdata", "checkout.golden"), tracetree.Shape(values, recorder.Ended()))
+}
+
+// TestIncomingTraceContext checks the server span continues the caller's trace, whether it's sent
+// in a W3C traceparent header or an X-Ray one, with the propagators registered as in main.
+func TestIncomingTraceContext(t *testing.T) {
+	const (
+		traceparent = "00-5759e988bd862e3fe1be46a994272793-53995c3f42cd8ad8-01"
+		xrayHeader  = "Root=1-6759e988-bd862e3fe1be46a994272794;Parent=63995c3f42cd8ad9;Sampled=1"
+	)
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantTrace  string
+		wantParent string
+	}{
+		{name: "none"},
+		{
+			name:       "traceparent",
+			headers:    map[string]string{"traceparent": traceparent},
+			wantTrace:  "5759e988bd862e3fe1be46a994272793",
+			wantParent: "53995c3f42cd8ad8",
+		},
+		{
+			name:       "x-ray",
+			headers:    map[string]string{"X-Amzn-Trace-Id": xrayHeader},
+			wantTrace:  "6759e988bd862e3fe1be46a994272794",
+			wantParent: "63995c3f42cd8ad9",
+		},
+		{
+			// A load balancer adds an X-Ray header to every request, which mustn't replace the
+			// caller's trace.
+			name:       "traceparent behind a load balancer",
+			headers:    map[string]string{"traceparent": traceparent, "X-Amzn-Trace-Id": xrayHeader},
+			wantTrace:  "5759e988bd862e3fe1be46a994272793",
+			wantParent: "53995c3f42cd8ad8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousTracerProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousTracerProvider)
+				otel.SetTextMapPropagator(previousPropagator)
+			})
+
+			settings, err := telemetry.LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings.TraceEndpoints = nil
+
+			providers, shutdown := initialiseOpenTelemetry("eu-west-1", settings)
+			t.Cleanup(shutdown)
+
+			recorder := tracetest.NewSpanRecorder()
+			providers.TracerProvider.RegisterSpanProcessor(recorder)
+
+			r := mux.NewRouter()
+			r.Use(otelmux.Middleware(serviceName))
+			r.HandleFunc("/checkout", func(http.ResponseWriter, *http.Request) {})
+
+			req := httptest.NewRequest(http.MethodGet, "/checkout", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			span := recorder.Ended()[0]
+
+			if tt.wantParent == "" {
+				if span.Parent().IsValid() {
+					t.Errorf("got parent %s, want a new trace", span.Parent().SpanID())
+				}
+
+				return
+			}
+
+			if got := span.SpanContext().TraceID().String(); got != tt.wantTrace {
+				t.Errorf("got trace %s, want %s", got, tt.wantTrace)
+			}
+
+			if got := span.Parent().SpanID().String(); got != tt.wantParent || !span.Parent().IsRemote() {
+				t.Errorf("got parent %s, want the caller's span %s", got, tt.wantParent)
+			}
+		})
+	}
+}
+
+// TestTargetSampling checks a checkout targeted by the admin endpoint is sampled from its basket
+// ID, with the router set up as in main. The checkouts are synthetic, and no synthetic traffic is
+// sampled, so only the target can sample them.
+func TestTargetSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		basketID    string
+		target      string
+		wantSampled bool
+	}{
+		{name: "targeted basket", basketID: "123", target: "123", wantSampled: true},
+		{name: "other basket", basketID: "456", target: "123"},
+		{name: "no target", basketID: "123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SYNTHETIC_SAMPLE_RATIO", "0")
+
+			previousTracerProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousTracerProvider)
+				otel.SetTextMapPropagator(previousPropagator)
+			})
+
+			settings, err := telemetry.LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings.TraceEndpoints = nil
+
+			providers, shutdown := initialiseOpenTelemetry("eu-west-1", settings)
+			t.Cleanup(shutdown)
+
+			recorder := tracetest.NewSpanRecorder()
+			providers.TracerProvider.RegisterSpanProcessor(recorder)
+
+			if tt.target != "" {
+				providers.Sampler.SetTarget("basket.id", tt.target)
+			}
+
+			payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer payments.Close()
+
+			client := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+			r := mux.NewRouter()
+			r.Use(middleware.Synthetic())
+			r.Use(middleware.QueryBaggage("basketId", "basket.id"))
+			r.Use(otelmux.Middleware(serviceName))
+			r.Handle("/checkout", checkoutHandler(nil, client, []string{payments.URL}))
+
+			req := httptest.NewRequest(http.MethodGet, "/checkout?basketId="+tt.basketID+"&amount=12.50", nil)
+			req.Header.Set(telemetry.SyntheticHeader, "true")
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("checkout responded %d", w.Code)
+			}
+
+			var server sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				if span.SpanKind() == trace.SpanKindServer {
+					server = span
+				}
+			}
+
+			if sampled := server != nil; sampled != tt.wantSampled {
+				t.Fatalf("got server span sampled %t, want %t", sampled, tt.wantSampled)
+			}
+
+			if server == nil {
+				return
+			}
+
+			attrs := attribute.NewSet(server.Attributes()...)
+			decision, _ := attrs.Value(appattr.Key("sampling.decision"))
+			if decision.AsString() != "forced" {
+				t.Errorf("got sampling.decision %q, want forced", decision.AsString())
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultXRayConsoleURL is the X-Ray console's base URL when XRAY_CONSOLE_URL isn't set.
+const defaultXRayConsoleURL = "https://console.aws.amazon.com/xray/home"
+
+// xrayConsole builds links to traces in the X-Ray console.
+type xrayConsole struct {
+	baseURL string
+	region  string
+}
+
+// xrayTraceID formats an OTel trace ID the way X-Ray displays it, e.g.
+// 1-5759e988-bd862e3fe1be46a994272793. The first 8 hex digits are the trace's start time.
+func xrayTraceID(traceID trace.TraceID) (string, error) {
+	if !traceID.IsValid() {
+		return "", errors.New("invalid trace id")
+	}
+
+	id := traceID.String()
+
+	return "1-" + id[0:8] + "-" + id[8:], nil
+}
+
+// traceURL returns a link that opens the trace in the X-Ray console.
+func (c xrayConsole) traceURL(traceID trace.TraceID) (string, error) {
+	id, err := xrayTraceID(traceID)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s?region=%s#/traces/%s", c.baseURL, url.QueryEscape(c.region), id), nil
+}
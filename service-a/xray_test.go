@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestXRayConsoleTraceURL(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("5759e988bd862e3fe1be46a994272793")
+
+	tests := []struct {
+		name    string
+		console xrayConsole
+		traceID trace.TraceID
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "default console",
+			console: xrayConsole{baseURL: defaultXRayConsoleURL, region: "eu-west-1"},
+			traceID: traceID,
+			want:    "https://console.aws.amazon.com/xray/home?region=eu-west-1#/traces/1-5759e988-bd862e3fe1be46a994272793",
+		},
+		{
+			name:    "custom console",
+			console: xrayConsole{baseURL: "https://console.amazonaws-us-gov.com/xray/home", region: "us-gov-west-1"},
+			traceID: traceID,
+			want:    "https://console.amazonaws-us-gov.com/xray/home?region=us-gov-west-1#/traces/1-5759e988-bd862e3fe1be46a994272793",
+		},
+		{
+			name:    "invalid trace ID",
+			console: xrayConsole{baseURL: defaultXRayConsoleURL, region: "eu-west-1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.console.traceURL(tt.traceID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+
+	"shared/telemetry"
+)
+
+// defaultAdminAddr is where the operator endpoints listen when ADMIN_ADDR isn't set. Only
+// localhost can reach them, as they describe how the service is configured.
+const defaultAdminAddr = "localhost:9001"
+
+// newAdminServer returns the server for the operator endpoints. It's separate from the payment
+// listener, so the endpoints aren't exposed along with the service.
+func newAdminServer(addr string, providers *telemetry.Providers) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/otel", telemetry.DescribeHandler(providers))
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shared/telemetry"
+)
+
+func TestAdminServer(t *testing.T) {
+	settings, err := telemetry.LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providers, shutdown, err := telemetry.Init(telemetry.Config{
+		ServiceName:               serviceName,
+		Settings:                  &settings,
+		DisableGlobalRegistration: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+
+	handler := newAdminServer("localhost:0", providers).Handler
+
+	tests := []struct {
+		method   string
+		wantCode int
+	}{
+		{method: http.MethodGet, wantCode: http.StatusOK},
+		{method: http.MethodPost, wantCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/admin/otel", nil))
+
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s /admin/otel: got status %d, want %d", tt.method, rec.Code, tt.wantCode)
+		}
+	}
+}
@@ -2,27 +2,40 @@ package main
 
 import (
 	"context"
-	"log"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel/attribute"
+	"shared/awsconfig"
+	"shared/messaging"
 )
 
-func getAWSConfig() aws.Config {
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-	}
+func getAWSConfig(settings awsconfig.Settings) (aws.Config, error) {
+	// Supplying our own attribute builder replaces the default, so it is passed explicitly to
+	// keep the service specific attributes.
+	return awsconfig.Load(
+		awsconfig.WithSettings(settings),
+		awsconfig.WithInstrumentation(otelaws.WithAttributeBuilder(otelaws.DefaultAttributeBuilder, payloadSizeAttributeBuilder)),
+	)
+}
 
-	// Instrument all AWS clients with OpenTelemetry
-	otelaws.AppendMiddlewares(&cfg.APIOptions)
+// payloadSizeAttributeBuilder records the size of the outgoing message body on the SQS send span.
+func payloadSizeAttributeBuilder(_ context.Context, in middleware.InitializeInput, _ middleware.InitializeOutput) []attribute.KeyValue {
+	input, ok := in.Parameters.(*sqs.SendMessageInput)
+	if !ok {
+		return nil
+	}
 
-	return cfg
+	return []attribute.KeyValue{messaging.PayloadSize(input.MessageBody)}
 }
 
+// newSQSClient returns the SQS client for the messageSender. The sender retries failed sends
+// itself, with its own limit and backoff, so the SDK makes a single attempt at each call;
+// otherwise every one of the sender's attempts would be retried again by the SDK.
 func newSQSClient(cfg aws.Config) *sqs.Client {
-	client := sqs.NewFromConfig(cfg)
-	return client
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		o.RetryMaxAttempts = 1
+	})
 }
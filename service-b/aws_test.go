@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/appattr"
+	"shared/awsconfig"
+	"shared/messaging"
+)
+
+func TestSendAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+	}{
+		{name: "single attempt", maxAttempts: 1},
+		{name: "retried by the sender", maxAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(`{"__type":"ServiceUnavailable","message":"unavailable"}`))
+			}))
+			t.Cleanup(server.Close)
+
+			sender := &messageSender{
+				client: newSQSClient(aws.Config{
+					Region:       "eu-west-1",
+					BaseEndpoint: aws.String(server.URL),
+					Credentials:  aws.AnonymousCredentials{},
+				}),
+				queueURL:    "https://sqs.eu-west-1.amazonaws.com/123456789012/payments",
+				maxAttempts: tt.maxAttempts,
+				slots:       make(chan struct{}, 1),
+			}
+
+			err := sender.send(context.Background(), sqs.SendMessageInput{MessageBody: aws.String("{}")})
+			if err == nil {
+				t.Fatal("send() = nil, want an error")
+			}
+
+			// Only the sender retries, so each of its attempts is a single request.
+			if got := requests.Load(); got != int32(tt.maxAttempts) {
+				t.Errorf("requests = %d, want %d", got, tt.maxAttempts)
+			}
+		})
+	}
+}
+
+func TestPayloadSizeAttributeBuilder(t *testing.T) {
+	tests := []struct {
+		name   string
+		params any
+		want   []attribute.KeyValue
+	}{
+		{
+			name:   "body",
+			params: &sqs.SendMessageInput{MessageBody: aws.String(`{"transactionId":"abc"}`)},
+			want:   []attribute.KeyValue{messaging.PayloadSizeKey.Int(23)},
+		},
+		{
+			name:   "nil body",
+			params: &sqs.SendMessageInput{},
+			want:   []attribute.KeyValue{messaging.PayloadSizeKey.Int(0)},
+		},
+		{name: "other operation", params: &sqs.ReceiveMessageInput{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := payloadSizeAttributeBuilder(context.Background(), middleware.InitializeInput{Parameters: tt.params}, middleware.InitializeOutput{})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSendPayloadSizeAttribute checks the builder is wired into the instrumentation, so the
+// attribute ends up on the send span.
+func TestSendPayloadSizeAttribute(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := getAWSConfig(awsconfig.Settings{
+		Region:          "eu-west-1",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		EndpointURL:     server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newSQSClient(cfg).SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/payments"),
+		MessageBody: aws.String(`{"transactionId":"abc"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+
+	for _, kv := range spans[0].Attributes() {
+		if kv.Key == messaging.PayloadSizeKey {
+			if kv.Value.AsInt64() != 23 {
+				t.Errorf("got %s %d, want 23", kv.Key, kv.Value.AsInt64())
+			}
+
+			return
+		}
+	}
+
+	t.Errorf("got no %s attribute on the %q span", messaging.PayloadSizeKey, spans[0].Name())
+}
+
+func TestSendConcurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		sends int
+	}{
+		{name: "one at a time", limit: 1, sends: 5},
+		{name: "bounded", limit: 4, sends: 20},
+		{name: "within the limit", limit: 8, sends: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+
+				for {
+					highest := maxInFlight.Load()
+					if n <= highest || maxInFlight.CompareAndSwap(highest, n) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				_, _ = w.Write([]byte("{}"))
+			}))
+			sender.slots = make(chan struct{}, tt.limit)
+
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			var wg sync.WaitGroup
+			for range tt.sends {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					ctx, span := tracer.Start(context.Background(), "Send Record")
+					defer span.End()
+
+					if err := sender.send(ctx, sqs.SendMessageInput{MessageBody: aws.String("{}")}); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := int(maxInFlight.Load()); got > tt.limit {
+				t.Errorf("got %d sends in flight at once, want at most %d", got, tt.limit)
+			}
+
+			var throttled int
+			for _, span := range recorder.Ended() {
+				set := attribute.NewSet(span.Attributes()...)
+				if v, _ := set.Value(appattr.Key("sqs.send.throttled_locally")); v.AsBool() {
+					throttled++
+				}
+			}
+
+			// Only the sends beyond the limit ever wait for a slot.
+			if tt.sends <= tt.limit && throttled != 0 {
+				t.Errorf("got %d sends throttled locally, want none", throttled)
+			}
+
+			if tt.sends > tt.limit && throttled == 0 {
+				t.Error("got no sends throttled locally, want those beyond the limit to wait")
+			}
+		})
+	}
+}
+
+// TestSendWaitDeadline checks a send waiting for a slot gives up once its request's deadline
+// passes, without calling SQS.
+func TestSendWaitDeadline(t *testing.T) {
+	var requests atomic.Int32
+	sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	// The only slot is taken by a send that never finishes.
+	sender.slots <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := sender.send(ctx, sqs.SendMessageInput{MessageBody: aws.String("{}")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the deadline exceeded", err)
+	}
+
+	if got := requests.Load(); got != 0 {
+		t.Errorf("got %d requests, want none", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"shared/awsconfig"
+	"shared/delay"
+	"shared/middleware"
+	"shared/telemetry"
+)
+
+// Config is the configuration of service-b, resolved from the environment by LoadConfig.
+type Config struct {
+	// AWS and Telemetry configure the AWS SDK and the OpenTelemetry SDK.
+	AWS       awsconfig.Settings `json:"aws"`
+	Telemetry telemetry.Settings `json:"telemetry"`
+
+	// QueueURL is the SQS queue the payment records are sent to (SQS_QUEUE_URL), and
+	// FallbackQueueURL the one they go to when they can't be (SQS_FALLBACK_QUEUE_URL).
+	QueueURL         string `json:"queueUrl"`
+	FallbackQueueURL string `json:"fallbackQueueUrl"`
+
+	// SendMaxAttempts bounds the attempts at sending each record (SQS_SEND_MAX_ATTEMPTS), and
+	// SendMaxConcurrency how many are sent at once (SQS_SEND_MAX_CONCURRENCY).
+	SendMaxAttempts    int `json:"sendMaxAttempts"`
+	SendMaxConcurrency int `json:"sendMaxConcurrency"`
+
+	// MaxRequestBodyBytes bounds the size of request bodies (MAX_REQUEST_BODY_BYTES).
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes"`
+
+	// HTTP4xxIsError counts 4xx responses, as well as 5xx, as errors (HTTP_4XX_IS_ERROR).
+	HTTP4xxIsError bool `json:"http4xxIsError"`
+
+	// ErrorInjectionRate is the fraction of requests failed on purpose (ERROR_INJECTION_RATE).
+	ErrorInjectionRate float64 `json:"errorInjectionRate"`
+
+	// PaymentDelay is injected into each payment (PAYMENT_DELAY).
+	PaymentDelay delay.Delay `json:"paymentDelay"`
+
+	// CurrencyRates simulates converting each payment into the SettlementCurrency, at these
+	// rates (CURRENCY_RATES, e.g. "USD=0.79,EUR=0.85", and SETTLEMENT_CURRENCY). No conversion is
+	// made without them.
+	CurrencyRates      map[string]float64 `json:"currencyRates"`
+	SettlementCurrency string             `json:"settlementCurrency"`
+
+	// AdminAddr is where the operator endpoints, such as /admin/otel, are served (ADMIN_ADDR).
+	// They're kept off the payment listener, and only listen on localhost unless set.
+	AdminAddr string `json:"adminAddr"`
+}
+
+// LoadConfig resolves the service's configuration from the environment, applying the defaults
+// for anything that isn't set. It returns an error naming the first invalid setting.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		QueueURL:            os.Getenv("SQS_QUEUE_URL"),
+		FallbackQueueURL:    os.Getenv("SQS_FALLBACK_QUEUE_URL"),
+		SendMaxAttempts:     defaultSendMaxAttempts,
+		SendMaxConcurrency:  defaultSendConcurrency,
+		MaxRequestBodyBytes: middleware.DefaultMaxBodySize,
+		HTTP4xxIsError:      os.Getenv("HTTP_4XX_IS_ERROR") == "true",
+		SettlementCurrency:  defaultSettlementCurrency,
+		AdminAddr:           defaultAdminAddr,
+	}
+
+	if v := os.Getenv("CURRENCY_RATES"); v != "" {
+		rates, err := parseCurrencyRates(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CURRENCY_RATES: %w", err)
+		}
+
+		cfg.CurrencyRates = rates
+	}
+
+	if v := os.Getenv("SETTLEMENT_CURRENCY"); v != "" {
+		cfg.SettlementCurrency = strings.ToUpper(v)
+	}
+
+	if v, ok := os.LookupEnv("SQS_SEND_MAX_ATTEMPTS"); ok {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return Config{}, fmt.Errorf("invalid SQS_SEND_MAX_ATTEMPTS: %q", v)
+		}
+
+		cfg.SendMaxAttempts = attempts
+	}
+
+	if v, ok := os.LookupEnv("SQS_SEND_MAX_CONCURRENCY"); ok {
+		concurrency, err := strconv.Atoi(v)
+		if err != nil || concurrency < 1 {
+			return Config{}, fmt.Errorf("invalid SQS_SEND_MAX_CONCURRENCY: %q", v)
+		}
+
+		cfg.SendMaxConcurrency = concurrency
+	}
+
+	if v, ok := os.LookupEnv("MAX_REQUEST_BODY_BYTES"); ok {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return Config{}, fmt.Errorf("invalid MAX_REQUEST_BODY_BYTES: %q", v)
+		}
+
+		cfg.MaxRequestBodyBytes = limit
+	}
+
+	if v, ok := os.LookupEnv("ERROR_INJECTION_RATE"); ok {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return Config{}, fmt.Errorf("invalid ERROR_INJECTION_RATE: %q", v)
+		}
+
+		cfg.ErrorInjectionRate = rate
+	}
+
+	if v, ok := os.LookupEnv("ADMIN_ADDR"); ok {
+		cfg.AdminAddr = v
+	}
+
+	var err error
+	if cfg.AWS, err = awsconfig.LoadSettings(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Telemetry, err = telemetry.LoadSettings(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.PaymentDelay, err = delay.Parse(os.Getenv("PAYMENT_DELAY")); err != nil {
+		return Config{}, fmt.Errorf("invalid PAYMENT_DELAY: %w", err)
+	}
+
+	return cfg, nil
+}
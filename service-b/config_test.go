@@ -0,0 +1,135 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"testing"
+
+	"shared/middleware"
+)
+
+// configEnv are the environment variables LoadConfig reads for service-b itself.
+var configEnv = []string{
+	"SQS_QUEUE_URL",
+	"SQS_FALLBACK_QUEUE_URL",
+	"SQS_SEND_MAX_ATTEMPTS",
+	"SQS_SEND_MAX_CONCURRENCY",
+	"MAX_REQUEST_BODY_BYTES",
+	"HTTP_4XX_IS_ERROR",
+	"ERROR_INJECTION_RATE",
+	"PAYMENT_DELAY",
+	"CURRENCY_RATES",
+	"SETTLEMENT_CURRENCY",
+	"ADMIN_ADDR",
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(t *testing.T, cfg Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.SendMaxAttempts != defaultSendMaxAttempts || cfg.SendMaxConcurrency != defaultSendConcurrency {
+					t.Errorf("got %d attempts and %d at once, want %d and %d", cfg.SendMaxAttempts, cfg.SendMaxConcurrency, defaultSendMaxAttempts, defaultSendConcurrency)
+				}
+
+				if cfg.MaxRequestBodyBytes != middleware.DefaultMaxBodySize {
+					t.Errorf("got max body %d, want %d", cfg.MaxRequestBodyBytes, middleware.DefaultMaxBodySize)
+				}
+
+				if cfg.SettlementCurrency != defaultSettlementCurrency || cfg.CurrencyRates != nil {
+					t.Errorf("got settlement in %s at %v, want %s without rates", cfg.SettlementCurrency, cfg.CurrencyRates, defaultSettlementCurrency)
+				}
+
+				if cfg.AdminAddr != defaultAdminAddr {
+					t.Errorf("got admin address %q, want %q", cfg.AdminAddr, defaultAdminAddr)
+				}
+
+				if cfg.HTTP4xxIsError || cfg.ErrorInjectionRate != 0 || cfg.PaymentDelay.Enabled() {
+					t.Errorf("got 4xx errors %t, injection rate %v and delay %v, want none", cfg.HTTP4xxIsError, cfg.ErrorInjectionRate, cfg.PaymentDelay)
+				}
+			},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"SQS_QUEUE_URL":            "https://sqs.eu-west-1.amazonaws.com/123456789012/payments",
+				"SQS_FALLBACK_QUEUE_URL":   "https://sqs.eu-west-1.amazonaws.com/123456789012/payments-fallback",
+				"SQS_SEND_MAX_ATTEMPTS":    "5",
+				"SQS_SEND_MAX_CONCURRENCY": "2",
+				"MAX_REQUEST_BODY_BYTES":   "1024",
+				"HTTP_4XX_IS_ERROR":        "true",
+				"ERROR_INJECTION_RATE":     "0.25",
+				"CURRENCY_RATES":           "USD=0.79,EUR=0.85",
+				"SETTLEMENT_CURRENCY":      "eur",
+				"ADMIN_ADDR":               ":9101",
+			},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.QueueURL != "https://sqs.eu-west-1.amazonaws.com/123456789012/payments" || cfg.FallbackQueueURL != "https://sqs.eu-west-1.amazonaws.com/123456789012/payments-fallback" {
+					t.Errorf("got queues %q and %q", cfg.QueueURL, cfg.FallbackQueueURL)
+				}
+
+				if cfg.SendMaxAttempts != 5 || cfg.SendMaxConcurrency != 2 {
+					t.Errorf("got %d attempts and %d at once, want 5 and 2", cfg.SendMaxAttempts, cfg.SendMaxConcurrency)
+				}
+
+				if cfg.MaxRequestBodyBytes != 1024 {
+					t.Errorf("got max body %d, want 1024", cfg.MaxRequestBodyBytes)
+				}
+
+				if !cfg.HTTP4xxIsError || cfg.ErrorInjectionRate != 0.25 {
+					t.Errorf("got 4xx errors %t and injection rate %v, want true and 0.25", cfg.HTTP4xxIsError, cfg.ErrorInjectionRate)
+				}
+
+				if want := map[string]float64{"USD": 0.79, "EUR": 0.85}; cfg.SettlementCurrency != "EUR" || !maps.Equal(cfg.CurrencyRates, want) {
+					t.Errorf("got settlement in %s at %v, want EUR at %v", cfg.SettlementCurrency, cfg.CurrencyRates, want)
+				}
+
+				if cfg.AdminAddr != ":9101" {
+					t.Errorf("got admin address %q, want :9101", cfg.AdminAddr)
+				}
+			},
+		},
+		{name: "no attempts", env: map[string]string{"SQS_SEND_MAX_ATTEMPTS": "0"}, wantErr: true},
+		{name: "attempts not a number", env: map[string]string{"SQS_SEND_MAX_ATTEMPTS": "few"}, wantErr: true},
+		{name: "no concurrency", env: map[string]string{"SQS_SEND_MAX_CONCURRENCY": "0"}, wantErr: true},
+		{name: "negative body limit", env: map[string]string{"MAX_REQUEST_BODY_BYTES": "-1"}, wantErr: true},
+		{name: "injection rate above 1", env: map[string]string{"ERROR_INJECTION_RATE": "1.5"}, wantErr: true},
+		{name: "malformed currency rates", env: map[string]string{"CURRENCY_RATES": "USD"}, wantErr: true},
+		{name: "malformed payment delay", env: map[string]string{"PAYMENT_DELAY": "soon"}, wantErr: true},
+		{name: "invalid telemetry", env: map[string]string{"SPAN_PROCESSOR": "eventually"}, wantErr: true},
+		{name: "invalid aws", env: map[string]string{"AWS_USE_FIPS_ENDPOINT": "maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range configEnv {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+
+			for key, v := range tt.env {
+				t.Setenv(key, v)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid setting")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, cfg)
+		})
+	}
+}
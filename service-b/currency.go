@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// defaultSettlementCurrency is the currency payments are converted into when it isn't configured.
+const defaultSettlementCurrency = "GBP"
+
+// errUnknownCurrency is returned for a payment in a currency with no conversion rate.
+var errUnknownCurrency = errors.New("unknown currency")
+
+// currencyConverter simulates converting each payment into the settlement currency, using a
+// fixed table of rates, to add a sub-operation to the payment's trace.
+type currencyConverter struct {
+	settlement string
+
+	// rates are how many units of the settlement currency one unit of each currency is worth.
+	rates map[string]float64
+
+	conversions metric.Int64Counter
+}
+
+func newCurrencyConverter(settlement string, rates map[string]float64, meter metric.Meter) (*currencyConverter, error) {
+	conversions, err := meter.Int64Counter(
+		"payment.currency.conversions",
+		metric.WithDescription("The number of payments converted into the settlement currency."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &currencyConverter{settlement: settlement, rates: rates, conversions: conversions}, nil
+}
+
+// convert converts the amount into the settlement currency within a Currency Conversion span.
+// It returns errUnknownCurrency, and marks the span as errored, if there's no rate for currency.
+// The currency code is case insensitive, and a payment without one is already in the settlement
+// currency.
+func (c *currencyConverter) convert(ctx context.Context, amount float64, currency string) (float64, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = c.settlement
+	}
+
+	ctx, span := tracer("payment").Start(ctx, "Currency Conversion", trace.WithAttributes(
+		appattr.Key("currency.conversion.from").String(currency),
+		appattr.Key("currency.conversion.to").String(c.settlement),
+	))
+	defer span.End()
+
+	rate := 1.0
+	if currency != c.settlement {
+		var ok bool
+		if rate, ok = c.rates[currency]; !ok {
+			err := fmt.Errorf("%w %q", errUnknownCurrency, currency)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "unknown currency")
+			return 0, err
+		}
+	}
+
+	converted := amount * rate
+
+	span.SetAttributes(
+		appattr.Key("currency.conversion.rate").Float64(rate),
+		appattr.Key("currency.conversion.amount").Float64(converted),
+	)
+
+	c.conversions.Add(ctx, 1, metric.WithAttributes(
+		appattr.Key("currency.conversion.from").String(currency),
+		appattr.Key("currency.conversion.to").String(c.settlement),
+	))
+
+	return converted, nil
+}
+
+// parseCurrencyRates parses a rate table such as "USD=0.79,EUR=0.85", where each rate is how many
+// units of the settlement currency one unit of the currency is worth.
+func parseCurrencyRates(v string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+
+	for _, entry := range strings.Split(v, ",") {
+		currency, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || currency == "" {
+			return nil, fmt.Errorf("invalid rate %q", entry)
+		}
+
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(rate > 0) {
+			return nil, fmt.Errorf("invalid rate %q", entry)
+		}
+
+		rates[strings.ToUpper(currency)] = rate
+	}
+
+	return rates, nil
+}
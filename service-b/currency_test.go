@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"shared/appattr"
+)
+
+func TestCurrencyConversion(t *testing.T) {
+	withoutPaymentLatency(t)
+
+	tests := []struct {
+		name            string
+		currency        string
+		wantFrom        string
+		wantCode        int
+		wantRate        float64
+		wantAmount      float64
+		wantErr         bool
+		wantConversions int64
+	}{
+		{name: "known currency", currency: "USD", wantFrom: "USD", wantCode: http.StatusOK, wantRate: 0.5, wantAmount: 5, wantConversions: 1},
+		{name: "lowercase currency", currency: "usd", wantFrom: "USD", wantCode: http.StatusOK, wantRate: 0.5, wantAmount: 5, wantConversions: 1},
+		{name: "settlement currency", currency: "GBP", wantFrom: "GBP", wantCode: http.StatusOK, wantRate: 1, wantAmount: 10, wantConversions: 1},
+		{name: "lowercase settlement currency", currency: "gbp", wantFrom: "GBP", wantCode: http.StatusOK, wantRate: 1, wantAmount: 10, wantConversions: 1},
+		{name: "padded currency", currency: "%20usd%20", wantFrom: "USD", wantCode: http.StatusOK, wantRate: 0.5, wantAmount: 5, wantConversions: 1},
+		{name: "no currency", wantFrom: "GBP", wantCode: http.StatusOK, wantRate: 1, wantAmount: 10, wantConversions: 1},
+		{name: "unknown currency", currency: "JPY", wantFrom: "JPY", wantCode: http.StatusUnprocessableEntity, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+
+			var sends atomic.Int32
+			sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sends.Add(1)
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				_, _ = w.Write([]byte("{}"))
+			}))
+
+			reader := sdkmetric.NewManualReader()
+			converter, err := newCurrencyConverter("GBP", map[string]float64{"USD": 0.5}, sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			amountTaken, _ := noop.NewMeterProvider().Meter("test").Float64Counter("payment.amount")
+
+			rec := httptest.NewRecorder()
+			paymentHandler(sender, converter, amountTaken).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payment?transactionId=abc&amount=10&currency="+tt.currency, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			// A payment that can't be converted isn't taken, so no record of it is sent.
+			if sent := sends.Load() > 0; sent == tt.wantErr {
+				t.Errorf("got sent %t, want %t", sent, !tt.wantErr)
+			}
+
+			spans := map[string]sdktrace.ReadOnlySpan{}
+			for _, span := range recorder.Ended() {
+				spans[span.Name()] = span
+			}
+
+			conversion, payment := spans["Currency Conversion"], spans["Process Payment"]
+			if conversion == nil || payment == nil {
+				t.Fatalf("got spans %v, want Currency Conversion and Process Payment", recorder.Ended())
+			}
+
+			if conversion.Parent().SpanID() != payment.SpanContext().SpanID() {
+				t.Error("got a Currency Conversion span outside the Process Payment span")
+			}
+
+			attrs := attribute.NewSet(conversion.Attributes()...)
+			if from, _ := attrs.Value(appattr.Key("currency.conversion.from")); from.AsString() != tt.wantFrom {
+				t.Errorf("got currency.conversion.from %q, want %q", from.AsString(), tt.wantFrom)
+			}
+
+			if to, _ := attrs.Value(appattr.Key("currency.conversion.to")); to.AsString() != "GBP" {
+				t.Errorf("got currency.conversion.to %q, want GBP", to.AsString())
+			}
+
+			if got := conversion.Status().Code == codes.Error; got != tt.wantErr {
+				t.Errorf("got errored %t, want %t", got, tt.wantErr)
+			}
+
+			rate, ok := attrs.Value(appattr.Key("currency.conversion.rate"))
+			if ok == tt.wantErr || rate.AsFloat64() != tt.wantRate {
+				t.Errorf("got currency.conversion.rate %v, want %v", rate.Emit(), tt.wantRate)
+			}
+
+			if amount, _ := attrs.Value(appattr.Key("currency.conversion.amount")); amount.AsFloat64() != tt.wantAmount {
+				t.Errorf("got currency.conversion.amount %v, want %v", amount.Emit(), tt.wantAmount)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+
+			var conversions int64
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "payment.currency.conversions" {
+						for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+							conversions += dp.Value
+						}
+					}
+				}
+			}
+
+			if conversions != tt.wantConversions {
+				t.Errorf("got %d conversions counted, want %d", conversions, tt.wantConversions)
+			}
+		})
+	}
+}
@@ -2,73 +2,278 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/config"
+	"shared/logging"
+	"shared/middleware"
+	"shared/telemetry"
 )
 
 const (
 	serviceName    = "service-b"
 	serviceVersion = "2.0.4"
+
+	// baggageMessageAttribute is the SQS message attribute used to carry W3C baggage.
+	baggageMessageAttribute = "baggage"
+
+	// shutdownTimeout bounds how long in-flight requests have to complete once a shutdown
+	// signal is received. Payments can take up to 5s to process, so allow comfortably longer.
+	shutdownTimeout = 10 * time.Second
+
+	// defaultPaymentAmount is charged when a payment request doesn't specify an amount.
+	defaultPaymentAmount = 10.00
 )
 
 func main() {
 
-	shutdown := initialiseOpenTelemetry()
+	slog.SetDefault(logging.New())
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	// With --print-config, or PRINT_CONFIG=true, the configuration is printed without starting.
+	if config.PrintRequested() {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	// Optionally trace the startup, with TRACE_STARTUP=true, to measure the cold start.
+	startup := telemetry.NewStartupTrace()
+
+	// The AWS config is loaded first so the resolved region can be recorded on the telemetry.
+	endPhase := startup.Phase("Load AWS Config")
+	awsCfg, err := getAWSConfig(cfg.AWS)
+	if err != nil {
+		log.Fatalf("error loading aws config: %v", err)
+	}
+	endPhase()
+
+	endPhase = startup.Phase("Init Telemetry")
+	providers, shutdown := initialiseOpenTelemetry(awsCfg.Region, cfg.Telemetry)
 	defer shutdown()
+	endPhase()
 
-	// Create AWS components
-	cfg := getAWSConfig()
-	sqsClient := newSQSClient(cfg)
+	endPhase = startup.Phase("Create Clients")
+	sqsClient := newSQSClient(awsCfg)
+	endPhase()
 
-	sqsQueueURL := os.Getenv("SQS_QUEUE_URL")
+	startup.Export(context.Background(), providers)
+
+	// Failed sends are retried up to SQS_SEND_MAX_ATTEMPTS times in total. Records that still
+	// can't be sent go to SQS_FALLBACK_QUEUE_URL, if set. At most SQS_SEND_MAX_CONCURRENCY
+	// records are sent at once. Any more wait for a free slot, for as long as their request allows.
+	sender := &messageSender{
+		client:           sqsClient,
+		queueURL:         cfg.QueueURL,
+		maxAttempts:      cfg.SendMaxAttempts,
+		fallbackQueueURL: cfg.FallbackQueueURL,
+		slots:            make(chan struct{}, cfg.SendMaxConcurrency),
+	}
 
 	rand.Seed(time.Now().UnixNano())
 
 	r := mux.NewRouter()
+
+	// Mark requests with X-Synthetic: true as synthetic traffic in the baggage. It must come before
+	// otelmux, which extracts the baggage.
+	r.Use(middleware.Synthetic())
 	r.Use(otelmux.Middleware(serviceName))
+	r.Use(middleware.RouteSpanName())
+
+	// Identify each request, honouring an X-Request-Id set by the client.
+	r.Use(middleware.RequestID())
+
+	// Record the service that made the request, and name this one as the caller downstream.
+	r.Use(middleware.Caller(serviceName))
+
+	// Only 5xx responses mark spans as errored, unless HTTP_4XX_IS_ERROR=true counts 4xx too.
+	r.Use(middleware.SpanStatus(telemetry.StatusPolicy{ClientErrors: cfg.HTTP4xxIsError}))
+
+	// Recover from panics, logging them with the trace they happened in.
+	r.Use(middleware.Recover())
+	r.Use(middleware.ColdStart(providers.ColdStart))
+	r.Use(middleware.BodySize())
 
-	r.HandleFunc("/payment", paymentHandler(sqsClient, sqsQueueURL))
-	http.Handle("/", r)
+	// Bound the size of request bodies, configurable in bytes via MAX_REQUEST_BODY_BYTES.
+	r.Use(middleware.MaxBodySize(cfg.MaxRequestBodyBytes))
 
-	fmt.Println("starting server on port 8001")
+	// Respect the deadline of the checkout that made the payment request, if it was propagated.
+	r.Use(middleware.Deadline())
 
-	if err := http.ListenAndServe(":8001", nil); err != nil {
+	// Optionally fail a fraction of requests, to demo errored traces.
+	if cfg.ErrorInjectionRate > 0 {
+		r.Use(middleware.ErrorInjection(cfg.ErrorInjectionRate, time.Now().UnixNano()))
+	}
+
+	// The instruments are created from this service's own MeterProvider rather than the global
+	// one, so they're exported even if the global registration is disabled.
+	meter := providers.MeterProvider.Meter(serviceName)
+
+	// Sum the value of the payments taken, giving the demo a business metric to chart.
+	amountTaken, err := meter.Float64Counter(
+		"payment.amount",
+		metric.WithDescription("The total amount of the payments taken."),
+	)
+	if err != nil {
+		log.Fatalf("error creating payment amount counter: %v", err)
+	}
+
+	// Optionally convert each payment into the settlement currency, with CURRENCY_RATES, to add a
+	// sub-operation to the payment's trace.
+	var converter *currencyConverter
+	if len(cfg.CurrencyRates) > 0 {
+		converter, err = newCurrencyConverter(cfg.SettlementCurrency, cfg.CurrencyRates, meter)
+		if err != nil {
+			log.Fatalf("error creating currency converter: %v", err)
+		}
+	}
+
+	// Optionally delay each payment, e.g. PAYMENT_DELAY=100ms-500ms, to demo latency in the
+	// trace waterfall.
+	r.Handle("/payment", middleware.Delay(cfg.PaymentDelay)(paymentHandler(sender, converter, amountTaken)))
+
+	srv := &http.Server{Addr: ":8001", Handler: r}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	adminServer := newAdminServer(cfg.AdminAddr, providers)
+	go func() {
+		slog.Info("starting admin server", "addr", cfg.AdminAddr)
+
+		if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	slog.Info("starting server on port 8001")
+
+	// Once the server has drained, the deferred telemetry shutdown flushes the remaining spans.
+	if err := serve(ctx, srv, ln, shutdownTimeout); err != nil {
+		slog.Error("error serving", "error", err)
+	}
+
+	_ = adminServer.Close()
 }
 
-func paymentHandler(sqsClient *sqs.Client, queueURL string) http.HandlerFunc {
+// serve serves the requests accepted on ln until ctx is done. It then stops accepting new
+// connections and waits for the in-flight payments to complete, for up to timeout.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, timeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+
+	return nil
+}
+
+func paymentHandler(sender *messageSender, converter *currencyConverter, amountTaken metric.Float64Counter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// Extract the basket ID value from the query string.
 		query := r.URL.Query()
 		transactionID := query.Get("transactionId")
+		currency := query.Get("currency")
+
+		// A request without an amount, e.g. from a service-a that predates it, is charged the
+		// default amount.
+		amount := defaultPaymentAmount
+		if v := query.Get("amount"); v != "" {
+			var err error
+			amount, err = strconv.ParseFloat(v, 64)
+			if err != nil || !(amount > 0) || math.IsInf(amount, 0) {
+				http.Error(w, "amount must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
 
-		receiptID := takePayment(r.Context(), transactionID)
+		// An abandoned payment wasn't taken, so no record of it is sent to the queue.
+		receiptID, err := takePayment(r.Context(), converter, transactionID, amount, currency)
+		if errors.Is(err, errUnknownCurrency) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			slog.WarnContext(r.Context(), "payment abandoned", "error", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "error taking payment", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		amountTaken.Add(r.Context(), amount, metric.WithAttributes(appattr.Key("payment.currency").String(currency)))
 
 		// Once payment has been processed, send a record of the transaction to the SQS queue.
-		messageBody := fmt.Sprintf(`{"transactionId": "%s", "receiptId": "%s"}`, transactionID, receiptID)
+		messageBody, err := json.Marshal(transactionRecord{
+			TransactionID: transactionID,
+			ReceiptID:     receiptID,
+			Amount:        math.Round(amount*100) / 100,
+			Currency:      currency,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error encoding transaction record", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
 		input := sqs.SendMessageInput{
-			MessageBody: &messageBody,
-			QueueUrl:    &queueURL,
+			MessageBody:       aws.String(string(messageBody)),
+			MessageAttributes: baggageMessageAttributes(r.Context()),
 		}
 
-		_, err := sqsClient.SendMessage(r.Context(), &input)
-		if err != nil {
-			fmt.Printf("error sending sqs message: %v\n", err)
+		if err := sender.send(r.Context(), input); err != nil {
+			slog.ErrorContext(r.Context(), "error sending sqs message", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -77,24 +282,82 @@ func paymentHandler(sqsClient *sqs.Client, queueURL string) http.HandlerFunc {
 	}
 }
 
-func takePayment(ctx context.Context, transactionID string) string {
-	ctx, span := otel.GetTracerProvider().
-		Tracer(serviceName).
-		Start(ctx, "Process Payment", trace.WithAttributes(attribute.String("transaction.id", transactionID)))
+// transactionRecord is the record of a payment sent to the queue for service-c to process.
+type transactionRecord struct {
+	TransactionID string  `json:"transactionId"`
+	ReceiptID     string  `json:"receiptId"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+}
 
-	defer span.End()
+// baggageMessageAttributes serialises any baggage in the context into an SQS message attribute.
+// SQS only propagates the X-Ray trace header (as the AWSTraceHeader system attribute), so the
+// baggage has to be carried explicitly for the consumer to extract.
+func baggageMessageAttributes(ctx context.Context) map[string]sqsTypes.MessageAttributeValue {
+	carrier := propagation.MapCarrier{}
+	propagation.Baggage{}.Inject(ctx, carrier)
+
+	value := carrier.Get(baggageMessageAttribute)
+	if value == "" {
+		return nil
+	}
 
-	// Simulate random latency to process payment
+	return map[string]sqsTypes.MessageAttributeValue{
+		baggageMessageAttribute: {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		},
+	}
+}
+
+// paymentLatency returns how long taking a payment takes, a random whole number of seconds
+// between 1 and 5.
+var paymentLatency = func() time.Duration {
 	minSleep := 1
 	maxSleep := 5
 	sleep := rand.Intn(maxSleep-minSleep+1) + minSleep
-	time.Sleep(time.Duration(sleep * int(time.Second)))
+
+	return time.Duration(sleep) * time.Second
+}
+
+// takePayment processes the payment, first converting it into the settlement currency if the
+// converter is set, and returns its receipt ID.
+func takePayment(ctx context.Context, converter *currencyConverter, transactionID string, amount float64, currency string) (string, error) {
+	ctx, span := tracer("payment").
+		Start(ctx, "Process Payment", trace.WithAttributes(
+			appattr.Key("transaction.id").String(transactionID),
+			appattr.Key("payment.amount").Float64(amount),
+			appattr.Key("payment.currency").String(currency),
+		))
+
+	defer span.End()
+
+	if converter != nil {
+		if _, err := converter.convert(ctx, amount, currency); err != nil {
+			span.SetStatus(codes.Error, "error converting currency")
+			return "", err
+		}
+	}
+
+	// Simulate random latency to process payment. A caller that gives up, or whose propagated
+	// deadline passes, abandons the payment rather than waiting for it.
+	select {
+	case <-time.After(paymentLatency()):
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		span.SetStatus(codes.Error, "payment abandoned")
+		return "", ctx.Err()
+	}
 
 	// Generate a random payment receipt ID
 	receiptID := uuid.New().String()
 
 	// Add the receiptID to the current span attributes
-	span.SetAttributes(attribute.String("payment.receipt.id", receiptID))
+	span.SetAttributes(appattr.Key("payment.receipt.id").String(receiptID))
+
+	// Record the moment the receipt was generated as a span event, so the trace timeline shows
+	// when it happened relative to the payment processing latency.
+	span.AddEvent("payment.receipt.generated", trace.WithAttributes(appattr.Key("payment.receipt.id").String(receiptID)))
 
-	return receiptID
+	return receiptID, nil
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestSender returns a messageSender whose queue is served by handler.
+func newTestSender(t *testing.T, handler http.Handler) *messageSender {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := sqs.New(sqs.Options{
+		Region:           "eu-west-1",
+		BaseEndpoint:     aws.String(server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+
+	return &messageSender{
+		client:      client,
+		queueURL:    "https://sqs.eu-west-1.amazonaws.com/123456789012/payments",
+		maxAttempts: 1,
+		slots:       make(chan struct{}, 1),
+	}
+}
+
+func TestTakePaymentAbandoned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, err := takePayment(ctx, nil, "abc", 10, "GBP")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %s to abandon the payment", elapsed)
+	}
+}
+
+func TestPaymentHandlerAbandoned(t *testing.T) {
+	var sends atomic.Int32
+	sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	amountTaken, _ := noop.NewMeterProvider().Meter("test").Float64Counter("payment.amount")
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/payment?transactionId=abc&amount=10&currency=GBP", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	paymentHandler(sender, nil, amountTaken).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if n := sends.Load(); n != 0 {
+		t.Errorf("sent %d messages for an abandoned payment", n)
+	}
+}
+
+// withoutPaymentLatency makes payments instant for the duration of the test.
+func withoutPaymentLatency(t *testing.T) {
+	previous := paymentLatency
+	paymentLatency = func() time.Duration { return 0 }
+	t.Cleanup(func() { paymentLatency = previous })
+}
+
+func TestPaymentHandlerRecord(t *testing.T) {
+	withoutPaymentLatency(t)
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		wantCode int
+		want     transactionRecord
+	}{
+		{
+			name:     "payment",
+			query:    url.Values{"transactionId": {"abc"}, "amount": {"12.345"}, "currency": {"GBP"}},
+			wantCode: http.StatusOK,
+			want:     transactionRecord{TransactionID: "abc", Amount: 12.35, Currency: "GBP"},
+		},
+		{
+			name:     "default amount",
+			query:    url.Values{"transactionId": {"abc"}, "currency": {"GBP"}},
+			wantCode: http.StatusOK,
+			want:     transactionRecord{TransactionID: "abc", Amount: defaultPaymentAmount, Currency: "GBP"},
+		},
+		{
+			name:     "values are escaped",
+			query:    url.Values{"transactionId": {`abc", "amount": 0, "x": "`}, "amount": {"5"}, "currency": {`GBP"}`}},
+			wantCode: http.StatusOK,
+			want:     transactionRecord{TransactionID: `abc", "amount": 0, "x": "`, Amount: 5, Currency: `GBP"}`},
+		},
+		{name: "zero amount", query: url.Values{"amount": {"0"}}, wantCode: http.StatusBadRequest},
+		{name: "invalid amount", query: url.Values{"amount": {"ten"}}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bodies := make(chan string, 1)
+			sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var input struct{ MessageBody string }
+				b, _ := io.ReadAll(r.Body)
+				_ = json.Unmarshal(b, &input)
+				bodies <- input.MessageBody
+
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				_, _ = w.Write([]byte("{}"))
+			}))
+
+			amountTaken, _ := noop.NewMeterProvider().Meter("test").Float64Counter("payment.amount")
+
+			rec := httptest.NewRecorder()
+			paymentHandler(sender, nil, amountTaken).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/payment?"+tt.query.Encode(), nil))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			body := <-bodies
+
+			var got transactionRecord
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("invalid record %s: %v", body, err)
+			}
+
+			// The receipt ID is random, so only its presence is checked.
+			if got.ReceiptID == "" {
+				t.Errorf("record %s has no receipt id", body)
+			}
+
+			got.ReceiptID = ""
+			if got != tt.want {
+				t.Errorf("got record %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTakePaymentAttributes(t *testing.T) {
+	withoutPaymentLatency(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	receiptID, err := takePayment(context.Background(), nil, "abc", 42.5, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+	for key, want := range map[attribute.Key]attribute.Value{
+		"transaction.id":     attribute.StringValue("abc"),
+		"payment.amount":     attribute.Float64Value(42.5),
+		"payment.currency":   attribute.StringValue("EUR"),
+		"payment.receipt.id": attribute.StringValue(receiptID),
+	} {
+		if got, _ := attrs.Value(key); got != want {
+			t.Errorf("got %s %v, want %v", key, got.Emit(), want.Emit())
+		}
+	}
+}
+
+// recordSpans registers a TracerProvider recording the spans globally, for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestTakePaymentReceiptEvent(t *testing.T) {
+	withoutPaymentLatency(t)
+	recorder := recordSpans(t)
+
+	receiptID, err := takePayment(context.Background(), nil, "abc", 10, "GBP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := recorder.Ended()[0]
+
+	var events []sdktrace.Event
+	for _, event := range span.Events() {
+		if event.Name == "payment.receipt.generated" {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("got %d payment.receipt.generated events, want 1", len(events))
+	}
+
+	event := events[0]
+	attrs := attribute.NewSet(event.Attributes...)
+	if got, _ := attrs.Value("payment.receipt.id"); got.AsString() != receiptID {
+		t.Errorf("got payment.receipt.id %q, want %q", got.AsString(), receiptID)
+	}
+
+	if event.Time.Before(span.StartTime()) || event.Time.After(span.EndTime()) {
+		t.Errorf("got the event at %s, want it within the span, from %s to %s", event.Time, span.StartTime(), span.EndTime())
+	}
+}
+
+// TestServeDrainsPayments checks that a payment in flight when the service is told to stop
+// completes, sending its record and ending its span, before serve returns.
+func TestServeDrainsPayments(t *testing.T) {
+	previous := paymentLatency
+	paymentLatency = func() time.Duration { return 200 * time.Millisecond }
+	t.Cleanup(func() { paymentLatency = previous })
+
+	recorder := recordSpans(t)
+
+	var sends atomic.Int32
+	sender := newTestSender(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sends.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	amountTaken, _ := noop.NewMeterProvider().Meter("test").Float64Counter("payment.amount")
+
+	started := make(chan struct{})
+	handler := paymentHandler(sender, nil, amountTaken)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		handler(w, r)
+	})}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, ln, 5*time.Second)
+	}()
+
+	responses := make(chan int, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/payment?transactionId=abc&amount=10&currency=GBP")
+		if err != nil {
+			responses <- 0
+			return
+		}
+		res.Body.Close()
+		responses <- res.StatusCode
+	}()
+
+	// Stop the service while the payment is being taken.
+	<-started
+	stop()
+
+	if err := <-served; err != nil {
+		t.Fatalf("serve() = %v", err)
+	}
+
+	// serve has returned, so the payment has to have completed already.
+	if n := sends.Load(); n != 1 {
+		t.Errorf("got %d records sent, want 1", n)
+	}
+
+	if ended := recorder.Ended(); len(ended) != 1 || ended[0].Name() != "Process Payment" {
+		t.Errorf("got %d spans ended, want the Process Payment span", len(ended))
+	}
+
+	if code := <-responses; code != http.StatusOK {
+		t.Errorf("got status %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/messaging"
+)
+
+const (
+	// defaultSendMaxAttempts bounds how many times a transaction record is sent to the queue.
+	defaultSendMaxAttempts = 3
+
+	// sendRetryBackoff is the wait before the first retry, doubling for each one after it.
+	sendRetryBackoff = 100 * time.Millisecond
+
+	// defaultSendConcurrency bounds how many records are sent to the queue at once.
+	defaultSendConcurrency = 64
+)
+
+// messageSender sends the transaction records to the queue, retrying transient failures with
+// backoff. By the time a record is sent the payment has been taken, so a record that still
+// can't be sent is written to the fallback queue, if there is one, rather than being lost.
+type messageSender struct {
+	client      *sqs.Client
+	queueURL    string
+	maxAttempts int
+
+	// fallbackQueueURL is where undeliverable records are sent, e.g. a dead-letter queue to be
+	// redriven later. There is no fallback when it's empty.
+	fallbackQueueURL string
+
+	// slots is a semaphore bounding the sends in flight, so a burst of payments can't get the
+	// service throttled by SQS. Its capacity is the limit.
+	slots chan struct{}
+}
+
+// acquire waits for a free send slot, or until ctx is done. Having to wait is recorded on the
+// span in ctx.
+func (s *messageSender) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(appattr.Key("sqs.send.throttled_locally").Bool(true))
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error waiting to send sqs message: %w", ctx.Err())
+	}
+}
+
+func (s *messageSender) release() {
+	<-s.slots
+}
+
+// send sends the message to the queue, falling back to the fallback queue once the retries are
+// exhausted. It only returns an error if the record couldn't be delivered anywhere.
+func (s *messageSender) send(ctx context.Context, input sqs.SendMessageInput) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+
+	span := trace.SpanFromContext(ctx)
+	backoff := sendRetryBackoff
+
+	input.QueueUrl = &s.queueURL
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if _, err = s.client.SendMessage(ctx, &input); err == nil {
+			span.SetAttributes(
+				appattr.Key("sqs.send.retry.count").Int(attempt-1),
+				attribute.String("messaging.destination.name", messaging.QueueName(s.queueURL)),
+			)
+			return nil
+		}
+
+		if !isTransient(err) || attempt == s.maxAttempts {
+			span.SetAttributes(appattr.Key("sqs.send.retry.count").Int(attempt - 1))
+			err = fmt.Errorf("sqs send message error after %d attempts: %w", attempt, err)
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			span.SetAttributes(appattr.Key("sqs.send.retry.count").Int(attempt - 1))
+			return fmt.Errorf("sqs send message error after %d attempts: %w", attempt, ctx.Err())
+		}
+	}
+
+	span.RecordError(err)
+
+	if s.fallbackQueueURL == "" {
+		span.SetStatus(codes.Error, "transaction record undeliverable")
+		slog.ErrorContext(ctx, "UNDELIVERABLE TRANSACTION RECORD: payment taken but not sent to the queue",
+			"message.body", aws.ToString(input.MessageBody), "error", err)
+		return err
+	}
+
+	input.QueueUrl = &s.fallbackQueueURL
+	if _, fallbackErr := s.client.SendMessage(ctx, &input); fallbackErr != nil {
+		span.RecordError(fallbackErr)
+		span.SetStatus(codes.Error, "transaction record undeliverable")
+		slog.ErrorContext(ctx, "UNDELIVERABLE TRANSACTION RECORD: payment taken but not sent to the queue or the fallback queue",
+			"message.body", aws.ToString(input.MessageBody), "error", err, "fallback.error", fallbackErr)
+		return fmt.Errorf("%w; fallback queue: %w", err, fallbackErr)
+	}
+
+	span.SetAttributes(
+		appattr.Key("sqs.send.fallback").Bool(true),
+		attribute.String("messaging.destination.name", messaging.QueueName(s.fallbackQueueURL)),
+	)
+	span.SetStatus(codes.Error, "transaction record sent to the fallback queue")
+	slog.ErrorContext(ctx, "transaction record sent to the fallback queue", "error", err)
+
+	return nil
+}
+
+// isTransient reports whether a failed send is worth retrying, according to the AWS SDK.
+func isTransient(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
@@ -2,26 +2,56 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/awsconfig"
 )
 
-func getAWSConfig() aws.Config {
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-	}
+const (
+	// tableCreationTimeout bounds how long ensureTable waits for a new table to become active.
+	tableCreationTimeout = 2 * time.Minute
 
-	// Instrument all AWS clients with OpenTelemetry
-	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	// defaultOperationTimeout bounds a single AWS call, so one slow call can't use up the whole
+	// message processing budget.
+	defaultOperationTimeout = 10 * time.Second
+)
 
-	return cfg
+func getAWSConfig(settings awsconfig.Settings) (aws.Config, error) {
+	return awsconfig.Load(awsconfig.WithSettings(settings))
+}
+
+// withOperationTimeout makes an AWS call with its own deadline. If the call times out, an event
+// naming the operation is added to the current span, so the trace shows exactly which call was
+// too slow; the instrumented call's own span is marked as errored by otelaws.
+func withOperationTimeout(ctx context.Context, timeout time.Duration, operation string, call func(context.Context) error) error {
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := call(opCtx)
+
+	// Only report the timeout when it was this operation's deadline, not the caller's, that expired.
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		trace.SpanFromContext(ctx).AddEvent("aws.operation.timeout", trace.WithAttributes(
+			appattr.Key("aws.operation").String(operation),
+			appattr.Key("timeout").String(timeout.String()),
+		))
+
+		return fmt.Errorf("%s timed out after %s: %w", operation, timeout, err)
+	}
+
+	return err
 }
 
 func newSQSClient(cfg aws.Config) *sqs.Client {
@@ -29,8 +59,12 @@ func newSQSClient(cfg aws.Config) *sqs.Client {
 	return client
 }
 
+// newS3Client creates the S3 client. Against a local endpoint such as LocalStack, buckets are
+// addressed by path, as their virtual-hosted names wouldn't resolve.
 func newS3Client(cfg aws.Config) *s3.Client {
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = cfg.BaseEndpoint != nil
+	})
 	return client
 }
 
@@ -38,3 +72,113 @@ func newDynamoClient(cfg aws.Config) *dynamodb.Client {
 	client := dynamodb.NewFromConfig(cfg)
 	return client
 }
+
+// ensureTable creates the DynamoDB table if it doesn't already exist, keyed on an "id" string
+// with a TTL on "ttl". It's intended for local runs against LocalStack; in AWS the table is
+// provisioned separately and this is never called.
+func ensureTable(ctx context.Context, client *dynamodb.Client, table string) (err error) {
+	ctx, span := tracer(componentDynamoDB).Start(ctx, "Ensure Table")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("aws.dynamodb.table_names", table))
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "error ensuring dynamodb table")
+		}
+	}()
+
+	_, err = client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err == nil {
+		span.SetAttributes(appattr.Key("created").Bool(false))
+		return nil
+	}
+
+	var notFound *dynamoTypes.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return fmt.Errorf("error describing table %s: %w", table, err)
+	}
+
+	_, err = client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   &table,
+		BillingMode: dynamoTypes.BillingModePayPerRequest,
+		AttributeDefinitions: []dynamoTypes.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: dynamoTypes.ScalarAttributeTypeS},
+		},
+		KeySchema: []dynamoTypes.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: dynamoTypes.KeyTypeHash},
+		},
+	})
+	if err != nil {
+		// Another instance may have created the table between the describe and the create.
+		var inUse *dynamoTypes.ResourceInUseException
+		if errors.As(err, &inUse) {
+			span.SetAttributes(appattr.Key("created").Bool(false))
+			return nil
+		}
+
+		return fmt.Errorf("error creating table %s: %w", table, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(client)
+	if err = waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: &table}, tableCreationTimeout); err != nil {
+		return fmt.Errorf("error waiting for table %s: %w", table, err)
+	}
+
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: &table,
+		TimeToLiveSpecification: &dynamoTypes.TimeToLiveSpecification{
+			AttributeName: aws.String("ttl"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error enabling ttl on table %s: %w", table, err)
+	}
+
+	span.SetAttributes(appattr.Key("created").Bool(true))
+
+	return nil
+}
+
+// ensureBucket creates the S3 bucket if it doesn't already exist. Like ensureTable, it's only
+// intended for local runs against LocalStack.
+func ensureBucket(ctx context.Context, client *s3.Client, bucket, region string) (err error) {
+	ctx, span := tracer(componentS3).Start(ctx, "Ensure Bucket")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("aws.s3.bucket", bucket))
+
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "error ensuring s3 bucket")
+		}
+	}()
+
+	input := &s3.CreateBucketInput{Bucket: &bucket}
+
+	// Buckets are created in us-east-1 unless a location constraint is given, and us-east-1
+	// itself must not be passed as one.
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3Types.CreateBucketConfiguration{
+			LocationConstraint: s3Types.BucketLocationConstraint(region),
+		}
+	}
+
+	_, err = client.CreateBucket(ctx, input)
+	if err != nil {
+		var ownedByYou *s3Types.BucketAlreadyOwnedByYou
+		if errors.As(err, &ownedByYou) {
+			span.SetAttributes(appattr.Key("created").Bool(false))
+			return nil
+		}
+
+		return fmt.Errorf("error creating bucket %s: %w", bucket, err)
+	}
+
+	span.SetAttributes(appattr.Key("created").Bool(true))
+
+	return nil
+}
@@ -0,0 +1,90 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"shared/awsconfig"
+)
+
+// localStackConfig returns the AWS config for the LocalStack endpoint set by AWS_ENDPOINT_URL,
+// skipping the test if it isn't set. Run with:
+//
+//	AWS_ENDPOINT_URL=http://localhost:4566 go test -tags integration ./...
+func localStackConfig(t *testing.T) aws.Config {
+	t.Helper()
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		t.Skip("AWS_ENDPOINT_URL isn't set")
+	}
+
+	cfg, err := getAWSConfig(awsconfig.Settings{
+		Region:          "eu-west-1",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		EndpointURL:     endpoint,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func TestEnsureTableLocalStack(t *testing.T) {
+	client := newDynamoClient(localStackConfig(t))
+	table := "ensure-table-" + t.Name()
+
+	t.Cleanup(func() {
+		_, _ = client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: &table})
+	})
+
+	// The second call finds the table the first created.
+	for range 2 {
+		if err := ensureTable(context.Background(), client, table); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ttl, err := client.DescribeTimeToLive(context.Background(), &dynamodb.DescribeTimeToLiveInput{TableName: &table})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := aws.ToString(ttl.TimeToLiveDescription.AttributeName); got != "ttl" {
+		t.Errorf("got ttl attribute %q, want %q", got, "ttl")
+	}
+}
+
+func TestEnsureBucketLocalStack(t *testing.T) {
+	cfg := localStackConfig(t)
+	client := newS3Client(cfg)
+	bucket := "ensure-bucket-localstack"
+
+	t.Cleanup(func() {
+		_, _ = client.DeleteBucket(context.Background(), &s3.DeleteBucketInput{Bucket: &bucket})
+	})
+
+	// The second call finds the bucket the first created.
+	for range 2 {
+		if err := ensureBucket(context.Background(), client, bucket, cfg.Region); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	location, err := client.GetBucketLocation(context.Background(), &s3.GetBucketLocationInput{Bucket: &bucket})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(location.LocationConstraint); got != cfg.Region {
+		t.Errorf("got location %q, want %q", got, cfg.Region)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeDynamo is a DynamoDB endpoint answering each action with a canned status and body,
+// recording the actions it's called with. Once a table has been created, it's described as
+// active.
+type fakeDynamo struct {
+	responses map[string]fakeResponse
+
+	mu      sync.Mutex
+	actions []string
+}
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+func (f *fakeDynamo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+
+	f.mu.Lock()
+	f.actions = append(f.actions, action)
+	response, ok := f.responses[action]
+	if !ok {
+		response = fakeResponse{status: http.StatusOK, body: "{}"}
+	}
+
+	if action == "CreateTable" && response.status == http.StatusOK {
+		f.responses["DescribeTable"] = activeTable
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(response.status)
+	_, _ = w.Write([]byte(response.body))
+}
+
+var activeTable = fakeResponse{status: http.StatusOK, body: `{"Table":{"TableName":"orders","TableStatus":"ACTIVE"}}`}
+
+// dynamoError returns the response for a DynamoDB error of the given type.
+func dynamoError(errorType string) fakeResponse {
+	return fakeResponse{
+		status: http.StatusBadRequest,
+		body:   `{"__type":"com.amazonaws.dynamodb.v20120810#` + errorType + `","message":"` + errorType + `"}`,
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	tests := []struct {
+		name        string
+		responses   map[string]fakeResponse
+		wantActions []string
+		wantCreated bool
+		wantErr     string
+	}{
+		{
+			name:        "exists",
+			responses:   map[string]fakeResponse{"DescribeTable": activeTable},
+			wantActions: []string{"DescribeTable"},
+		},
+		{
+			name:        "missing",
+			responses:   map[string]fakeResponse{"DescribeTable": dynamoError("ResourceNotFoundException")},
+			wantActions: []string{"DescribeTable", "CreateTable", "DescribeTable", "UpdateTimeToLive"},
+			wantCreated: true,
+		},
+		{
+			name: "created concurrently",
+			responses: map[string]fakeResponse{
+				"DescribeTable": dynamoError("ResourceNotFoundException"),
+				"CreateTable":   dynamoError("ResourceInUseException"),
+			},
+			wantActions: []string{"DescribeTable", "CreateTable"},
+		},
+		{
+			name:        "describe fails",
+			responses:   map[string]fakeResponse{"DescribeTable": dynamoError("AccessDeniedException")},
+			wantActions: []string{"DescribeTable"},
+			wantErr:     "error describing table orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, nil)
+
+			fake := &fakeDynamo{responses: tt.responses}
+			server := httptest.NewServer(fake)
+			t.Cleanup(server.Close)
+
+			client := dynamodb.New(dynamodb.Options{
+				Region:       "eu-west-1",
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  aws.AnonymousCredentials{},
+			})
+
+			err := ensureTable(context.Background(), client, "orders")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(fake.actions, tt.wantActions) {
+				t.Errorf("got actions %v, want %v", fake.actions, tt.wantActions)
+			}
+
+			assertEnsureSpan(t, pt, "Ensure Table", tt.wantCreated, tt.wantErr != "")
+		})
+	}
+}
+
+// assertEnsureSpan checks the span wrapping an ensure call records whether the resource was
+// created, or the error if it failed.
+func assertEnsureSpan(t *testing.T, pt *pollerTest, name string, wantCreated, wantErr bool) {
+	t.Helper()
+
+	for _, span := range pt.spans.Ended() {
+		if span.Name() != name {
+			continue
+		}
+
+		if got := span.Status().Code == codes.Error; got != wantErr {
+			t.Errorf("got errored %t, want %t", got, wantErr)
+		}
+
+		created, ok := spanAttribute(span, "created")
+		if !wantErr && (!ok || created.AsBool() != wantCreated) {
+			t.Errorf("got created %v, want %t", created.Emit(), wantCreated)
+		}
+
+		return
+	}
+
+	t.Fatalf("no %s span", name)
+}
+
+func TestEnsureBucket(t *testing.T) {
+	const ownedByYou = `<Error><Code>BucketAlreadyOwnedByYou</Code><Message>owned by you</Message></Error>`
+	const exists = `<Error><Code>BucketAlreadyExists</Code><Message>exists</Message></Error>`
+
+	tests := []struct {
+		name         string
+		region       string
+		status       int
+		body         string
+		wantLocation string
+		wantCreated  bool
+		wantErr      string
+	}{
+		{name: "created", region: "eu-west-1", status: http.StatusOK, wantLocation: "eu-west-1", wantCreated: true},
+		{name: "created in us-east-1", region: "us-east-1", status: http.StatusOK, wantCreated: true},
+		{name: "already owned", region: "eu-west-1", status: http.StatusConflict, body: ownedByYou, wantLocation: "eu-west-1"},
+		{
+			name:         "owned by someone else",
+			region:       "eu-west-1",
+			status:       http.StatusConflict,
+			body:         exists,
+			wantLocation: "eu-west-1",
+			wantErr:      "error creating bucket orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, nil)
+
+			var method, path, location string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path = r.Method, r.URL.Path
+
+				var config struct {
+					LocationConstraint string
+				}
+				_ = xml.NewDecoder(r.Body).Decode(&config)
+				location = config.LocationConstraint
+
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(server.Close)
+
+			client := newS3Client(aws.Config{
+				Region:       tt.region,
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  aws.AnonymousCredentials{},
+			})
+
+			err := ensureBucket(context.Background(), client, "orders", tt.region)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if method != http.MethodPut || path != "/orders" {
+				t.Errorf("got %s %s, want PUT /orders", method, path)
+			}
+
+			if location != tt.wantLocation {
+				t.Errorf("got location constraint %q, want %q", location, tt.wantLocation)
+			}
+
+			assertEnsureSpan(t, pt, "Ensure Bucket", tt.wantCreated, tt.wantErr != "")
+		})
+	}
+}
+
+// TestOperationTimeouts checks each AWS call times out on its own deadline against a slow
+// endpoint, recording which operation timed out on the span.
+func TestOperationTimeouts(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		operation string
+		call      func(ctx context.Context, endpoint string)
+	}{
+		{
+			name:      "put item",
+			operation: "DynamoDB.PutItem",
+			call: func(ctx context.Context, endpoint string) {
+				client := dynamodb.New(dynamodb.Options{
+					Region:       "eu-west-1",
+					BaseEndpoint: aws.String(endpoint),
+					Credentials:  aws.AnonymousCredentials{},
+				})
+				_ = writeToDynamoDB(ctx, client, "orders", "abc", timeout)
+			},
+		},
+		{
+			name:      "put object",
+			operation: "S3.PutObject",
+			call: func(ctx context.Context, endpoint string) {
+				client := newS3Client(aws.Config{
+					Region:       "eu-west-1",
+					BaseEndpoint: aws.String(endpoint),
+					Credentials:  aws.AnonymousCredentials{},
+				})
+				_ = writeToS3Bucket(ctx, client, "orders", objectKeyFormat{}, strings.NewReader("{}"), "application/json", systemClock{}, timeout)
+			},
+		},
+		{
+			name:      "delete message",
+			operation: "SQS.DeleteMessage",
+			call: func(ctx context.Context, endpoint string) {
+				p := &Poller{
+					sqsClient: sqs.New(sqs.Options{
+						Region:       "eu-west-1",
+						BaseEndpoint: aws.String(endpoint),
+						Credentials:  aws.AnonymousCredentials{},
+					}),
+					queueURL:         "https://sqs.eu-west-1.amazonaws.com/123456789012/orders",
+					operationTimeout: timeout,
+				}
+				p.deleteMessage(ctx, trace.SpanFromContext(ctx), testMessage())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The endpoint doesn't respond until the test has finished.
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			t.Cleanup(server.Close)
+			t.Cleanup(func() { close(release) })
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			for _, callerDeadline := range []bool{false, true} {
+				ctx, span := tp.Tracer("test").Start(context.Background(), "Process Message")
+
+				// When the caller's own deadline expires first, the operation didn't time out.
+				if callerDeadline {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, timeout/2)
+					defer cancel()
+				}
+
+				start := time.Now()
+				tt.call(ctx, server.URL)
+				span.End()
+
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("got the call taking %s, want it to time out after %s", elapsed, timeout)
+				}
+
+				ended := recorder.Ended()
+				events := ended[len(ended)-1].Events()
+
+				var timedOut []string
+				for _, event := range events {
+					if event.Name == "aws.operation.timeout" {
+						attrs := attribute.NewSet(event.Attributes...)
+						operation, _ := attrs.Value("aws.operation")
+						timedOut = append(timedOut, operation.AsString())
+					}
+				}
+
+				want := []string{tt.operation}
+				if callerDeadline {
+					want = nil
+				}
+
+				if !slices.Equal(timedOut, want) {
+					t.Errorf("caller deadline %t: got timed out operations %v, want %v", callerDeadline, timedOut, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/baggage"
+	"shared/telemetry"
+)
+
+func TestMessageCaller(t *testing.T) {
+	tests := []struct {
+		name       string
+		baggage    string
+		wantCaller string
+	}{
+		{name: "propagated", baggage: "service.name=service-b,basket.id=123", wantCaller: "service-b"},
+		{name: "not propagated", baggage: "basket.id=123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPropagators(t)
+
+			// The handler's context is what the downstream requests propagate.
+			var downstream baggage.Baggage
+			pt := newPollerTest(t, handlerFunc(func(ctx context.Context, _ sqsTypes.Message) error {
+				downstream = baggage.FromContext(ctx)
+				return nil
+			}))
+
+			message := testMessage()
+			message.MessageAttributes = map[string]sqsTypes.MessageAttributeValue{
+				baggageMessageAttribute: {DataType: aws.String("String"), StringValue: aws.String(tt.baggage)},
+			}
+
+			span := pt.handle(t, message)
+
+			got, ok := spanAttribute(span, telemetry.CallerKey())
+			if ok != (tt.wantCaller != "") || got.AsString() != tt.wantCaller {
+				t.Errorf("got %s %q, want %q", telemetry.CallerKey(), got.AsString(), tt.wantCaller)
+			}
+
+			if caller := downstream.Member(telemetry.CallerBaggageMember).Value(); caller != serviceName {
+				t.Errorf("got caller %q propagated downstream, want %q", caller, serviceName)
+			}
+
+			if basket := downstream.Member("basket.id").Value(); basket != "123" {
+				t.Errorf("got basket.id %q propagated downstream, want 123", basket)
+			}
+		})
+	}
+}
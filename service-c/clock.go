@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// Clock tells the time. Components that depend on the current time, such as building S3 object
+// keys or timing receives, take a Clock rather than calling time.Now, so a fixed clock can be
+// substituted to make them deterministic. The same goes for waiting, with After rather than
+// time.After.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the system time, used in production.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
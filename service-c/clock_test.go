@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+// fakeWaiter is a channel returned by After, sent the time once the clock reaches it.
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2022, time.October, 19, 22, 30, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := fakeWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+
+	c.waiters = append(c.waiters, w)
+
+	return w.c
+}
+
+// advance moves the clock on, firing the channels of any After calls it reaches.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+
+		w.c <- c.now
+	}
+	c.waiters = waiting
+}
+
+// waiting returns how many After channels haven't fired yet.
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+func TestProcessedCacheTTL(t *testing.T) {
+	const ttl = time.Minute
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "just processed", want: true},
+		{name: "within the TTL", elapsed: 59 * time.Second, want: true},
+		{name: "at the TTL", elapsed: ttl, want: true},
+		{name: "after the TTL", elapsed: ttl + time.Nanosecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			cache := newProcessedCache(10, ttl, clock)
+
+			cache.add("abc")
+			clock.advance(tt.elapsed)
+
+			if got := cache.contains("abc"); got != tt.want {
+				t.Errorf("got contains %t after %s, want %t", got, tt.elapsed, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    bool
+	}{
+		{name: "exhausted", want: false},
+		{name: "not yet refilled", elapsed: 400 * time.Millisecond, want: false},
+		{name: "refilled", elapsed: 500 * time.Millisecond, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			budget := newRetryBudget(1, 2, clock)
+
+			if !budget.allow() {
+				t.Fatal("got a full budget refusing a retry")
+			}
+
+			clock.advance(tt.elapsed)
+
+			if got := budget.allow(); got != tt.want {
+				t.Errorf("got allow %t after %s, want %t", got, tt.elapsed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifecycleEventTimestamps(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+
+	pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error {
+		clock.advance(time.Second)
+		return nil
+	}))
+	pt.poller.clock = clock
+
+	span := pt.handle(t, testMessage())
+
+	got := map[string]time.Time{}
+	for _, event := range span.Events() {
+		got[event.Name] = event.Time
+	}
+
+	tests := []struct {
+		event string
+		want  time.Time
+	}{
+		{event: eventMessageReceived, want: start},
+		{event: eventMessageProcessingStarted, want: start},
+		{event: eventMessageProcessingCompleted, want: start.Add(time.Second)},
+		{event: eventMessageDeleted, want: start.Add(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			timestamp, ok := got[tt.event]
+			if !ok {
+				t.Fatalf("no %s event", tt.event)
+			}
+
+			if !timestamp.Equal(tt.want) {
+				t.Errorf("got timestamp %s, want %s", timestamp, tt.want)
+			}
+		})
+	}
+}
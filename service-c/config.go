@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"shared/awsconfig"
+	"shared/delay"
+	"shared/messaging"
+	"shared/telemetry"
+)
+
+// Config is the configuration of service-c, resolved from the environment by LoadConfig.
+type Config struct {
+	// AWS and Telemetry configure the AWS SDK and the OpenTelemetry SDK.
+	AWS       awsconfig.Settings `json:"aws"`
+	Telemetry telemetry.Settings `json:"telemetry"`
+
+	// QueueURLs are the SQS queues consumed, from SQS_QUEUE_URLS, comma separated, or otherwise
+	// SQS_QUEUE_URL.
+	QueueURLs []string `json:"queueUrls"`
+
+	// Bucket and Table are where each message is recorded (S3_BUCKET_NAME and
+	// DYNAMO_TABLE_NAME). For local runs they're optionally created on startup
+	// (S3_AUTO_CREATE and DYNAMO_AUTO_CREATE).
+	Bucket           string `json:"bucket"`
+	Table            string `json:"table"`
+	S3AutoCreate     bool   `json:"s3AutoCreate"`
+	DynamoAutoCreate bool   `json:"dynamoAutoCreate"`
+
+	// S3KeyPrefix and S3KeyPartitionByDate shape the S3 object keys (S3_KEY_PREFIX and
+	// S3_KEY_PARTITION_BY_DATE), and S3BodyFormat their content (S3_BODY_FORMAT).
+	S3KeyPrefix          string `json:"s3KeyPrefix"`
+	S3KeyPartitionByDate bool   `json:"s3KeyPartitionByDate"`
+	S3BodyFormat         string `json:"s3BodyFormat"`
+
+	// S3BatchSize combines the payloads of up to that many messages into each S3 object, flushed
+	// at least every S3BatchInterval (S3_BATCH_SIZE and S3_BATCH_INTERVAL). Zero disables it.
+	S3BatchSize     int           `json:"s3BatchSize"`
+	S3BatchInterval time.Duration `json:"s3BatchInterval"`
+
+	// WaitTimeSeconds is the long-poll duration (SQS_WAIT_TIME_SECONDS), MaxMessages the most
+	// messages received at once (SQS_MAX_MESSAGES), and EmptyReceiveSleep the pause after an
+	// empty receive (EMPTY_RECEIVE_SLEEP).
+	WaitTimeSeconds   int32         `json:"waitTimeSeconds"`
+	MaxMessages       int32         `json:"maxMessages"`
+	EmptyReceiveSleep time.Duration `json:"emptyReceiveSleep"`
+
+	// ReceiveSystemAttributes and ReceiveMessageAttributes are further attributes requested with
+	// the received messages (SQS_RECEIVE_SYSTEM_ATTRIBUTES and SQS_RECEIVE_MESSAGE_ATTRIBUTES).
+	ReceiveSystemAttributes  []string `json:"receiveSystemAttributes"`
+	ReceiveMessageAttributes []string `json:"receiveMessageAttributes"`
+
+	// ProcessingTimeout bounds each message (MESSAGE_PROCESSING_TIMEOUT), OperationTimeout each
+	// AWS call (AWS_OPERATION_TIMEOUT), and DrainTimeout the shutdown (SHUTDOWN_DRAIN_TIMEOUT).
+	ProcessingTimeout time.Duration `json:"processingTimeout"`
+	OperationTimeout  time.Duration `json:"operationTimeout"`
+	DrainTimeout      time.Duration `json:"drainTimeout"`
+
+	// The downstream requests made for each message (DOWNSTREAM_CONCURRENCY,
+	// DOWNSTREAM_REQUEST_TIMEOUT, DOWNSTREAM_DEADLINE, DOWNSTREAM_MAX_ATTEMPTS,
+	// DOWNSTREAM_RETRY_BUDGET and DOWNSTREAM_RETRY_BUDGET_REFILL).
+	DownstreamConcurrency       int           `json:"downstreamConcurrency"`
+	DownstreamRequestTimeout    time.Duration `json:"downstreamRequestTimeout"`
+	DownstreamDeadline          time.Duration `json:"downstreamDeadline"`
+	DownstreamMaxAttempts       int           `json:"downstreamMaxAttempts"`
+	DownstreamRetryBudget       int           `json:"downstreamRetryBudget"`
+	DownstreamRetryBudgetRefill float64       `json:"downstreamRetryBudgetRefill"`
+
+	// IdempotencyCacheSize remembers the IDs of that many processed messages, for
+	// IdempotencyCacheTTL, so their redeliveries are skipped (IDEMPOTENCY_CACHE_SIZE and
+	// IDEMPOTENCY_CACHE_TTL). Zero disables it.
+	IdempotencyCacheSize int           `json:"idempotencyCacheSize"`
+	IdempotencyCacheTTL  time.Duration `json:"idempotencyCacheTtl"`
+
+	// MalformedMessageAction is what happens to a malformed message, "delete" or "retain"
+	// (MALFORMED_MESSAGE_ACTION).
+	MalformedMessageAction string `json:"malformedMessageAction"`
+
+	// MaxReceiveCount is the maxReceiveCount of the queues' redrive policy (SQS_MAX_RECEIVE_COUNT),
+	// to tell which messages are moving to the dead-letter queue. Zero means it isn't known.
+	MaxReceiveCount int `json:"maxReceiveCount"`
+
+	// HTTP4xxIsError counts 4xx responses, as well as 5xx, as errors (HTTP_4XX_IS_ERROR).
+	HTTP4xxIsError bool `json:"http4xxIsError"`
+
+	// TracePolls traces every receive, including the empty ones (TRACE_POLLS).
+	TracePolls bool `json:"tracePolls"`
+
+	// ConsumerDelay is injected into each message's processing (CONSUMER_DELAY).
+	ConsumerDelay delay.Delay `json:"consumerDelay"`
+}
+
+// Validate checks the settings the service can't start without, which LoadConfig leaves to be
+// checked separately so that an incomplete configuration can still be printed.
+func (c Config) Validate() error {
+	for _, queueURL := range c.QueueURLs {
+		if messaging.QueueName(queueURL) == "" {
+			return fmt.Errorf("invalid SQS queue URL: %q", queueURL)
+		}
+	}
+
+	return nil
+}
+
+// LoadConfig resolves the service's configuration from the environment, applying the defaults
+// for anything that isn't set. It returns an error naming the first invalid setting.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		QueueURLs:                   []string{os.Getenv("SQS_QUEUE_URL")},
+		Bucket:                      os.Getenv("S3_BUCKET_NAME"),
+		Table:                       os.Getenv("DYNAMO_TABLE_NAME"),
+		S3AutoCreate:                os.Getenv("S3_AUTO_CREATE") == "true",
+		DynamoAutoCreate:            os.Getenv("DYNAMO_AUTO_CREATE") == "true",
+		S3KeyPrefix:                 os.Getenv("S3_KEY_PREFIX"),
+		S3KeyPartitionByDate:        os.Getenv("S3_KEY_PARTITION_BY_DATE") == "true",
+		S3BodyFormat:                os.Getenv("S3_BODY_FORMAT"),
+		S3BatchInterval:             defaultS3BatchInterval,
+		WaitTimeSeconds:             defaultWaitTime,
+		MaxMessages:                 1,
+		ProcessingTimeout:           defaultProcessingTimeout,
+		OperationTimeout:            defaultOperationTimeout,
+		DrainTimeout:                defaultDrainTimeout,
+		DownstreamConcurrency:       1,
+		DownstreamMaxAttempts:       1,
+		DownstreamRetryBudget:       defaultRetryBudget,
+		DownstreamRetryBudgetRefill: defaultRetryBudgetRefill,
+		IdempotencyCacheTTL:         defaultIdempotencyCacheTTL,
+		MalformedMessageAction:      os.Getenv("MALFORMED_MESSAGE_ACTION"),
+		HTTP4xxIsError:              os.Getenv("HTTP_4XX_IS_ERROR") == "true",
+		TracePolls:                  os.Getenv("TRACE_POLLS") == "true",
+	}
+
+	if v := os.Getenv("SQS_QUEUE_URLS"); v != "" {
+		cfg.QueueURLs = strings.Split(v, ",")
+	}
+
+	for i, queueURL := range cfg.QueueURLs {
+		cfg.QueueURLs[i] = strings.TrimSpace(queueURL)
+	}
+
+	if cfg.S3BodyFormat == "" {
+		cfg.S3BodyFormat = "random"
+	}
+
+	if _, err := newBodyGenerator(cfg.S3BodyFormat); err != nil {
+		return Config{}, fmt.Errorf("invalid S3_BODY_FORMAT: %w", err)
+	}
+
+	if v, ok := os.LookupEnv("S3_BATCH_SIZE"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Config{}, fmt.Errorf("invalid S3_BATCH_SIZE: %q", v)
+		}
+
+		cfg.S3BatchSize = n
+	}
+
+	if v, ok := os.LookupEnv("S3_BATCH_INTERVAL"); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return Config{}, fmt.Errorf("invalid S3_BATCH_INTERVAL: %q", v)
+		}
+
+		cfg.S3BatchInterval = interval
+	}
+
+	// Without a long-poll an empty queue would busy-spin the poller, so it then pauses between
+	// receives unless EMPTY_RECEIVE_SLEEP says otherwise.
+	if v, ok := os.LookupEnv("SQS_WAIT_TIME_SECONDS"); ok {
+		seconds, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || seconds < 0 || seconds > defaultWaitTime {
+			return Config{}, fmt.Errorf("invalid SQS_WAIT_TIME_SECONDS: %q", v)
+		}
+
+		cfg.WaitTimeSeconds = int32(seconds)
+	}
+
+	if cfg.WaitTimeSeconds == 0 {
+		cfg.EmptyReceiveSleep = shortPollSleep
+	}
+
+	if v, ok := os.LookupEnv("SQS_MAX_MESSAGES"); ok {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 1 || n > 10 {
+			return Config{}, fmt.Errorf("invalid SQS_MAX_MESSAGES: %q", v)
+		}
+
+		cfg.MaxMessages = int32(n)
+	}
+
+	if v := os.Getenv("SQS_RECEIVE_SYSTEM_ATTRIBUTES"); v != "" {
+		cfg.ReceiveSystemAttributes = strings.Split(v, ",")
+	}
+
+	if v := os.Getenv("SQS_RECEIVE_MESSAGE_ATTRIBUTES"); v != "" {
+		cfg.ReceiveMessageAttributes = strings.Split(v, ",")
+	}
+
+	// A zero timeout would fail every message, AWS call or drain at once, so only the pause and
+	// the downstream limits, where zero means none, may be zero.
+	for _, setting := range []struct {
+		key       string
+		d         *time.Duration
+		allowZero bool
+	}{
+		{"EMPTY_RECEIVE_SLEEP", &cfg.EmptyReceiveSleep, true},
+		{"MESSAGE_PROCESSING_TIMEOUT", &cfg.ProcessingTimeout, false},
+		{"AWS_OPERATION_TIMEOUT", &cfg.OperationTimeout, false},
+		{"SHUTDOWN_DRAIN_TIMEOUT", &cfg.DrainTimeout, false},
+		{"DOWNSTREAM_REQUEST_TIMEOUT", &cfg.DownstreamRequestTimeout, true},
+		{"DOWNSTREAM_DEADLINE", &cfg.DownstreamDeadline, true},
+	} {
+		if v, ok := os.LookupEnv(setting.key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 || (d == 0 && !setting.allowZero) {
+				return Config{}, fmt.Errorf("invalid %s: %q", setting.key, v)
+			}
+
+			*setting.d = d
+		}
+	}
+
+	for _, setting := range []struct {
+		key string
+		n   *int
+	}{
+		{"DOWNSTREAM_CONCURRENCY", &cfg.DownstreamConcurrency},
+		{"DOWNSTREAM_MAX_ATTEMPTS", &cfg.DownstreamMaxAttempts},
+	} {
+		if v, ok := os.LookupEnv(setting.key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return Config{}, fmt.Errorf("invalid %s: %q", setting.key, v)
+			}
+
+			*setting.n = n
+		}
+	}
+
+	if v, ok := os.LookupEnv("DOWNSTREAM_RETRY_BUDGET"); ok {
+		capacity, err := strconv.Atoi(v)
+		if err != nil || capacity < 0 {
+			return Config{}, fmt.Errorf("invalid DOWNSTREAM_RETRY_BUDGET: %q", v)
+		}
+
+		cfg.DownstreamRetryBudget = capacity
+	}
+
+	if v, ok := os.LookupEnv("DOWNSTREAM_RETRY_BUDGET_REFILL"); ok {
+		refill, err := strconv.ParseFloat(v, 64)
+		if err != nil || refill < 0 {
+			return Config{}, fmt.Errorf("invalid DOWNSTREAM_RETRY_BUDGET_REFILL: %q", v)
+		}
+
+		cfg.DownstreamRetryBudgetRefill = refill
+	}
+
+	if v, ok := os.LookupEnv("IDEMPOTENCY_CACHE_SIZE"); ok {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return Config{}, fmt.Errorf("invalid IDEMPOTENCY_CACHE_SIZE: %q", v)
+		}
+
+		cfg.IdempotencyCacheSize = size
+	}
+
+	if v, ok := os.LookupEnv("IDEMPOTENCY_CACHE_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return Config{}, fmt.Errorf("invalid IDEMPOTENCY_CACHE_TTL: %q", v)
+		}
+
+		cfg.IdempotencyCacheTTL = ttl
+	}
+
+	switch cfg.MalformedMessageAction {
+	case "":
+		cfg.MalformedMessageAction = "delete"
+	case "delete", "retain":
+	default:
+		return Config{}, fmt.Errorf("invalid MALFORMED_MESSAGE_ACTION: %q", cfg.MalformedMessageAction)
+	}
+
+	if v, ok := os.LookupEnv("SQS_MAX_RECEIVE_COUNT"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Config{}, fmt.Errorf("invalid SQS_MAX_RECEIVE_COUNT: %q", v)
+		}
+
+		cfg.MaxReceiveCount = n
+	}
+
+	var err error
+	if cfg.AWS, err = awsconfig.LoadSettings(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Telemetry, err = telemetry.LoadSettings(); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.ConsumerDelay, err = delay.Parse(os.Getenv("CONSUMER_DELAY")); err != nil {
+		return Config{}, fmt.Errorf("invalid CONSUMER_DELAY: %w", err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"shared/config"
+)
+
+func TestLoadConfigQueueURLs(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueURL  string
+		queueURLs string
+		wantErr   string
+	}{
+		{name: "unset", wantErr: `invalid SQS queue URL: ""`},
+		{name: "single", queueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/payments"},
+		{
+			name:      "several",
+			queueURLs: "https://sqs.eu-west-1.amazonaws.com/123456789012/payments, https://sqs.eu-west-1.amazonaws.com/123456789012/refunds",
+		},
+		{
+			name:      "one invalid",
+			queueURLs: "https://sqs.eu-west-1.amazonaws.com/123456789012/payments,",
+			wantErr:   `invalid SQS queue URL: ""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SQS_QUEUE_URL", tt.queueURL)
+			t.Setenv("SQS_QUEUE_URLS", tt.queueURLs)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			// The configuration can be printed whether or not it's valid.
+			var out bytes.Buffer
+			if err := config.Print(&out, cfg); err != nil {
+				t.Fatalf("Print() error = %v", err)
+			}
+
+			err = cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigProcessingTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", want: 30 * time.Second},
+		{name: "set", env: "5s", want: 5 * time.Second},
+		{name: "invalid", env: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("MESSAGE_PROCESSING_TIMEOUT", tt.env)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", cfg.ProcessingTimeout)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.ProcessingTimeout != tt.want {
+				t.Errorf("got %s, want %s", cfg.ProcessingTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigS3Keys(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantPrefix    string
+		wantPartition bool
+	}{
+		{name: "default"},
+		{name: "prefix", env: map[string]string{"S3_KEY_PREFIX": "orders"}, wantPrefix: "orders"},
+		{name: "partitioned", env: map[string]string{"S3_KEY_PARTITION_BY_DATE": "true"}, wantPartition: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, v := range tt.env {
+				t.Setenv(key, v)
+			}
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.S3KeyPrefix != tt.wantPrefix || cfg.S3KeyPartitionByDate != tt.wantPartition {
+				t.Errorf("got prefix %q and partitioning %t, want %q and %t", cfg.S3KeyPrefix, cfg.S3KeyPartitionByDate, tt.wantPrefix, tt.wantPartition)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEmptyReceiveSleep(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantWait int32
+		want     time.Duration
+		wantErr  bool
+	}{
+		{name: "long-poll doesn't sleep", wantWait: 20},
+		{name: "short-poll sleeps", env: map[string]string{"SQS_WAIT_TIME_SECONDS": "0"}, want: shortPollSleep},
+		{
+			name: "short-poll sleep set",
+			env:  map[string]string{"SQS_WAIT_TIME_SECONDS": "0", "EMPTY_RECEIVE_SLEEP": "250ms"},
+			want: 250 * time.Millisecond,
+		},
+		{
+			name:     "long-poll sleep set",
+			env:      map[string]string{"SQS_WAIT_TIME_SECONDS": "5", "EMPTY_RECEIVE_SLEEP": "1s"},
+			wantWait: 5,
+			want:     time.Second,
+		},
+		{name: "invalid wait time", env: map[string]string{"SQS_WAIT_TIME_SECONDS": "21"}, wantErr: true},
+		{name: "invalid sleep", env: map[string]string{"EMPTY_RECEIVE_SLEEP": "briefly"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", cfg.EmptyReceiveSleep)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.WaitTimeSeconds != tt.wantWait || cfg.EmptyReceiveSleep != tt.want {
+				t.Errorf("got wait %ds and sleep %s, want %ds and %s", cfg.WaitTimeSeconds, cfg.EmptyReceiveSleep, tt.wantWait, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDurations(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		got     func(cfg Config) time.Duration
+		wantErr bool
+	}{
+		{key: "MESSAGE_PROCESSING_TIMEOUT", value: "0s", wantErr: true},
+		{key: "MESSAGE_PROCESSING_TIMEOUT", value: "-1s", wantErr: true},
+		{key: "AWS_OPERATION_TIMEOUT", value: "2s", got: func(cfg Config) time.Duration { return cfg.OperationTimeout }},
+		{key: "AWS_OPERATION_TIMEOUT", value: "0s", wantErr: true},
+		{key: "AWS_OPERATION_TIMEOUT", value: "-1s", wantErr: true},
+		{key: "SHUTDOWN_DRAIN_TIMEOUT", value: "10s", got: func(cfg Config) time.Duration { return cfg.DrainTimeout }},
+		{key: "SHUTDOWN_DRAIN_TIMEOUT", value: "0s", wantErr: true},
+		{key: "SHUTDOWN_DRAIN_TIMEOUT", value: "-1s", wantErr: true},
+		{key: "DOWNSTREAM_REQUEST_TIMEOUT", value: "0s", got: func(cfg Config) time.Duration { return cfg.DownstreamRequestTimeout }},
+		{key: "DOWNSTREAM_REQUEST_TIMEOUT", value: "-1s", wantErr: true},
+		{key: "DOWNSTREAM_DEADLINE", value: "0s", got: func(cfg Config) time.Duration { return cfg.DownstreamDeadline }},
+		{key: "DOWNSTREAM_DEADLINE", value: "-1s", wantErr: true},
+		{key: "EMPTY_RECEIVE_SLEEP", value: "0s", got: func(cfg Config) time.Duration { return cfg.EmptyReceiveSleep }},
+		{key: "EMPTY_RECEIVE_SLEEP", value: "-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid duration")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, _ := time.ParseDuration(tt.value)
+			if got := tt.got(cfg); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
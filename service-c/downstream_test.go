@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRetryDelay(t *testing.T) {
+	cfg := downstreamConfig{retryBackoff: 100 * time.Millisecond, maxRetryBackoff: time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{attempt: 1, max: 100 * time.Millisecond},
+		{attempt: 2, max: 200 * time.Millisecond},
+		{attempt: 4, max: 800 * time.Millisecond},
+		{attempt: 5, max: time.Second},
+		{attempt: 64, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		for range 100 {
+			if d := cfg.retryDelay(tt.attempt); d <= 0 || d > tt.max {
+				t.Fatalf("retryDelay(%d) = %s, want within (0, %s]", tt.attempt, d, tt.max)
+			}
+		}
+	}
+
+	if d := (downstreamConfig{}).retryDelay(1); d != 0 {
+		t.Errorf("retryDelay without a backoff = %s, want 0", d)
+	}
+}
+
+func TestMakeDownstreamRequests(t *testing.T) {
+	var unavailable, ok atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unavailable":
+			unavailable.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/slow":
+			time.Sleep(50 * time.Millisecond)
+			ok.Add(1)
+		default:
+			ok.Add(1)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name            string
+		endpoints       []string
+		maxAttempts     int
+		budget          int
+		wantUnavailable int32
+		wantOK          int32
+		wantEvents      map[string]int
+	}{
+		{
+			name:            "retries a 5xx response",
+			endpoints:       []string{"/unavailable"},
+			maxAttempts:     3,
+			budget:          10,
+			wantUnavailable: 3,
+			wantEvents:      map[string]int{"downstream.request.retry": 2},
+		},
+		{
+			name:            "the retry budget caps retries",
+			endpoints:       []string{"/unavailable", "/unavailable", "/unavailable"},
+			maxAttempts:     3,
+			budget:          1,
+			wantUnavailable: 4,
+			wantEvents:      map[string]int{"downstream.request.retry": 1, "downstream.retry.denied": 3},
+		},
+		{
+			name:        "a failure doesn't cancel the other requests",
+			endpoints:   []string{"/missing", "/slow", "/slow"},
+			maxAttempts: 1,
+			wantOK:      3,
+			wantEvents:  map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unavailable.Store(0)
+			ok.Store(0)
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "process message")
+
+			cfg := downstreamConfig{
+				concurrency:     len(tt.endpoints),
+				maxAttempts:     tt.maxAttempts,
+				retryBackoff:    time.Millisecond,
+				maxRetryBackoff: 5 * time.Millisecond,
+			}
+			if tt.budget > 0 {
+				cfg.retryBudget = newRetryBudget(tt.budget, 0, systemClock{})
+			}
+			for _, endpoint := range tt.endpoints {
+				cfg.endpoints = append(cfg.endpoints, server.URL+endpoint)
+			}
+
+			// A 4xx response or a 5xx one that ran out of attempts isn't a request error.
+			if err := makeDownstreamRequests(ctx, server.Client(), cfg); err != nil {
+				t.Fatalf("makeDownstreamRequests() = %v", err)
+			}
+			span.End()
+
+			if got := unavailable.Load(); got != tt.wantUnavailable {
+				t.Errorf("5xx responses = %d, want %d", got, tt.wantUnavailable)
+			}
+			if got := ok.Load(); got != tt.wantOK {
+				t.Errorf("completed requests = %d, want %d", got, tt.wantOK)
+			}
+
+			events := map[string]int{}
+			for _, event := range recorder.Ended()[0].Events() {
+				events[event.Name]++
+			}
+			for name, want := range tt.wantEvents {
+				if events[name] != want {
+					t.Errorf("%s events = %d, want %d", name, events[name], want)
+				}
+			}
+			if tt.wantEvents != nil && events["downstream.request.skipped"] != 0 {
+				t.Errorf("skipped %d requests, want none", events["downstream.request.skipped"])
+			}
+		})
+	}
+}
+
+func TestMakeDownstreamRequestsStopsBackingOffOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	cfg := downstreamConfig{
+		concurrency:     1,
+		maxAttempts:     10,
+		retryBackoff:    time.Hour,
+		maxRetryBackoff: time.Hour,
+		endpoints:       []string{server.URL},
+	}
+
+	start := time.Now()
+	_ = makeDownstreamRequests(ctx, server.Client(), cfg)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("makeDownstreamRequests() took %s after its context was done", elapsed)
+	}
+}
+
+// TestDownstreamRequestsPropagateBaggage checks the downstream requests carry the baggage along
+// with the trace context, whether the transport is given the propagator, as in main, or falls
+// back to the global one.
+func TestDownstreamRequestsPropagateBaggage(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(xray.Propagator{}, propagation.TraceContext{}, propagation.Baggage{})
+
+	tests := []struct {
+		name string
+		opts []otelhttp.Option
+	}{
+		{name: "explicit propagator", opts: []otelhttp.Option{otelhttp.WithPropagators(propagator)}},
+		{name: "global propagator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPropagators(t)
+
+			headers := make(chan http.Header, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers <- r.Header.Clone()
+			}))
+			t.Cleanup(server.Close)
+
+			member, err := baggage.NewMember("transaction.id", "txn-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bag, err := baggage.New(member)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tp := sdktrace.NewTracerProvider()
+			ctx, span := tp.Tracer("test").Start(baggage.ContextWithBaggage(context.Background(), bag), "Process Message")
+			defer span.End()
+
+			client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport, tt.opts...)}
+			cfg := downstreamConfig{concurrency: 1, maxAttempts: 1, endpoints: []string{server.URL}}
+			if err := makeDownstreamRequests(ctx, client, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			got := <-headers
+			if b := got.Get("Baggage"); !strings.Contains(b, "transaction.id=txn-1") {
+				t.Errorf("got baggage header %q, want transaction.id=txn-1", b)
+			}
+
+			for _, header := range []string{"Traceparent", "X-Amzn-Trace-Id"} {
+				if got.Get(header) == "" {
+					t.Errorf("got no %s header", header)
+				}
+			}
+		})
+	}
+}
+
+// TestMakeDownstreamRequestsCancellation checks that once the requests are cancelled, whether by
+// the parent context or their own deadline, the one in flight stops and those still pending are
+// skipped, each recorded on the span, while a request timing out doesn't stop the others.
+func TestMakeDownstreamRequestsCancellation(t *testing.T) {
+	tests := []struct {
+		name           string
+		concurrency    int
+		cancelAfter    int
+		requestTimeout time.Duration
+		deadline       time.Duration
+		wantRequests   int32
+		wantSkipped    int
+		wantReason     string
+	}{
+		{name: "parent cancelled", concurrency: 1, cancelAfter: 1, wantRequests: 1, wantSkipped: 2, wantReason: "context canceled"},
+		{name: "deadline", concurrency: 1, deadline: 30 * time.Millisecond, wantRequests: 1, wantSkipped: 2, wantReason: "context deadline exceeded"},
+		{name: "request timeout", concurrency: 1, requestTimeout: 20 * time.Millisecond, wantRequests: 3},
+		{name: "parent cancelled with every request in flight", concurrency: 3, cancelAfter: 3, wantRequests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The endpoint doesn't respond until the request is cancelled or the test has finished.
+			var requests atomic.Int32
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if n := requests.Add(1); int(n) == tt.cancelAfter {
+					cancel()
+				}
+
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			t.Cleanup(server.Close)
+			t.Cleanup(func() { close(release) })
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			ctx, span := tp.Tracer("test").Start(ctx, "process message")
+
+			cfg := downstreamConfig{
+				concurrency:    tt.concurrency,
+				requestTimeout: tt.requestTimeout,
+				deadline:       tt.deadline,
+				maxAttempts:    1,
+				endpoints:      []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"},
+			}
+
+			if err := makeDownstreamRequests(ctx, server.Client(), cfg); err == nil {
+				t.Error("got no error, want the cancelled requests' errors")
+			}
+			span.End()
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+
+			var skipped int
+			for _, event := range recorder.Ended()[0].Events() {
+				if event.Name != "downstream.request.skipped" {
+					continue
+				}
+
+				skipped++
+
+				attrs := attribute.NewSet(event.Attributes...)
+				if reason, _ := attrs.Value("skip.reason"); reason.AsString() != tt.wantReason {
+					t.Errorf("got skip.reason %q, want %q", reason.AsString(), tt.wantReason)
+				}
+			}
+
+			if skipped != tt.wantSkipped {
+				t.Errorf("got %d requests skipped, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"go.opentelemetry.io/otel/attribute"
+	"shared/appattr"
+)
+
+// processingStage names the step of message processing that failed.
+type processingStage string
+
+const (
+	stageDynamo     processingStage = "dynamo"
+	stageS3         processingStage = "s3"
+	stageDownstream processingStage = "downstream"
+	stageTimeout    processingStage = "timeout"
+)
+
+// ProcessingError is returned when a message could not be processed. Retryable errors (e.g.
+// throttling, timeouts, network failures) may succeed if the message is redelivered, while
+// terminal errors (e.g. a missing table or denied access) will fail the same way every time.
+type ProcessingError struct {
+	Stage     processingStage
+	Retryable bool
+	Err       error
+}
+
+func (e *ProcessingError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *ProcessingError) Unwrap() error {
+	return e.Err
+}
+
+// attributes describes the error on the processing span.
+func (e *ProcessingError) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		appattr.Key("processing.error.stage").String(string(e.Stage)),
+		appattr.Key("processing.error.retryable").Bool(e.Retryable),
+	}
+}
+
+// newProcessingError classifies err from the given stage, or returns nil if err is nil.
+func newProcessingError(stage processingStage, err error) *ProcessingError {
+	if err == nil {
+		return nil
+	}
+
+	return &ProcessingError{Stage: stage, Retryable: isRetryable(stage, err), Err: err}
+}
+
+func isRetryable(stage processingStage, err error) bool {
+	// The downstream requests run after the record and object are written, and already retry
+	// their own transient failures. Redelivering the message for them would redo the writes, and
+	// a downstream that stays down would keep the message on the queue forever.
+	if stage == stageDownstream {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	if isThrottlingError(err) {
+		return true
+	}
+
+	// Fall back to the AWS SDK's own view of which errors are worth retrying.
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
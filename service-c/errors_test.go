@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestNewProcessingError(t *testing.T) {
+	tests := []struct {
+		name  string
+		stage processingStage
+		err   error
+		want  bool
+	}{
+		{name: "deadline", stage: stageDynamo, err: fmt.Errorf("put: %w", context.DeadlineExceeded), want: true},
+		{name: "cancelled", stage: stageS3, err: context.Canceled, want: true},
+		{name: "throttled", stage: stageDynamo, err: &types.ProvisionedThroughputExceededException{}, want: true},
+		{name: "missing table", stage: stageDynamo, err: &types.ResourceNotFoundException{}},
+		{name: "access denied", stage: stageS3, err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+		{name: "downstream", stage: stageDownstream, err: errors.New("connection refused")},
+		{name: "downstream timeout", stage: stageDownstream, err: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newProcessingError(tt.stage, tt.err)
+			if err.Stage != tt.stage || err.Retryable != tt.want {
+				t.Errorf("got stage %q retryable %t, want %q %t", err.Stage, err.Retryable, tt.stage, tt.want)
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v doesn't wrap %v", err, tt.err)
+			}
+		})
+	}
+
+	if err := newProcessingError(stageS3, nil); err != nil {
+		t.Errorf("got %v for no error, want nil", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// MessageHandler processes a message received by the Poller. The Poller takes care of the
+// message's span, metrics and deletion around the handler, whatever the handler does, so a
+// handler only needs to implement the business logic.
+//
+// Returning a *ProcessingError that isn't Retryable has the message deleted, as it would fail
+// the same way again. Any other error leaves the message on the queue to be redelivered.
+type MessageHandler interface {
+	Handle(ctx context.Context, message sqsTypes.Message) error
+}
+
+// pipelineHandler is the default MessageHandler. It writes a record to DynamoDB, then makes the
+// downstream requests and writes an object to S3 concurrently.
+type pipelineHandler struct {
+	httpClient   *http.Client
+	s3Client     *s3.Client
+	bucket       string
+	keyFormat    objectKeyFormat
+	bodies       BodyGenerator
+	downstream   downstreamConfig
+	dynamoClient *dynamodb.Client
+	table        string
+
+	// operationTimeout bounds each individual AWS call.
+	operationTimeout time.Duration
+
+	// clock tells the time when building object keys.
+	clock Clock
+
+	// batcher, if set, combines the messages' S3 payloads into batched objects rather than
+	// writing an object per message.
+	batcher *s3Batcher
+
+	// goroutines counts the processing goroutines currently running.
+	goroutines metric.Int64UpDownCounter
+}
+
+// registerMetrics registers the handler's instruments with the meter.
+func (h *pipelineHandler) registerMetrics(meter metric.Meter) error {
+	var err error
+	h.goroutines, err = meter.Int64UpDownCounter(
+		"processing.goroutines.active",
+		metric.WithDescription("The number of goroutines currently processing messages."),
+		metric.WithUnit("{goroutine}"),
+	)
+
+	return err
+}
+
+// goroutineStarted counts a processing goroutine as running, tagged with the message's queue, so
+// leaked or runaway goroutines show up in the metrics. The returned func must be deferred by the
+// goroutine to count it as finished.
+func (h *pipelineHandler) goroutineStarted(ctx context.Context) func() {
+	attrs := metric.WithAttributes(attribute.String("messaging.destination.name", queueNameFromContext(ctx)))
+
+	h.goroutines.Add(ctx, 1, attrs)
+	return func() { h.goroutines.Add(ctx, -1, attrs) }
+}
+
+func (h *pipelineHandler) Handle(ctx context.Context, message sqsTypes.Message) error {
+	// process returns a *ProcessingError, which mustn't be returned as a non-nil error when nil.
+	if err := h.process(ctx, message); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (h *pipelineHandler) process(ctx context.Context, message sqsTypes.Message) *ProcessingError {
+	// Demo writing to DynamoDB. This runs synchronously, before any of the concurrent work.
+	dynamoCtx, dynamoSpan := startWork(ctx, componentDynamoDB, "Write Record", workModeSync, trace.SpanKindClient)
+	err := writeToDynamoDB(dynamoCtx, h.dynamoClient, h.table, *message.MessageId, h.operationTimeout)
+	dynamoSpan.End()
+	recordStage(ctx, stageDynamo, err)
+
+	if err != nil {
+		return newProcessingError(stageDynamo, err)
+	}
+
+	// Demo tracing concurrent processes. Both goroutines' spans are children of the Concurrent
+	// Work span, so the trace shows them running side by side within it.
+	var downstreamErr, s3Err error
+
+	concurrentCtx, concurrentSpan := startWork(ctx, componentProcessing, "Concurrent Work", workModeAsync, trace.SpanKindInternal)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2) // Add two go routines
+
+	go func(ctx context.Context, wg *sync.WaitGroup, httpClient *http.Client) {
+		defer wg.Done()
+		defer h.goroutineStarted(ctx)()
+
+		ctx, span := startWork(ctx, componentProcessing, "Downstream Requests", workModeAsync, trace.SpanKindInternal)
+		defer span.End()
+
+		downstreamErr = makeDownstreamRequests(ctx, httpClient, h.downstream)
+	}(concurrentCtx, wg, h.httpClient)
+
+	go func(ctx context.Context, wg *sync.WaitGroup, s3Client *s3.Client, bucket string, keyFormat objectKeyFormat) {
+		defer wg.Done()
+		defer h.goroutineStarted(ctx)()
+
+		// A batched payload is only buffered here, and written by the batch's flush.
+		if h.batcher != nil {
+			ctx, span := startWork(ctx, componentS3, "Buffer Object", workModeAsync, trace.SpanKindInternal)
+			defer span.End()
+
+			body, _, err := h.bodies.Generate(message)
+			if err == nil {
+				err = h.batcher.add(ctx, body)
+			}
+
+			s3Err = err
+			return
+		}
+
+		ctx, span := startWork(ctx, componentS3, "Write Object", workModeAsync, trace.SpanKindClient)
+		defer span.End()
+
+		body, contentType, err := h.bodies.Generate(message)
+		if err != nil {
+			s3Err = err
+			return
+		}
+
+		s3Err = writeToS3Bucket(ctx, s3Client, bucket, keyFormat, body, contentType, h.clock, h.operationTimeout)
+	}(concurrentCtx, wg, h.s3Client, h.bucket, h.keyFormat)
+
+	wg.Wait()
+
+	recordStage(ctx, stageS3, s3Err)
+	recordStage(ctx, stageDownstream, downstreamErr)
+
+	// Name the branches that failed on the span grouping them, so the failure is obvious without
+	// drilling into its children.
+	if failed := failedBranches(map[processingStage]error{stageDownstream: downstreamErr, stageS3: s3Err}); len(failed) > 0 {
+		concurrentSpan.SetAttributes(appattr.Key("failed.branches").StringSlice(failed))
+	}
+
+	concurrentSpan.End()
+
+	if s3Err != nil {
+		return newProcessingError(stageS3, s3Err)
+	}
+
+	return newProcessingError(stageDownstream, downstreamErr)
+}
+
+// failedBranches returns the names of the branches whose error is non-nil, in a stable order.
+func failedBranches(errs map[processingStage]error) []string {
+	var failed []string
+	for stage, err := range errs {
+		if err != nil {
+			failed = append(failed, string(stage))
+		}
+	}
+
+	sort.Strings(failed)
+
+	return failed
+}
+
+// workMode records whether a unit of work runs synchronously or concurrently with other work.
+type workMode string
+
+const (
+	workModeSync  workMode = "sync"
+	workModeAsync workMode = "async"
+)
+
+// startWork starts a span for a unit of message processing, tagged with its work mode so the
+// trace communicates the execution model. Spans wrapping a single remote dependency, such as a
+// DynamoDB or S3 write, are client spans; spans grouping other work are internal. The span is
+// created by the tracer for the given component.
+func startWork(ctx context.Context, component, name string, mode workMode, kind trace.SpanKind) (context.Context, trace.Span) {
+	return tracer(component).Start(ctx, name,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(appattr.Key("work.mode").String(string(mode))),
+	)
+}
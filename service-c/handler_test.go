@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWorkModeAttributes(t *testing.T) {
+	pt := newPipelineTest(t)
+	pt.handle(t, testMessage())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	names := map[string]string{}
+	for _, span := range pt.spans.Ended() {
+		spans[span.Name()] = span
+		names[span.SpanContext().SpanID().String()] = span.Name()
+	}
+
+	tests := []struct {
+		span       string
+		wantMode   string
+		wantParent string
+	}{
+		{span: "Write Record", wantMode: "sync", wantParent: "Process Message"},
+		{span: "Concurrent Work", wantMode: "async", wantParent: "Process Message"},
+		{span: "Downstream Requests", wantMode: "async", wantParent: "Concurrent Work"},
+		{span: "Write Object", wantMode: "async", wantParent: "Concurrent Work"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.span, func(t *testing.T) {
+			span, ok := spans[tt.span]
+			if !ok {
+				t.Fatalf("no %s span", tt.span)
+			}
+
+			if mode, _ := spanAttribute(span, "work.mode"); mode.AsString() != tt.wantMode {
+				t.Errorf("got work.mode %q, want %q", mode.AsString(), tt.wantMode)
+			}
+
+			if parent := names[span.Parent().SpanID().String()]; parent != tt.wantParent {
+				t.Errorf("got parent %q, want %q", parent, tt.wantParent)
+			}
+		})
+	}
+}
+
+func TestSpanKinds(t *testing.T) {
+	pt := newPipelineTest(t)
+	pt.handle(t, testMessage())
+
+	kinds := map[string]trace.SpanKind{}
+	for _, span := range pt.spans.Ended() {
+		kinds[span.Name()] = span.SpanKind()
+	}
+
+	tests := []struct {
+		span string
+		want trace.SpanKind
+	}{
+		{span: "Process Message", want: trace.SpanKindConsumer},
+		{span: "Write Record", want: trace.SpanKindClient},
+		{span: "Write Object", want: trace.SpanKindClient},
+		{span: "Concurrent Work", want: trace.SpanKindInternal},
+		{span: "Downstream Requests", want: trace.SpanKindInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.span, func(t *testing.T) {
+			got, ok := kinds[tt.span]
+			if !ok {
+				t.Fatalf("no %s span", tt.span)
+			}
+
+			if got != tt.want {
+				t.Errorf("got kind %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpanScopes(t *testing.T) {
+	pt := newPipelineTest(t)
+	pt.handle(t, testMessage())
+
+	scopes := map[string]instrumentation.Scope{}
+	for _, span := range pt.spans.Ended() {
+		scopes[span.Name()] = span.InstrumentationScope()
+	}
+
+	tests := []struct {
+		span string
+		want string
+	}{
+		{span: "Process Message", want: "service-c/sqs"},
+		{span: "Write Record", want: "service-c/dynamodb"},
+		{span: "Concurrent Work", want: "service-c/processing"},
+		{span: "Downstream Requests", want: "service-c/processing"},
+		{span: "Write Object", want: "service-c/s3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.span, func(t *testing.T) {
+			got, ok := scopes[tt.span]
+			if !ok {
+				t.Fatalf("no %s span", tt.span)
+			}
+
+			if got.Name != tt.want || got.Version != serviceVersion {
+				t.Errorf("got scope %s@%s, want %s@%s", got.Name, got.Version, tt.want, serviceVersion)
+			}
+		})
+	}
+}
+
+// TestCustomHandler checks the poller applies its spans, metrics and deletion around any
+// MessageHandler, not only the default pipeline.
+func TestCustomHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantDeleted bool
+		wantFailed  int64
+	}{
+		{name: "handled", wantDeleted: true},
+		{name: "retryable failure", err: newProcessingError(stageDynamo, context.DeadlineExceeded), wantFailed: 1},
+		{name: "terminal failure", err: newProcessingError(stageDownstream, errors.New("rejected")), wantDeleted: true, wantFailed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			pt := newPollerTest(t, handlerFunc(func(ctx context.Context, message sqsTypes.Message) error {
+				received = aws.ToString(message.Body)
+
+				_, span := otel.Tracer("custom").Start(ctx, "Custom Work")
+				span.End()
+
+				return tt.err
+			}))
+
+			span := pt.handle(t, testMessage())
+
+			if received != aws.ToString(testMessage().Body) {
+				t.Errorf("got body %q, want %q", received, aws.ToString(testMessage().Body))
+			}
+
+			var custom sdktrace.ReadOnlySpan
+			for _, s := range pt.spans.Ended() {
+				if s.Name() == "Custom Work" {
+					custom = s
+				}
+			}
+
+			if custom == nil || custom.Parent().SpanID() != span.SpanContext().SpanID() {
+				t.Error("got no Custom Work span under the Process Message span")
+			}
+
+			if got := span.Status().Code == codes.Error; got != (tt.err != nil) {
+				t.Errorf("got errored %t, want %t", got, tt.err != nil)
+			}
+
+			if got := pt.sqs.called("DeleteMessage"); got != tt.wantDeleted {
+				t.Errorf("got deleted %t, want %t", got, tt.wantDeleted)
+			}
+
+			var failed int64
+			for _, dp := range pt.counter(t, "sqs.messages.failed") {
+				failed += dp.Value
+			}
+
+			if failed != tt.wantFailed {
+				t.Errorf("got %d failures counted, want %d", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+// TestActiveGoroutines checks the processing goroutines are counted while they run, tagged with
+// the message's queue, and that the count returns to zero once the message is processed.
+func TestActiveGoroutines(t *testing.T) {
+	pt := newPipelineTest(t)
+	handler := pt.poller.handler.(*pipelineHandler)
+
+	reader := sdkmetric.NewManualReader()
+	if err := handler.registerMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The downstream request is held until the count has been checked mid-processing.
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(downstream.Close)
+
+	releaseOnce := sync.OnceFunc(func() { close(release) })
+	t.Cleanup(releaseOnce)
+	handler.downstream.endpoints = []string{downstream.URL}
+
+	active := func() (int64, string) {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name == "processing.goroutines.active" {
+					dp := m.Data.(metricdata.Sum[int64]).DataPoints[0]
+					queue, _ := dp.Attributes.Value("messaging.destination.name")
+					return dp.Value, queue.AsString()
+				}
+			}
+		}
+
+		t.Fatal("no processing.goroutines.active metric")
+		return 0, ""
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pt.poller.handleMessage(context.Background(), testMessage(), trace.SpanContext{})
+	}()
+
+	<-arrived
+	if got, queue := active(); got < 1 || queue != "orders" {
+		t.Errorf("got %d goroutines active on queue %q mid-processing, want at least 1 on orders", got, queue)
+	}
+
+	releaseOnce()
+	<-done
+
+	if got, _ := active(); got != 0 {
+		t.Errorf("got %d goroutines active after processing, want 0", got)
+	}
+}
+
+// TestFailedBranches checks the Concurrent Work span names exactly the branches that failed.
+func TestFailedBranches(t *testing.T) {
+	tests := []struct {
+		name           string
+		failDownstream bool
+		failS3         bool
+		want           []string
+	}{
+		{name: "none"},
+		{name: "downstream", failDownstream: true, want: []string{"downstream"}},
+		{name: "s3", failS3: true, want: []string{"s3"}},
+		{name: "both", failDownstream: true, failS3: true, want: []string{"downstream", "s3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPipelineTest(t)
+			handler := pt.poller.handler.(*pipelineHandler)
+
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			t.Cleanup(failing.Close)
+
+			// A 5xx from a downstream endpoint isn't a failure, while an unreachable one is.
+			if tt.failDownstream {
+				unreachable := httptest.NewServer(http.NotFoundHandler())
+				unreachable.Close()
+				handler.downstream.endpoints = []string{unreachable.URL}
+			}
+
+			if tt.failS3 {
+				handler.s3Client = newS3Client(aws.Config{
+					Region:           "eu-west-1",
+					BaseEndpoint:     aws.String(failing.URL),
+					Credentials:      aws.AnonymousCredentials{},
+					RetryMaxAttempts: 1,
+				})
+			}
+
+			pt.handle(t, testMessage())
+
+			var concurrent sdktrace.ReadOnlySpan
+			for _, span := range pt.spans.Ended() {
+				if span.Name() == "Concurrent Work" {
+					concurrent = span
+				}
+			}
+
+			if concurrent == nil {
+				t.Fatal("no Concurrent Work span")
+			}
+
+			got, ok := spanAttribute(concurrent, "failed.branches")
+			if ok != (len(tt.want) > 0) || !slices.Equal(got.AsStringSlice(), tt.want) {
+				t.Errorf("got failed.branches %v, want %v", got.AsStringSlice(), tt.want)
+			}
+		})
+	}
+}
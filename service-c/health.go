@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// newHealthServer returns a server exposing the pollers' readiness at /readyz. Once the
+// pollers start draining, /readyz reports "draining" with a 503 so no new work is routed here.
+func newHealthServer(addr string, poller pollerGroup) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if poller.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "draining (%d in flight)\n", poller.InFlight())
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "ready (%d in flight)\n", poller.InFlight())
+	})
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
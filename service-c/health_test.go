@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		states     []pollerState
+		inFlight   []int64
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "running",
+			states:     []pollerState{stateRunning, stateRunning},
+			inFlight:   []int64{1, 2},
+			wantStatus: http.StatusOK,
+			wantBody:   "ready (3 in flight)",
+		},
+		{
+			name:       "draining",
+			states:     []pollerState{stateRunning, stateDraining},
+			inFlight:   []int64{0, 1},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "draining (1 in flight)",
+		},
+		{
+			name:       "stopped",
+			states:     []pollerState{stateStopped, stateStopped},
+			inFlight:   []int64{0, 0},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "draining (0 in flight)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var group pollerGroup
+			for i, state := range tt.states {
+				p := &Poller{}
+				p.state.Store(int32(state))
+				p.inFlight.Store(tt.inFlight[i])
+				group = append(group, p)
+			}
+
+			rec := httptest.NewRecorder()
+			newHealthServer(":0", group).Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
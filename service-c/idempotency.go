@@ -0,0 +1,82 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyCacheTTL is how long a processed message ID is remembered for by default.
+const defaultIdempotencyCacheTTL = 5 * time.Minute
+
+// processedCache remembers the IDs of recently processed messages, so a message redelivered soon
+// after it was processed can be skipped before any work is done. It holds at most size IDs,
+// evicting the least recently processed once full, and forgets each ID after ttl. It is safe
+// for concurrent use.
+type processedCache struct {
+	size  int
+	ttl   time.Duration
+	clock Clock
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type processedEntry struct {
+	id      string
+	expires time.Time
+}
+
+func newProcessedCache(size int, ttl time.Duration, clock Clock) *processedCache {
+	return &processedCache{
+		size:  size,
+		ttl:   ttl,
+		clock: clock,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// contains reports whether the message ID was processed within the TTL.
+func (c *processedCache) contains(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[id]
+	if !ok {
+		return false
+	}
+
+	if c.clock.Now().After(elem.Value.(*processedEntry).expires) {
+		c.remove(elem)
+		return false
+	}
+
+	return true
+}
+
+// add records the message ID as processed.
+func (c *processedCache) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.clock.Now().Add(c.ttl)
+
+	if elem, ok := c.items[id]; ok {
+		elem.Value.(*processedEntry).expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[id] = c.order.PushFront(&processedEntry{id: id, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *processedCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*processedEntry).id)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessedCacheEviction(t *testing.T) {
+	tests := []struct {
+		name      string
+		processed []string
+		want      map[string]bool
+	}{
+		{name: "within the size", processed: []string{"a", "b"}, want: map[string]bool{"a": true, "b": true}},
+		{name: "least recent evicted", processed: []string{"a", "b", "c"}, want: map[string]bool{"a": false, "b": true, "c": true}},
+		{name: "reprocessed kept", processed: []string{"a", "b", "a", "c"}, want: map[string]bool{"a": true, "b": false, "c": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newProcessedCache(2, time.Minute, newFakeClock())
+			for _, id := range tt.processed {
+				cache.add(id)
+			}
+
+			for id, want := range tt.want {
+				if got := cache.contains(id); got != want {
+					t.Errorf("got contains(%q) %t, want %t", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestProcessedCacheConcurrent checks the cache is safe for the poller's concurrent workers, and
+// stays within its size however they interleave.
+func TestProcessedCacheConcurrent(t *testing.T) {
+	cache := newProcessedCache(50, time.Minute, newFakeClock())
+
+	var wg sync.WaitGroup
+	for worker := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range 100 {
+				id := strconv.Itoa(worker*100 + i)
+				cache.add(id)
+				cache.contains(id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := cache.order.Len(); got != 50 || len(cache.items) != 50 {
+		t.Errorf("got %d IDs in the cache, want 50", got)
+	}
+}
@@ -1,121 +1,295 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamoTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/propagation"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"shared/appattr"
+	"shared/config"
+	"shared/logging"
+	"shared/messaging"
+	"shared/telemetry"
 )
 
 const (
 	serviceName    = "service-c"
 	serviceVersion = "1.0.1"
-)
 
-func main() {
+	// baggageMessageAttribute is the SQS message attribute service-b uses to carry W3C baggage.
+	baggageMessageAttribute = "baggage"
 
-	shutdown := initialiseOpenTelemetry()
-	defer shutdown()
+	defaultProcessingTimeout = 30 * time.Second
 
-	// Create AWS components
-	cfg := getAWSConfig()
-	sqsClient := newSQSClient(cfg)
-	s3Client := newS3Client(cfg)
-	dynamoClient := newDynamoClient(cfg)
+	// defaultDrainTimeout is how long in-flight work has to finish once shutdown begins.
+	defaultDrainTimeout = 30 * time.Second
 
-	queueURL := os.Getenv("SQS_QUEUE_URL")
-	bucket := os.Getenv("S3_BUCKET_NAME")
-	table := os.Getenv("DYNAMO_TABLE_NAME")
+	// defaultWaitTime is the SQS long-poll duration in seconds, which is the maximum allowed.
+	defaultWaitTime = 20
 
-	httpClient := http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	// shortPollSleep is the default pause after an empty receive when long-polling is disabled.
+	shortPollSleep = time.Second
 
-	rand.Seed(time.Now().UnixNano())
+	// healthAddr is where the readiness endpoint is served.
+	healthAddr = ":8002"
 
-	fmt.Println("service started")
-	poll(context.Background(), sqsClient, queueURL, &httpClient, s3Client, bucket, dynamoClient, table)
-}
+	// dynamoMaxAttempts and dynamoRetryBackoff bound the retries of a throttled DynamoDB write.
+	// The backoff doubles after each attempt.
+	dynamoMaxAttempts  = 4
+	dynamoRetryBackoff = 100 * time.Millisecond
+)
+
+func main() {
 
-func poll(ctx context.Context, sqsClient *sqs.Client, queueURL string, httpClient *http.Client, s3Client *s3.Client, bucket string, dynamoClient *dynamodb.Client, table string) {
+	slog.SetDefault(logging.New())
 
-	sqsReceiveMessageInput := sqs.ReceiveMessageInput{
-		QueueUrl:            &queueURL,
-		MaxNumberOfMessages: 1, // For demo purposes let's only receive 1 message
-		WaitTimeSeconds:     20,
-		AttributeNames:      []sqsTypes.QueueAttributeName{sqsTypes.QueueAttributeName(sqsTypes.MessageSystemAttributeNameAWSTraceHeader)},
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
 	}
 
-	for {
-		if ctx.Err() != nil {
-			return
+	// With --print-config, or PRINT_CONFIG=true, the configuration is printed without starting.
+	if config.PrintRequested() {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatal(err)
 		}
 
-		fmt.Println("receiving message")
-		output, err := sqsClient.ReceiveMessage(ctx, &sqsReceiveMessageInput)
-		if err != nil {
-			fmt.Printf("error receiving sqs message: %v\n", err)
-			return
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	// Optionally trace the startup, with TRACE_STARTUP=true, to measure the cold start.
+	startup := telemetry.NewStartupTrace()
+
+	// The AWS config is loaded first so the resolved region can be recorded on the telemetry.
+	endPhase := startup.Phase("Load AWS Config")
+	awsCfg, err := getAWSConfig(cfg.AWS)
+	if err != nil {
+		log.Fatalf("error loading aws config: %v", err)
+	}
+	endPhase()
+
+	endPhase = startup.Phase("Init Telemetry")
+	providers, shutdown := initialiseOpenTelemetry(awsCfg.Region, cfg.Telemetry)
+	defer shutdown()
+	endPhase()
+
+	endPhase = startup.Phase("Create Clients")
+	sqsClient := newSQSClient(awsCfg)
+	s3Client := newS3Client(awsCfg)
+	dynamoClient := newDynamoClient(awsCfg)
+	endPhase()
+
+	startup.Export(context.Background(), providers)
+
+	bucket, table := cfg.Bucket, cfg.Table
+
+	// For local runs against LocalStack, optionally create the table so the demo can bootstrap
+	// itself. In AWS the table is assumed to exist.
+	if cfg.DynamoAutoCreate {
+		if err := ensureTable(context.Background(), dynamoClient, table); err != nil {
+			log.Fatalf("error ensuring dynamodb table: %v", err)
 		}
+	}
 
-		if len(output.Messages) == 0 {
-			continue
+	if cfg.S3AutoCreate {
+		if err := ensureBucket(context.Background(), s3Client, bucket, awsCfg.Region); err != nil {
+			log.Fatalf("error ensuring s3 bucket: %v", err)
 		}
+	}
 
-		fmt.Printf("processing message %s\n", *output.Messages[0].MessageId)
+	// Optionally prefix and partition the S3 object keys by date, e.g. "orders/2022/10/19/<uuid>.txt".
+	keyFormat := objectKeyFormat{
+		prefix:          cfg.S3KeyPrefix,
+		partitionByDate: cfg.S3KeyPartitionByDate,
+	}
 
-		processMessage(ctx, httpClient, output.Messages[0], s3Client, bucket, dynamoClient, table)
+	// The composite propagator injects the baggage header alongside the trace header, so the
+	// transaction correlation reaches the downstream calls too. It's passed explicitly rather
+	// than relying on the global registration. Only 5xx responses mark the client spans as
+	// errored, unless HTTP_4XX_IS_ERROR=true counts 4xx too.
+	statusPolicy := telemetry.StatusPolicy{ClientErrors: cfg.HTTP4xxIsError}
+	httpClient := http.Client{Transport: otelhttp.NewTransport(statusPolicy.Transport(http.DefaultTransport), otelhttp.WithPropagators(providers.Propagator))}
 
-		fmt.Printf("deleting message %s\n", *output.Messages[0].MessageId)
+	rand.Seed(time.Now().UnixNano())
 
-		sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-			QueueUrl:      &queueURL,
-			ReceiptHandle: output.Messages[0].ReceiptHandle,
-		})
+	// The downstream requests are made one at a time by default. DOWNSTREAM_CONCURRENCY makes
+	// several at once, and DOWNSTREAM_REQUEST_TIMEOUT and DOWNSTREAM_DEADLINE bound each request
+	// and all of them respectively.
+	downstream := downstreamConfig{
+		concurrency:    cfg.DownstreamConcurrency,
+		requestTimeout: cfg.DownstreamRequestTimeout,
+		deadline:       cfg.DownstreamDeadline,
+		maxAttempts:    cfg.DownstreamMaxAttempts,
+
+		retryBackoff:    defaultDownstreamRetryBackoff,
+		maxRetryBackoff: defaultDownstreamMaxRetryBackoff,
 	}
-}
 
-func processMessage(ctx context.Context, httpClient *http.Client, message sqsTypes.Message, s3Client *s3.Client, bucket string, dynamoClient *dynamodb.Client, table string) {
-	// Extracts the Tracing information from the SQS message and injects it to the context
-	ctx = propagateTraceFromSQSMessage(ctx, message)
+	// Failed downstream requests are retried up to DOWNSTREAM_MAX_ATTEMPTS times in total, within
+	// a retry budget shared by every request: DOWNSTREAM_RETRY_BUDGET retries, refilled at
+	// DOWNSTREAM_RETRY_BUDGET_REFILL a second. Without it, a failing endpoint would be retried by
+	// every message at once.
+	if downstream.maxAttempts > 1 {
+		downstream.retryBudget = newRetryBudget(cfg.DownstreamRetryBudget, cfg.DownstreamRetryBudgetRefill, systemClock{})
+	}
 
-	ctx, span := otel.GetTracerProvider().Tracer(serviceName).Start(ctx, "Process Message",
-		trace.WithSpanKind(trace.SpanKindServer),
-		trace.WithAttributes(semconv.MessagingMessageIDKey.String(*message.MessageId)),
-	)
-	defer span.End()
+	// The S3 objects hold random data, unless S3_BODY_FORMAT=json records the message instead.
+	bodies, err := newBodyGenerator(cfg.S3BodyFormat)
+	if err != nil {
+		log.Fatalf("invalid S3_BODY_FORMAT: %v", err)
+	}
+
+	// Every queue's messages are processed the same way.
+	handler := &pipelineHandler{
+		httpClient:       &httpClient,
+		s3Client:         s3Client,
+		bucket:           bucket,
+		keyFormat:        keyFormat,
+		bodies:           bodies,
+		downstream:       downstream,
+		dynamoClient:     dynamoClient,
+		table:            table,
+		operationTimeout: cfg.OperationTimeout,
+		clock:            systemClock{},
+	}
+
+	// Optionally combine the S3 payloads of up to S3_BATCH_SIZE messages into a single gzipped
+	// object, flushed at least every S3_BATCH_INTERVAL, to demo batching writes.
+	if cfg.S3BatchSize > 0 {
+		handler.batcher = &s3Batcher{
+			client:      s3Client,
+			bucket:      bucket,
+			keyFormat:   keyFormat,
+			clock:       systemClock{},
+			timeout:     cfg.OperationTimeout,
+			maxMessages: cfg.S3BatchSize,
+			interval:    cfg.S3BatchInterval,
+		}
+	}
+
+	// The handler and poller instruments belong to the providers initialised above, not whichever
+	// MeterProvider happens to be global.
+	meter := providers.MeterProvider.Meter(serviceName)
+
+	if err := handler.registerMetrics(meter); err != nil {
+		log.Fatalf("error registering handler metrics: %v", err)
+	}
+
+	// Optionally remember the IDs of the last IDEMPOTENCY_CACHE_SIZE processed messages, for
+	// IDEMPOTENCY_CACHE_TTL, so their redeliveries are skipped. The cache is shared by every
+	// queue's poller.
+	var processed *processedCache
+	if cfg.IdempotencyCacheSize > 0 {
+		processed = newProcessedCache(cfg.IdempotencyCacheSize, cfg.IdempotencyCacheTTL, systemClock{})
+	}
 
-	// Demo writing to DynamoDB
-	writeToDynamoDB(ctx, dynamoClient, table, *message.MessageId)
+	// Messages can be consumed from several queues at once, listed comma separated in
+	// SQS_QUEUE_URLS, to demo fanning in from several producers. Malformed messages are deleted
+	// by default. MALFORMED_MESSAGE_ACTION=retain leaves them on the queue instead, for its
+	// redrive policy to move to its dead-letter queue.
+	var pollers pollerGroup
+	for _, queueURL := range cfg.QueueURLs {
+		poller := &Poller{
+			sqsClient:         sqsClient,
+			queueURL:          queueURL,
+			queueName:         messaging.QueueName(queueURL),
+			processingTimeout: cfg.ProcessingTimeout,
+			handler:           handler,
+			operationTimeout:  cfg.OperationTimeout,
+			tracePolls:        cfg.TracePolls,
+			waitTime:          cfg.WaitTimeSeconds,
+			maxMessages:       cfg.MaxMessages,
+			emptyReceiveSleep: cfg.EmptyReceiveSleep,
+			clock:             systemClock{},
+			receiveAttributes: newReceiveAttributes(cfg.ReceiveSystemAttributes, cfg.ReceiveMessageAttributes),
+			delay:             cfg.ConsumerDelay,
+			processed:         processed,
+			retainMalformed:   cfg.MalformedMessageAction == "retain",
+			maxReceiveCount:   cfg.MaxReceiveCount,
+			coldStart:         providers.ColdStart,
+		}
 
-	// Demo tracing concurrent processes
-	wg := &sync.WaitGroup{}
-	wg.Add(2) // Add two go routines
+		if err := poller.registerMetrics(meter); err != nil {
+			log.Fatalf("error registering poller metrics: %v", err)
+		}
 
-	go func(ctx context.Context, wg *sync.WaitGroup, httpClient *http.Client) {
-		defer wg.Done()
-		makeDownstreamRequests(ctx, httpClient)
-	}(ctx, wg, httpClient)
+		pollers = append(pollers, poller)
+	}
+	// Shutdown happens in two phases. The first SIGTERM stops the pollers receiving new messages,
+	// while any message already in flight is allowed to finish. A second signal, or the drain
+	// timeout expiring, forces the pollers to abandon the in-flight messages.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	work, force := context.WithCancel(context.Background())
+	defer force()
+
+	go func() {
+		<-ctx.Done()
+		slog.Info("draining pollers", "timeout", cfg.DrainTimeout.String())
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			slog.Warn("second signal received, forcing shutdown")
+		case <-time.After(cfg.DrainTimeout):
+			slog.Warn("drain timeout expired, forcing shutdown")
+		case <-work.Done():
+			return
+		}
 
-	go func(ctx context.Context, wg *sync.WaitGroup, s3Client *s3.Client, bucket string) {
-		defer wg.Done()
-		writeToS3Bucket(ctx, s3Client, bucket)
-	}(ctx, wg, s3Client, bucket)
+		force()
+	}()
 
-	wg.Wait()
+	healthServer := newHealthServer(healthAddr, pollers)
+	go func() {
+		if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	slog.Info("service started")
+	pollers.Run(ctx, work)
+
+	// Write any payloads still buffered once the pollers have stopped, before the telemetry is
+	// flushed by the deferred shutdown.
+	if handler.batcher != nil {
+		handler.batcher.Close()
+	}
+
+	if err := healthServer.Shutdown(context.Background()); err != nil {
+		slog.Error("error shutting down health server", "error", err)
+	}
 }
 
 func propagateTraceFromSQSMessage(ctx context.Context, msg sqsTypes.Message) context.Context {
@@ -123,61 +297,280 @@ func propagateTraceFromSQSMessage(ctx context.Context, msg sqsTypes.Message) con
 		"X-Amzn-Trace-Id": msg.Attributes[string(sqsTypes.MessageSystemAttributeNameAWSTraceHeader)],
 	}
 
+	// Baggage isn't part of the AWSTraceHeader, so it is carried in its own message attribute.
+	if attr, ok := msg.MessageAttributes[baggageMessageAttribute]; ok && attr.StringValue != nil {
+		traceHeader[baggageMessageAttribute] = *attr.StringValue
+	}
+
 	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(traceHeader))
 }
 
-func writeToDynamoDB(ctx context.Context, dynamoClient *dynamodb.Client, table string, msgID string) {
-	_, err := dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+// baggageAttributes converts each baggage member in the context into a span attribute,
+// prefixed with "baggage." to distinguish it from attributes set by the service itself.
+func baggageAttributes(ctx context.Context) []attribute.KeyValue {
+	members := baggage.FromContext(ctx).Members()
+	if len(members) == 0 {
+		return nil
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(members))
+	for _, member := range members {
+		attrs = append(attrs, appattr.Key("baggage."+member.Key()).String(member.Value()))
+	}
+
+	return attrs
+}
+
+// writeToDynamoDB records the message, retrying with backoff if the write is throttled. The item
+// is keyed on the message ID, so repeating the write is idempotent.
+func writeToDynamoDB(ctx context.Context, dynamoClient *dynamodb.Client, table string, msgID string, timeout time.Duration) error {
+	input := &dynamodb.PutItemInput{
 		TableName: &table,
 		Item: map[string]dynamoTypes.AttributeValue{
 			"id": &dynamoTypes.AttributeValueMemberS{Value: msgID},
 		},
-	})
-	if err != nil {
-		fmt.Printf("dynamodb put item error: %v\n", err)
 	}
+
+	span := trace.SpanFromContext(ctx)
+	backoff := dynamoRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := withOperationTimeout(ctx, timeout, "DynamoDB.PutItem", func(ctx context.Context) error {
+			_, err := dynamoClient.PutItem(ctx, input)
+			return err
+		})
+		if err == nil {
+			span.SetAttributes(appattr.Key("db.retry.count").Int(attempt - 1))
+			return nil
+		}
+
+		if !isThrottlingError(err) || attempt == dynamoMaxAttempts {
+			span.SetAttributes(appattr.Key("db.retry.count").Int(attempt - 1))
+			return fmt.Errorf("dynamodb put item error after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			span.SetAttributes(appattr.Key("db.retry.count").Int(attempt - 1))
+			return fmt.Errorf("dynamodb put item error after %d attempts: %w", attempt, ctx.Err())
+		}
+	}
+}
+
+// isThrottlingError reports whether err means the request was rejected due to throughput limits
+// and is safe to retry.
+func isThrottlingError(err error) bool {
+	var throughputExceeded *dynamoTypes.ProvisionedThroughputExceededException
+	var requestLimitExceeded *dynamoTypes.RequestLimitExceeded
+
+	return errors.As(err, &throughputExceeded) || errors.As(err, &requestLimitExceeded)
+}
+
+// downstreamConfig controls how the downstream requests are made.
+type downstreamConfig struct {
+	// concurrency is how many requests are in flight at once.
+	concurrency int
+
+	// requestTimeout bounds each request, and deadline bounds them all. Zero means no limit
+	// beyond the message's processing timeout.
+	requestTimeout time.Duration
+	deadline       time.Duration
+
+	// maxAttempts bounds the attempts at each request. Requests that error, or get a 5xx
+	// response, are retried while the retryBudget, shared by every request, allows it. A nil
+	// budget doesn't limit the retries.
+	maxAttempts int
+	retryBudget *retryBudget
+
+	// retryBackoff is the most a request waits before its first retry, doubling for each retry
+	// after it up to maxRetryBackoff. Each wait is a random fraction of that, so the retries of
+	// requests that failed together are spread out.
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+
+	// endpoints are the URLs requested, the demo endpoints when it's empty.
+	endpoints []string
+}
+
+// The default backoff between downstream retries.
+const (
+	defaultDownstreamRetryBackoff    = 200 * time.Millisecond
+	defaultDownstreamMaxRetryBackoff = 2 * time.Second
+)
+
+// demoEndpoints are the downstream endpoints requested for each message, which respond with the
+// status in their path.
+var demoEndpoints = []string{
+	"https://httpstat.us/201",
+	"https://httpstat.us/302",
+	"https://httpstat.us/404",
+	"https://httpstat.us/418",
+	"https://httpstat.us/503",
+}
+
+// retryDelay returns how long to wait before retrying a request after the given attempt failed:
+// a random duration up to the capped, exponential backoff for the attempt.
+func (c downstreamConfig) retryDelay(attempt int) time.Duration {
+	backoff := c.maxRetryBackoff
+	if shift := attempt - 1; shift < 32 && c.retryBackoff<<shift < backoff {
+		backoff = c.retryBackoff << shift
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff))) + 1
 }
 
-func makeDownstreamRequests(ctx context.Context, httpClient *http.Client) {
+// makeDownstreamRequests calls each of the demo endpoints, returning the errors of any requests
+// that failed. An error status code from an endpoint is not treated as a failure.
+//
+// A request that fails doesn't stop the others, which are independent of it. Once the parent
+// context is cancelled (by a shutdown or the processing timeout), the requests in flight are
+// cancelled and those still pending are skipped. Each skipped request is recorded as an event on
+// the span in ctx.
+func makeDownstreamRequests(ctx context.Context, httpClient *http.Client, cfg downstreamConfig) error {
 	minSleep := 1
 	maxSleep := 3
 
-	// Make some downstream calls
-	urls := []string{
-		"https://httpstat.us/201",
-		"https://httpstat.us/302",
-		"https://httpstat.us/404",
-		"https://httpstat.us/418",
-		"https://httpstat.us/503",
+	urls := cfg.endpoints
+	if len(urls) == 0 {
+		urls = demoEndpoints
+	}
+
+	if cfg.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.deadline)
+		defer cancel()
 	}
 
+	span := trace.SpanFromContext(ctx)
+
+	var mu sync.Mutex
+	var errs []error
+
+	var g errgroup.Group
+	g.SetLimit(cfg.concurrency)
+
 	for _, url := range urls {
 		sleep := rand.Intn(maxSleep-minSleep+1) + minSleep
 		url += fmt.Sprintf("?sleep=%d", sleep*1000)
 
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			fmt.Printf("http request error for %s: %v\n", url, err)
-			continue
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				span.AddEvent("downstream.request.skipped", trace.WithAttributes(
+					attribute.String("url.full", url),
+					appattr.Key("skip.reason").String(err.Error()),
+				))
+				return nil
+			}
+
+			if err := makeDownstreamRequest(ctx, httpClient, url, cfg); err != nil {
+				slog.ErrorContext(ctx, "http request error", "url", url, "error", err)
+
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// makeDownstreamRequest makes a request to one downstream endpoint, retrying as the config
+// allows after a backoff. A retry denied by the retry budget is recorded on the span in ctx. A 5xx
+// response is retried, but isn't returned as an error once the attempts run out.
+func makeDownstreamRequest(ctx context.Context, httpClient *http.Client, url string, cfg downstreamConfig) error {
+	span := trace.SpanFromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		status, err := attemptDownstreamRequest(ctx, httpClient, url, cfg.requestTimeout)
+		if err == nil && status < http.StatusInternalServerError {
+			return nil
+		}
+
+		if attempt >= cfg.maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		if cfg.retryBudget != nil && !cfg.retryBudget.allow() {
+			span.SetAttributes(appattr.Key("retry.budget_exhausted").Bool(true))
+			span.AddEvent("downstream.retry.denied", trace.WithAttributes(attribute.String("url.full", url)))
+			return err
+		}
+
+		select {
+		case <-time.After(cfg.retryDelay(attempt)):
+		case <-ctx.Done():
+			return err
 		}
-		resp.Body.Close()
+
+		span.AddEvent("downstream.request.retry", trace.WithAttributes(
+			attribute.String("url.full", url),
+			appattr.Key("retry.attempt").Int(attempt+1),
+		))
 	}
 }
 
-func writeToS3Bucket(ctx context.Context, s3Client *s3.Client, bucket string) {
-	filename := fmt.Sprintf("%d.txt", time.Now().Unix())
+// attemptDownstreamRequest makes a single attempt at a request, returning the response's status.
+func attemptDownstreamRequest(ctx context.Context, httpClient *http.Client, url string, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
 
-	// buf := // 8192 bytes
-	data := make([]byte, 1<<13)
-	rand.Read(data)
+	return resp.StatusCode, nil
+}
+
+// objectKeyFormat describes how the S3 object keys are built. By default keys are flat,
+// e.g. "1666137600.txt". Well distributed, date partitioned keys avoid hot partitions and
+// make the stored objects browsable by date.
+type objectKeyFormat struct {
+	prefix          string
+	partitionByDate bool
+}
 
-	_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &bucket,
-		Key:    &filename,
-		Body:   bytes.NewBuffer(data),
+func (f objectKeyFormat) key(now time.Time) string {
+	if !f.partitionByDate {
+		return path.Join(f.prefix, fmt.Sprintf("%d.txt", now.Unix()))
+	}
+
+	return path.Join(f.prefix, now.UTC().Format("2006/01/02"), uuid.New().String()+".txt")
+}
+
+func writeToS3Bucket(ctx context.Context, s3Client *s3.Client, bucket string, keyFormat objectKeyFormat, body io.Reader, contentType string, clock Clock, timeout time.Duration) error {
+	filename := keyFormat.key(clock.Now())
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("aws.s3.key", filename))
+
+	err := withOperationTimeout(ctx, timeout, "S3.PutObject", func(ctx context.Context) error {
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      &bucket,
+			Key:         &filename,
+			Body:        body,
+			ContentType: &contentType,
+		})
+		return err
 	})
 	if err != nil {
-		fmt.Printf("s3 put object error: %v\n", err)
+		return fmt.Errorf("s3 put object error: %w", err)
 	}
+
+	return nil
 }
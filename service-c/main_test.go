@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObjectKeyFormat(t *testing.T) {
+	now := time.Date(2022, time.October, 19, 23, 30, 0, 0, time.FixedZone("BST", 3600))
+
+	tests := []struct {
+		name   string
+		format objectKeyFormat
+		want   string
+	}{
+		{name: "flat", want: `^1666218600\.txt$`},
+		{name: "flat with prefix", format: objectKeyFormat{prefix: "orders"}, want: `^orders/1666218600\.txt$`},
+		{name: "partitioned", format: objectKeyFormat{partitionByDate: true}, want: `^2022/10/19/[0-9a-f-]{36}\.txt$`},
+		{
+			name:   "partitioned with prefix",
+			format: objectKeyFormat{prefix: "orders/", partitionByDate: true},
+			want:   `^orders/2022/10/19/[0-9a-f-]{36}\.txt$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format.key(now); !regexp.MustCompile(tt.want).MatchString(got) {
+				t.Errorf("got key %q, want one matching %s", got, tt.want)
+			}
+		})
+	}
+
+	// Partitioned keys are unique, even when written in the same second.
+	partitioned := objectKeyFormat{partitionByDate: true}
+	if a, b := partitioned.key(now), partitioned.key(now); a == b {
+		t.Errorf("got the same key %q twice", a)
+	}
+}
+
+func TestWriteObjectKeyAttribute(t *testing.T) {
+	pt := newPipelineTest(t)
+	pt.poller.handler.(*pipelineHandler).keyFormat = objectKeyFormat{prefix: "orders", partitionByDate: true}
+
+	pt.handle(t, testMessage())
+
+	for _, span := range pt.spans.Ended() {
+		if span.Name() != "Write Object" {
+			continue
+		}
+
+		key, _ := spanAttribute(span, "aws.s3.key")
+		if !regexp.MustCompile(`^orders/\d{4}/\d{2}/\d{2}/[0-9a-f-]{36}\.txt$`).MatchString(key.AsString()) {
+			t.Errorf("got aws.s3.key %q, want a partitioned key under orders/", key.AsString())
+		}
+
+		return
+	}
+
+	t.Error("no Write Object span")
+}
+
+func TestWriteToDynamoDBRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		errorType    string
+		wantRequests int
+		wantRetries  int64
+		wantErr      bool
+	}{
+		{name: "success", wantRequests: 1},
+		{name: "throttled twice", failures: 2, errorType: "ProvisionedThroughputExceededException", wantRequests: 3, wantRetries: 2},
+		{name: "request limit", failures: 1, errorType: "RequestLimitExceeded", wantRequests: 2, wantRetries: 1},
+		{
+			name:         "always throttled",
+			failures:     dynamoMaxAttempts,
+			errorType:    "ProvisionedThroughputExceededException",
+			wantRequests: dynamoMaxAttempts,
+			wantRetries:  dynamoMaxAttempts - 1,
+			wantErr:      true,
+		},
+		{name: "not retryable", failures: 1, errorType: "ValidationException", wantRequests: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				response := fakeResponse{status: http.StatusOK, body: "{}"}
+				if requests <= tt.failures {
+					response = dynamoError(tt.errorType)
+				}
+
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				w.WriteHeader(response.status)
+				_, _ = w.Write([]byte(response.body))
+			}))
+			t.Cleanup(server.Close)
+
+			// The SDK's own retries are disabled, so only writeToDynamoDB retries.
+			client := dynamodb.New(dynamodb.Options{
+				Region:       "eu-west-1",
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  aws.AnonymousCredentials{},
+				Retryer:      aws.NopRetryer{},
+			})
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "Process Message")
+
+			err := writeToDynamoDB(ctx, client, "orders", "abc", time.Second)
+			span.End()
+
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, tt.wantRequests)
+			}
+
+			retries, ok := spanAttribute(recorder.Ended()[0], "db.retry.count")
+			if !ok || retries.AsInt64() != tt.wantRetries {
+				t.Errorf("got db.retry.count %v, want %d", retries.Emit(), tt.wantRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// BodyGenerator generates the body of the S3 object written for a message, and its content type.
+type BodyGenerator interface {
+	Generate(message sqsTypes.Message) (io.Reader, string, error)
+}
+
+// newBodyGenerator returns the generator for a format from S3_BODY_FORMAT: "random" (the
+// default) or "json".
+func newBodyGenerator(format string) (BodyGenerator, error) {
+	switch format {
+	case "", "random":
+		return randomBody{size: 1 << 13}, nil
+	case "json":
+		return jsonBody{}, nil
+	default:
+		return nil, fmt.Errorf("unknown body format %q", format)
+	}
+}
+
+// randomBody generates size bytes of random data, whatever the message.
+type randomBody struct {
+	size int
+}
+
+func (g randomBody) Generate(sqsTypes.Message) (io.Reader, string, error) {
+	data := make([]byte, g.size)
+	rand.Read(data)
+
+	return bytes.NewReader(data), "application/octet-stream", nil
+}
+
+// jsonBody generates a JSON document recording the message, so the stored object reflects the
+// transaction that was processed.
+type jsonBody struct{}
+
+func (jsonBody) Generate(message sqsTypes.Message) (io.Reader, string, error) {
+	document := struct {
+		MessageID   string `json:"messageId"`
+		Transaction any    `json:"transaction"`
+	}{
+		MessageID: derefString(message.MessageId),
+	}
+
+	// The body from service-b is a JSON transaction record, which is embedded as it is. Any
+	// other body is kept as a string.
+	body := derefString(message.Body)
+	if json.Valid([]byte(body)) {
+		document.Transaction = json.RawMessage(body)
+	} else {
+		document.Transaction = body
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encoding object body: %w", err)
+	}
+
+	return bytes.NewReader(data), "application/json", nil
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestBodyGenerators(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		body            string
+		wantBody        string
+		wantContentType string
+		wantSize        int
+		wantErr         bool
+	}{
+		{name: "default", wantContentType: "application/octet-stream", wantSize: 1 << 13},
+		{name: "random", format: "random", wantContentType: "application/octet-stream", wantSize: 1 << 13},
+		{
+			name:            "json transaction",
+			format:          "json",
+			body:            `{"transactionId":"abc"}`,
+			wantBody:        `{"messageId":"c5a1e2b4-7e0f-4c1d-9a61-1f6d2f0e8b3a","transaction":{"transactionId":"abc"}}`,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "json with a plain body",
+			format:          "json",
+			body:            "abc",
+			wantBody:        `{"messageId":"c5a1e2b4-7e0f-4c1d-9a61-1f6d2f0e8b3a","transaction":"abc"}`,
+			wantContentType: "application/json",
+		},
+		{name: "unknown", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := newBodyGenerator(tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %T, want an error", generator)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The object is uploaded to a fake S3, which records what it was sent.
+			var uploaded []byte
+			var contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				uploaded, _ = io.ReadAll(r.Body)
+				contentType = r.Header.Get("Content-Type")
+			}))
+			t.Cleanup(server.Close)
+
+			client := newS3Client(aws.Config{
+				Region:       "eu-west-1",
+				BaseEndpoint: aws.String(server.URL),
+				Credentials:  aws.AnonymousCredentials{},
+			})
+
+			message := testMessage()
+			if tt.body != "" {
+				message.Body = aws.String(tt.body)
+			}
+
+			body, bodyContentType, err := generator.Generate(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeToS3Bucket(context.Background(), client, "orders", objectKeyFormat{}, body, bodyContentType, systemClock{}, time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			if contentType != tt.wantContentType {
+				t.Errorf("got content type %q, want %q", contentType, tt.wantContentType)
+			}
+
+			if tt.wantBody != "" && string(uploaded) != tt.wantBody {
+				t.Errorf("got body %s, want %s", uploaded, tt.wantBody)
+			}
+
+			if tt.wantSize != 0 && len(uploaded) != tt.wantSize {
+				t.Errorf("got a body of %d bytes, want %d", len(uploaded), tt.wantSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/delay"
+	"shared/messaging"
+	"shared/requestid"
+	"shared/telemetry"
+)
+
+// Poller receives messages from an SQS queue and processes them.
+type Poller struct {
+	sqsClient         *sqs.Client
+	queueURL          string
+	processingTimeout time.Duration
+
+	// queueName identifies the queue on the poller's spans and metrics.
+	queueName string
+
+	// handler processes each received message.
+	handler MessageHandler
+
+	// operationTimeout bounds each individual AWS call the poller makes, such as deleting a
+	// message.
+	operationTimeout time.Duration
+
+	// tracePolls creates a span for every receive, including the empty long-polls. It's off by
+	// default as an idle poller produces one span every WaitTimeSeconds.
+	tracePolls bool
+
+	// waitTime is the long-poll duration of each receive, in seconds.
+	waitTime int32
+
+	// maxMessages is the most messages each receive returns. The batch is processed in order.
+	maxMessages int32
+
+	// emptyReceiveSleep is how long to wait after a receive returns no messages. It only
+	// matters when waitTime is short, as a long-poll already stops the loop spinning.
+	emptyReceiveSleep time.Duration
+
+	// inFlight counts the messages currently being processed.
+	inFlight atomic.Int64
+
+	// batchSize records the number of messages returned by each receive.
+	batchSize metric.Int64Histogram
+
+	// state is the poller's pollerState.
+	state atomic.Int32
+
+	// clock tells the time when timing receives and recording lifecycle events.
+	clock Clock
+
+	// receiveAttributes are the attribute names requested with each received message.
+	receiveAttributes receiveAttributes
+
+	// delay is injected before each message is handled, to shape the trace for a demo.
+	delay delay.Delay
+
+	// processed, if set, remembers the recently processed messages, so their redeliveries are
+	// skipped. duplicates counts the messages skipped.
+	processed  *processedCache
+	duplicates metric.Int64Counter
+
+	// retainMalformed leaves malformed messages on the queue, for its redrive policy to move to
+	// the dead-letter queue, rather than deleting them. malformed counts them.
+	retainMalformed bool
+	malformed       metric.Int64Counter
+
+	// failures counts the messages that failed processing, by the stage that failed and whether
+	// the failure is retried.
+	failures metric.Int64Counter
+
+	// maxReceiveCount is the maxReceiveCount of the queue's redrive policy, if known, so that a
+	// message left on the queue for the last time is logged as moving to the dead-letter queue.
+	maxReceiveCount int
+
+	// endToEnd records the time from the checkout starting to its message being processed.
+	endToEnd metric.Float64Histogram
+
+	// coldStart marks the span of the first message the service processes. It's shared by every
+	// queue's poller.
+	coldStart *telemetry.ColdStart
+}
+
+// pollerState tracks the poller through a two-phase shutdown. A running poller receives and
+// processes messages. Once draining it stops receiving, but lets the message in flight finish,
+// unless the shutdown is forced. It's stopped once Run returns.
+type pollerState int32
+
+const (
+	stateRunning pollerState = iota
+	stateDraining
+	stateStopped
+)
+
+func (s pollerState) String() string {
+	switch s {
+	case stateRunning:
+		return "running"
+	case stateDraining:
+		return "draining"
+	default:
+		return "stopped"
+	}
+}
+
+// transition moves the poller to the next state. States only move forward, so a late
+// transition to draining can't undo the poller having stopped.
+func (p *Poller) transition(to pollerState) {
+	for {
+		from := pollerState(p.state.Load())
+		if from >= to {
+			return
+		}
+
+		if p.state.CompareAndSwap(int32(from), int32(to)) {
+			slog.Info("poller state changed", "from", from.String(), "to", to.String())
+			return
+		}
+	}
+}
+
+// registerMetrics registers the poller's instruments with the meter.
+func (p *Poller) registerMetrics(meter metric.Meter) error {
+	_, err := meter.Int64ObservableGauge(
+		"sqs.messages.in_flight",
+		metric.WithDescription("The number of SQS messages currently being processed."),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(p.InFlight(), p.queueAttributes())
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	// The buckets cover every batch size a receive can return, so the fill rate is exact.
+	p.batchSize, err = meter.Int64Histogram(
+		"sqs.receive.batch_size",
+		metric.WithDescription("The number of messages returned by each SQS receive."),
+		metric.WithUnit("{message}"),
+		metric.WithExplicitBucketBoundaries(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.duplicates, err = meter.Int64Counter(
+		"sqs.messages.duplicates_skipped",
+		metric.WithDescription("The number of redelivered SQS messages skipped as already processed."),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.malformed, err = meter.Int64Counter(
+		"sqs.messages.malformed",
+		metric.WithDescription("The number of SQS messages received that were malformed and couldn't be processed."),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.failures, err = meter.Int64Counter(
+		"sqs.messages.failed",
+		metric.WithDescription("The number of SQS messages that failed processing."),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	p.endToEnd, err = meter.Float64Histogram(
+		"order.end_to_end.duration",
+		metric.WithDescription("The time from a checkout starting in service-a to its message being processed."),
+		metric.WithUnit("s"),
+	)
+
+	return err
+}
+
+// queueAttributes identifies the poller's queue on its metrics.
+func (p *Poller) queueAttributes() metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String("messaging.destination.name", p.queueName))
+}
+
+// InFlight returns the number of messages currently being processed.
+func (p *Poller) InFlight() int64 {
+	return p.inFlight.Load()
+}
+
+// Draining reports whether the poller has stopped receiving new messages.
+func (p *Poller) Draining() bool {
+	return pollerState(p.state.Load()) != stateRunning
+}
+
+// Run polls the queue until ctx is cancelled, and shuts down in two phases. Cancelling ctx
+// starts draining: no new messages are received, but a message that is already being processed
+// is allowed to finish. Cancelling work forces the shutdown, aborting that message's processing
+// so it is redelivered later.
+func (p *Poller) Run(ctx, work context.Context) {
+	defer p.transition(stateStopped)
+
+	// Flip to draining as soon as the shutdown starts, rather than once the in-flight message
+	// has finished, so readiness reports it straight away.
+	stopDraining := context.AfterFunc(ctx, func() { p.transition(stateDraining) })
+	defer stopDraining()
+
+	sqsReceiveMessageInput := sqs.ReceiveMessageInput{
+		QueueUrl:            &p.queueURL,
+		MaxNumberOfMessages: p.maxMessages,
+		WaitTimeSeconds:     p.waitTime,
+	}
+	p.receiveAttributes.apply(&sqsReceiveMessageInput)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.DebugContext(ctx, "receiving message")
+		output, poll, err := p.receive(ctx, &sqsReceiveMessageInput)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			slog.ErrorContext(ctx, "error receiving sqs message", "error", err)
+			return
+		}
+
+		if len(output.Messages) == 0 {
+			if p.emptyReceiveSleep > 0 {
+				select {
+				case <-p.clock.After(p.emptyReceiveSleep):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			continue
+		}
+
+		// Once received, the messages are processed and deleted even if draining begins, and are
+		// only abandoned if the shutdown is forced.
+		for _, message := range output.Messages {
+			p.handleMessage(work, message, poll)
+		}
+	}
+}
+
+// receive makes a single ReceiveMessage call. When poll tracing is enabled the call is wrapped
+// in a Poll span, whose span context is returned so the processing spans can link back to it.
+//
+// The number of messages received is recorded in the batch size histogram. Empty receives are
+// only recorded when polls are traced, as otherwise an idle poller would swamp the histogram
+// with zeros.
+func (p *Poller) receive(ctx context.Context, input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, trace.SpanContext, error) {
+	if !p.tracePolls {
+		output, err := p.sqsClient.ReceiveMessage(ctx, input)
+		if err == nil && len(output.Messages) > 0 {
+			p.batchSize.Record(ctx, int64(len(output.Messages)), p.queueAttributes())
+		}
+
+		return output, trace.SpanContext{}, err
+	}
+
+	ctx, span := tracer(componentSQS).Start(ctx, "Poll",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", p.queueName)),
+	)
+	defer span.End()
+
+	start := p.clock.Now()
+	output, err := p.sqsClient.ReceiveMessage(ctx, input)
+
+	span.SetAttributes(appattr.Key("poll.wait_duration_ms").Int64(p.clock.Since(start).Milliseconds()))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error receiving sqs message")
+		return nil, span.SpanContext(), err
+	}
+
+	span.SetAttributes(
+		attribute.Int("messaging.batch.message_count", len(output.Messages)),
+		appattr.Key("poll.empty").Bool(len(output.Messages) == 0),
+	)
+	p.batchSize.Record(ctx, int64(len(output.Messages)), p.queueAttributes())
+
+	return output, span.SpanContext(), nil
+}
+
+// The events recorded on the Process Message span as a message moves through its lifecycle.
+const (
+	eventMessageReceived            = "message.received"
+	eventMessageProcessingStarted   = "message.processing.started"
+	eventMessageProcessingCompleted = "message.processing.completed"
+	eventMessageProcessingFailed    = "message.processing.failed"
+	eventMessageDeleted             = "message.deleted"
+	eventMessageMalformed           = "message.malformed"
+)
+
+// malformedReason returns why the message can't be processed, or "" if it can.
+func malformedReason(message sqsTypes.Message) string {
+	switch {
+	case message.MessageId == nil || *message.MessageId == "":
+		return "missing message id"
+	case message.Body == nil || *message.Body == "":
+		return "empty body"
+	default:
+		return ""
+	}
+}
+
+func (p *Poller) handleMessage(ctx context.Context, message sqsTypes.Message, poll trace.SpanContext) {
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	// The span covers the message's whole lifecycle, from being received to being deleted, which
+	// is marked by events on the span.
+	ctx, span := p.startMessageSpan(ctx, message, poll)
+	defer span.End()
+
+	id := derefString(message.MessageId)
+
+	// A message's request ID is its message ID, which correlates its logs like a request's.
+	ctx = requestid.NewContext(ctx, id)
+	span.SetAttributes(requestid.Key().String(id))
+
+	p.addEvent(span, eventMessageReceived)
+
+	// Whatever becomes of the message, a single line summarising it is logged once it's handled.
+	result := &messageResult{start: p.clock.Now()}
+	ctx = contextWithStageResults(ctx, &result.stages)
+	defer p.logResult(ctx, message, result)
+
+	// A malformed message can't be processed, however many times it's redelivered.
+	if reason := malformedReason(message); reason != "" {
+		p.addEvent(span, eventMessageMalformed, appattr.Key("malformed.reason").String(reason))
+		p.malformed.Add(ctx, 1, p.queueAttributes())
+		slog.WarnContext(ctx, "received malformed message", "message.id", id, "reason", reason, "retained", p.retainMalformed)
+		result.outcome = outcomeMalformed
+
+		if !p.retainMalformed {
+			result.deleted = p.deleteMessage(ctx, span, message)
+		}
+
+		return
+	}
+
+	slog.DebugContext(ctx, "processing message", "message.id", id)
+
+	result.outcome, result.err = p.processMessage(ctx, span, message)
+	if err := result.err; err != nil {
+		slog.ErrorContext(ctx, "error processing message", "message.id", id, "error", err)
+
+		// Leave a retryable failure on the queue so it is redelivered once the visibility timeout
+		// expires. A terminal failure would fail the same way again, so it's deleted instead.
+		var processingErr *ProcessingError
+		if !errors.As(err, &processingErr) || processingErr.Retryable {
+			return
+		}
+	}
+
+	result.deleted = p.deleteMessage(ctx, span, message)
+}
+
+// deleteMessage deletes the message from the queue once it needs no further processing. It
+// reports whether the message was deleted.
+func (p *Poller) deleteMessage(ctx context.Context, span trace.Span, message sqsTypes.Message) bool {
+	id := derefString(message.MessageId)
+
+	if message.ReceiptHandle == nil {
+		slog.ErrorContext(ctx, "unable to delete message without a receipt handle", "message.id", id)
+		return false
+	}
+
+	slog.DebugContext(ctx, "deleting message", "message.id", id)
+
+	err := withOperationTimeout(ctx, p.operationTimeout, "SQS.DeleteMessage", func(ctx context.Context) error {
+		_, err := p.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      &p.queueURL,
+			ReceiptHandle: message.ReceiptHandle,
+		})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error deleting message", "message.id", id, "error", err)
+		return false
+	}
+
+	p.addEvent(span, eventMessageDeleted)
+
+	return true
+}
+
+// startMessageSpan starts the Process Message span, continuing the trace propagated by the
+// producer.
+func (p *Poller) startMessageSpan(ctx context.Context, message sqsTypes.Message, poll trace.SpanContext) (context.Context, trace.Span) {
+	// Extracts the Tracing information from the SQS message and injects it to the context
+	ctx = propagateTraceFromSQSMessage(ctx, message)
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingMessageIDKey.String(derefString(message.MessageId)),
+			attribute.String("messaging.destination.name", p.queueName),
+			messaging.PayloadSize(message.Body),
+		),
+	}
+
+	// The message's parent is the producer's span, so the Poll span that received it is
+	// attached as a link instead.
+	if poll.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: poll}))
+	}
+
+	// A message from a producer that isn't instrumented carries no trace context, so its span
+	// starts a new trace. It's flagged, so gaps in the propagation are easy to find.
+	orphan := !trace.SpanContextFromContext(ctx).IsValid()
+	if orphan {
+		opts = append(opts, trace.WithAttributes(appattr.Key("messaging.trace.orphan").Bool(true)))
+	}
+
+	ctx, span := tracer(componentSQS).Start(ctx, "Process Message", opts...)
+
+	if orphan {
+		slog.DebugContext(ctx, "message has no trace context, starting a new trace", "message.id", derefString(message.MessageId))
+	}
+
+	p.coldStart.Mark(span)
+
+	return ctx, span
+}
+
+// processMessage has the handler process the message, unless it needs no processing, returning
+// the outcome along with any error.
+func (p *Poller) processMessage(ctx context.Context, span trace.Span, message sqsTypes.Message) (messageOutcome, error) {
+	// Malformed messages are rejected before they're processed, so the message has an ID.
+	id := *message.MessageId
+
+	// All child operations inherit this deadline, so they are aborted once it is exceeded.
+	ctx, cancel := context.WithTimeout(ctx, p.processingTimeout)
+	defer cancel()
+
+	// Let the handler tag its own telemetry with the queue the message came from.
+	ctx = contextWithQueueName(ctx, p.queueName)
+
+	// Copy any baggage propagated by the producer onto the span so it is searchable in the backend.
+	span.SetAttributes(baggageAttributes(ctx)...)
+
+	// Record the service that produced the message, and name this one as the caller of the
+	// downstream requests.
+	if caller, ok := telemetry.CallerFromContext(ctx); ok {
+		span.SetAttributes(telemetry.CallerKey().String(caller))
+	}
+
+	ctx = telemetry.ContextWithCaller(ctx, serviceName)
+
+	// A message redelivered soon after it was processed, e.g. because the delete failed, has
+	// nothing left to do. It's deleted without being processed again.
+	if p.processed != nil && p.processed.contains(id) {
+		span.SetAttributes(appattr.Key("idempotent.cache_hit").Bool(true))
+		p.duplicates.Add(ctx, 1, p.queueAttributes())
+		slog.InfoContext(ctx, "skipping message that was already processed", "message.id", id)
+		return outcomeSkipped, nil
+	}
+
+	// The message can wait in the queue for longer than the request that produced it was willing
+	// to wait, in which case nobody is waiting for the result and it's skipped. Otherwise the
+	// propagated deadline bounds the processing, as well as the processing timeout.
+	timedOut := fmt.Sprintf("processing timed out after %s", p.processingTimeout)
+	if deadline, ok := telemetry.DeadlineFromContext(ctx); ok {
+		if !p.clock.Now().Before(deadline) {
+			span.SetAttributes(appattr.Key("deadline.exceeded_on_arrival").Bool(true))
+			slog.InfoContext(ctx, "skipping message whose deadline has passed", "message.id", id, "deadline", deadline)
+			return outcomeSkipped, nil
+		}
+
+		if processingDeadline, _ := ctx.Deadline(); deadline.Before(processingDeadline) {
+			timedOut = fmt.Sprintf("processing passed the propagated deadline of %s", deadline.Format(time.RFC3339Nano))
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	p.addEvent(span, eventMessageProcessingStarted)
+
+	// Any artificial delay configured for the demo counts towards the processing timeout.
+	err := p.delay.Inject(ctx)
+	if err == nil {
+		err = p.handler.Handle(ctx, message)
+	}
+
+	// A handler that overruns its deadline fails as a timeout, whatever it returned. The error
+	// names whichever deadline was the earlier: the processing timeout or the propagated one.
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		span.SetAttributes(appattr.Key("timeout").Bool(true))
+		err = newProcessingError(stageTimeout, fmt.Errorf("%s: %w", timedOut, ctx.Err()))
+	}
+
+	if err != nil {
+		p.addEvent(span, eventMessageProcessingFailed)
+
+		var processingErr *ProcessingError
+		if errors.As(err, &processingErr) {
+			span.SetAttributes(processingErr.attributes()...)
+			p.failures.Add(ctx, 1, p.queueAttributes(), metric.WithAttributes(processingErr.attributes()...))
+		} else {
+			p.failures.Add(ctx, 1, p.queueAttributes())
+		}
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "message processing failed")
+		return outcomeFailed, err
+	}
+
+	p.addEvent(span, eventMessageProcessingCompleted)
+	p.recordEndToEnd(ctx)
+
+	if p.processed != nil {
+		p.processed.add(id)
+	}
+
+	return outcomeSucceeded, nil
+}
+
+// recordEndToEnd records the time since the checkout that produced the message started, if its
+// start time was propagated. The start time was taken by another host's clock, so a negative
+// duration, from the clocks being skewed, is recorded as zero.
+func (p *Poller) recordEndToEnd(ctx context.Context) {
+	start, ok := telemetry.CheckoutStartFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	d := p.clock.Since(start)
+	if d < 0 {
+		slog.WarnContext(ctx, "checkout started in the future, the hosts' clocks are skewed", "skew", (-d).String())
+		d = 0
+	}
+
+	p.endToEnd.Record(ctx, d.Seconds(), p.queueAttributes())
+}
+
+// addEvent records a lifecycle event on the message's span, timestamped by the poller's clock.
+func (p *Poller) addEvent(span trace.Span, name string, attrs ...attribute.KeyValue) {
+	span.AddEvent(name, trace.WithTimestamp(p.clock.Now()), trace.WithAttributes(attrs...))
+}
+
+// pollerGroup runs a Poller for each of several queues, processing their messages concurrently.
+type pollerGroup []*Poller
+
+// Run runs every poller until they have all returned. Shutdown is coordinated through ctx and
+// work, which every poller shares: see Poller.Run.
+func (g pollerGroup) Run(ctx, work context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range g {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(ctx, work)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// InFlight returns the number of messages currently being processed across all the queues.
+func (g pollerGroup) InFlight() int64 {
+	var n int64
+	for _, p := range g {
+		n += p.InFlight()
+	}
+
+	return n
+}
+
+// Draining reports whether any of the pollers has stopped receiving new messages.
+func (g pollerGroup) Draining() bool {
+	for _, p := range g {
+		if p.Draining() {
+			return true
+		}
+	}
+
+	return false
+}
+
+type queueNameKey struct{}
+
+// contextWithQueueName returns a copy of ctx carrying the name of the queue the message being
+// processed was received from.
+func contextWithQueueName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queueNameKey{}, name)
+}
+
+// queueNameFromContext returns the name of the queue the message being processed was received
+// from, or "" if there isn't one.
+func queueNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(queueNameKey{}).(string)
+	return name
+}
@@ -0,0 +1,1307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+	"shared/messaging"
+	"shared/requestid"
+)
+
+// fakeSQS is an SQS endpoint that records the actions it's called with, answering each with an
+// empty response, except that every receive returns the messages.
+type fakeSQS struct {
+	mu       sync.Mutex
+	actions  []string
+	messages []sqsTypes.Message
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+
+	f.mu.Lock()
+	f.actions = append(f.actions, action)
+	output := sqs.ReceiveMessageOutput{Messages: f.messages}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if action == "ReceiveMessage" {
+		_ = json.NewEncoder(w).Encode(output)
+		return
+	}
+
+	_, _ = w.Write([]byte("{}"))
+}
+
+// receive has every receive return the messages.
+func (f *fakeSQS) receive(messages ...sqsTypes.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = messages
+}
+
+// called reports whether the action was called.
+func (f *fakeSQS) called(action string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, a := range f.actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// count returns how many times the action was called.
+func (f *fakeSQS) count(action string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	for _, a := range f.actions {
+		if a == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+// handlerFunc adapts a function to a MessageHandler.
+type handlerFunc func(ctx context.Context, message sqsTypes.Message) error
+
+func (f handlerFunc) Handle(ctx context.Context, message sqsTypes.Message) error {
+	return f(ctx, message)
+}
+
+// pollerTest is a Poller wired to a fake SQS endpoint, with its spans and metrics recorded.
+type pollerTest struct {
+	poller  *Poller
+	sqs     *fakeSQS
+	spans   *tracetest.SpanRecorder
+	metrics *sdkmetric.ManualReader
+}
+
+func newPollerTest(t *testing.T, handler MessageHandler) *pollerTest {
+	t.Helper()
+
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	fake := &fakeSQS{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := sqs.New(sqs.Options{
+		Region:                           "eu-west-1",
+		BaseEndpoint:                     aws.String(server.URL),
+		Credentials:                      aws.AnonymousCredentials{},
+		DisableMessageChecksumValidation: true,
+	})
+
+	const queueURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/orders"
+
+	p := &Poller{
+		sqsClient:         client,
+		queueURL:          queueURL,
+		queueName:         "orders",
+		processingTimeout: time.Second,
+		operationTimeout:  time.Second,
+		handler:           handler,
+		clock:             systemClock{},
+	}
+
+	metrics := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)).Meter("test")
+	if err := p.registerMetrics(meter); err != nil {
+		t.Fatal(err)
+	}
+
+	return &pollerTest{poller: p, sqs: fake, spans: spans, metrics: metrics}
+}
+
+// handle has the poller handle a message, returning its Process Message span.
+func (pt *pollerTest) handle(t *testing.T, message sqsTypes.Message) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	pt.poller.handleMessage(context.Background(), message, trace.SpanContext{})
+
+	for _, span := range pt.spans.Ended() {
+		if span.Name() == "Process Message" {
+			return span
+		}
+	}
+
+	t.Fatal("no Process Message span")
+	return nil
+}
+
+// counter returns the data points of the named counter.
+func (pt *pollerTest) counter(t *testing.T, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := pt.metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data.(metricdata.Sum[int64]).DataPoints
+			}
+		}
+	}
+
+	return nil
+}
+
+// testMessage returns a well formed message.
+func testMessage() sqsTypes.Message {
+	return sqsTypes.Message{
+		MessageId:     aws.String("c5a1e2b4-7e0f-4c1d-9a61-1f6d2f0e8b3a"),
+		Body:          aws.String(`{"transactionId":"abc"}`),
+		ReceiptHandle: aws.String("receipt"),
+	}
+}
+
+// spanAttribute returns the value of the span's attribute with the given key.
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return attribute.Value{}, false
+}
+
+// TestPollerClassifiesFailures checks what becomes of a message for each way the handler can fail.
+func TestPollerClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantDeleted bool
+		wantStage   string
+		wantRetry   bool
+	}{
+		{name: "success", wantDeleted: true},
+		{
+			name:      "retryable",
+			err:       newProcessingError(stageDynamo, context.DeadlineExceeded),
+			wantStage: "dynamo",
+			wantRetry: true,
+		},
+		{
+			name:        "terminal",
+			err:         newProcessingError(stageS3, &sqsTypes.QueueDoesNotExist{Message: aws.String("no bucket")}),
+			wantDeleted: true,
+			wantStage:   "s3",
+		},
+		{
+			name:        "downstream",
+			err:         newProcessingError(stageDownstream, &json.SyntaxError{}),
+			wantDeleted: true,
+			wantStage:   "downstream",
+		},
+		{
+			name: "unclassified",
+			err:  context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return tt.err }))
+
+			span := pt.handle(t, testMessage())
+
+			if got := pt.sqs.called("DeleteMessage"); got != tt.wantDeleted {
+				t.Errorf("got deleted %t, want %t", got, tt.wantDeleted)
+			}
+
+			stage, ok := spanAttribute(span, "processing.error.stage")
+			if stage.AsString() != tt.wantStage {
+				t.Errorf("got processing.error.stage %q, want %q", stage.AsString(), tt.wantStage)
+			}
+
+			if retryable, _ := spanAttribute(span, "processing.error.retryable"); ok && retryable.AsBool() != tt.wantRetry {
+				t.Errorf("got processing.error.retryable %t, want %t", retryable.AsBool(), tt.wantRetry)
+			}
+
+			var failures int64
+			for _, dp := range pt.counter(t, "sqs.messages.failed") {
+				failures += dp.Value
+			}
+
+			var want int64
+			if tt.err != nil {
+				want = 1
+			}
+
+			if failures != want {
+				t.Errorf("got %d failures counted, want %d", failures, want)
+			}
+		})
+	}
+}
+
+// contextWithPropagatedDeadline returns a context whose baggage carries the deadline, as if it had
+// been propagated with the message.
+func contextWithPropagatedDeadline(t *testing.T, deadline time.Time) context.Context {
+	t.Helper()
+
+	member, err := baggage.NewMember("deadline", strconv.FormatInt(deadline.UnixMilli(), 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+// TestProcessMessageDeadlines checks that processing stops at the earlier of the processing
+// timeout and the propagated deadline, naming the one that fired, and that a message whose
+// deadline has already passed is skipped.
+func TestProcessMessageDeadlines(t *testing.T) {
+	const processingTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		propagated  time.Duration
+		wantOutcome messageOutcome
+		wantErr     string
+		wantSkipped bool
+	}{
+		{name: "processing timeout", wantOutcome: outcomeFailed, wantErr: "processing timed out after 100ms"},
+		{name: "later propagated deadline", propagated: time.Minute, wantOutcome: outcomeFailed, wantErr: "processing timed out after 100ms"},
+		{name: "earlier propagated deadline", propagated: 20 * time.Millisecond, wantOutcome: outcomeFailed, wantErr: "propagated deadline"},
+		{name: "expired on arrival", propagated: -time.Second, wantOutcome: outcomeSkipped, wantSkipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled bool
+			pt := newPollerTest(t, handlerFunc(func(ctx context.Context, _ sqsTypes.Message) error {
+				handled = true
+				<-ctx.Done()
+				return ctx.Err()
+			}))
+			pt.poller.processingTimeout = processingTimeout
+
+			ctx := context.Background()
+			if tt.propagated != 0 {
+				ctx = contextWithPropagatedDeadline(t, time.Now().Add(tt.propagated))
+			}
+
+			ctx, span := otel.Tracer("test").Start(ctx, "Process Message")
+			outcome, err := pt.poller.processMessage(ctx, span, testMessage())
+			span.End()
+
+			if outcome != tt.wantOutcome {
+				t.Errorf("got outcome %q, want %q", outcome, tt.wantOutcome)
+			}
+
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+
+			if handled == tt.wantSkipped {
+				t.Errorf("got handled %t, want %t", handled, !tt.wantSkipped)
+			}
+
+			exceeded, _ := spanAttribute(pt.spans.Ended()[0], "deadline.exceeded_on_arrival")
+			if exceeded.AsBool() != tt.wantSkipped {
+				t.Errorf("got deadline.exceeded_on_arrival %t, want %t", exceeded.AsBool(), tt.wantSkipped)
+			}
+		})
+	}
+}
+
+// withPropagators registers the propagators globally as main does, for the rest of the test.
+func withPropagators(t *testing.T) {
+	t.Helper()
+
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(xray.Propagator{}, propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+}
+
+// TestBaggageAttributes checks that the baggage carried in a message's attributes is recorded
+// on its span, each member prefixed with "baggage.".
+func TestBaggageAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		baggage string
+		want    map[attribute.Key]string
+	}{
+		{name: "none"},
+		{
+			name:    "members",
+			baggage: "transaction.id=abc,user.agent=curl%2F8.0",
+			want: map[attribute.Key]string{
+				"baggage.transaction.id": "abc",
+				"baggage.user.agent":     "curl/8.0",
+			},
+		},
+		{name: "malformed", baggage: "=;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPropagators(t)
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+
+			message := testMessage()
+			if tt.baggage != "" {
+				message.MessageAttributes = map[string]sqsTypes.MessageAttributeValue{
+					baggageMessageAttribute: {DataType: aws.String("String"), StringValue: aws.String(tt.baggage)},
+				}
+			}
+
+			span := pt.handle(t, message)
+
+			got := make(map[attribute.Key]string)
+			for _, kv := range span.Attributes() {
+				if strings.HasPrefix(string(kv.Key), "baggage.") {
+					got[kv.Key] = kv.Value.AsString()
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("got baggage attributes %v, want %v", got, tt.want)
+			}
+
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("got %s %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+// TestProcessingTimeout checks that a handler overrunning the processing timeout fails the
+// message as a timeout, leaving it on the queue to be redelivered, whether or not the handler
+// gives up when its context is done.
+func TestProcessingTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler handlerFunc
+	}{
+		{
+			name: "handler gives up",
+			handler: func(ctx context.Context, _ sqsTypes.Message) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+		{
+			name: "handler finishes late",
+			handler: func(ctx context.Context, _ sqsTypes.Message) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, tt.handler)
+			pt.poller.processingTimeout = 20 * time.Millisecond
+
+			span := pt.handle(t, testMessage())
+
+			if pt.sqs.called("DeleteMessage") {
+				t.Error("the message was deleted, want it left to be redelivered")
+			}
+
+			if span.Status().Code != codes.Error {
+				t.Errorf("got status %v, want an error", span.Status())
+			}
+
+			if timeout, _ := spanAttribute(span, "timeout"); !timeout.AsBool() {
+				t.Error("got no timeout attribute")
+			}
+
+			if stage, _ := spanAttribute(span, "processing.error.stage"); stage.AsString() != string(stageTimeout) {
+				t.Errorf("got processing.error.stage %q, want %q", stage.AsString(), stageTimeout)
+			}
+		})
+	}
+}
+
+// gauge returns the data points of the named gauge.
+func (pt *pollerTest) gauge(t *testing.T, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := pt.metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data.(metricdata.Gauge[int64]).DataPoints
+			}
+		}
+	}
+
+	return nil
+}
+
+// TestInFlight checks that the in-flight count covers a message while it's being handled, and
+// returns to zero once the message has been handled, however that ends.
+func TestInFlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		message func() sqsTypes.Message
+		err     error
+		handled bool
+	}{
+		{name: "success", message: testMessage, handled: true},
+		{name: "failure", message: testMessage, err: newProcessingError(stageDynamo, context.DeadlineExceeded), handled: true},
+		{
+			name: "malformed",
+			message: func() sqsTypes.Message {
+				m := testMessage()
+				m.Body = nil
+				return m
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pt *pollerTest
+			var during int64 = -1
+			var observed []metricdata.DataPoint[int64]
+			pt = newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error {
+				during = pt.poller.InFlight()
+				observed = pt.gauge(t, "sqs.messages.in_flight")
+				return tt.err
+			}))
+
+			const batch = 3
+			for range batch {
+				pt.handle(t, tt.message())
+			}
+
+			if tt.handled {
+				if during != 1 {
+					t.Errorf("got %d in flight while handling, want 1", during)
+				}
+
+				if len(observed) != 1 || observed[0].Value != 1 {
+					t.Errorf("got in-flight gauge %v while handling, want 1", observed)
+				}
+			} else if during != -1 {
+				t.Error("got malformed message handled, want it skipped")
+			}
+
+			if got := pt.poller.InFlight(); got != 0 {
+				t.Errorf("got %d in flight after the batch, want 0", got)
+			}
+
+			dps := pt.gauge(t, "sqs.messages.in_flight")
+			if len(dps) != 1 || dps[0].Value != 0 {
+				t.Fatalf("got in-flight gauge %v after the batch, want 0", dps)
+			}
+
+			if queue, _ := dps[0].Attributes.Value("messaging.destination.name"); queue.AsString() != "orders" {
+				t.Errorf("got messaging.destination.name %q, want %q", queue.AsString(), "orders")
+			}
+		})
+	}
+}
+
+func TestPayloadSizeAttribute(t *testing.T) {
+	tests := []struct {
+		name string
+		body *string
+		want int64
+	}{
+		{name: "body", body: aws.String(`{"transactionId":"abc"}`), want: 23},
+		{name: "nil body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+
+			message := testMessage()
+			message.Body = tt.body
+			span := pt.handle(t, message)
+
+			got, ok := spanAttribute(span, messaging.PayloadSizeKey)
+			if !ok {
+				t.Fatalf("got no %s attribute", messaging.PayloadSizeKey)
+			}
+
+			if got.AsInt64() != tt.want {
+				t.Errorf("got %s %d, want %d", messaging.PayloadSizeKey, got.AsInt64(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPollSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		tracePolls bool
+		messages   int
+	}{
+		{name: "off", messages: 1},
+		{name: "off and empty"},
+		{name: "on", tracePolls: true, messages: 2},
+		{name: "on and empty", tracePolls: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+			pt.poller.tracePolls = tt.tracePolls
+
+			var output sqs.ReceiveMessageOutput
+			for i := range tt.messages {
+				message := testMessage()
+				message.MessageId = aws.String(strconv.Itoa(i))
+				output.Messages = append(output.Messages, message)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				_ = json.NewEncoder(w).Encode(output)
+			}))
+			t.Cleanup(server.Close)
+
+			pt.poller.sqsClient = sqs.New(sqs.Options{
+				Region:                           "eu-west-1",
+				BaseEndpoint:                     aws.String(server.URL),
+				Credentials:                      aws.AnonymousCredentials{},
+				DisableMessageChecksumValidation: true,
+			})
+
+			received, poll, err := pt.poller.receive(context.Background(), &sqs.ReceiveMessageInput{QueueUrl: &pt.poller.queueURL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, message := range received.Messages {
+				pt.poller.handleMessage(context.Background(), message, poll)
+			}
+
+			var polls, processed []sdktrace.ReadOnlySpan
+			for _, span := range pt.spans.Ended() {
+				switch span.Name() {
+				case "Poll":
+					polls = append(polls, span)
+				case "Process Message":
+					processed = append(processed, span)
+				}
+			}
+
+			if !tt.tracePolls {
+				if len(polls) != 0 || poll.IsValid() {
+					t.Fatalf("got %d Poll spans, want none", len(polls))
+				}
+
+				for _, span := range processed {
+					if len(span.Links()) != 0 {
+						t.Errorf("got %d links on the Process Message span, want none", len(span.Links()))
+					}
+				}
+
+				return
+			}
+
+			if len(polls) != 1 {
+				t.Fatalf("got %d Poll spans, want 1", len(polls))
+			}
+
+			if empty, _ := spanAttribute(polls[0], "poll.empty"); empty.AsBool() != (tt.messages == 0) {
+				t.Errorf("got poll.empty %t, want %t", empty.AsBool(), tt.messages == 0)
+			}
+
+			if count, _ := spanAttribute(polls[0], "messaging.batch.message_count"); count.AsInt64() != int64(tt.messages) {
+				t.Errorf("got messaging.batch.message_count %d, want %d", count.AsInt64(), tt.messages)
+			}
+
+			if _, ok := spanAttribute(polls[0], "poll.wait_duration_ms"); !ok {
+				t.Error("got no poll.wait_duration_ms attribute")
+			}
+
+			if len(processed) != tt.messages {
+				t.Fatalf("got %d Process Message spans, want %d", len(processed), tt.messages)
+			}
+
+			for _, span := range processed {
+				links := span.Links()
+				if len(links) != 1 || links[0].SpanContext.SpanID() != polls[0].SpanContext().SpanID() {
+					t.Errorf("got links %v, want a link to the Poll span", links)
+				}
+			}
+		})
+	}
+}
+
+// TestEmptyReceiveSleep checks that a short-polling poller pauses, on its clock, after an empty
+// receive rather than busy-spinning, and that it stops during the pause once cancelled.
+func TestEmptyReceiveSleep(t *testing.T) {
+	tests := []struct {
+		name         string
+		advance      time.Duration
+		wantReceives int
+	}{
+		{name: "sleeping", wantReceives: 1},
+		{name: "still sleeping", advance: 59 * time.Second, wantReceives: 1},
+		{name: "slept", advance: time.Minute, wantReceives: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+			pt.poller.emptyReceiveSleep = time.Minute
+			pt.poller.clock = clock
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pt.poller.Run(ctx, context.Background())
+			}()
+
+			// sleeping waits for the poller to have received n times, and to be sleeping again.
+			sleeping := func(n int) {
+				deadline := time.Now().Add(time.Second)
+				for pt.sqs.count("ReceiveMessage") < n || clock.waiting() == 0 {
+					if time.Now().After(deadline) {
+						t.Fatalf("got %d receives, want the poller sleeping after %d", pt.sqs.count("ReceiveMessage"), n)
+					}
+
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			sleeping(1)
+			clock.advance(tt.advance)
+			sleeping(tt.wantReceives)
+
+			cancel()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Run didn't return once cancelled")
+			}
+
+			if n := pt.sqs.count("ReceiveMessage"); n != tt.wantReceives {
+				t.Errorf("got %d receives, want %d", n, tt.wantReceives)
+			}
+		})
+	}
+}
+
+// TestTwoPhaseShutdown checks that once draining starts no more messages are received, while the
+// message in flight is allowed to finish, unless the shutdown is then forced.
+func TestTwoPhaseShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		force        bool
+		wantAborted  bool
+		wantDeletion bool
+	}{
+		{name: "drained", wantDeletion: true},
+		{name: "forced", force: true, wantAborted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			finish := make(chan struct{})
+			aborted := make(chan bool, 1)
+
+			pt := newPollerTest(t, handlerFunc(func(ctx context.Context, _ sqsTypes.Message) error {
+				started <- struct{}{}
+				select {
+				case <-finish:
+					aborted <- false
+					return nil
+				case <-ctx.Done():
+					aborted <- true
+					return ctx.Err()
+				}
+			}))
+			pt.sqs.receive(testMessage())
+
+			ctx, drain := context.WithCancel(context.Background())
+			work, force := context.WithCancel(context.Background())
+			defer force()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pt.poller.Run(ctx, work)
+			}()
+
+			<-started
+			if pt.poller.Draining() {
+				t.Fatal("got the poller draining before the shutdown")
+			}
+
+			// Phase one: stop receiving, and let the message finish.
+			receives := pt.sqs.count("ReceiveMessage")
+			drain()
+
+			// The state flips asynchronously once the context is cancelled.
+			for deadline := time.Now().Add(time.Second); !pt.poller.Draining(); time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("got the poller running once draining started, want it draining")
+				}
+			}
+
+			if got := pt.poller.InFlight(); got != 1 {
+				t.Errorf("got %d in flight while draining, want 1", got)
+			}
+
+			// Phase two: either the message finishes, or the shutdown is forced.
+			if tt.force {
+				force()
+			} else {
+				close(finish)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run didn't return")
+			}
+
+			if got := <-aborted; got != tt.wantAborted {
+				t.Errorf("got the message aborted %t, want %t", got, tt.wantAborted)
+			}
+
+			if got := pt.sqs.count("ReceiveMessage"); got != receives {
+				t.Errorf("got %d receives after draining started, want none", got-receives)
+			}
+
+			if got := pt.sqs.called("DeleteMessage"); got != tt.wantDeletion {
+				t.Errorf("got the message deleted %t, want %t", got, tt.wantDeletion)
+			}
+
+			if got := pollerState(pt.poller.state.Load()); got != stateStopped {
+				t.Errorf("got state %s once Run returned, want %s", got, stateStopped)
+			}
+		})
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	malformed := testMessage()
+	malformed.Body = nil
+
+	tests := []struct {
+		name    string
+		message sqsTypes.Message
+		err     error
+		want    []string
+	}{
+		{
+			name:    "processed",
+			message: testMessage(),
+			want:    []string{eventMessageReceived, eventMessageProcessingStarted, eventMessageProcessingCompleted, eventMessageDeleted},
+		},
+		{
+			name:    "retryable failure",
+			message: testMessage(),
+			err:     newProcessingError(stageDynamo, context.DeadlineExceeded),
+			want:    []string{eventMessageReceived, eventMessageProcessingStarted, eventMessageProcessingFailed},
+		},
+		{
+			name:    "terminal failure",
+			message: testMessage(),
+			err:     newProcessingError(stageDownstream, &json.SyntaxError{}),
+			want:    []string{eventMessageReceived, eventMessageProcessingStarted, eventMessageProcessingFailed, eventMessageDeleted},
+		},
+		{
+			name:    "malformed",
+			message: malformed,
+			want:    []string{eventMessageReceived, eventMessageMalformed, eventMessageDeleted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return tt.err }))
+
+			span := pt.handle(t, tt.message)
+
+			// The error recorded on a failure is an exception event, not part of the lifecycle.
+			var got []string
+			for _, event := range span.Events() {
+				if strings.HasPrefix(event.Name, "message.") {
+					got = append(got, event.Name)
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got events %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		tracePolls bool
+		messages   int
+		wantCount  uint64
+	}{
+		{name: "batch", messages: 3, wantCount: 1},
+		{name: "empty"},
+		{name: "traced batch", tracePolls: true, messages: 3, wantCount: 1},
+		{name: "traced empty", tracePolls: true, wantCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPollerTest(t, nil)
+			pt.poller.tracePolls = tt.tracePolls
+
+			var messages []sqsTypes.Message
+			for i := range tt.messages {
+				message := testMessage()
+				message.MessageId = aws.String(strconv.Itoa(i))
+				messages = append(messages, message)
+			}
+			pt.sqs.receive(messages...)
+
+			if _, _, err := pt.poller.receive(context.Background(), &sqs.ReceiveMessageInput{QueueUrl: &pt.poller.queueURL}); err != nil {
+				t.Fatal(err)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := pt.metrics.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+
+			var count uint64
+			var sum int64
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "sqs.receive.batch_size" {
+						for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+							count += dp.Count
+							sum += dp.Sum
+						}
+					}
+				}
+			}
+
+			// Empty receives are only recorded when polls are traced.
+			if count != tt.wantCount || sum != int64(tt.messages) {
+				t.Errorf("got %d batches of %d messages in total, want %d of %d", count, sum, tt.wantCount, tt.messages)
+			}
+		})
+	}
+}
+
+// TestPollerGroup checks that a group polls each of its queues concurrently, tagging the
+// messages from each with the queue they came from, and that they all stop together.
+func TestPollerGroup(t *testing.T) {
+	queues := []string{"payments", "refunds"}
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	handler := handlerFunc(func(ctx context.Context, _ sqsTypes.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		handled[queueNameFromContext(ctx)]++
+		return nil
+	})
+
+	var group pollerGroup
+	var tests []*pollerTest
+	for _, queue := range queues {
+		pt := newPollerTest(t, handler)
+		pt.poller.queueName = queue
+		pt.poller.queueURL = "https://sqs.eu-west-1.amazonaws.com/123456789012/" + queue
+		pt.sqs.receive(testMessage())
+
+		group = append(group, pt.poller)
+		tests = append(tests, pt)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		group.Run(ctx, context.Background())
+	}()
+
+	// Both queues are drained while the group runs.
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		drained := handled["payments"] > 0 && handled["refunds"] > 0
+		mu.Unlock()
+
+		if drained {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("got messages handled from one queue at most, want both")
+		}
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return once cancelled")
+	}
+
+	if !group.Draining() {
+		t.Error("got the group running after the shutdown, want it draining")
+	}
+
+	// The tracer provider is global, so the spans from both pollers are recorded by the last.
+	spans := map[string]int{}
+	for _, span := range tests[len(tests)-1].spans.Ended() {
+		if span.Name() == "Process Message" {
+			queue, _ := spanAttribute(span, "messaging.destination.name")
+			spans[queue.AsString()]++
+		}
+	}
+
+	for i, queue := range queues {
+		t.Run(queue, func(t *testing.T) {
+			if spans[queue] == 0 {
+				t.Errorf("got no Process Message spans for %s, want some", queue)
+			}
+
+			if tests[i].sqs.count("DeleteMessage") == 0 {
+				t.Errorf("got no messages deleted from %s, want some", queue)
+			}
+		})
+	}
+}
+
+func TestOrphanMessages(t *testing.T) {
+	const traceHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+	tests := []struct {
+		name        string
+		traceHeader string
+		wantOrphan  bool
+	}{
+		{name: "trace context", traceHeader: traceHeader},
+		{name: "no trace context", wantOrphan: true},
+		{name: "malformed trace context", traceHeader: "Root=nonsense", wantOrphan: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPropagators(t)
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+
+			message := testMessage()
+			if tt.traceHeader != "" {
+				message.Attributes = map[string]string{
+					string(sqsTypes.MessageSystemAttributeNameAWSTraceHeader): tt.traceHeader,
+				}
+			}
+
+			span := pt.handle(t, message)
+
+			orphan, _ := spanAttribute(span, "messaging.trace.orphan")
+			if orphan.AsBool() != tt.wantOrphan {
+				t.Errorf("got messaging.trace.orphan %t, want %t", orphan.AsBool(), tt.wantOrphan)
+			}
+
+			// An orphan starts a new trace, while any other message continues the producer's.
+			if continued := span.Parent().IsValid(); continued == tt.wantOrphan {
+				t.Errorf("got the producer's trace continued %t, want %t", continued, !tt.wantOrphan)
+			}
+		})
+	}
+}
+
+func TestMessageRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID string
+	}{
+		{name: "uuid", messageID: "c5a1e2b4-7e0f-4c1d-9a61-1f6d2f0e8b3a"},
+		{name: "other", messageID: "msg-123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled string
+			pt := newPollerTest(t, handlerFunc(func(ctx context.Context, _ sqsTypes.Message) error {
+				handled, _ = requestid.FromContext(ctx)
+				return nil
+			}))
+
+			message := testMessage()
+			message.MessageId = aws.String(tt.messageID)
+
+			span := pt.handle(t, message)
+
+			if handled != tt.messageID {
+				t.Errorf("got request ID %q in the handler's context, want %q", handled, tt.messageID)
+			}
+
+			if got, _ := spanAttribute(span, requestid.Key()); got.AsString() != tt.messageID {
+				t.Errorf("got %s %q, want %q", requestid.Key(), got.AsString(), tt.messageID)
+			}
+		})
+	}
+}
+
+func TestDuplicateMessages(t *testing.T) {
+	tests := []struct {
+		name          string
+		firstErr      error
+		cached        bool
+		wantProcessed int
+		wantSkipped   int64
+	}{
+		{name: "redelivered", cached: true, wantProcessed: 1, wantSkipped: 1},
+		{name: "redelivered after failing", firstErr: errors.New("dynamodb unavailable"), cached: true, wantProcessed: 2},
+		{name: "without the cache", wantProcessed: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var processed int
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error {
+				processed++
+				if processed == 1 {
+					return tt.firstErr
+				}
+
+				return nil
+			}))
+
+			if tt.cached {
+				pt.poller.processed = newProcessedCache(10, time.Minute, systemClock{})
+			}
+
+			// The same message is delivered twice.
+			pt.poller.handleMessage(context.Background(), testMessage(), trace.SpanContext{})
+			pt.poller.handleMessage(context.Background(), testMessage(), trace.SpanContext{})
+
+			if processed != tt.wantProcessed {
+				t.Errorf("got the message processed %d times, want %d", processed, tt.wantProcessed)
+			}
+
+			var spans []sdktrace.ReadOnlySpan
+			for _, span := range pt.spans.Ended() {
+				if span.Name() == "Process Message" {
+					spans = append(spans, span)
+				}
+			}
+
+			if len(spans) != 2 {
+				t.Fatalf("got %d Process Message spans, want 2", len(spans))
+			}
+
+			if hit, _ := spanAttribute(spans[0], "idempotent.cache_hit"); hit.AsBool() {
+				t.Error("got the first delivery skipped, want it processed")
+			}
+
+			hit, _ := spanAttribute(spans[1], "idempotent.cache_hit")
+			if got := hit.AsBool(); got != (tt.wantSkipped > 0) {
+				t.Errorf("got idempotent.cache_hit %t on the redelivery, want %t", got, tt.wantSkipped > 0)
+			}
+
+			var skipped int64
+			for _, dp := range pt.counter(t, "sqs.messages.duplicates_skipped") {
+				skipped += dp.Value
+			}
+
+			if skipped != tt.wantSkipped {
+				t.Errorf("got %d duplicates skipped, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     func(*sqsTypes.Message)
+		retain      bool
+		wantReason  string
+		wantDeleted bool
+	}{
+		{name: "nil message ID", message: func(m *sqsTypes.Message) { m.MessageId = nil }, wantReason: "missing message id", wantDeleted: true},
+		{name: "empty message ID", message: func(m *sqsTypes.Message) { m.MessageId = aws.String("") }, wantReason: "missing message id", wantDeleted: true},
+		{name: "nil body", message: func(m *sqsTypes.Message) { m.Body = nil }, wantReason: "empty body", wantDeleted: true},
+		{name: "empty body", message: func(m *sqsTypes.Message) { m.Body = aws.String("") }, wantReason: "empty body", wantDeleted: true},
+		{
+			name:       "nothing set",
+			message:    func(m *sqsTypes.Message) { *m = sqsTypes.Message{} },
+			wantReason: "missing message id",
+		},
+		{name: "retained", message: func(m *sqsTypes.Message) { m.Body = nil }, retain: true, wantReason: "empty body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled bool
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error {
+				handled = true
+				return nil
+			}))
+			pt.poller.retainMalformed = tt.retain
+
+			message := testMessage()
+			tt.message(&message)
+
+			span := pt.handle(t, message)
+
+			if handled {
+				t.Error("got the malformed message handled, want it skipped")
+			}
+
+			var reason string
+			for _, event := range span.Events() {
+				if event.Name == eventMessageMalformed {
+					set := attribute.NewSet(event.Attributes...)
+					v, _ := set.Value(appattr.Key("malformed.reason"))
+					reason = v.AsString()
+				}
+			}
+
+			if reason != tt.wantReason {
+				t.Errorf("got malformed.reason %q, want %q", reason, tt.wantReason)
+			}
+
+			if dps := pt.counter(t, "sqs.messages.malformed"); len(dps) != 1 || dps[0].Value != 1 {
+				t.Errorf("got malformed messages %v, want 1", dps)
+			}
+
+			if got := pt.sqs.called("DeleteMessage"); got != tt.wantDeleted {
+				t.Errorf("got deleted %t, want %t", got, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+// TestEndToEndDuration checks the time since the propagated checkout start is recorded once the
+// message is processed, clamped to zero when the hosts' clocks are skewed.
+func TestEndToEndDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		baggage  func(now time.Time) string
+		want     float64
+		wantNone bool
+	}{
+		{
+			name: "elapsed",
+			baggage: func(now time.Time) string {
+				return "checkout.start=" + strconv.FormatInt(now.Add(-2500*time.Millisecond).UnixMilli(), 10)
+			},
+			want: 2.5,
+		},
+		{
+			name: "clocks skewed",
+			baggage: func(now time.Time) string {
+				return "checkout.start=" + strconv.FormatInt(now.Add(time.Second).UnixMilli(), 10)
+			},
+		},
+		{name: "not propagated", wantNone: true},
+		{name: "invalid", baggage: func(time.Time) string { return "checkout.start=yesterday" }, wantNone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPropagators(t)
+			pt := newPollerTest(t, handlerFunc(func(context.Context, sqsTypes.Message) error { return nil }))
+
+			clock := newFakeClock()
+			pt.poller.clock = clock
+
+			message := testMessage()
+			if tt.baggage != nil {
+				message.MessageAttributes = map[string]sqsTypes.MessageAttributeValue{
+					baggageMessageAttribute: {DataType: aws.String("String"), StringValue: aws.String(tt.baggage(clock.Now()))},
+				}
+			}
+
+			pt.handle(t, message)
+
+			var rm metricdata.ResourceMetrics
+			if err := pt.metrics.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+
+			var dps []metricdata.HistogramDataPoint[float64]
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name == "order.end_to_end.duration" {
+						dps = m.Data.(metricdata.Histogram[float64]).DataPoints
+					}
+				}
+			}
+
+			if tt.wantNone {
+				if len(dps) != 0 {
+					t.Errorf("got %d end-to-end durations recorded, want none", len(dps))
+				}
+
+				return
+			}
+
+			if len(dps) != 1 || dps[0].Count != 1 {
+				t.Fatalf("got end-to-end durations %v, want one", dps)
+			}
+
+			if dps[0].Sum != tt.want {
+				t.Errorf("got an end-to-end duration of %gs, want %gs", dps[0].Sum, tt.want)
+			}
+		})
+	}
+}
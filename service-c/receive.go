@@ -0,0 +1,71 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// allMessageAttributes requests every message attribute on a receive.
+const allMessageAttributes = "All"
+
+// receiveAttributes is the set of system and message attribute names requested on each receive.
+// Features that read an attribute from the received messages declare it here, rather than the
+// names being hardcoded on the receive request.
+type receiveAttributes struct {
+	system  []sqsTypes.MessageSystemAttributeName
+	message []string
+}
+
+// newReceiveAttributes composes the attribute names the poller's features need, along with any
+// extra ones configured through SQS_RECEIVE_SYSTEM_ATTRIBUTES and SQS_RECEIVE_MESSAGE_ATTRIBUTES.
+func newReceiveAttributes(extraSystem, extraMessage []string) receiveAttributes {
+	var a receiveAttributes
+
+	// The X-Ray trace header, to continue the producer's trace.
+	a.requireSystem(sqsTypes.MessageSystemAttributeNameAWSTraceHeader)
+
+	// The W3C baggage carried alongside it.
+	a.requireMessage(baggageMessageAttribute)
+
+	// The approximate receive count, to tell when a message left on the queue is moving to the
+	// dead-letter queue.
+	a.requireSystem(sqsTypes.MessageSystemAttributeNameApproximateReceiveCount)
+
+	for _, name := range extraSystem {
+		a.requireSystem(sqsTypes.MessageSystemAttributeName(name))
+	}
+
+	a.requireMessage(extraMessage...)
+
+	return a
+}
+
+func (a *receiveAttributes) requireSystem(names ...sqsTypes.MessageSystemAttributeName) {
+	for _, name := range names {
+		if name != "" && !slices.Contains(a.system, name) {
+			a.system = append(a.system, name)
+		}
+	}
+}
+
+// requireMessage adds message attribute names to the set. Requesting "All" replaces any
+// individual names, as it already includes them.
+func (a *receiveAttributes) requireMessage(names ...string) {
+	for _, name := range names {
+		switch {
+		case name == "" || slices.Contains(a.message, name) || slices.Contains(a.message, allMessageAttributes):
+		case name == allMessageAttributes:
+			a.message = []string{allMessageAttributes}
+		default:
+			a.message = append(a.message, name)
+		}
+	}
+}
+
+// apply sets the attribute names on a receive request.
+func (a receiveAttributes) apply(input *sqs.ReceiveMessageInput) {
+	input.MessageSystemAttributeNames = a.system
+	input.MessageAttributeNames = a.message
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func TestReceiveAttributes(t *testing.T) {
+	tests := []struct {
+		name        string
+		system      []string
+		message     []string
+		wantSystem  []sqsTypes.MessageSystemAttributeName
+		wantMessage []string
+	}{
+		{
+			name:        "features only",
+			wantSystem:  []sqsTypes.MessageSystemAttributeName{"AWSTraceHeader", "ApproximateReceiveCount"},
+			wantMessage: []string{"baggage"},
+		},
+		{
+			name:        "extra names",
+			system:      []string{"SentTimestamp"},
+			message:     []string{"tenant"},
+			wantSystem:  []sqsTypes.MessageSystemAttributeName{"AWSTraceHeader", "ApproximateReceiveCount", "SentTimestamp"},
+			wantMessage: []string{"baggage", "tenant"},
+		},
+		{
+			name:        "duplicates",
+			system:      []string{"AWSTraceHeader", ""},
+			message:     []string{"baggage", ""},
+			wantSystem:  []sqsTypes.MessageSystemAttributeName{"AWSTraceHeader", "ApproximateReceiveCount"},
+			wantMessage: []string{"baggage"},
+		},
+		{
+			name:        "all message attributes",
+			message:     []string{"tenant", "All", "region"},
+			wantSystem:  []sqsTypes.MessageSystemAttributeName{"AWSTraceHeader", "ApproximateReceiveCount"},
+			wantMessage: []string{"All"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input sqs.ReceiveMessageInput
+			newReceiveAttributes(tt.system, tt.message).apply(&input)
+
+			if !slices.Equal(input.MessageSystemAttributeNames, tt.wantSystem) {
+				t.Errorf("got system attributes %v, want %v", input.MessageSystemAttributeNames, tt.wantSystem)
+			}
+
+			if !slices.Equal(input.MessageAttributeNames, tt.wantMessage) {
+				t.Errorf("got message attributes %v, want %v", input.MessageAttributeNames, tt.wantMessage)
+			}
+		})
+	}
+}
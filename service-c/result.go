@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// messageOutcome classifies how the processing of a message ended.
+type messageOutcome string
+
+const (
+	outcomeSucceeded messageOutcome = "succeeded"
+	outcomeSkipped   messageOutcome = "skipped"
+	outcomeMalformed messageOutcome = "malformed"
+	outcomeFailed    messageOutcome = "failed"
+)
+
+// messageDisposition is what becomes of a message once it has been handled.
+type messageDisposition string
+
+const (
+	// dispositionDeleted messages were removed from the queue.
+	dispositionDeleted messageDisposition = "deleted"
+
+	// dispositionRedelivered messages were left on the queue, to be received again once their
+	// visibility timeout expires.
+	dispositionRedelivered messageDisposition = "redelivered"
+
+	// dispositionDLQ messages were left on the queue having been received as many times as its
+	// redrive policy allows, so they're moved to the dead-letter queue rather than redelivered.
+	dispositionDLQ messageDisposition = "dlq"
+)
+
+// stageResults records whether each stage of processing a message succeeded. Stages that never
+// ran, e.g. because an earlier one failed, aren't recorded.
+type stageResults struct {
+	mu      sync.Mutex
+	results map[processingStage]bool
+}
+
+func (s *stageResults) record(stage processingStage, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.results == nil {
+		s.results = make(map[processingStage]bool)
+	}
+
+	s.results[stage] = err == nil
+}
+
+// attr returns the recorded stages as a group of booleans, in the order the stages run.
+func (s *stageResults) attr() slog.Attr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attrs []any
+	for _, stage := range []processingStage{stageDynamo, stageS3, stageDownstream} {
+		if ok, ran := s.results[stage]; ran {
+			attrs = append(attrs, slog.Bool(string(stage), ok))
+		}
+	}
+
+	return slog.Group("stages", attrs...)
+}
+
+type stageResultsKey struct{}
+
+// contextWithStageResults returns a context that the handler records its stages' results in.
+func contextWithStageResults(ctx context.Context, results *stageResults) context.Context {
+	return context.WithValue(ctx, stageResultsKey{}, results)
+}
+
+// recordStage records whether a stage of processing the message in ctx succeeded. It does nothing
+// if the context isn't recording the stages.
+func recordStage(ctx context.Context, stage processingStage, err error) {
+	if results, ok := ctx.Value(stageResultsKey{}).(*stageResults); ok {
+		results.record(stage, err)
+	}
+}
+
+// messageResult is gathered while a message is handled, and summarised in a single log line once
+// it has been.
+type messageResult struct {
+	start   time.Time
+	outcome messageOutcome
+	err     error
+	stages  stageResults
+	deleted bool
+}
+
+// logResult logs the result of handling the message: its outcome, how long it took, the stages
+// that ran and what became of it. The log handler adds the trace ID from ctx, so the line leads to
+// the message's trace, and it's logged whether or not the trace was sampled.
+//
+// It's logged at info when the message was processed and deleted, at warn when it's redelivered
+// to be tried again, and at error when a failed message is dropped or moved to the dead-letter
+// queue.
+func (p *Poller) logResult(ctx context.Context, message sqsTypes.Message, result *messageResult) {
+	disposition := p.disposition(message, result.deleted)
+
+	level := slog.LevelInfo
+	switch {
+	case disposition == dispositionDLQ:
+		level = slog.LevelError
+	case disposition == dispositionRedelivered:
+		level = slog.LevelWarn
+	case result.outcome == outcomeFailed || result.outcome == outcomeMalformed:
+		level = slog.LevelError
+	}
+
+	attrs := []slog.Attr{
+		slog.String("message.id", derefString(message.MessageId)),
+		slog.String("outcome", string(result.outcome)),
+		slog.String("disposition", string(disposition)),
+		slog.String("duration", p.clock.Since(result.start).String()),
+		result.stages.attr(),
+	}
+
+	if result.err != nil {
+		attrs = append(attrs, slog.Any("error", result.err))
+	}
+
+	slog.LogAttrs(ctx, level, "message handled", attrs...)
+}
+
+// disposition classifies what becomes of the message. A message left on the queue is moving to
+// the dead-letter queue if it has been received maxReceiveCount times, when that's known.
+func (p *Poller) disposition(message sqsTypes.Message, deleted bool) messageDisposition {
+	if deleted {
+		return dispositionDeleted
+	}
+
+	if p.maxReceiveCount > 0 && receiveCount(message) >= p.maxReceiveCount {
+		return dispositionDLQ
+	}
+
+	return dispositionRedelivered
+}
+
+// receiveCount returns the number of times the message has been received, or zero if it wasn't
+// received with its ApproximateReceiveCount.
+func receiveCount(message sqsTypes.Message) int {
+	n, err := strconv.Atoi(message.Attributes[string(sqsTypes.MessageSystemAttributeNameApproximateReceiveCount)])
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
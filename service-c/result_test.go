@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logRecorder is a slog.Handler that records every record, with the trace ID of the context it
+// was logged with, as the service's log handler would add it.
+type logRecorder struct {
+	mu       sync.Mutex
+	records  []slog.Record
+	traceIDs []trace.TraceID
+}
+
+func (h *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *logRecorder) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, r.Clone())
+	h.traceIDs = append(h.traceIDs, trace.SpanContextFromContext(ctx).TraceID())
+
+	return nil
+}
+
+func (h *logRecorder) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *logRecorder) WithGroup(string) slog.Handler { return h }
+
+// recordLogs makes the default logger record its logs for the rest of the test.
+func recordLogs(t *testing.T) *logRecorder {
+	t.Helper()
+
+	recorder := &logRecorder{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(recorder))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return recorder
+}
+
+func TestMessageResultLog(t *testing.T) {
+	tests := []struct {
+		name            string
+		failDownstream  bool
+		failS3          bool
+		receiveCount    string
+		wantLevel       slog.Level
+		wantOutcome     messageOutcome
+		wantDisposition messageDisposition
+		wantStages      map[string]bool
+		wantErr         bool
+	}{
+		{
+			name:            "success",
+			wantLevel:       slog.LevelInfo,
+			wantOutcome:     outcomeSucceeded,
+			wantDisposition: dispositionDeleted,
+			wantStages:      map[string]bool{"dynamo": true, "s3": true, "downstream": true},
+		},
+		{
+			name:            "downstream failed",
+			failDownstream:  true,
+			wantLevel:       slog.LevelError,
+			wantOutcome:     outcomeFailed,
+			wantDisposition: dispositionDeleted,
+			wantStages:      map[string]bool{"dynamo": true, "s3": true, "downstream": false},
+			wantErr:         true,
+		},
+		{
+			name:            "s3 failed",
+			failS3:          true,
+			receiveCount:    "1",
+			wantLevel:       slog.LevelWarn,
+			wantOutcome:     outcomeFailed,
+			wantDisposition: dispositionRedelivered,
+			wantStages:      map[string]bool{"dynamo": true, "s3": false, "downstream": true},
+			wantErr:         true,
+		},
+		{
+			name:            "s3 failed for the last time",
+			failS3:          true,
+			receiveCount:    "3",
+			wantLevel:       slog.LevelError,
+			wantOutcome:     outcomeFailed,
+			wantDisposition: dispositionDLQ,
+			wantStages:      map[string]bool{"dynamo": true, "s3": false, "downstream": true},
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := newPipelineTest(t)
+			pt.poller.maxReceiveCount = 3
+			handler := pt.poller.handler.(*pipelineHandler)
+
+			if tt.failDownstream {
+				unreachable := httptest.NewServer(http.NotFoundHandler())
+				unreachable.Close()
+				handler.downstream.endpoints = []string{unreachable.URL}
+			}
+
+			if tt.failS3 {
+				failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}))
+				t.Cleanup(failing.Close)
+
+				handler.s3Client = newS3Client(aws.Config{
+					Region:           "eu-west-1",
+					BaseEndpoint:     aws.String(failing.URL),
+					Credentials:      aws.AnonymousCredentials{},
+					RetryMaxAttempts: 1,
+				})
+			}
+
+			message := testMessage()
+			if tt.receiveCount != "" {
+				message.Attributes = map[string]string{
+					string(sqsTypes.MessageSystemAttributeNameApproximateReceiveCount): tt.receiveCount,
+				}
+			}
+
+			logs := recordLogs(t)
+			span := pt.handle(t, message)
+
+			logs.mu.Lock()
+			defer logs.mu.Unlock()
+
+			var handled []int
+			for i, r := range logs.records {
+				if r.Message == "message handled" {
+					handled = append(handled, i)
+				}
+			}
+
+			if len(handled) != 1 {
+				t.Fatalf("got %d message handled lines, want 1", len(handled))
+			}
+
+			record := logs.records[handled[0]]
+			if record.Level != tt.wantLevel {
+				t.Errorf("got level %s, want %s", record.Level, tt.wantLevel)
+			}
+
+			// The line is logged in the message's trace, which the log handler adds the ID of.
+			if traceID := logs.traceIDs[handled[0]]; traceID != span.SpanContext().TraceID() {
+				t.Errorf("got trace ID %s, want %s", traceID, span.SpanContext().TraceID())
+			}
+
+			attrs := map[string]slog.Value{}
+			record.Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value
+				return true
+			})
+
+			for key, want := range map[string]string{
+				"message.id":  aws.ToString(message.MessageId),
+				"outcome":     string(tt.wantOutcome),
+				"disposition": string(tt.wantDisposition),
+			} {
+				if got := attrs[key].String(); got != want {
+					t.Errorf("got %s %q, want %q", key, got, want)
+				}
+			}
+
+			if attrs["duration"].String() == "" {
+				t.Error("got no duration")
+			}
+
+			if _, ok := attrs["error"]; ok != tt.wantErr {
+				t.Errorf("got error logged %t, want %t", ok, tt.wantErr)
+			}
+
+			stages := map[string]bool{}
+			for _, a := range attrs["stages"].Group() {
+				stages[a.Key] = a.Value.Bool()
+			}
+
+			if len(stages) != len(tt.wantStages) {
+				t.Errorf("got stages %v, want %v", stages, tt.wantStages)
+			}
+
+			for stage, want := range tt.wantStages {
+				if got, ok := stages[stage]; !ok || got != want {
+					t.Errorf("got stage %s succeeded %t, want %t", stage, got, want)
+				}
+			}
+		})
+	}
+}
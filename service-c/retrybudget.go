@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The default size of the downstream retry budget, and the retries it's refilled with a second.
+const (
+	defaultRetryBudget       = 10
+	defaultRetryBudgetRefill = 1.0
+)
+
+// retryBudget is a token bucket shared by every downstream request, so retries are rate limited
+// across all of them. When a dependency fails outright, each request retrying independently
+// would multiply the load on it; with a shared budget the retries stop once the budget is spent,
+// until it refills. It is safe for concurrent use.
+type retryBudget struct {
+	capacity float64
+	refill   float64 // tokens per second
+	clock    Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRetryBudget returns a full budget of capacity retries, refilling at refill retries a second.
+func newRetryBudget(capacity int, refill float64, clock Clock) *retryBudget {
+	return &retryBudget{
+		capacity: float64(capacity),
+		refill:   refill,
+		clock:    clock,
+		tokens:   float64(capacity),
+		last:     clock.Now(),
+	}
+}
+
+// allow spends a token on a retry, reporting false if the budget is exhausted.
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.refill)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// defaultS3BatchInterval is how long a batch of S3 payloads is buffered for, at most, before it
+// is flushed.
+const defaultS3BatchInterval = 5 * time.Second
+
+// s3Batcher combines the payloads of several messages into a single gzipped S3 object, rather
+// than writing an object per message. A batch is flushed once it holds maxMessages payloads, or
+// interval after its first payload was added, whichever comes first.
+//
+// Each payload is added in its own span, and the flush span links back to every one of them, so
+// the trace of any message leads to the write that stored its payload. Note that a message is
+// deleted from the queue once its payload is buffered, so a batch that fails to flush, or is
+// still buffered if the process crashes, is lost.
+type s3Batcher struct {
+	client      *s3.Client
+	bucket      string
+	keyFormat   objectKeyFormat
+	clock       Clock
+	timeout     time.Duration
+	maxMessages int
+	interval    time.Duration
+
+	// mu guards the batch being filled. flushMu serialises the flushes, so Close can wait for a
+	// flush already in progress.
+	mu      sync.Mutex
+	flushMu sync.Mutex
+	buf     *bytes.Buffer
+	gz      *gzip.Writer
+	links   []trace.Link
+	timer   *time.Timer
+}
+
+// add appends a payload to the current batch, linking the span in ctx to the batch's eventual
+// flush. The batch is flushed before add returns if the payload fills it.
+func (b *s3Batcher) add(ctx context.Context, body io.Reader) error {
+	b.mu.Lock()
+
+	if b.gz == nil {
+		b.buf = &bytes.Buffer{}
+		b.gz = gzip.NewWriter(b.buf)
+
+		batch := b.gz
+		b.timer = time.AfterFunc(b.interval, func() { b.flushBatch(batch) })
+	}
+
+	// Payloads are separated by newlines, so a batch of JSON bodies is newline-delimited JSON.
+	_, err := io.Copy(b.gz, body)
+	if err == nil {
+		_, err = b.gz.Write([]byte("\n"))
+	}
+
+	if err != nil {
+		b.mu.Unlock()
+		return fmt.Errorf("error buffering s3 payload: %w", err)
+	}
+
+	b.links = append(b.links, trace.LinkFromContext(ctx))
+	var full *gzip.Writer
+	if len(b.links) >= b.maxMessages {
+		full = b.gz
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(appattr.Key("s3.batch.position").Int(len(b.links)))
+
+	b.mu.Unlock()
+
+	if full != nil {
+		b.flushBatch(full)
+	}
+
+	return nil
+}
+
+// flush writes the current batch, if there is one, to S3.
+func (b *s3Batcher) flush() {
+	b.flushBatch(nil)
+}
+
+// flushBatch writes the current batch to S3, if it is the given batch, or any batch if nil. A
+// flush isn't part of any one message's trace, so its span starts a new trace, linked to the
+// spans of the payloads in it.
+func (b *s3Batcher) flushBatch(batch *gzip.Writer) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	if batch != nil && batch != b.gz {
+		// The batch the timer was started for has already been flushed.
+		b.mu.Unlock()
+		return
+	}
+
+	buf, gz, links := b.buf, b.gz, b.links
+	if gz != nil {
+		b.timer.Stop()
+	}
+
+	b.buf, b.gz, b.links, b.timer = nil, nil, nil, nil
+	b.mu.Unlock()
+
+	if gz == nil {
+		return
+	}
+
+	filename := b.keyFormat.key(b.clock.Now()) + ".gz"
+
+	ctx, span := tracer(componentS3).Start(context.Background(), "Flush Objects",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("aws.s3.bucket", b.bucket),
+			attribute.String("aws.s3.key", filename),
+			appattr.Key("s3.batch.message_count").Int(len(links)),
+		),
+	)
+	defer span.End()
+
+	err := gz.Close()
+	if err == nil {
+		err = withOperationTimeout(ctx, b.timeout, "S3.PutObject", func(ctx context.Context) error {
+			_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:      &b.bucket,
+				Key:         &filename,
+				Body:        bytes.NewReader(buf.Bytes()),
+				ContentType: aws.String("application/gzip"),
+			})
+			return err
+		})
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error flushing s3 batch")
+		slog.ErrorContext(ctx, "error flushing s3 batch, its payloads are lost", "aws.s3.key", filename, "messages", len(links), "error", err)
+	}
+}
+
+// Close flushes any buffered payloads, waiting for a flush already in progress. It must only be
+// called once the pollers have stopped, as payloads added afterwards are never flushed.
+func (b *s3Batcher) Close() {
+	b.flush()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// fakeS3 records the objects put to it, unzipped.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects []string
+	types   []string
+	keys    []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body string
+	if zr, err := gzip.NewReader(r.Body); err == nil {
+		b, _ := io.ReadAll(zr)
+		body = string(b)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects = append(f.objects, body)
+	f.types = append(f.types, r.Header.Get("Content-Type"))
+	f.keys = append(f.keys, r.URL.Path)
+}
+
+// flushSpans returns the Flush Objects spans that have ended.
+func flushSpans(recorder *tracetest.SpanRecorder) []sdktrace.ReadOnlySpan {
+	var flushes []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "Flush Objects" {
+			flushes = append(flushes, span)
+		}
+	}
+
+	return flushes
+}
+
+func TestS3Batcher(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxMessages int
+		interval    time.Duration
+		payloads    []string
+		close       bool
+		want        []string
+	}{
+		{name: "flushed when full", maxMessages: 3, interval: time.Hour, payloads: []string{"a", "b", "c"}, want: []string{"a\nb\nc\n"}},
+		{name: "flushed after the interval", maxMessages: 10, interval: 10 * time.Millisecond, payloads: []string{"a", "b"}, want: []string{"a\nb\n"}},
+		{name: "flushed on close", maxMessages: 10, interval: time.Hour, payloads: []string{"a", "b"}, close: true, want: []string{"a\nb\n"}},
+		{
+			name:        "several batches",
+			maxMessages: 2,
+			interval:    time.Hour,
+			payloads:    []string{"a", "b", "c"},
+			close:       true,
+			want:        []string{"a\nb\n", "c\n"},
+		},
+		{name: "nothing buffered", maxMessages: 10, interval: time.Hour, close: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			fake := &fakeS3{}
+			server := httptest.NewServer(fake)
+			t.Cleanup(server.Close)
+
+			b := &s3Batcher{
+				client: newS3Client(aws.Config{
+					Region:       "eu-west-1",
+					BaseEndpoint: aws.String(server.URL),
+					Credentials:  aws.AnonymousCredentials{},
+				}),
+				bucket:      "orders",
+				clock:       systemClock{},
+				timeout:     time.Second,
+				maxMessages: tt.maxMessages,
+				interval:    tt.interval,
+			}
+
+			// Each payload is buffered in the span of the message it came from.
+			var buffered []trace.SpanContext
+			for _, payload := range tt.payloads {
+				ctx, span := otel.Tracer("test").Start(context.Background(), "Buffer Object")
+				if err := b.add(ctx, strings.NewReader(payload)); err != nil {
+					t.Fatal(err)
+				}
+
+				span.End()
+				buffered = append(buffered, span.SpanContext())
+			}
+
+			if tt.close {
+				b.Close()
+			}
+
+			// A flush after the interval happens in the background, and its span ends once the object
+			// has been put.
+			deadline := time.Now().Add(time.Second)
+			for len(flushSpans(recorder)) < len(tt.want) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+
+			if len(fake.objects) != len(tt.want) {
+				t.Fatalf("got %d objects, want %d", len(fake.objects), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				if fake.objects[i] != want {
+					t.Errorf("got object %d %q, want %q", i, fake.objects[i], want)
+				}
+
+				if fake.types[i] != "application/gzip" {
+					t.Errorf("got content type %q, want application/gzip", fake.types[i])
+				}
+
+				if !strings.HasSuffix(fake.keys[i], ".gz") {
+					t.Errorf("got key %q, want a .gz key", fake.keys[i])
+				}
+			}
+
+			// Each flush span links to the spans of the payloads in its batch, in order.
+			flushes := flushSpans(recorder)
+			if len(flushes) != len(tt.want) {
+				t.Fatalf("got %d Flush Objects spans, want %d", len(flushes), len(tt.want))
+			}
+
+			var linked []trace.SpanContext
+			for _, span := range flushes {
+				if span.Parent().IsValid() {
+					t.Error("got a Flush Objects span with a parent, want a new root")
+				}
+
+				count, _ := spanAttribute(span, appattr.Key("s3.batch.message_count"))
+				if int(count.AsInt64()) != len(span.Links()) {
+					t.Errorf("got s3.batch.message_count %d, want %d", count.AsInt64(), len(span.Links()))
+				}
+
+				for _, link := range span.Links() {
+					linked = append(linked, link.SpanContext)
+				}
+			}
+
+			if len(linked) != len(buffered) {
+				t.Fatalf("got %d links, want %d", len(linked), len(buffered))
+			}
+
+			for i := range buffered {
+				if !linked[i].Equal(buffered[i]) {
+					t.Errorf("got link %d to span %s, want %s", i, linked[i].SpanID(), buffered[i].SpanID())
+				}
+			}
+		})
+	}
+}
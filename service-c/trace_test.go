@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/awsconfig"
+	"shared/tracetree"
+)
+
+// fakeAWS answers DynamoDB and S3 calls with empty, successful responses.
+func fakeAWS(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_") {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+// newPipelineTest returns a pollerTest whose handler is the pipelineHandler, instrumented as in
+// main, writing to fake DynamoDB and S3 endpoints and making its downstream request to a fake
+// endpoint. The propagators are set as in main.
+func newPipelineTest(t *testing.T) *pollerTest {
+	t.Helper()
+
+	withPropagators(t)
+
+	handler := &pipelineHandler{}
+	pt := newPollerTest(t, handler)
+
+	aws := httptest.NewServer(http.HandlerFunc(fakeAWS))
+	t.Cleanup(aws.Close)
+
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(downstream.Close)
+
+	// The instrumentation takes the tracer provider set by newPollerTest.
+	cfg, err := getAWSConfig(awsconfig.Settings{
+		Region:          "eu-west-1",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		EndpointURL:     aws.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies, _ := newBodyGenerator("random")
+
+	*handler = pipelineHandler{
+		httpClient:   &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		s3Client:     newS3Client(cfg),
+		bucket:       "orders",
+		bodies:       bodies,
+		dynamoClient: newDynamoClient(cfg),
+		table:        "orders",
+		downstream: downstreamConfig{
+			concurrency: 1,
+			maxAttempts: 1,
+			endpoints:   []string{downstream.URL},
+		},
+		operationTimeout: time.Second,
+		clock:            systemClock{},
+	}
+	if err := handler.registerMetrics(noop.NewMeterProvider().Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+
+	return pt
+}
+
+// sentMessage returns a message sent within a span of service-b, recorded by producer, carrying
+// the trace context in its AWSTraceHeader as SQS does.
+func sentMessage(t *testing.T, producer *tracetest.SpanRecorder) sqsTypes.Message {
+	t.Helper()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(producer))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	carrier := propagation.MapCarrier{}
+	ctx, span := tp.Tracer("service-b").Start(context.Background(), "SQS.SendMessage", trace.WithSpanKind(trace.SpanKindProducer))
+	xray.Propagator{}.Inject(ctx, carrier)
+	span.End()
+
+	message := testMessage()
+	message.Attributes = map[string]string{
+		string(sqsTypes.MessageSystemAttributeNameAWSTraceHeader): carrier.Get("X-Amzn-Trace-Id"),
+	}
+
+	return message
+}
+
+// TestMessageTraceHierarchy checks that the trace propagated over SQS continues in service-c,
+// with the DynamoDB, S3 and downstream work under the message's span.
+func TestMessageTraceHierarchy(t *testing.T) {
+	pt := newPipelineTest(t)
+	producer := tracetest.NewSpanRecorder()
+
+	pt.handle(t, sentMessage(t, producer))
+
+	n := tracetree.N
+	tracetree.Assert(t, n("SQS.SendMessage",
+		n("Process Message",
+			n("Write Record", n("DynamoDB.PutItem")),
+			n("Concurrent Work",
+				n("Downstream Requests", n("HTTP GET")),
+				n("Write Object", n("S3.PutObject")),
+			),
+		),
+	), producer.Ended(), pt.spans.Ended())
+}
+
+// TestMessageTraceShape locks in the spans of a processed message, with their kinds, parents and
+// attributes. Run it with -update to rewrite the golden file once a change to the trace is
+// intended.
+func TestMessageTraceShape(t *testing.T) {
+	pt := newPipelineTest(t)
+	producer := tracetest.NewSpanRecorder()
+
+	pt.handle(t, sentMessage(t, producer))
+
+	values := []attribute.Key{
+		"messaging.destination.name",
+		"work.mode",
+		"rpc.system",
+		"rpc.service",
+		"rpc.method",
+		"http.request.method",
+		"http.response.status_code",
+		"aws.dynamodb.table_names",
+	}
+
+	tracetree.Golden(t, filepath.Join("testdata", "message.golden"), tracetree.Shape(values, producer.Ended(), pt.spans.Ended()))
+}
@@ -0,0 +1,22 @@
+// Package appattr builds the keys of the attributes the services define themselves, as opposed
+// to the standard semantic convention attributes.
+package appattr
+
+import (
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// prefix is the namespace from ATTRIBUTE_PREFIX (e.g. "app."), read once per process. When
+// empty, the keys are used as they are.
+var prefix = sync.OnceValue(func() string {
+	return os.Getenv("ATTRIBUTE_PREFIX")
+})
+
+// Key returns the attribute key for name, with the configured namespace applied. Using it for
+// every custom attribute keeps them distinguishable from, and clear of, the semconv keys.
+func Key(name string) attribute.Key {
+	return attribute.Key(prefix() + name)
+}
@@ -0,0 +1,50 @@
+package appattr
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   attribute.Key
+	}{
+		{name: "basket.id", want: "basket.id"},
+		{name: "basket.id", prefix: "app.", want: "app.basket.id"},
+		{name: "payment.amount", want: "payment.amount"},
+		{name: "payment.amount", prefix: "app.", want: "app.payment.amount"},
+	}
+
+	// The prefix is read once per process, so only the rows for this process's prefix run here.
+	for _, tt := range tests {
+		if tt.prefix != os.Getenv("ATTRIBUTE_PREFIX") {
+			continue
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(tt.name); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestKeyWithPrefix re-runs TestKey with ATTRIBUTE_PREFIX set, which is only read once per
+// process.
+func TestKeyWithPrefix(t *testing.T) {
+	if os.Getenv("ATTRIBUTE_PREFIX") != "" {
+		t.Skip("already running with a prefix")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestKey$", "-test.v")
+	cmd.Env = append(os.Environ(), "ATTRIBUTE_PREFIX=app.")
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("with ATTRIBUTE_PREFIX=app.: %v\n%s", err, out)
+	}
+}
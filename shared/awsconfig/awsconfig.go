@@ -0,0 +1,219 @@
+// Package awsconfig loads the AWS SDK config in the same way for every service.
+package awsconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+)
+
+// imdsTimeout bounds each request to the EC2 instance metadata service (IMDS). On EC2 it responds
+// in milliseconds, so a short timeout only matters elsewhere, where it isn't reachable.
+const imdsTimeout = time.Second
+
+// Settings are the parts of the AWS config Load takes from the environment, resolved by
+// LoadSettings. Anything else, such as the region, is resolved by the SDK as usual.
+type Settings struct {
+	// Region is the region set by AWS_REGION, if any. On EC2 it's otherwise resolved from IMDS.
+	Region string `json:"region"`
+
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials, used when both the key
+	// ID and secret are set (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN).
+	// Otherwise Profile picks a named profile (AWS_PROFILE).
+	AccessKeyID     string `json:"accessKeyId" config:"secret"`
+	SecretAccessKey string `json:"secretAccessKey" config:"secret"`
+	SessionToken    string `json:"sessionToken" config:"secret"`
+	Profile         string `json:"profile"`
+
+	// EndpointURL points every client at a local endpoint such as LocalStack (AWS_ENDPOINT_URL).
+	EndpointURL string `json:"endpointUrl"`
+
+	// EC2MetadataDisabled disables IMDS (AWS_EC2_METADATA_DISABLED).
+	EC2MetadataDisabled bool `json:"ec2MetadataDisabled"`
+
+	// UseFIPSEndpoint and UseDualStackEndpoint enable FIPS and dual-stack endpoints
+	// (AWS_USE_FIPS_ENDPOINT and AWS_USE_DUALSTACK_ENDPOINT).
+	UseFIPSEndpoint      bool `json:"useFipsEndpoint"`
+	UseDualStackEndpoint bool `json:"useDualStackEndpoint"`
+}
+
+// LoadSettings resolves the settings from the environment. It returns an error naming the first
+// invalid setting.
+func LoadSettings() (Settings, error) {
+	s := Settings{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Profile:         os.Getenv("AWS_PROFILE"),
+		EndpointURL:     os.Getenv("AWS_ENDPOINT_URL"),
+	}
+
+	for _, setting := range []struct {
+		key     string
+		enabled *bool
+	}{
+		{"AWS_EC2_METADATA_DISABLED", &s.EC2MetadataDisabled},
+		{"AWS_USE_FIPS_ENDPOINT", &s.UseFIPSEndpoint},
+		{"AWS_USE_DUALSTACK_ENDPOINT", &s.UseDualStackEndpoint},
+	} {
+		enabled, err := envBool(setting.key)
+		if err != nil {
+			return Settings{}, err
+		}
+
+		*setting.enabled = enabled
+	}
+
+	return s, nil
+}
+
+// Option customises how Load resolves the config.
+type Option func(*options)
+
+type options struct {
+	settings *Settings
+	loadOpts []func(*config.LoadOptions) error
+	otelOpts []otelaws.Option
+}
+
+// WithSettings makes Load use the given settings, rather than loading them from the environment.
+func WithSettings(s Settings) Option {
+	return func(o *options) {
+		o.settings = &s
+	}
+}
+
+// WithLoadOptions passes extra options to config.LoadDefaultConfig. They're applied after the
+// ones Load sets itself, so they take precedence.
+func WithLoadOptions(opts ...func(*config.LoadOptions) error) Option {
+	return func(o *options) {
+		o.loadOpts = append(o.loadOpts, opts...)
+	}
+}
+
+// WithFIPSEndpoint makes the clients use FIPS endpoints, for regulated environments.
+func WithFIPSEndpoint() Option {
+	return WithLoadOptions(config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+}
+
+// WithDualStackEndpoint makes the clients use dual-stack endpoints, which support IPv6.
+func WithDualStackEndpoint() Option {
+	return WithLoadOptions(config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+}
+
+// WithInstrumentation passes opts to the OpenTelemetry instrumentation of the clients.
+func WithInstrumentation(opts ...otelaws.Option) Option {
+	return func(o *options) {
+		o.otelOpts = append(o.otelOpts, opts...)
+	}
+}
+
+// Load resolves the AWS config and instruments every client created from it with
+// OpenTelemetry. The instrumentation uses the global providers, so Load can be called before
+// the OpenTelemetry SDK is initialised.
+//
+// FIPS and dual-stack endpoints are enabled with AWS_USE_FIPS_ENDPOINT=true and
+// AWS_USE_DUALSTACK_ENDPOINT=true, or with the corresponding options.
+//
+// On EC2, the region and credentials are resolved from IMDS if they aren't otherwise configured.
+// IMDS is disabled entirely with AWS_EC2_METADATA_DISABLED=true, or when AWS_ENDPOINT_URL points
+// the clients at a local endpoint such as LocalStack.
+func Load(opts ...Option) (aws.Config, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := o.settings
+	if s == nil {
+		loaded, err := LoadSettings()
+		if err != nil {
+			return aws.Config{}, err
+		}
+
+		s = &loaded
+	}
+
+	// The options set here go first, so those passed in take precedence.
+	var loadOpts []func(*config.LoadOptions) error
+
+	if s.Region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(s.Region))
+	}
+
+	// When running locally (e.g. against LocalStack) we want to be able to supply static
+	// credentials or pick a named profile. In AWS, neither is set and the default
+	// credential chain (env, shared config, IMDS, ECS task role, etc.) is used instead.
+	switch {
+	case s.AccessKeyID != "" && s.SecretAccessKey != "":
+		provider := credentials.NewStaticCredentialsProvider(s.AccessKeyID, s.SecretAccessKey, s.SessionToken)
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(provider))
+	case s.Profile != "":
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(s.Profile))
+	}
+
+	// Off EC2, the SDK waits for IMDS requests to time out before giving up on it, adding seconds
+	// to startup, so it's disabled when the services obviously aren't using it and otherwise
+	// given a short timeout.
+	if s.EC2MetadataDisabled || s.EndpointURL != "" {
+		loadOpts = append(loadOpts, config.WithEC2IMDSClientEnableState(imds.ClientDisabled))
+	} else {
+		client := imds.New(imds.Options{HTTPClient: awshttp.NewBuildableClient().WithTimeout(imdsTimeout)})
+		loadOpts = append(loadOpts,
+			config.WithEC2IMDSRegion(func(r *config.UseEC2IMDSRegion) { r.Client = client }),
+			config.WithEC2RoleCredentialOptions(func(r *ec2rolecreds.Options) { r.Client = client }),
+		)
+	}
+
+	if s.UseFIPSEndpoint {
+		loadOpts = append(loadOpts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+
+	if s.UseDualStackEndpoint {
+		loadOpts = append(loadOpts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+
+	o.loadOpts = append(loadOpts, o.loadOpts...)
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), o.loadOpts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("unable to load SDK config: %w", err)
+	}
+
+	// The endpoint is set on the config, from where every client takes it, rather than left to the
+	// SDK reading AWS_ENDPOINT_URL, so that it also applies when the settings are passed in.
+	if s.EndpointURL != "" {
+		cfg.BaseEndpoint = aws.String(s.EndpointURL)
+	}
+
+	// Instrument all AWS clients with OpenTelemetry
+	otelaws.AppendMiddlewares(&cfg.APIOptions, o.otelOpts...)
+
+	return cfg, nil
+}
+
+// envBool reads a boolean environment variable, which is false when unset.
+func envBool(key string) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", key, v)
+	}
+
+	return enabled, nil
+}
@@ -0,0 +1,254 @@
+package awsconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestLoadEndpointURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     *string
+	}{
+		{name: "unset"},
+		{name: "localstack", endpoint: "http://localhost:4566", want: aws.String("http://localhost:4566")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(WithSettings(Settings{
+				Region:          "eu-west-1",
+				AccessKeyID:     "test",
+				SecretAccessKey: "test",
+				EndpointURL:     tt.endpoint,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if aws.ToString(cfg.BaseEndpoint) != aws.ToString(tt.want) {
+				t.Errorf("got base endpoint %q, want %q", aws.ToString(cfg.BaseEndpoint), aws.ToString(tt.want))
+			}
+		})
+	}
+}
+
+// TestLoadDisablesIMDS checks that, without other credentials, the credential chain doesn't
+// fall back to IMDS when it's disabled explicitly or a local endpoint is configured.
+func TestLoadDisablesIMDS(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+	}{
+		{name: "endpoint", settings: Settings{Region: "eu-west-1", EndpointURL: "http://localhost:4566"}},
+		{name: "disabled", settings: Settings{Region: "eu-west-1", EC2MetadataDisabled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Keep any credentials on the machine out of the chain.
+			dir := t.TempDir()
+			t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+
+			cfg, err := Load(WithSettings(tt.settings))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = cfg.Credentials.Retrieve(context.Background())
+			if err == nil || !strings.Contains(err.Error(), "access disabled to EC2 IMDS") {
+				t.Errorf("got error %v, want IMDS disabled", err)
+			}
+		})
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   Settings
+		wantKeyID  string
+		wantSource string
+		wantErr    string
+	}{
+		{
+			name:       "static",
+			settings:   Settings{AccessKeyID: "static-id", SecretAccessKey: "static-secret", SessionToken: "token"},
+			wantKeyID:  "static-id",
+			wantSource: credentials.StaticCredentialsName,
+		},
+		{
+			name:      "static takes precedence over the profile",
+			settings:  Settings{AccessKeyID: "static-id", SecretAccessKey: "static-secret", Profile: "local"},
+			wantKeyID: "static-id",
+		},
+		{
+			name:      "profile",
+			settings:  Settings{Profile: "local"},
+			wantKeyID: "profile-id",
+		},
+		{
+			name:     "missing profile",
+			settings: Settings{Profile: "missing"},
+			wantErr:  "unable to load SDK config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+
+			creds := "[local]\naws_access_key_id = profile-id\naws_secret_access_key = profile-secret\n"
+			if err := os.WriteFile(filepath.Join(dir, "credentials"), []byte(creds), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.settings.Region = "eu-west-1"
+			tt.settings.EC2MetadataDisabled = true
+
+			cfg, err := Load(WithSettings(tt.settings))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := cfg.Credentials.Retrieve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.AccessKeyID != tt.wantKeyID {
+				t.Errorf("got access key ID %q, want %q", got.AccessKeyID, tt.wantKeyID)
+			}
+
+			if tt.wantSource != "" && got.Source != tt.wantSource {
+				t.Errorf("got source %q, want %q", got.Source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		settings *Settings
+		want     string
+	}{
+		{name: "from the environment", env: "eu-west-2", want: "eu-west-2"},
+		{name: "from the settings", env: "eu-west-2", settings: &Settings{Region: "us-east-1"}, want: "us-east-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", tt.env)
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+			var opts []Option
+			if tt.settings != nil {
+				opts = append(opts, WithSettings(*tt.settings))
+			}
+
+			cfg, err := Load(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Region != tt.want {
+				t.Errorf("got region %q, want %q", cfg.Region, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEndpointOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		fipsEnv       string
+		dualStackEnv  string
+		settings      *Settings
+		opts          []Option
+		wantFIPS      aws.FIPSEndpointState
+		wantDualStack aws.DualStackEndpointState
+		wantErr       string
+	}{
+		{name: "default"},
+		{name: "FIPS from the environment", fipsEnv: "true", wantFIPS: aws.FIPSEndpointStateEnabled},
+		{name: "dual-stack from the environment", dualStackEnv: "true", wantDualStack: aws.DualStackEndpointStateEnabled},
+		{name: "disabled in the environment", fipsEnv: "false", dualStackEnv: "false"},
+		{
+			name:     "FIPS from the settings",
+			settings: &Settings{Region: "us-east-1", UseFIPSEndpoint: true},
+			wantFIPS: aws.FIPSEndpointStateEnabled,
+		},
+		{name: "FIPS option", opts: []Option{WithFIPSEndpoint()}, wantFIPS: aws.FIPSEndpointStateEnabled},
+		{
+			name:          "dual-stack option",
+			opts:          []Option{WithDualStackEndpoint()},
+			wantDualStack: aws.DualStackEndpointStateEnabled,
+		},
+		{name: "invalid", fipsEnv: "sometimes", wantErr: "invalid AWS_USE_FIPS_ENDPOINT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", "us-east-1")
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+			t.Setenv("AWS_USE_FIPS_ENDPOINT", tt.fipsEnv)
+			t.Setenv("AWS_USE_DUALSTACK_ENDPOINT", tt.dualStackEnv)
+
+			opts := tt.opts
+			if tt.settings != nil {
+				opts = append(opts, WithSettings(*tt.settings))
+			}
+
+			cfg, err := Load(opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The clients resolve their endpoints from the load options recorded on the config.
+			var loadOpts config.LoadOptions
+			for _, source := range cfg.ConfigSources {
+				if o, ok := source.(config.LoadOptions); ok {
+					loadOpts = o
+					break
+				}
+			}
+
+			if loadOpts.UseFIPSEndpoint != tt.wantFIPS {
+				t.Errorf("got FIPS endpoint state %v, want %v", loadOpts.UseFIPSEndpoint, tt.wantFIPS)
+			}
+
+			if loadOpts.UseDualStackEndpoint != tt.wantDualStack {
+				t.Errorf("got dual-stack endpoint state %v, want %v", loadOpts.UseDualStackEndpoint, tt.wantDualStack)
+			}
+		})
+	}
+}
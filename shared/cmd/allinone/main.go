@@ -0,0 +1,143 @@
+// Command allinone runs service-a, service-b and service-c together for local development,
+// without Docker. Each service is built from the workspace and started as a child process,
+// wired to the others over loopback HTTP, with its output prefixed by the service name. All
+// three export to the same collector and keep their own service.name, so a checkout still
+// shows up as one trace across three services.
+//
+// The services are separate main packages in separate modules, so they run as child
+// processes rather than sharing an address space; the separate binaries are unchanged.
+// Interrupting the command stops all three, giving each the chance to drain.
+//
+// Running the three services in a single process, sharing one telemetry pipeline while keeping
+// a service.name each, is out of scope: it would need the services turned into libraries and
+// a provider per service, for no difference in the traces the collector receives.
+//
+// The AWS configuration service-b and service-c need (queue URL, table and bucket names) is
+// read from the environment as usual. Pass -aws-endpoint to point the AWS SDK at LocalStack.
+//
+// Usage (from the repository root):
+//
+//	allinone -aws-endpoint http://localhost:4566
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var services = []string{"service-a", "service-b", "service-c"}
+
+// stopTimeout bounds how long a service has to exit after being asked to stop. It's longer
+// than service-c's default drain timeout.
+const stopTimeout = 35 * time.Second
+
+func main() {
+	root := flag.String("root", ".", "path to the repository root containing go.work")
+	awsEndpoint := flag.String("aws-endpoint", "", "AWS endpoint URL to use for every AWS service, e.g. LocalStack's")
+	flag.Parse()
+
+	binDir, err := os.MkdirTemp("", "allinone")
+	if err != nil {
+		log.Fatalf("error creating build directory: %v", err)
+	}
+	defer os.RemoveAll(binDir)
+
+	for _, name := range services {
+		if err := build(*root, name, binDir); err != nil {
+			log.Fatalf("error building %s: %v", name, err)
+		}
+	}
+
+	env := append(os.Environ(), "PAYMENT_SERVICE_HOST=http://localhost:8001")
+	if *awsEndpoint != "" {
+		env = append(env, "AWS_ENDPOINT_URL="+*awsEndpoint)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, name := range services {
+		cmd, err := start(ctx, filepath.Join(binDir, name), name, env)
+		if err != nil {
+			stop()
+			log.Printf("error starting %s: %v", name, err)
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// If one service exits, stop the others rather than leave a partial demo running.
+			defer stop()
+
+			if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+				log.Printf("%s exited: %v", name, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// build compiles the named service into binDir.
+func build(root, name, binDir string) error {
+	cmd := exec.Command("go", "build", "-o", filepath.Join(binDir, name), "./"+name)
+	cmd.Dir = root
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// start runs the binary at path, prefixing every line it writes with the service name. The
+// process is sent SIGTERM when ctx is cancelled, and killed if it hasn't exited by stopTimeout.
+func start(ctx context.Context, path, name string, env []string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = env
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = stopTimeout
+
+	out := &prefixWriter{out: log.New(os.Stdout, fmt.Sprintf("[%s] ", name), 0)}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	return cmd, cmd.Start()
+}
+
+// prefixWriter writes each complete line it receives through a logger that adds the prefix,
+// holding back a partial line until the rest of it arrives.
+type prefixWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	out *log.Logger
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.out.Println(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
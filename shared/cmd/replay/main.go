@@ -0,0 +1,351 @@
+// Command replay re-exports spans captured by the file exporter (see TRACES_FILE_PATH) to a
+// live OTLP endpoint. Trace and span IDs are preserved, and the timestamps are shifted so the
+// replayed trace appears recent in the backend. This lets a presenter capture a good demo run
+// once and replay it deterministically on stage.
+//
+// Note that X-Ray trace IDs embed the time the trace started, and X-Ray rejects traces whose
+// ID is more than 30 days old, so captures need to be replayed within that window.
+//
+// Usage:
+//
+//	replay -file spans.json -endpoint localhost:4317 -shift auto
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+func main() {
+	// The spans are replayed over gRPC, whatever protocol the services export with.
+	defaultEndpoint := telemetry.OTLPEndpointFor(telemetry.SignalTraces, telemetry.ProtocolGRPC)
+
+	file := flag.String("file", "spans.json", "newline-delimited span JSON file written by the file exporter")
+	endpoint := flag.String("endpoint", defaultEndpoint, "OTLP gRPC endpoint to export the spans to")
+	shift := flag.String("shift", "auto", `how far to move the span timestamps forward: "auto" to make the trace end now, or a duration such as "72h" ("0" keeps the original times)`)
+	flag.Parse()
+
+	stubs, err := readSpans(*file)
+	if err != nil {
+		log.Fatalf("error reading spans: %v", err)
+	}
+
+	if len(stubs) == 0 {
+		log.Fatalf("no spans found in %s", *file)
+	}
+
+	offset, err := timeShift(*shift, stubs)
+	if err != nil {
+		log.Fatalf("invalid shift: %v", err)
+	}
+
+	for i := range stubs {
+		shiftSpan(&stubs[i], offset)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure(), otlptracegrpc.WithEndpoint(*endpoint))
+	if err != nil {
+		log.Fatalf("failed to create new otlp trace exporter: %v", err)
+	}
+	defer func() { _ = exporter.Shutdown(context.Background()) }()
+
+	if err := exporter.ExportSpans(ctx, stubs.Snapshots()); err != nil {
+		log.Fatalf("error exporting spans: %v", err)
+	}
+
+	fmt.Printf("replayed %d spans to %s (shifted by %s)\n", len(stubs), *endpoint, offset)
+}
+
+// timeShift resolves the -shift flag into the offset to apply to every timestamp.
+func timeShift(shift string, stubs tracetest.SpanStubs) (time.Duration, error) {
+	if shift != "auto" {
+		return time.ParseDuration(shift)
+	}
+
+	// Move the whole capture forward so that the last span ends now, keeping the relative
+	// timing between spans intact.
+	var latest time.Time
+	for _, stub := range stubs {
+		if stub.EndTime.After(latest) {
+			latest = stub.EndTime
+		}
+	}
+
+	return time.Since(latest), nil
+}
+
+func shiftSpan(stub *tracetest.SpanStub, offset time.Duration) {
+	stub.StartTime = stub.StartTime.Add(offset)
+	stub.EndTime = stub.EndTime.Add(offset)
+
+	for i := range stub.Events {
+		stub.Events[i].Time = stub.Events[i].Time.Add(offset)
+	}
+}
+
+func readSpans(path string) (tracetest.SpanStubs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stubs tracetest.SpanStubs
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record spanRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		stub, err := record.stub()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		stubs = append(stubs, stub)
+	}
+
+	return stubs, scanner.Err()
+}
+
+// spanRecord mirrors the JSON written by the stdout exporter for a tracetest.SpanStub. The
+// SDK types only implement json.Marshaler, so the span has to be decoded by hand.
+type spanRecord struct {
+	Name                   string
+	SpanContext            spanContextRecord
+	Parent                 spanContextRecord
+	SpanKind               trace.SpanKind
+	StartTime              time.Time
+	EndTime                time.Time
+	Attributes             []keyValueRecord
+	Events                 []eventRecord
+	Links                  []linkRecord
+	Status                 sdktrace.Status
+	DroppedAttributes      int
+	DroppedEvents          int
+	DroppedLinks           int
+	ChildSpanCount         int
+	Resource               []keyValueRecord
+	InstrumentationLibrary instrumentation.Library
+}
+
+type spanContextRecord struct {
+	TraceID    string
+	SpanID     string
+	TraceFlags string
+	TraceState string
+	Remote     bool
+}
+
+type keyValueRecord struct {
+	Key   string
+	Value struct {
+		Type  string
+		Value json.RawMessage
+	}
+}
+
+type eventRecord struct {
+	Name                  string
+	Attributes            []keyValueRecord
+	DroppedAttributeCount int
+	Time                  time.Time
+}
+
+type linkRecord struct {
+	SpanContext           spanContextRecord
+	Attributes            []keyValueRecord
+	DroppedAttributeCount int
+}
+
+func (r spanRecord) stub() (tracetest.SpanStub, error) {
+	spanContext, err := r.SpanContext.spanContext()
+	if err != nil {
+		return tracetest.SpanStub{}, fmt.Errorf("span context: %w", err)
+	}
+
+	// Root spans have an empty parent, which is left as an invalid SpanContext.
+	var parent trace.SpanContext
+	if r.Parent.SpanID != "" && r.Parent.SpanID != (trace.SpanID{}).String() {
+		if parent, err = r.Parent.spanContext(); err != nil {
+			return tracetest.SpanStub{}, fmt.Errorf("parent: %w", err)
+		}
+	}
+
+	attrs, err := attributes(r.Attributes)
+	if err != nil {
+		return tracetest.SpanStub{}, err
+	}
+
+	resourceAttrs, err := attributes(r.Resource)
+	if err != nil {
+		return tracetest.SpanStub{}, err
+	}
+
+	events := make([]sdktrace.Event, 0, len(r.Events))
+	for _, e := range r.Events {
+		eventAttrs, err := attributes(e.Attributes)
+		if err != nil {
+			return tracetest.SpanStub{}, err
+		}
+
+		events = append(events, sdktrace.Event{
+			Name:                  e.Name,
+			Attributes:            eventAttrs,
+			DroppedAttributeCount: e.DroppedAttributeCount,
+			Time:                  e.Time,
+		})
+	}
+
+	links := make([]sdktrace.Link, 0, len(r.Links))
+	for _, l := range r.Links {
+		linkContext, err := l.SpanContext.spanContext()
+		if err != nil {
+			return tracetest.SpanStub{}, fmt.Errorf("link: %w", err)
+		}
+
+		linkAttrs, err := attributes(l.Attributes)
+		if err != nil {
+			return tracetest.SpanStub{}, err
+		}
+
+		links = append(links, sdktrace.Link{
+			SpanContext:           linkContext,
+			Attributes:            linkAttrs,
+			DroppedAttributeCount: l.DroppedAttributeCount,
+		})
+	}
+
+	return tracetest.SpanStub{
+		Name:                   r.Name,
+		SpanContext:            spanContext,
+		Parent:                 parent,
+		SpanKind:               r.SpanKind,
+		StartTime:              r.StartTime,
+		EndTime:                r.EndTime,
+		Attributes:             attrs,
+		Events:                 events,
+		Links:                  links,
+		Status:                 r.Status,
+		DroppedAttributes:      r.DroppedAttributes,
+		DroppedEvents:          r.DroppedEvents,
+		DroppedLinks:           r.DroppedLinks,
+		ChildSpanCount:         r.ChildSpanCount,
+		Resource:               resource.NewSchemaless(resourceAttrs...),
+		InstrumentationLibrary: r.InstrumentationLibrary,
+	}, nil
+}
+
+func (r spanContextRecord) spanContext() (trace.SpanContext, error) {
+	traceID, err := trace.TraceIDFromHex(r.TraceID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	spanID, err := trace.SpanIDFromHex(r.SpanID)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	flags, err := strconv.ParseUint(r.TraceFlags, 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, fmt.Errorf("trace flags: %w", err)
+	}
+
+	traceState, err := trace.ParseTraceState(r.TraceState)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.TraceFlags(flags),
+		TraceState: traceState,
+		Remote:     r.Remote,
+	}), nil
+}
+
+func attributes(records []keyValueRecord) ([]attribute.KeyValue, error) {
+	attrs := make([]attribute.KeyValue, 0, len(records))
+
+	for _, r := range records {
+		kv, err := r.keyValue()
+		if err != nil {
+			return nil, fmt.Errorf("attribute %q: %w", r.Key, err)
+		}
+
+		attrs = append(attrs, kv)
+	}
+
+	return attrs, nil
+}
+
+func (r keyValueRecord) keyValue() (attribute.KeyValue, error) {
+	key := attribute.Key(r.Key)
+	raw := r.Value.Value
+
+	switch r.Value.Type {
+	case "BOOL":
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return key.Bool(v), err
+	case "INT64":
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return key.Int64(v), err
+	case "FLOAT64":
+		var v float64
+		err := json.Unmarshal(raw, &v)
+		return key.Float64(v), err
+	case "STRING":
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return key.String(v), err
+	case "BOOLSLICE":
+		var v []bool
+		err := json.Unmarshal(raw, &v)
+		return key.BoolSlice(v), err
+	case "INT64SLICE":
+		var v []int64
+		err := json.Unmarshal(raw, &v)
+		return key.Int64Slice(v), err
+	case "FLOAT64SLICE":
+		var v []float64
+		err := json.Unmarshal(raw, &v)
+		return key.Float64Slice(v), err
+	case "STRINGSLICE":
+		var v []string
+		err := json.Unmarshal(raw, &v)
+		return key.StringSlice(v), err
+	default:
+		return attribute.KeyValue{}, fmt.Errorf("unsupported type %q", r.Value.Type)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// capture writes a checkout's spans to a file as the file exporter does, returning the path and
+// the spans as they were recorded.
+func capture(t *testing.T) (string, []sdktrace.ReadOnlySpan) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "spans.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	tracer := tp.Tracer("service-a/checkout")
+
+	ctx, root := tracer.Start(context.Background(), "GET /checkout", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := tracer.Start(ctx, "Make Payment",
+		trace.WithLinks(trace.Link{SpanContext: root.SpanContext(), Attributes: []attribute.KeyValue{attribute.String("link.reason", "test")}}),
+		trace.WithAttributes(
+			attribute.String("basket.id", "42"),
+			attribute.Int("attempt", 2),
+			attribute.Float64("payment.amount", 12.5),
+			attribute.Bool("synthetic", true),
+			attribute.StringSlice("failed.branches", []string{"s3", "downstream"}),
+			attribute.Int64Slice("sizes", []int64{1, 2}),
+		))
+	child.AddEvent("payment.receipt.generated", trace.WithAttributes(attribute.String("payment.receipt.id", "r-1")))
+	child.SetStatus(codes.Error, "payment failed")
+	child.End()
+	root.End()
+
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, recorder.Ended()
+}
+
+func TestReadSpans(t *testing.T) {
+	path, recorded := capture(t)
+
+	stubs, err := readSpans(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stubs) != len(recorded) {
+		t.Fatalf("got %d spans, want %d", len(stubs), len(recorded))
+	}
+
+	for i, want := range tracetest.SpanStubsFromReadOnlySpans(recorded) {
+		got := stubs[i]
+
+		if got.Name != want.Name || got.SpanKind != want.SpanKind || got.Status != want.Status {
+			t.Errorf("got span %q (%v, %v), want %q (%v, %v)", got.Name, got.SpanKind, got.Status, want.Name, want.SpanKind, want.Status)
+		}
+
+		if !got.SpanContext.Equal(want.SpanContext) || got.Parent.SpanID() != want.Parent.SpanID() {
+			t.Errorf("%s: got span context %v with parent %v, want %v with parent %v", want.Name, got.SpanContext, got.Parent.SpanID(), want.SpanContext, want.Parent.SpanID())
+		}
+
+		if !got.StartTime.Equal(want.StartTime) || !got.EndTime.Equal(want.EndTime) {
+			t.Errorf("%s: got times %s to %s, want %s to %s", want.Name, got.StartTime, got.EndTime, want.StartTime, want.EndTime)
+		}
+
+		if gotAttrs, wantAttrs := attribute.NewSet(got.Attributes...), attribute.NewSet(want.Attributes...); !gotAttrs.Equals(&wantAttrs) {
+			t.Errorf("%s: got attributes %v, want %v", want.Name, got.Attributes, want.Attributes)
+		}
+
+		if len(got.Events) != len(want.Events) || len(got.Links) != len(want.Links) {
+			t.Fatalf("%s: got %d events and %d links, want %d and %d", want.Name, len(got.Events), len(got.Links), len(want.Events), len(want.Links))
+		}
+
+		for j := range want.Events {
+			if got.Events[j].Name != want.Events[j].Name || !got.Events[j].Time.Equal(want.Events[j].Time) {
+				t.Errorf("%s: got event %q at %s, want %q at %s", want.Name, got.Events[j].Name, got.Events[j].Time, want.Events[j].Name, want.Events[j].Time)
+			}
+		}
+
+		for j := range want.Links {
+			if !got.Links[j].SpanContext.Equal(want.Links[j].SpanContext) {
+				t.Errorf("%s: got link to %v, want %v", want.Name, got.Links[j].SpanContext, want.Links[j].SpanContext)
+			}
+		}
+	}
+}
+
+func TestReadSpansInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "not json", content: "spans\n"},
+		{name: "bad trace ID", content: `{"Name":"x","SpanContext":{"TraceID":"zz","SpanID":"0102030405060708","TraceFlags":"01"}}` + "\n"},
+		{name: "unsupported attribute", content: `{"Name":"x","SpanContext":{"TraceID":"0102030405060708090a0b0c0d0e0f10","SpanID":"0102030405060708","TraceFlags":"01"},"Attributes":[{"Key":"k","Value":{"Type":"MAP","Value":{}}}]}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spans.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := readSpans(path); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestTimeShift(t *testing.T) {
+	end := time.Now().Add(-72 * time.Hour)
+	stubs := tracetest.SpanStubs{
+		{StartTime: end.Add(-2 * time.Second), EndTime: end.Add(-time.Second)},
+		{StartTime: end.Add(-3 * time.Second), EndTime: end},
+	}
+
+	tests := []struct {
+		shift   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{shift: "0", want: 0},
+		{shift: "24h", want: 24 * time.Hour},
+		{shift: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := timeShift(tt.shift, stubs)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("timeShift(%q) = %s, %v, want %s", tt.shift, got, err, tt.want)
+		}
+	}
+
+	// With auto, the last span is moved to end now.
+	offset, err := timeShift("auto", stubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := end.Add(offset); time.Since(got) > time.Minute || time.Since(got) < 0 {
+		t.Errorf("got the last span ending at %s, want it to end now", got)
+	}
+}
+
+func TestShiftSpan(t *testing.T) {
+	start := time.Date(2022, time.October, 19, 19, 0, 0, 0, time.UTC)
+	stub := tracetest.SpanStub{
+		StartTime: start,
+		EndTime:   start.Add(time.Second),
+		Events:    []sdktrace.Event{{Name: "payment.receipt.generated", Time: start.Add(500 * time.Millisecond)}},
+	}
+
+	shiftSpan(&stub, time.Hour)
+
+	if !stub.StartTime.Equal(start.Add(time.Hour)) || !stub.EndTime.Equal(start.Add(time.Hour+time.Second)) {
+		t.Errorf("got times %s to %s", stub.StartTime, stub.EndTime)
+	}
+
+	if !stub.Events[0].Time.Equal(start.Add(time.Hour + 500*time.Millisecond)) {
+		t.Errorf("got the event at %s", stub.Events[0].Time)
+	}
+}
@@ -0,0 +1,197 @@
+// Package config prints the configuration a service resolved from its environment, so operators
+// can check what a deployment will actually do without starting it.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// redacted replaces the values of sensitive settings.
+const redacted = "REDACTED"
+
+// sharedSettings are the environment variables read directly by the shared packages, as they're
+// needed before the configuration is loaded. The OTEL_ and AWS_ ones, which the SDKs also read
+// themselves, are always included.
+var sharedSettings = []string{
+	"ATTRIBUTE_PREFIX",
+	"LOG_FORMAT",
+	"LOG_LEVEL",
+	"TRACE_STARTUP",
+}
+
+// sensitive are the parts of an environment variable's name that mark its value as a secret,
+// such as credentials or the OTLP headers, which usually carry an API key.
+var sensitive = []string{"ACCESS_KEY", "SECRET", "TOKEN", "PASSWORD", "HEADERS"}
+
+// PrintRequested reports whether the service was asked to print its configuration and exit,
+// with the --print-config flag or PRINT_CONFIG=true.
+func PrintRequested() bool {
+	return slices.Contains(os.Args[1:], "--print-config") || os.Getenv("PRINT_CONFIG") == "true"
+}
+
+// Print writes the service's configuration as JSON, alongside the environment variables the
+// shared packages and SDKs read for themselves.
+//
+// The service's configuration is written using the field names in its json tags. Values with a
+// String method, such as durations, are written as strings. The value of any field tagged
+// `config:"secret"` is redacted, as is any user info in the URLs of a field tagged `config:"url"`.
+func Print(w io.Writer, service any) error {
+	out := map[string]any{
+		"service":     value(reflect.ValueOf(service)),
+		"environment": environment(),
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+
+	return nil
+}
+
+// environment returns the shared settings that are set, with the sensitive values redacted.
+func environment() map[string]string {
+	env := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		key, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, "OTEL_") && !strings.HasPrefix(key, "AWS_") && !slices.Contains(sharedSettings, key) {
+			continue
+		}
+
+		switch {
+		case isSensitive(key) && v != "":
+			v = redacted
+		case strings.Contains(key, "ENDPOINT"):
+			endpoints := strings.Split(v, ",")
+			for i, endpoint := range endpoints {
+				endpoints[i] = redactEndpoint(strings.TrimSpace(endpoint))
+			}
+
+			v = strings.Join(endpoints, ",")
+		}
+
+		env[key] = v
+	}
+
+	return env
+}
+
+func isSensitive(key string) bool {
+	for _, s := range sensitive {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// value converts v into a form that encodes to readable JSON.
+func value(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return value(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]any)
+
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			switch name {
+			case "-":
+				continue
+			case "":
+				name = field.Name
+			}
+
+			switch field.Tag.Get("config") {
+			case "secret":
+				if !v.Field(i).IsZero() {
+					fields[name] = redacted
+					continue
+				}
+			case "url":
+				fields[name] = redactURLs(v.Field(i))
+				continue
+			}
+
+			fields[name] = value(v.Field(i))
+		}
+
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = value(v.Index(i))
+		}
+
+		return items
+	case reflect.Map:
+		entries := make(map[string]any, v.Len())
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = value(v.MapIndex(key))
+		}
+
+		return entries
+	default:
+		return v.Interface()
+	}
+}
+
+// redactURLs returns the URL, or URLs, in v with any user info hidden.
+func redactURLs(v reflect.Value) any {
+	switch urls := v.Interface().(type) {
+	case string:
+		return redactEndpoint(urls)
+	case []string:
+		redacted := make([]string, len(urls))
+		for i, u := range urls {
+			redacted[i] = redactEndpoint(u)
+		}
+
+		return redacted
+	default:
+		return value(v)
+	}
+}
+
+// redactEndpoint hides any user info in an endpoint URL.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return endpoint
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,95 @@
+// Package delay injects artificial latency at chosen points in the services, so presenters can
+// shape the trace waterfalls shown in a demo.
+package delay
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"shared/appattr"
+)
+
+// Delay is a fixed delay, or a random one within a range. The zero Delay injects nothing.
+type Delay struct {
+	min, max time.Duration
+}
+
+// Parse parses a delay from its configured form: a duration such as "200ms" for a fixed delay,
+// or a range such as "100ms-500ms" for a random one. An empty string is no delay.
+func Parse(s string) (Delay, error) {
+	if s == "" {
+		return Delay{}, nil
+	}
+
+	lower, upper, isRange := strings.Cut(s, "-")
+
+	minDelay, err := time.ParseDuration(lower)
+	if err != nil {
+		return Delay{}, err
+	}
+
+	maxDelay := minDelay
+	if isRange {
+		if maxDelay, err = time.ParseDuration(upper); err != nil {
+			return Delay{}, err
+		}
+	}
+
+	if minDelay < 0 || maxDelay < minDelay {
+		return Delay{}, fmt.Errorf("invalid delay range %q", s)
+	}
+
+	return Delay{min: minDelay, max: maxDelay}, nil
+}
+
+// Enabled reports whether the delay injects anything.
+func (d Delay) Enabled() bool {
+	return d.max > 0
+}
+
+// String returns the delay in the form Parse accepts, or "" for no delay.
+func (d Delay) String() string {
+	switch {
+	case !d.Enabled():
+		return ""
+	case d.min == d.max:
+		return d.min.String()
+	default:
+		return d.min.String() + "-" + d.max.String()
+	}
+}
+
+// Inject waits for the delay within an Artificial Delay span, recording how long it waited as
+// injected.delay_ms. It returns early with the context's error if ctx is done first.
+func (d Delay) Inject(ctx context.Context) error {
+	if !d.Enabled() {
+		return nil
+	}
+
+	wait := d.min
+	if d.max > d.min {
+		wait += time.Duration(rand.Int63n(int64(d.max - d.min)))
+	}
+
+	ctx, span := otel.GetTracerProvider().Tracer("shared/delay").Start(ctx, "Artificial Delay")
+	defer span.End()
+
+	span.SetAttributes(appattr.Key("injected.delay_ms").Int64(wait.Milliseconds()))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		span.SetStatus(codes.Error, "delay interrupted")
+		return ctx.Err()
+	}
+}
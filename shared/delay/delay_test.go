@@ -0,0 +1,141 @@
+package delay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/appattr"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Delay
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "fixed", s: "200ms", want: Delay{min: 200 * time.Millisecond, max: 200 * time.Millisecond}},
+		{name: "range", s: "100ms-500ms", want: Delay{min: 100 * time.Millisecond, max: 500 * time.Millisecond}},
+		{name: "not a duration", s: "briefly", wantErr: true},
+		{name: "range upside down", s: "500ms-100ms", wantErr: true},
+		{name: "negative", s: "-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			// A delay prints as it was configured.
+			if got.String() != tt.s {
+				t.Errorf("got String() %q, want %q", got.String(), tt.s)
+			}
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     string
+		timeout   time.Duration
+		wantSpan  bool
+		wantErr   bool
+		wantRange [2]int64
+	}{
+		{name: "disabled"},
+		{name: "fixed", delay: "20ms", wantSpan: true, wantRange: [2]int64{20, 20}},
+		{name: "random", delay: "10ms-30ms", wantSpan: true, wantRange: [2]int64{10, 30}},
+		{name: "cancelled", delay: "1h", timeout: 10 * time.Millisecond, wantSpan: true, wantErr: true, wantRange: [2]int64{3600000, 3600000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+			d, err := Parse(tt.delay)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "checkout")
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			err = d.Inject(ctx)
+			elapsed := time.Since(start)
+			parent.End()
+
+			if gotErr := err != nil; gotErr != tt.wantErr || (tt.wantErr && !errors.Is(err, context.DeadlineExceeded)) {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			var delays []sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				if span.Name() == "Artificial Delay" {
+					delays = append(delays, span)
+				}
+			}
+
+			if !tt.wantSpan {
+				if len(delays) != 0 {
+					t.Errorf("got %d Artificial Delay spans, want none", len(delays))
+				}
+
+				return
+			}
+
+			if len(delays) != 1 {
+				t.Fatalf("got %d Artificial Delay spans, want 1", len(delays))
+			}
+			span := delays[0]
+
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("got the Artificial Delay span outside the checkout span, want it a child")
+			}
+
+			attrs := attribute.NewSet(span.Attributes()...)
+			injected, _ := attrs.Value(appattr.Key("injected.delay_ms"))
+			if ms := injected.AsInt64(); ms < tt.wantRange[0] || ms > tt.wantRange[1] {
+				t.Errorf("got injected.delay_ms %d, want %d to %d", ms, tt.wantRange[0], tt.wantRange[1])
+			}
+
+			if !tt.wantErr && elapsed < time.Duration(injected.AsInt64())*time.Millisecond {
+				t.Errorf("got a delay of %s, want at least %dms", elapsed, injected.AsInt64())
+			}
+
+			if got := span.Status().Code == codes.Error; got != tt.wantErr {
+				t.Errorf("got errored %t, want %t", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package logging configures a structured, levelled logger in the same way for every service.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"shared/requestid"
+)
+
+// New returns a logger configured from the environment:
+//
+//   - LOG_LEVEL sets the minimum level: debug, info, warn or error. Defaults to info.
+//   - LOG_FORMAT selects json or text output. Defaults to json.
+//
+// Records logged with a context carrying a span are annotated with its trace and span IDs, so
+// log lines can be correlated with the trace they were written during. Likewise, records logged
+// with a context carrying a request ID are annotated with it.
+func New() *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level(os.Getenv("LOG_LEVEL"))}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	return slog.New(traceHandler{handler})
+}
+
+func level(s string) slog.Level {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// traceHandler adds the IDs of the span and the request in the record's context to each record.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	if id, ok := requestid.FromContext(ctx); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"shared/requestid"
+)
+
+func TestTraceCorrelation(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	spanCtx, span := tp.Tracer("test").Start(context.Background(), "checkout")
+	defer span.End()
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		wantSpan      trace.SpanContext
+		wantRequestID string
+	}{
+		{name: "within a span", ctx: spanCtx, wantSpan: span.SpanContext()},
+		{name: "outside a span", ctx: context.Background()},
+		{
+			name:          "within a span and a request",
+			ctx:           requestid.NewContext(spanCtx, "req-123"),
+			wantSpan:      span.SpanContext(),
+			wantRequestID: "req-123",
+		},
+		{name: "with an invalid span context", ctx: trace.ContextWithSpanContext(context.Background(), trace.SpanContext{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sink bytes.Buffer
+			logger := slog.New(traceHandler{slog.NewJSONHandler(&sink, nil)})
+
+			logger.InfoContext(tt.ctx, "payment taken")
+
+			var record map[string]any
+			if err := json.Unmarshal(sink.Bytes(), &record); err != nil {
+				t.Fatalf("error decoding the log record %q: %v", sink.String(), err)
+			}
+
+			want := map[string]string{"request_id": tt.wantRequestID}
+			if tt.wantSpan.IsValid() {
+				want["trace_id"] = tt.wantSpan.TraceID().String()
+				want["span_id"] = tt.wantSpan.SpanID().String()
+			}
+
+			for _, key := range []string{"trace_id", "span_id", "request_id"} {
+				got, ok := record[key]
+				switch {
+				case want[key] == "" && ok:
+					t.Errorf("%s = %v, want it omitted", key, got)
+				case want[key] != "" && got != want[key]:
+					t.Errorf("%s = %v, want %s", key, got, want[key])
+				}
+			}
+		})
+	}
+}
+
+func TestTraceCorrelationWithAttrsAndGroup(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "checkout")
+	defer span.End()
+
+	var sink bytes.Buffer
+	logger := slog.New(traceHandler{slog.NewJSONHandler(&sink, nil)}).With("service", "service-a").WithGroup("payment")
+
+	logger.InfoContext(ctx, "payment taken", "amount", 10)
+
+	var record struct {
+		Service string `json:"service"`
+		Payment struct {
+			TraceID string `json:"trace_id"`
+			SpanID  string `json:"span_id"`
+		} `json:"payment"`
+	}
+	if err := json.Unmarshal(sink.Bytes(), &record); err != nil {
+		t.Fatalf("error decoding the log record %q: %v", sink.String(), err)
+	}
+
+	if record.Service != "service-a" {
+		t.Errorf("service = %q, want service-a", record.Service)
+	}
+	if got, want := record.Payment.TraceID, span.SpanContext().TraceID().String(); got != want {
+		t.Errorf("trace_id = %q, want %q", got, want)
+	}
+	if got, want := record.Payment.SpanID, span.SpanContext().SpanID().String(); got != want {
+		t.Errorf("span_id = %q, want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		format    string
+		wantLevel slog.Level
+		wantText  bool
+	}{
+		{name: "defaults", wantLevel: slog.LevelInfo},
+		{name: "debug", level: "debug", wantLevel: slog.LevelDebug},
+		{name: "warn", level: "WARN", wantLevel: slog.LevelWarn},
+		{name: "warning", level: "warning", wantLevel: slog.LevelWarn},
+		{name: "error", level: "error", wantLevel: slog.LevelError},
+		{name: "unknown level", level: "verbose", wantLevel: slog.LevelInfo},
+		{name: "text", format: "TEXT", wantLevel: slog.LevelInfo, wantText: true},
+		{name: "json", format: "json", wantLevel: slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.level)
+			t.Setenv("LOG_FORMAT", tt.format)
+
+			logger := New()
+
+			for _, l := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+				if got, want := logger.Enabled(context.Background(), l), l >= tt.wantLevel; got != want {
+					t.Errorf("got %s enabled %t, want %t", l, got, want)
+				}
+			}
+
+			handler, ok := logger.Handler().(traceHandler)
+			if !ok {
+				t.Fatalf("got handler %T, want traceHandler", logger.Handler())
+			}
+
+			if _, text := handler.Handler.(*slog.TextHandler); text != tt.wantText {
+				t.Errorf("got handler %T, want text %t", handler.Handler, tt.wantText)
+			}
+		})
+	}
+}
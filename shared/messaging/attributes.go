@@ -0,0 +1,18 @@
+// Package messaging holds span attributes shared by the services that produce and consume
+// SQS messages.
+package messaging
+
+import "go.opentelemetry.io/otel/attribute"
+
+// PayloadSizeKey is the size of the message body in bytes.
+const PayloadSizeKey = attribute.Key("messaging.message.payload_size_bytes")
+
+// PayloadSize returns the payload size attribute for a message body. A nil body is reported
+// as zero bytes.
+func PayloadSize(body *string) attribute.KeyValue {
+	if body == nil {
+		return PayloadSizeKey.Int(0)
+	}
+
+	return PayloadSizeKey.Int(len(*body))
+}
@@ -0,0 +1,31 @@
+package messaging
+
+import "testing"
+
+func TestPayloadSize(t *testing.T) {
+	body := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		body *string
+		want int64
+	}{
+		{name: "nil"},
+		{name: "empty", body: body("")},
+		{name: "ascii", body: body(`{"transactionId":"abc"}`), want: 23},
+		{name: "multibyte", body: body(`{"currency":"€"}`), want: 18},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PayloadSize(tt.body)
+			if got.Key != PayloadSizeKey {
+				t.Errorf("got key %q, want %q", got.Key, PayloadSizeKey)
+			}
+
+			if got.Value.AsInt64() != tt.want {
+				t.Errorf("got %d bytes, want %d", got.Value.AsInt64(), tt.want)
+			}
+		})
+	}
+}
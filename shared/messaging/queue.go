@@ -0,0 +1,45 @@
+package messaging
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// queueNamePattern matches a valid SQS queue name: up to 80 alphanumeric characters, hyphens and
+// underscores, with a ".fifo" suffix for a FIFO queue.
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,80}(\.fifo)?$`)
+
+// queueNames caches the names parsed from queue URLs, as they're needed for every span and
+// metric but only a handful of URLs are ever seen.
+var queueNames sync.Map
+
+// QueueName returns the name of the queue at an SQS queue URL, which is its last path segment,
+// e.g. "payments" for "https://sqs.us-east-1.amazonaws.com/123456789012/payments", or
+// "payments.fifo" for a FIFO queue. It returns "" if the URL isn't a valid queue URL, of the
+// form scheme://host/account/name.
+func QueueName(queueURL string) string {
+	if name, ok := queueNames.Load(queueURL); ok {
+		return name.(string)
+	}
+
+	name := parseQueueName(queueURL)
+	queueNames.Store(queueURL, name)
+
+	return name
+}
+
+func parseQueueName(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) != 2 || segments[0] == "" || !queueNamePattern.MatchString(segments[1]) {
+		return ""
+	}
+
+	return segments[1]
+}
@@ -0,0 +1,42 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueueName(t *testing.T) {
+	tests := []struct {
+		name     string
+		queueURL string
+		want     string
+	}{
+		{name: "standard", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/payments", want: "payments"},
+		{name: "fifo", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/payments.fifo", want: "payments.fifo"},
+		{name: "trailing slash", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/payments/", want: "payments"},
+		{name: "localstack", queueURL: "http://localhost:4566/000000000000/orders_dlq", want: "orders_dlq"},
+		{name: "empty"},
+		{name: "not a URL", queueURL: "payments"},
+		{name: "unsupported scheme", queueURL: "ftp://sqs.us-east-1.amazonaws.com/123456789012/payments"},
+		{name: "no account", queueURL: "https://sqs.us-east-1.amazonaws.com/payments"},
+		{name: "too deep", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/payments/extra"},
+		{name: "invalid name", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/pay%20ments"},
+		{name: "name too long", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/" + strings.Repeat("a", 81)},
+		{name: "wrong suffix", queueURL: "https://sqs.us-east-1.amazonaws.com/123456789012/payments.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second lookup is answered from the cache, and must agree with the first.
+			for range 2 {
+				if got := QueueName(tt.queueURL); got != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+
+			if _, ok := queueNames.Load(tt.queueURL); !ok {
+				t.Errorf("got %q uncached, want it cached", tt.queueURL)
+			}
+		})
+	}
+}
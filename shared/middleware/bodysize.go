@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BodySize returns a middleware that records the request and response body sizes on the
+// server span as http.request.body.size and http.response.body.size. The bytes actually read
+// and written are counted rather than trusting Content-Length, so chunked requests and
+// streamed responses are measured too. It must be registered after the otelmux middleware.
+func BodySize() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := &countingReadCloser{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+
+			cw := &countingResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+
+			trace.SpanFromContext(r.Context()).SetAttributes(
+				attribute.Int64("http.request.body.size", body.n),
+				attribute.Int64("http.response.body.size", cw.n),
+			)
+		})
+	}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (c *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
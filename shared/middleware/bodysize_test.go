@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBodySize(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		chunked      bool
+		read         int64
+		response     []string
+		wantRequest  int64
+		wantResponse int64
+	}{
+		{name: "no body", response: []string{"ok"}, wantResponse: 2},
+		{name: "known length", body: `{"amount":10}`, read: -1, response: []string{`{"id":"abc"}`}, wantRequest: 13, wantResponse: 12},
+		{name: "chunked", body: strings.Repeat("x", 1000), chunked: true, read: -1, wantRequest: 1000},
+		{name: "partly read", body: strings.Repeat("x", 1000), read: 10, wantRequest: 10},
+		{name: "several writes", response: []string{"a", "bc", "def"}, wantResponse: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(BodySize())
+
+			r.HandleFunc("/payments", func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case tt.read < 0:
+					_, _ = io.Copy(io.Discard, r.Body)
+				case tt.read > 0:
+					_, _ = io.CopyN(io.Discard, r.Body, tt.read)
+				}
+
+				for _, s := range tt.response {
+					_, _ = io.WriteString(w, s)
+				}
+			})
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/payments", body)
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d spans, want 1", len(ended))
+			}
+
+			attrs := attribute.NewSet(ended[0].Attributes()...)
+			for key, want := range map[attribute.Key]int64{
+				"http.request.body.size":  tt.wantRequest,
+				"http.response.body.size": tt.wantResponse,
+			} {
+				if got, _ := attrs.Value(key); got.AsInt64() != want {
+					t.Errorf("got %s %d, want %d", key, got.AsInt64(), want)
+				}
+			}
+
+			if int64(rec.Body.Len()) != tt.wantResponse {
+				t.Errorf("got %d bytes written, want %d", rec.Body.Len(), tt.wantResponse)
+			}
+		})
+	}
+}
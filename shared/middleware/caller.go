@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+// Caller returns a middleware that records the service that made the request, if it propagated
+// its name in the baggage, on the server span. The service's own name then replaces it in the
+// baggage, so the downstream services record this one as their caller. It must be registered
+// after the otelmux middleware.
+func Caller(serviceName string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if caller, ok := telemetry.CallerFromContext(r.Context()); ok {
+				trace.SpanFromContext(r.Context()).SetAttributes(telemetry.CallerKey().String(caller))
+			}
+
+			next.ServeHTTP(w, r.WithContext(telemetry.ContextWithCaller(r.Context(), serviceName)))
+		})
+	}
+}
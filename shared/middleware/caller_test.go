@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/telemetry"
+)
+
+func TestCaller(t *testing.T) {
+	tests := []struct {
+		name       string
+		baggage    string
+		wantCaller string
+		wantOther  string
+	}{
+		{name: "propagated", baggage: "service.name=service-a", wantCaller: "service-a"},
+		{name: "with other members", baggage: "service.name=service-a,basket.id=123", wantCaller: "service-a", wantOther: "123"},
+		{name: "not propagated"},
+		{name: "other members only", baggage: "basket.id=123", wantOther: "123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			// The baggage is extracted from, and injected into, the headers as otelhttp does.
+			propagator := propagation.Baggage{}
+
+			r := mux.NewRouter()
+
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))))
+				})
+			})
+			r.Use(serverSpan(tracer))
+			r.Use(Caller("service-b"))
+
+			downstream := http.Header{}
+			r.HandleFunc("/payment", func(_ http.ResponseWriter, r *http.Request) {
+				propagator.Inject(r.Context(), propagation.HeaderCarrier(downstream))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/payment", nil)
+			if tt.baggage != "" {
+				req.Header.Set("baggage", tt.baggage)
+			}
+
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+			got, ok := attrs.Value(telemetry.CallerKey())
+			if ok != (tt.wantCaller != "") || got.AsString() != tt.wantCaller {
+				t.Errorf("got %s %q, want %q", telemetry.CallerKey(), got.AsString(), tt.wantCaller)
+			}
+
+			// The downstream calls name this service as their caller, keeping the rest of the
+			// baggage.
+			bag, err := baggage.Parse(downstream.Get("baggage"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if caller := bag.Member(telemetry.CallerBaggageMember).Value(); caller != "service-b" {
+				t.Errorf("got caller %q propagated downstream, want service-b", caller)
+			}
+
+			if other := bag.Member("basket.id").Value(); other != tt.wantOther {
+				t.Errorf("got basket.id %q propagated downstream, want %q", other, tt.wantOther)
+			}
+		})
+	}
+}
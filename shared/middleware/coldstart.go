@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+// ColdStart returns a middleware that marks the server span of the first request handled by
+// the service as a cold start, using the providers' ColdStart. It must be registered after the
+// otelmux middleware.
+func ColdStart(coldStart *telemetry.ColdStart) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			coldStart.Mark(trace.SpanFromContext(r.Context()))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"shared/telemetry"
+)
+
+// Deadline returns a middleware that bounds each request by the deadline propagated in its
+// baggage (see telemetry.ContextWithDeadline), so the service stops working on a request once
+// the caller has given up on it. Requests without a propagated deadline are passed through
+// untouched. It must be registered after the otelmux middleware, which extracts the baggage.
+func Deadline() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := telemetry.WithPropagatedDeadline(r.Context())
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// PropagateDeadline returns a middleware that adds the request context's deadline to the baggage,
+// so it's propagated to every downstream service. It must be registered inside whatever sets the
+// deadline, such as a timeout middleware.
+func PropagateDeadline() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(telemetry.ContextWithDeadline(r.Context())))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"shared/delay"
+)
+
+// Delay returns a middleware that injects the delay before the handler runs. If the request is
+// cancelled during the delay, the handler isn't run at all.
+func Delay(d delay.Delay) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !d.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := d.Inject(r.Context()); err != nil {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
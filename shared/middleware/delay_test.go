@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shared/delay"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		delay       string
+		timeout     time.Duration
+		wantHandled bool
+	}{
+		{name: "disabled", wantHandled: true},
+		{name: "delayed", delay: "10ms", wantHandled: true},
+		{name: "cancelled during the delay", delay: "1h", timeout: 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := delay.Parse(tt.delay)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var handled bool
+			handler := Delay(d)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				handled = true
+			}))
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkout", nil).WithContext(ctx))
+
+			if handled != tt.wantHandled {
+				t.Errorf("got handled %t, want %t", handled, tt.wantHandled)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// errInjected is recorded on the server span of requests failed by ErrorInjection.
+var errInjected = errors.New("injected error")
+
+// ErrorInjection returns a middleware that fails the given fraction of requests (0 to 1) with a
+// 500, so errored traces can be shown on demand. The server span is marked as errored and
+// tagged error.injected=true to distinguish it from a real failure. The seed makes the choice
+// of failed requests reproducible. It must be registered after the otelmux middleware.
+func ErrorInjection(rate float64, seed int64) mux.MiddlewareFunc {
+	var mu sync.Mutex
+	rng := rand.New(rand.NewSource(seed))
+
+	inject := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return rng.Float64() < rate
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !inject() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(appattr.Key("error.injected").Bool(true))
+			span.RecordError(errInjected)
+			span.SetStatus(codes.Error, errInjected.Error())
+
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestErrorInjection(t *testing.T) {
+	const requests = 200
+
+	tests := []struct {
+		name    string
+		rate    float64
+		wantMin int
+		wantMax int
+	}{
+		{name: "disabled", rate: 0},
+		{name: "always", rate: 1, wantMin: requests, wantMax: requests},
+		{name: "a fraction", rate: 0.25, wantMin: requests / 8, wantMax: requests * 3 / 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// run serves the requests, returning which were failed.
+			run := func() []bool {
+				recorder := tracetest.NewSpanRecorder()
+				tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+				r := mux.NewRouter()
+				r.Use(serverSpan(tracer))
+				r.Use(ErrorInjection(tt.rate, 1))
+				r.HandleFunc("/payment", func(http.ResponseWriter, *http.Request) {})
+
+				var failed []bool
+				for range requests {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/payment", nil))
+					failed = append(failed, w.Code == http.StatusInternalServerError)
+				}
+
+				for i, span := range recorder.Ended() {
+					attrs := attribute.NewSet(span.Attributes()...)
+					injected, _ := attrs.Value("error.injected")
+					errored := span.Status().Code == codes.Error && len(span.Events()) == 1 && span.Events()[0].Name == "exception"
+
+					if injected.AsBool() != failed[i] || errored != failed[i] {
+						t.Errorf("request %d: got error.injected %t and an errored span %t, want %t", i, injected.AsBool(), errored, failed[i])
+					}
+				}
+
+				return failed
+			}
+
+			failed := run()
+
+			var n int
+			for _, f := range failed {
+				if f {
+					n++
+				}
+			}
+
+			if n < tt.wantMin || n > tt.wantMax {
+				t.Errorf("got %d of %d requests failed, want %d to %d", n, requests, tt.wantMin, tt.wantMax)
+			}
+
+			// The same seed fails the same requests.
+			for i, f := range run() {
+				if f != failed[i] {
+					t.Fatalf("request %d: got failed %t on the second run, want %t", i, f, failed[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// DefaultMaxBodySize is the request body limit used when a service doesn't configure one.
+const DefaultMaxBodySize = 1 << 20 // 1MB
+
+// MaxBodySize returns a middleware that limits request bodies to limit bytes. A request whose
+// Content-Length is already over the limit is rejected with a 413 before reaching the handler.
+// Otherwise the body is wrapped with http.MaxBytesReader, so a handler reading a chunked body
+// past the limit gets an *http.MaxBytesError and should respond with a 413 itself. Either way
+// the server span is marked as errored. It must be registered after the otelmux middleware.
+func MaxBodySize(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+
+			if r.ContentLength > limit {
+				markTooLarge(span)
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), span: span}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func markTooLarge(span trace.Span) {
+	span.SetAttributes(appattr.Key("http.request.body.too_large").Bool(true))
+	span.SetStatus(codes.Error, "request body too large")
+}
+
+// limitedBody records on the span when the body's limit is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		markTooLarge(b.span)
+	}
+
+	return n, err
+}
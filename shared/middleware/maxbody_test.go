@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/appattr"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	const limit = 10
+
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{name: "no body", wantStatus: http.StatusOK},
+		{name: "under the limit", body: "12345", wantStatus: http.StatusOK},
+		{name: "at the limit", body: strings.Repeat("x", limit), wantStatus: http.StatusOK},
+		{name: "over the limit", body: strings.Repeat("x", limit+1), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked under the limit", body: "12345", chunked: true, wantStatus: http.StatusOK},
+		{name: "chunked over the limit", body: strings.Repeat("x", 100), chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(MaxBodySize(limit))
+
+			var handled bool
+			r.HandleFunc("/payments", func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+
+				if _, err := io.Copy(io.Discard, r.Body); err != nil {
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+						return
+					}
+
+					t.Errorf("got error reading the body %v", err)
+				}
+			})
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/payments", body)
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			tooLarge := tt.wantStatus == http.StatusRequestEntityTooLarge
+
+			// A body known to be too large up front never reaches the handler.
+			if wantHandled := !tooLarge || tt.chunked; handled != wantHandled {
+				t.Errorf("got handled %t, want %t", handled, wantHandled)
+			}
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d spans, want 1", len(ended))
+			}
+
+			if got := ended[0].Status().Code == codes.Error; got != tooLarge {
+				t.Errorf("got errored %t, want %t", got, tooLarge)
+			}
+
+			attrs := attribute.NewSet(ended[0].Attributes()...)
+			if got, _ := attrs.Value(appattr.Key("http.request.body.too_large")); got.AsBool() != tooLarge {
+				t.Errorf("got http.request.body.too_large %t, want %t", got.AsBool(), tooLarge)
+			}
+		})
+	}
+}
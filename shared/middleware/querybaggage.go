@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// QueryBaggage returns a middleware that carries a request's query parameter into its baggage
+// as member, e.g. ?basketId=123 as basket.id=123. It must be registered before the otelmux
+// middleware, so the sampler sees the member when the server span starts, and a TargetSampler
+// can force-sample the request by it. Requests without the parameter are passed through
+// untouched.
+func QueryBaggage(param, member string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.URL.Query().Get(param)
+			if value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, withBaggageMember(r, member, value))
+		})
+	}
+}
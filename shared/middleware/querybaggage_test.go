@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+func TestQueryBaggage(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		baggage     string
+		wantBasket  string
+		wantMembers int
+	}{
+		{name: "parameter", target: "/checkout?basketId=123", wantBasket: "123", wantMembers: 1},
+		{name: "keeps the baggage", target: "/checkout?basketId=123", baggage: "caller=service-x", wantBasket: "123", wantMembers: 2},
+		{name: "replaces the member", target: "/checkout?basketId=123", baggage: "basket.id=456", wantBasket: "123", wantMembers: 1},
+		{name: "escaped value", target: "/checkout?basketId=a%20b%3B", wantBasket: "a b;", wantMembers: 1},
+		{name: "no parameter", target: "/checkout", baggage: "basket.id=456", wantBasket: "456", wantMembers: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := QueryBaggage("basketId", "basket.id")(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(baggageHeader)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.baggage != "" {
+				req.Header.Set(baggageHeader, tt.baggage)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			bag, err := baggage.Parse(got)
+			if err != nil {
+				t.Fatalf("got invalid baggage %q: %v", got, err)
+			}
+
+			if basket := bag.Member("basket.id").Value(); basket != tt.wantBasket {
+				t.Errorf("got basket.id %q, want %q", basket, tt.wantBasket)
+			}
+
+			if bag.Len() != tt.wantMembers {
+				t.Errorf("got baggage %q, want %d members", got, tt.wantMembers)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recover returns a middleware that recovers from a panic in a handler, responding with a 500
+// rather than letting net/http drop the connection. The request context is captured before the
+// handler runs, so the panic and its stack are logged with the trace and span IDs even though
+// the panic has unwound the handler's stack, and the panic is recorded on the server span. It
+// must be registered after the otelmux middleware.
+func Recover() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+
+				// net/http uses ErrAbortHandler to abort a response on purpose, so leave it alone.
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				stack := debug.Stack()
+
+				span := trace.SpanFromContext(ctx)
+				span.RecordError(fmt.Errorf("panic: %v", p), trace.WithStackTrace(true))
+				span.SetStatus(codes.Error, "panic serving request")
+
+				slog.ErrorContext(ctx, "panic serving request", "panic", fmt.Sprint(p), "stack", string(stack))
+
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
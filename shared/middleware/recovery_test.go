@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logRecorder is a slog.Handler recording each record along with the trace ID of the context it
+// was logged with.
+type logRecorder struct {
+	mu       sync.Mutex
+	records  []slog.Record
+	traceIDs []trace.TraceID
+}
+
+func (h *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *logRecorder) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, r)
+	h.traceIDs = append(h.traceIDs, trace.SpanContextFromContext(ctx).TraceID())
+
+	return nil
+}
+
+func (h *logRecorder) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *logRecorder) WithGroup(string) slog.Handler { return h }
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name       string
+		panic      any
+		wantStatus int
+		wantLogged bool
+	}{
+		{name: "no panic", wantStatus: http.StatusOK},
+		{name: "panic", panic: "payment backend exploded", wantStatus: http.StatusInternalServerError, wantLogged: true},
+		{name: "panic with an error", panic: http.ErrBodyNotAllowed, wantStatus: http.StatusInternalServerError, wantLogged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := &logRecorder{}
+			previous := slog.Default()
+			slog.SetDefault(slog.New(logs))
+			t.Cleanup(func() { slog.SetDefault(previous) })
+
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(Recover())
+
+			r.HandleFunc("/checkout", func(http.ResponseWriter, *http.Request) {
+				if tt.panic != nil {
+					panic(tt.panic)
+				}
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/checkout", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d spans, want 1", len(ended))
+			}
+			span := ended[0]
+
+			if got := span.Status().Code == codes.Error; got != tt.wantLogged {
+				t.Errorf("got errored %t, want %t", got, tt.wantLogged)
+			}
+
+			if !tt.wantLogged {
+				if len(logs.records) != 0 {
+					t.Errorf("got %d log records, want none", len(logs.records))
+				}
+
+				return
+			}
+
+			if len(logs.records) != 1 {
+				t.Fatalf("got %d log records, want 1", len(logs.records))
+			}
+
+			// The panic unwound the handler, but the log line still carries the request's trace.
+			if got, want := logs.traceIDs[0], span.SpanContext().TraceID(); got != want {
+				t.Errorf("got trace ID %s on the panic log, want %s", got, want)
+			}
+
+			attrs := map[string]string{}
+			logs.records[0].Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value.String()
+				return true
+			})
+
+			if want := fmt.Sprint(tt.panic); attrs["panic"] != want {
+				t.Errorf("got panic %q, want %q", attrs["panic"], want)
+			}
+
+			if !strings.Contains(attrs["stack"], "goroutine") {
+				t.Errorf("got stack %q, want a stack trace", attrs["stack"])
+			}
+
+			var exceptions int
+			for _, event := range span.Events() {
+				if event.Name == "exception" {
+					exceptions++
+				}
+			}
+
+			if exceptions != 1 {
+				t.Errorf("got %d exception events, want 1", exceptions)
+			}
+		})
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	r := mux.NewRouter()
+
+	r.Use(Recover())
+
+	r.HandleFunc("/checkout", func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler re-raised", p)
+		}
+	}()
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/checkout", nil))
+}
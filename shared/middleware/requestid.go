@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"shared/requestid"
+)
+
+// RequestID returns a middleware that identifies each request with the ID in its X-Request-Id
+// header, or a newly generated one if the header is missing or invalid. The ID is stored in the
+// request context, recorded on the server span and echoed in the response's X-Request-Id
+// header. It must be registered after the otelmux middleware.
+func RequestID() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(requestid.Key().String(id))
+			w.Header().Set(requestid.Header, id)
+
+			next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+		})
+	}
+}
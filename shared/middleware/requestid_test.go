@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantKept bool
+	}{
+		{name: "honored", header: "req-123", wantKept: true},
+		{name: "generated"},
+		{name: "invalid", header: "req\x00123"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(RequestID())
+
+			var inContext string
+			r.HandleFunc("/checkout", func(_ http.ResponseWriter, r *http.Request) {
+				inContext, _ = requestid.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/checkout", nil)
+			if tt.header != "" {
+				req.Header.Set(requestid.Header, tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(requestid.Header)
+			if tt.wantKept && echoed != tt.header {
+				t.Errorf("got request ID %q, want %q", echoed, tt.header)
+			}
+
+			if !tt.wantKept && (echoed == tt.header || !requestid.Valid(echoed)) {
+				t.Errorf("got request ID %q, want a newly generated one", echoed)
+			}
+
+			if inContext != echoed {
+				t.Errorf("got request ID %q in the context, want %q", inContext, echoed)
+			}
+
+			attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+			if got, _ := attrs.Value(requestid.Key()); got.AsString() != echoed {
+				t.Errorf("got %s %q, want %q", requestid.Key(), got.AsString(), echoed)
+			}
+		})
+	}
+}
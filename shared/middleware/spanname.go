@@ -0,0 +1,39 @@
+// Package middleware contains HTTP middleware shared by the services.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName returns a low-cardinality span name for the request, built from the HTTP method and
+// the matched mux route template (e.g. "GET /orders/{id}") rather than the raw request path.
+// Using the raw path would create a distinct span name for every ID, exploding the number of
+// unique span names in the backend. Use this for any span named after an incoming request.
+func SpanName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "HTTP " + r.Method
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "HTTP " + r.Method
+	}
+
+	return r.Method + " " + template
+}
+
+// RouteSpanName returns a middleware that renames the current server span using SpanName.
+// It must be registered after the otelmux middleware so that the server span is available
+// from the request context.
+func RouteSpanName() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace.SpanFromContext(r.Context()).SetName(SpanName(r))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
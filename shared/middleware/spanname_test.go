@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRouteSpanName(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   string
+	}{
+		{name: "path parameter", method: http.MethodGet, path: "/orders/123", want: "GET /orders/{id}"},
+		{name: "another ID, same name", method: http.MethodGet, path: "/orders/456", want: "GET /orders/{id}"},
+		{name: "nested parameters", method: http.MethodDelete, path: "/baskets/9/items/3", want: "DELETE /baskets/{basketId}/items/{itemId}"},
+		{name: "static route", method: http.MethodGet, path: "/checkout", want: "GET /checkout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(RouteSpanName())
+
+			ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+			r.Handle("/orders/{id}", ok)
+			r.Handle("/baskets/{basketId}/items/{itemId}", ok)
+			r.Handle("/checkout", ok)
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			ended := recorder.Ended()
+			if len(ended) != 1 {
+				t.Fatalf("got %d spans, want 1", len(ended))
+			}
+
+			if got := ended[0].Name(); got != tt.want {
+				t.Errorf("got span name %q, want %q (raw path %q)", got, tt.want, tt.path)
+			}
+		})
+	}
+}
+
+func TestSpanNameWithoutRoute(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/orders/123", nil)
+
+	if got := SpanName(r); got != "HTTP POST" {
+		t.Errorf("got %q, want %q", got, "HTTP POST")
+	}
+}
+
+// serverSpan stands in for otelmux, starting a server span named after the raw path.
+func serverSpan(tracer trace.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(r.Context(), r.URL.Path, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
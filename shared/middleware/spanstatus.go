@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+// SpanStatus returns a middleware that marks the server span as errored when the response's
+// status code is an error under the policy, e.g. a 404 when the policy counts client errors.
+// Responses the policy doesn't consider errors leave the status as the otelmux middleware sets
+// it. It must be registered after the otelmux middleware, and before any middleware that
+// writes responses of its own, so their status codes are seen too.
+func SpanStatus(policy telemetry.StatusPolicy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusResponseWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			if policy.IsError(sw.code) {
+				trace.SpanFromContext(r.Context()).SetStatus(codes.Error, http.StatusText(sw.code))
+			}
+		})
+	}
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (s *statusResponseWriter) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.code = code
+		s.wroteHeader = true
+	}
+
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusResponseWriter) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (s *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
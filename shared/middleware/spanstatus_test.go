@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/telemetry"
+)
+
+func TestSpanStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy telemetry.StatusPolicy
+		code   int
+		want   codes.Code
+	}{
+		{name: "default 200", code: http.StatusOK, want: codes.Unset},
+		{name: "default 404", code: http.StatusNotFound, want: codes.Unset},
+		{name: "default 500", code: http.StatusInternalServerError, want: codes.Error},
+		{name: "client errors 200", policy: telemetry.StatusPolicy{ClientErrors: true}, code: http.StatusOK, want: codes.Unset},
+		{name: "client errors 404", policy: telemetry.StatusPolicy{ClientErrors: true}, code: http.StatusNotFound, want: codes.Error},
+		{name: "client errors 500", policy: telemetry.StatusPolicy{ClientErrors: true}, code: http.StatusInternalServerError, want: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(SpanStatus(tt.policy))
+
+			r.HandleFunc("/checkout", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.code)
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/checkout", nil))
+
+			if rec.Code != tt.code {
+				t.Errorf("got status code %d, want %d", rec.Code, tt.code)
+			}
+
+			if got := recorder.Ended()[0].Status().Code; got != tt.want {
+				t.Errorf("got span status %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
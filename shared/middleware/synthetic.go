@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/baggage"
+	"shared/telemetry"
+)
+
+// baggageHeader is the W3C baggage header.
+const baggageHeader = "baggage"
+
+// Synthetic returns a middleware that carries a request's X-Synthetic: true header into its
+// baggage, so the request is marked as synthetic traffic across every service it reaches. It must
+// be registered before the otelmux middleware, as the header is added to the request's baggage
+// header for otelmux to extract; the server span, and the sampling decision, then see it too.
+func Synthetic() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(telemetry.SyntheticHeader) != "true" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, withBaggageMember(r, telemetry.SyntheticBaggageMember, "true"))
+		})
+	}
+}
+
+// withBaggageMember returns the request with key=value added to its baggage header, for otelmux
+// to extract. Invalid baggage from the client would be dropped by the extraction anyway, so it's
+// replaced rather than rejecting the request. The request is returned unchanged if the member
+// isn't valid baggage.
+func withBaggageMember(r *http.Request, key, value string) *http.Request {
+	bag, err := baggage.Parse(r.Header.Get(baggageHeader))
+	if err != nil {
+		bag = baggage.Baggage{}
+	}
+
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return r
+	}
+
+	if bag, err = bag.SetMember(member); err != nil {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set(baggageHeader, bag.String())
+
+	return r
+}
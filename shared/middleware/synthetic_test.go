@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+// TestSynthetic sends a request through two services, each set up as service-a and service-b
+// are, and checks the synthetic flag set by the first reaches the spans of both.
+func TestSynthetic(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		baggage       string
+		sampleRatio   string
+		wantSynthetic bool
+		wantSpans     int
+		wantBasket    string
+	}{
+		{name: "synthetic", header: "true", wantSynthetic: true, wantSpans: 2},
+		{name: "keeps the baggage", header: "true", baggage: "basket.id=123", wantSynthetic: true, wantSpans: 2, wantBasket: "123"},
+		{name: "replaces invalid baggage", header: "true", baggage: "=;", wantSynthetic: true, wantSpans: 2},
+		{name: "not synthetic", header: "false", wantSpans: 2},
+		{name: "no header", baggage: "basket.id=123", wantSpans: 2, wantBasket: "123"},
+		{name: "synthetic sampled out", header: "true", sampleRatio: "0", wantSynthetic: true},
+		{name: "real traffic sampled", sampleRatio: "0", wantSpans: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SYNTHETIC_SAMPLE_RATIO", "1")
+			if tt.sampleRatio != "" {
+				t.Setenv("SYNTHETIC_SAMPLE_RATIO", tt.sampleRatio)
+			}
+
+			settings, err := telemetry.LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			settings.TraceEndpoints = nil
+
+			providers, shutdown, err := telemetry.Init(telemetry.Config{
+				ServiceName:               "test",
+				DisableGlobalRegistration: true,
+				Settings:                  &settings,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(shutdown)
+
+			recorder := tracetest.NewSpanRecorder()
+			providers.TracerProvider.RegisterSpanProcessor(recorder)
+			tracer := providers.TracerProvider.Tracer("test")
+
+			// newService routes requests as the services do: the X-Synthetic header is moved into
+			// the baggage, which is extracted, as otelmux does, before the server span starts.
+			newService := func(handler http.HandlerFunc) *httptest.Server {
+				r := mux.NewRouter()
+
+				r.Use(Synthetic())
+				r.Use(func(next http.Handler) http.Handler {
+					return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						ctx := providers.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+						next.ServeHTTP(w, r.WithContext(ctx))
+					})
+				})
+				r.Use(serverSpan(tracer))
+
+				r.HandleFunc("/", handler)
+
+				server := httptest.NewServer(r)
+				t.Cleanup(server.Close)
+
+				return server
+			}
+
+			var downstreamBaggage baggage.Baggage
+			downstream := newService(func(_ http.ResponseWriter, r *http.Request) {
+				downstreamBaggage = baggage.FromContext(r.Context())
+			})
+
+			upstream := newService(func(w http.ResponseWriter, r *http.Request) {
+				req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+				providers.Propagator.Inject(r.Context(), propagation.HeaderCarrier(req.Header))
+
+				res, err := http.DefaultClient.Do(req)
+				if err != nil {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				res.Body.Close()
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+			if tt.header != "" {
+				req.Header.Set(telemetry.SyntheticHeader, tt.header)
+			}
+
+			if tt.baggage != "" {
+				req.Header.Set("baggage", tt.baggage)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusOK)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != tt.wantSpans {
+				t.Fatalf("got %d spans sampled, want %d", len(spans), tt.wantSpans)
+			}
+
+			for _, span := range spans {
+				if span.SpanKind() != trace.SpanKindServer {
+					continue
+				}
+
+				attrs := attribute.NewSet(span.Attributes()...)
+				synthetic, _ := attrs.Value(telemetry.SyntheticKey())
+				if synthetic.AsBool() != tt.wantSynthetic {
+					t.Errorf("got %s %t on a server span, want %t", telemetry.SyntheticKey(), synthetic.AsBool(), tt.wantSynthetic)
+				}
+			}
+
+			if got := downstreamBaggage.Member(telemetry.SyntheticBaggageMember).Value() == "true"; got != tt.wantSynthetic {
+				t.Errorf("got synthetic %t in the downstream baggage, want %t", got, tt.wantSynthetic)
+			}
+
+			if basket := downstreamBaggage.Member("basket.id").Value(); basket != tt.wantBasket {
+				t.Errorf("got basket.id %q in the downstream baggage, want %q", basket, tt.wantBasket)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"shared/telemetry"
+)
+
+// UserAgent returns a middleware that records the client's User-Agent on the server span and
+// adds it to the baggage, so it's propagated to every downstream service. Requests without a
+// User-Agent are passed through untouched. It must be registered after the otelmux middleware.
+func UserAgent() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent := r.UserAgent()
+			if userAgent == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			trace.SpanFromContext(r.Context()).SetAttributes(telemetry.UserAgentKey.String(userAgent))
+			next.ServeHTTP(w, r.WithContext(telemetry.ContextWithUserAgent(r.Context(), userAgent)))
+		})
+	}
+}
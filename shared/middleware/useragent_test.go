@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/telemetry"
+)
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+	}{
+		{name: "set", userAgent: "curl/8.0"},
+		{name: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+			r := mux.NewRouter()
+
+			r.Use(serverSpan(tracer))
+			r.Use(UserAgent())
+
+			var propagated string
+			r.HandleFunc("/checkout", func(_ http.ResponseWriter, r *http.Request) {
+				propagated = baggage.FromContext(r.Context()).Member(telemetry.UserAgentBaggageMember).Value()
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/checkout", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if propagated != tt.userAgent {
+				t.Errorf("got user agent %q in the baggage, want %q", propagated, tt.userAgent)
+			}
+
+			attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+			got, ok := attrs.Value(telemetry.UserAgentKey)
+			if ok != (tt.userAgent != "") || got.AsString() != tt.userAgent {
+				t.Errorf("got %s %q, want %q", telemetry.UserAgentKey, got.AsString(), tt.userAgent)
+			}
+		})
+	}
+}
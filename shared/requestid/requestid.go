@@ -0,0 +1,57 @@
+// Package requestid carries the ID that correlates the logs and spans of a single request, or
+// message, through the context.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"shared/appattr"
+)
+
+// Header is the HTTP header a request ID is accepted in and echoed back in.
+const Header = "X-Request-Id"
+
+// maxLength bounds the length of a request ID accepted from a client, so an arbitrarily long
+// header can't bloat the logs and spans.
+const maxLength = 128
+
+type key struct{}
+
+// Key returns the span attribute key the request ID is recorded as.
+func Key() attribute.Key {
+	return appattr.Key("request.id")
+}
+
+// New generates a new request ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether id is acceptable as a request ID: non-empty, no longer than 128
+// characters and printable ASCII only.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, if there is one.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(key{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,58 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "uuid", id: "c5a1e2b4-7e0f-4c1d-9a61-1f6d2f0e8b3a", want: true},
+		{name: "printable", id: "req-123 ~!", want: true},
+		{name: "longest", id: strings.Repeat("a", maxLength), want: true},
+		{name: "empty"},
+		{name: "too long", id: strings.Repeat("a", maxLength+1)},
+		{name: "newline", id: "req\n123"},
+		{name: "non-ASCII", id: "req-é"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.id); got != tt.want {
+				t.Errorf("got Valid(%q) %t, want %t", tt.id, got, tt.want)
+			}
+		})
+	}
+
+	// Generated IDs are valid and unique.
+	if a, b := New(), New(); !Valid(a) || a == b {
+		t.Errorf("got generated IDs %q and %q, want two different valid IDs", a, b)
+	}
+}
+
+func TestContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		want   string
+		wantOK bool
+	}{
+		{name: "set", ctx: NewContext(context.Background(), "req-123"), want: "req-123", wantOK: true},
+		{name: "unset", ctx: context.Background()},
+		{name: "empty", ctx: NewContext(context.Background(), "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FromContext(tt.ctx)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// baggageSpanProcessor copies configured baggage members onto every span as it starts, so a
+// correlation ID set once at the edge (e.g. a tenant or session ID) is searchable on every span
+// in the trace without each handler setting it by hand.
+type baggageSpanProcessor struct {
+	// attributes maps a baggage member key to the span attribute key it is copied to.
+	attributes map[string]string
+}
+
+var _ sdktrace.SpanProcessor = baggageSpanProcessor{}
+
+func newBaggageSpanProcessor(attributes map[string]string) baggageSpanProcessor {
+	return baggageSpanProcessor{attributes: attributes}
+}
+
+func (p baggageSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	bag := baggage.FromContext(ctx)
+
+	for member, key := range p.attributes {
+		if value := bag.Member(member).Value(); value != "" {
+			s.SetAttributes(attribute.String(key, value))
+		}
+	}
+}
+
+func (baggageSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (baggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,104 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// contextWithBaggage returns a context carrying the baggage members.
+func contextWithBaggage(t *testing.T, members map[string]string) context.Context {
+	t.Helper()
+
+	var bag baggage.Baggage
+	for key, value := range members {
+		member, err := baggage.NewMember(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bag, err = bag.SetMember(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return baggage.ContextWithBaggage(context.Background(), bag)
+}
+
+func TestBaggageSpanProcessor(t *testing.T) {
+	tests := []struct {
+		name    string
+		baggage map[string]string
+		want    map[attribute.Key]string
+	}{
+		{name: "no baggage", want: map[attribute.Key]string{}},
+		{
+			name:    "mapped members",
+			baggage: map[string]string{"tenant": "acme", "session": "s-1"},
+			want:    map[attribute.Key]string{"tenant.id": "acme", "session.id": "s-1"},
+		},
+		{
+			name:    "unmapped members are ignored",
+			baggage: map[string]string{"tenant": "acme", "other": "x"},
+			want:    map[attribute.Key]string{"tenant.id": "acme"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(newBaggageSpanProcessor(map[string]string{"tenant": "tenant.id", "session": "session.id"})),
+				sdktrace.WithSpanProcessor(recorder),
+			)
+
+			// Both the span started with the baggage and its child are enriched.
+			ctx, parent := tp.Tracer("test").Start(contextWithBaggage(t, tt.baggage), "parent")
+			_, child := tp.Tracer("test").Start(ctx, "child")
+			child.End()
+			parent.End()
+
+			for _, span := range recorder.Ended() {
+				got := map[attribute.Key]string{}
+				for _, kv := range span.Attributes() {
+					got[kv.Key] = kv.Value.AsString()
+				}
+
+				if len(got) != len(tt.want) {
+					t.Errorf("%s: got attributes %v, want %v", span.Name(), got, tt.want)
+				}
+
+				for key, want := range tt.want {
+					if got[key] != want {
+						t.Errorf("%s: got %s %q, want %q", span.Name(), key, got[key], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestInitBaggageAttributes checks Config.BaggageAttributes registers the processor.
+func TestInitBaggageAttributes(t *testing.T) {
+	providers := initForTest(t, Config{
+		ServiceName:               "service-a",
+		DisableGlobalRegistration: true,
+		BaggageAttributes:         map[string]string{"tenant": "tenant.id"},
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	providers.TracerProvider.RegisterSpanProcessor(recorder)
+
+	_, span := providers.TracerProvider.Tracer("test").Start(contextWithBaggage(t, map[string]string{"tenant": "acme"}), "checkout")
+	span.End()
+
+	attrs := attribute.NewSet(recorder.Ended()[0].Attributes()...)
+	got, _ := attrs.Value("tenant.id")
+	if got.AsString() != "acme" {
+		t.Errorf("got tenant.id %q, want %q", got.AsString(), "acme")
+	}
+}
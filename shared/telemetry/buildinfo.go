@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// Commit is the VCS revision the service was built from. It can be set at build time with
+// -ldflags "-X shared/telemetry.Commit=<sha>"; otherwise the revision Go embedded in the binary
+// is used, if there is one.
+var Commit string
+
+// registerBuildInfo registers a build_info gauge, always 1 and labelled with the service's name,
+// version and commit, so dashboards can join metrics to what is deployed. An up gauge is
+// registered alongside it, reporting 1 whenever the service is running and exporting metrics.
+func registerBuildInfo(meter metric.Meter, cfg Config) error {
+	attrs := metric.WithAttributeSet(attribute.NewSet(
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(cfg.ServiceVersion),
+		semconv.VCSRefHeadRevisionKey.String(commit()),
+	))
+
+	buildInfo, err := meter.Int64ObservableGauge("build_info",
+		metric.WithDescription("Build information about the running service, always 1."),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating build_info gauge: %w", err)
+	}
+
+	up, err := meter.Int64ObservableGauge("up",
+		metric.WithDescription("Whether the service is up, always 1 while it's running."),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating up gauge: %w", err)
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(buildInfo, 1, attrs)
+		o.ObserveInt64(up, 1)
+		return nil
+	}, buildInfo, up)
+	if err != nil {
+		return fmt.Errorf("error registering build info callback: %w", err)
+	}
+
+	return nil
+}
+
+// commit returns the revision to label build_info with, preferring one set through ldflags.
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+func TestRegisterBuildInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		commit     string
+		wantCommit string
+	}{
+		{name: "commit from ldflags", commit: "abc123", wantCommit: "abc123"},
+		// Test binaries aren't stamped with VCS information.
+		{name: "no commit", wantCommit: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := Commit
+			Commit = tt.commit
+			t.Cleanup(func() { Commit = previous })
+
+			reader := sdkmetric.NewManualReader()
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+			if err := registerBuildInfo(meter, Config{ServiceName: "service-a", ServiceVersion: "1.2.3"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+
+			gauges := map[string][]metricdata.DataPoint[int64]{}
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					gauges[m.Name] = m.Data.(metricdata.Gauge[int64]).DataPoints
+				}
+			}
+
+			wantAttrs := attribute.NewSet(
+				semconv.ServiceName("service-a"),
+				semconv.ServiceVersion("1.2.3"),
+				semconv.VCSRefHeadRevision(tt.wantCommit),
+			)
+
+			for name, want := range map[string]attribute.Set{"build_info": wantAttrs, "up": *attribute.EmptySet()} {
+				points := gauges[name]
+				if len(points) != 1 {
+					t.Fatalf("got %d %s data points, want 1", len(points), name)
+				}
+
+				if points[0].Value != 1 {
+					t.Errorf("got %s %d, want 1", name, points[0].Value)
+				}
+
+				if !points[0].Attributes.Equals(&want) {
+					t.Errorf("got %s labels %v, want %v", name, points[0].Attributes.ToSlice(), want.ToSlice())
+				}
+			}
+		})
+	}
+}
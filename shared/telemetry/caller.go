@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"shared/appattr"
+)
+
+// CallerBaggageMember is the baggage member carrying the name of the service that made a call,
+// so the service receiving it can record who called it. Each service replaces it with its own
+// name before calling the next, so it always names the immediate caller.
+const CallerBaggageMember = "service.name"
+
+// CallerKey returns the span attribute key the calling service is recorded as.
+func CallerKey() attribute.Key {
+	return appattr.Key("caller.service.name")
+}
+
+// CallerFromContext returns the name of the service that made the call in ctx, if it was
+// propagated.
+func CallerFromContext(ctx context.Context) (string, bool) {
+	caller := baggage.FromContext(ctx).Member(CallerBaggageMember).Value()
+	return caller, caller != ""
+}
+
+// ContextWithCaller returns a copy of ctx whose baggage names serviceName as the caller of any
+// calls made with it.
+func ContextWithCaller(ctx context.Context, serviceName string) context.Context {
+	member, err := baggage.NewMemberRaw(CallerBaggageMember, serviceName)
+	if err != nil {
+		return ctx
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
@@ -0,0 +1,22 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+)
+
+// CheckoutStartBaggageMember is the baggage member carrying the time the checkout that started
+// the trace began, in Unix milliseconds, so the service that finishes the order can measure how
+// long it took end to end.
+const CheckoutStartBaggageMember = "checkout.start"
+
+// ContextWithCheckoutStart returns a copy of ctx whose baggage carries the checkout's start time.
+func ContextWithCheckoutStart(ctx context.Context, start time.Time) context.Context {
+	return contextWithTimeMember(ctx, CheckoutStartBaggageMember, start)
+}
+
+// CheckoutStartFromContext returns the checkout start time propagated in ctx's baggage, if there
+// is a valid one.
+func CheckoutStartFromContext(ctx context.Context) (time.Time, bool) {
+	return timeMember(ctx, CheckoutStartBaggageMember)
+}
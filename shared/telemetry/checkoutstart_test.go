@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestCheckoutStart(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		ctx    func() context.Context
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "not started", ctx: context.Background},
+		{
+			name:   "started",
+			ctx:    func() context.Context { return ContextWithCheckoutStart(context.Background(), now) },
+			want:   now.Truncate(time.Millisecond),
+			wantOK: true,
+		},
+		{
+			name: "alongside the deadline",
+			ctx: func() context.Context {
+				ctx := contextWithTimeMember(context.Background(), DeadlineBaggageMember, now.Add(time.Minute))
+				return ContextWithCheckoutStart(ctx, now)
+			},
+			want:   now.Truncate(time.Millisecond),
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Propagate the baggage over HTTP headers, as between the services.
+			carrier := propagation.HeaderCarrier{}
+			propagation.Baggage{}.Inject(tt.ctx(), carrier)
+			received := propagation.Baggage{}.Extract(context.Background(), carrier)
+
+			got, ok := CheckoutStartFromContext(received)
+			if ok != tt.wantOK || ok && !got.Equal(tt.want) {
+				t.Errorf("got checkout start %s (%t), want %s (%t)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
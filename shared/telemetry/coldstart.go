@@ -0,0 +1,30 @@
+package telemetry
+
+import (
+	"sync"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ColdStart marks the first span it's given as a cold start. The first request or message a
+// service handles pays for the blocking OTLP dial and AWS config load, so this makes that
+// latency easy to separate out in the backend.
+//
+// Init creates one for each set of providers, so every service, or test, instrumented in the
+// process marks its own first span.
+type ColdStart struct {
+	once sync.Once
+}
+
+// Mark tags span with faas.coldstart=true if it's the first span to be marked, and does nothing
+// on every later call. A nil ColdStart marks nothing.
+func (c *ColdStart) Mark(span trace.Span) {
+	if c == nil {
+		return
+	}
+
+	c.once.Do(func() {
+		span.SetAttributes(semconv.FaaSColdstart(true))
+	})
+}
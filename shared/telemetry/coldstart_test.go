@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+func TestColdStartMarksOnlyTheFirstSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	// Each ColdStart marks its own first span, as two services in one process would.
+	first, second := &ColdStart{}, &ColdStart{}
+	for _, c := range []*ColdStart{first, first, second, first, second} {
+		_, span := tracer.Start(context.Background(), "span")
+		c.Mark(span)
+		span.End()
+	}
+
+	var marked []bool
+	for _, span := range recorder.Ended() {
+		coldStart := false
+		for _, kv := range span.Attributes() {
+			if kv == semconv.FaaSColdstart(true) {
+				coldStart = true
+			}
+		}
+
+		marked = append(marked, coldStart)
+	}
+
+	want := []bool{true, false, true, false, false}
+	if len(marked) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(marked), len(want))
+	}
+
+	for i := range want {
+		if marked[i] != want[i] {
+			t.Errorf("span %d: coldstart = %t, want %t", i, marked[i], want[i])
+		}
+	}
+}
+
+func TestColdStartNilMarksNothing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test").Start(context.Background(), "span")
+
+	var c *ColdStart
+	c.Mark(span)
+	span.End()
+
+	if attrs := recorder.Ended()[0].Attributes(); len(attrs) != 0 {
+		t.Errorf("got attributes %v, want none", attrs)
+	}
+}
@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// DeadlineBaggageMember is the baggage member carrying the deadline of the request that started
+// the trace, so downstream services can stop working on it once nobody is waiting for the result.
+//
+// The deadline is propagated as an absolute time, in Unix milliseconds, rather than as the time
+// remaining. That keeps it meaningful across SQS, where a message can sit in the queue for an
+// arbitrary time before it is received, at the cost of relying on the services' clocks agreeing.
+const DeadlineBaggageMember = "deadline"
+
+// ContextWithDeadline returns a copy of ctx whose baggage carries ctx's deadline. The context is
+// returned unchanged if it has no deadline, or if the baggage already carries an earlier one.
+func ContextWithDeadline(ctx context.Context) context.Context {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+
+	if propagated, ok := DeadlineFromContext(ctx); ok && propagated.Before(deadline) {
+		return ctx
+	}
+
+	return contextWithTimeMember(ctx, DeadlineBaggageMember, deadline)
+}
+
+// DeadlineFromContext returns the deadline propagated in ctx's baggage, if there is a valid one.
+func DeadlineFromContext(ctx context.Context) (time.Time, bool) {
+	return timeMember(ctx, DeadlineBaggageMember)
+}
+
+// contextWithTimeMember returns a copy of ctx whose baggage carries t in the member key, in Unix
+// milliseconds. The context is returned unchanged if the member can't be set.
+func contextWithTimeMember(ctx context.Context, key string, t time.Time) context.Context {
+	member, err := baggage.NewMember(key, strconv.FormatInt(t.UnixMilli(), 10))
+	if err != nil {
+		return ctx
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// timeMember returns the time carried in the member key of ctx's baggage, if there is a valid one.
+func timeMember(ctx context.Context, key string) (time.Time, bool) {
+	value := baggage.FromContext(ctx).Member(key).Value()
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+// WithPropagatedDeadline returns a copy of ctx that is cancelled at the deadline propagated in
+// its baggage, so the service respects the budget of the request that started the trace. The
+// context is returned unchanged, with a no-op cancel, if no deadline was propagated.
+func WithPropagatedDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := DeadlineFromContext(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+
+	return context.WithDeadline(ctx, deadline)
+}
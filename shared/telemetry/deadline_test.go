@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestContextWithDeadline(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+
+	tests := []struct {
+		name       string
+		deadline   time.Duration
+		propagated time.Duration
+		want       time.Duration
+		wantOK     bool
+	}{
+		{name: "no deadline"},
+		{name: "deadline", deadline: time.Second, want: time.Second, wantOK: true},
+		{name: "earlier propagated deadline", deadline: time.Second, propagated: 500 * time.Millisecond, want: 500 * time.Millisecond, wantOK: true},
+		{name: "later propagated deadline", deadline: time.Second, propagated: time.Minute, want: time.Second, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.propagated != 0 {
+				ctx = contextWithTimeMember(ctx, DeadlineBaggageMember, now.Add(tt.propagated))
+			}
+
+			if tt.deadline != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, now.Add(tt.deadline))
+				defer cancel()
+			}
+
+			// Propagate the baggage over HTTP headers, as between the services.
+			carrier := propagation.HeaderCarrier{}
+			propagation.Baggage{}.Inject(ContextWithDeadline(ctx), carrier)
+			received := propagation.Baggage{}.Extract(context.Background(), carrier)
+
+			got, ok := DeadlineFromContext(received)
+			if ok != tt.wantOK || ok && !got.Equal(now.Add(tt.want)) {
+				t.Errorf("got deadline %s (%t), want %s (%t)", got, ok, now.Add(tt.want), tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDeadlineFromContextInvalid(t *testing.T) {
+	member, err := baggage.NewMember(DeadlineBaggageMember, "tomorrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bag, _ := baggage.New(member)
+	if _, ok := DeadlineFromContext(baggage.ContextWithBaggage(context.Background(), bag)); ok {
+		t.Error("got a deadline from an invalid member")
+	}
+}
+
+func TestWithPropagatedDeadline(t *testing.T) {
+	ctx, cancel := WithPropagatedDeadline(context.Background())
+	cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("got a deadline without one being propagated")
+	}
+
+	deadline := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	ctx, cancel = WithPropagatedDeadline(contextWithTimeMember(context.Background(), DeadlineBaggageMember, deadline))
+	defer cancel()
+
+	if got, ok := ctx.Deadline(); !ok || !got.Equal(deadline) {
+		t.Errorf("got deadline %s (%t), want %s", got, ok, deadline)
+	}
+}
@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Description summarises the OpenTelemetry configuration a service is actually running with.
+type Description struct {
+	Sampler         string            `json:"sampler"`
+	TraceEndpoints  []string          `json:"traceEndpoints"`
+	TracesProtocol  Protocol          `json:"tracesProtocol"`
+	MetricsEndpoint string            `json:"metricsEndpoint,omitempty"`
+	MetricsProtocol Protocol          `json:"metricsProtocol,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Resource        map[string]string `json:"resource"`
+	Propagators     []string          `json:"propagators"`
+}
+
+// redacted replaces sensitive values in a Description.
+const redacted = "REDACTED"
+
+// Describe returns the configuration Init resolved. The values of any OTLP headers, which
+// usually carry credentials, and any credentials in the endpoints are redacted.
+func (p *Providers) Describe() Description {
+	d := Description{
+		Sampler:         p.Sampler.Description(),
+		TracesProtocol:  p.tracesProtocol,
+		MetricsEndpoint: redactEndpoint(p.metricsEndpoint),
+		MetricsProtocol: p.metricsProtocol,
+		Resource:        make(map[string]string),
+		Propagators:     p.propagators,
+	}
+
+	for _, endpoint := range p.traceEndpoints {
+		d.TraceEndpoints = append(d.TraceEndpoints, redactEndpoint(endpoint))
+	}
+
+	for _, kv := range p.resource.Attributes() {
+		d.Resource[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_METRICS_HEADERS"} {
+		for _, header := range strings.Split(os.Getenv(env), ",") {
+			if key, _, ok := strings.Cut(header, "="); ok {
+				if d.Headers == nil {
+					d.Headers = make(map[string]string)
+				}
+
+				d.Headers[strings.TrimSpace(key)] = redacted
+			}
+		}
+	}
+
+	return d
+}
+
+// redactEndpoint hides any user info in an endpoint URL.
+func redactEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.User == nil {
+		return endpoint
+	}
+
+	return u.Redacted()
+}
+
+// DescribeHandler serves the providers' Description as JSON, e.g. at GET /admin/otel.
+func DescribeHandler(p *Providers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.Describe())
+	}
+}
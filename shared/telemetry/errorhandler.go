@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorHandler handles the errors the SDK can't return to the caller, such as a batch of spans
+// or metrics failing to export in the background. By default they're only written to the
+// standard logger; the handler logs them as structured errors and counts them, so a collector
+// going away shows up in the logs and metrics of every service.
+type errorHandler struct {
+	errors metric.Int64Counter
+}
+
+func newErrorHandler(meter metric.Meter) (*errorHandler, error) {
+	errors, err := meter.Int64Counter("otel.sdk.errors",
+		metric.WithDescription("Errors reported by the OpenTelemetry SDK, such as failed exports."),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sdk error counter: %w", err)
+	}
+
+	return &errorHandler{errors: errors}, nil
+}
+
+// Handle logs and counts the error. Errors from the OTLP exporters are labelled with their gRPC
+// status code, e.g. Unavailable while the collector is down.
+func (h *errorHandler) Handle(err error) {
+	errorType := "other"
+	if code := status.Code(err); code != codes.Unknown {
+		errorType = code.String()
+	}
+
+	slog.Error("opentelemetry error", "error", err, "error.type", errorType)
+	h.errors.Add(context.Background(), 1, metric.WithAttributes(attribute.String("error.type", errorType)))
+}
+
+// minConnectTimeout is gRPC's default minimum time a connection attempt is given.
+const minConnectTimeout = 20 * time.Second
+
+// reconnectDialOptions bound how long the exporters' gRPC connections wait between attempts to
+// reconnect to the collector. gRPC backs off for up to 2 minutes by default, so after a collector
+// restart the telemetry could otherwise stay undelivered long after the collector is back.
+func reconnectDialOptions(maxDelay time.Duration) []grpc.DialOption {
+	if maxDelay <= 0 {
+		return nil
+	}
+
+	params := backoff.DefaultConfig
+	params.MaxDelay = maxDelay
+	if params.BaseDelay > maxDelay {
+		params.BaseDelay = maxDelay
+	}
+
+	// Setting the connect params replaces gRPC's minimum connect timeout too, so it's kept.
+	return []grpc.DialOption{grpc.WithConnectParams(grpc.ConnectParams{Backoff: params, MinConnectTimeout: minConnectTimeout})}
+}
@@ -0,0 +1,95 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingExporter fails every export with err.
+type failingExporter struct {
+	err error
+}
+
+func (e failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return e.err
+}
+
+func (e failingExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantErrorType string
+	}{
+		{name: "collector unavailable", err: status.Error(codes.Unavailable, "connection refused"), wantErrorType: "Unavailable"},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, "context deadline exceeded"), wantErrorType: "DeadlineExceeded"},
+		{name: "other", err: errors.New("export failed"), wantErrorType: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previousLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			t.Cleanup(func() { slog.SetDefault(previousLogger) })
+
+			reader := sdkmetric.NewManualReader()
+			handler, err := newErrorHandler(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			previous := otel.GetErrorHandler()
+			otel.SetErrorHandler(handler)
+			t.Cleanup(func() { otel.SetErrorHandler(previous) })
+
+			// The simple span processor reports the export error to the global handler, as the batch
+			// processor does when exporting in the background.
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(failingExporter{err: tt.err}))).Tracer("test")
+			_, span := tracer.Start(context.Background(), "Checkout")
+			span.End()
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+
+			counted := map[string]int64{}
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					if m.Name != "otel.sdk.errors" {
+						continue
+					}
+
+					for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+						errorType, _ := dp.Attributes.Value(attribute.Key("error.type"))
+						counted[errorType.AsString()] += dp.Value
+					}
+				}
+			}
+
+			if len(counted) != 1 || counted[tt.wantErrorType] != 1 {
+				t.Errorf("got otel.sdk.errors %v, want 1 of error.type %s", counted, tt.wantErrorType)
+			}
+
+			if got := logs.String(); !strings.Contains(got, "opentelemetry error") || !strings.Contains(got, "error.type="+tt.wantErrorType) {
+				t.Errorf("got logs %q, want the error logged with error.type %s", got, tt.wantErrorType)
+			}
+		})
+	}
+}
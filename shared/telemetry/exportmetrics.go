@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// instrumentedExporter wraps a SpanExporter and counts its successful and failed exports, and
+// the spans it exported, so a collector rejecting data shows up in the metrics.
+type instrumentedExporter struct {
+	sdktrace.SpanExporter
+
+	successes metric.Int64Counter
+	failures  metric.Int64Counter
+	spans     metric.Int64Counter
+}
+
+// newInstrumentedExporter wraps exporter, counting its exports with meter.
+func newInstrumentedExporter(exporter sdktrace.SpanExporter, meter metric.Meter) (*instrumentedExporter, error) {
+	successes, err := meter.Int64Counter("otel.trace_export.success",
+		metric.WithDescription("Span export calls that succeeded."),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating export success counter: %w", err)
+	}
+
+	failures, err := meter.Int64Counter("otel.trace_export.failure",
+		metric.WithDescription("Span export calls that failed."),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating export failure counter: %w", err)
+	}
+
+	spans, err := meter.Int64Counter("otel.trace_export.spans",
+		metric.WithDescription("Spans successfully exported."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating exported spans counter: %w", err)
+	}
+
+	return &instrumentedExporter{SpanExporter: exporter, successes: successes, failures: failures, spans: spans}, nil
+}
+
+func (e *instrumentedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.SpanExporter.ExportSpans(ctx, spans); err != nil {
+		e.failures.Add(ctx, 1)
+		return err
+	}
+
+	e.successes.Add(ctx, 1)
+	e.spans.Add(ctx, int64(len(spans)))
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// counterTotal returns the sum of the named counter's data points.
+func counterTotal(t *testing.T, reader *sdkmetric.ManualReader, name string) int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					total += dp.Value
+				}
+			}
+		}
+	}
+
+	return total
+}
+
+func TestInstrumentedExporter(t *testing.T) {
+	tests := []struct {
+		name          string
+		batches       []int
+		down          []bool
+		wantSuccesses int64
+		wantFailures  int64
+		wantSpans     int64
+	}{
+		{name: "success", batches: []int{2, 3}, down: []bool{false, false}, wantSuccesses: 2, wantSpans: 5},
+		{name: "failure", batches: []int{2}, down: []bool{true}, wantFailures: 1},
+		{name: "failure then recovery", batches: []int{2, 1, 4}, down: []bool{true, true, false}, wantSuccesses: 1, wantFailures: 2, wantSpans: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+			flaky := &flakyExporter{InMemoryExporter: tracetest.NewInMemoryExporter()}
+			exporter, err := newInstrumentedExporter(flaky, meter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, n := range tt.batches {
+				flaky.down = tt.down[i]
+
+				spans := make([]sdktrace.ReadOnlySpan, n)
+				for j := range spans {
+					spans[j] = tracetest.SpanStub{Name: "span"}.Snapshot()
+				}
+
+				if err := exporter.ExportSpans(context.Background(), spans); (err != nil) != tt.down[i] {
+					t.Fatalf("batch %d: got error %v, want error %t", i, err, tt.down[i])
+				}
+			}
+
+			for name, want := range map[string]int64{
+				"otel.trace_export.success": tt.wantSuccesses,
+				"otel.trace_export.failure": tt.wantFailures,
+				"otel.trace_export.spans":   tt.wantSpans,
+			} {
+				if got := counterTotal(t, reader, name); got != want {
+					t.Errorf("got %s %d, want %d", name, got, want)
+				}
+			}
+		})
+	}
+}
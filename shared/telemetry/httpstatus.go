@@ -0,0 +1,57 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StatusPolicy decides which HTTP response status codes mark a span as errored. By default only
+// 5xx responses are errors, on both server and client spans, so a 404 from a downstream service
+// doesn't count towards the error rate unless ClientErrors says it should.
+type StatusPolicy struct {
+	// ClientErrors also marks 4xx responses as errors.
+	ClientErrors bool
+}
+
+// IsError reports whether a response with the status code is an error under the policy.
+func (p StatusPolicy) IsError(code int) bool {
+	if code >= http.StatusInternalServerError {
+		return true
+	}
+
+	return p.ClientErrors && code >= http.StatusBadRequest
+}
+
+// Transport returns an http.RoundTripper that applies the policy to the client span of each
+// request. It must be wrapped by the otelhttp transport, so the client span is in the request
+// context.
+//
+// The otelhttp transport marks every 4xx response as an error once the request returns. A span's
+// status can't be set back to Unset, so a response the policy doesn't consider an error is
+// marked Ok instead, which takes precedence over any status set later.
+func (p StatusPolicy) Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := next.RoundTrip(r)
+		if err != nil {
+			return res, err
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		switch {
+		case p.IsError(res.StatusCode):
+			span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+		case res.StatusCode >= http.StatusBadRequest:
+			span.SetStatus(codes.Ok, "")
+		}
+
+		return res, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clientSpan stands in for the otelhttp transport: it starts a client span for each request and,
+// like otelhttp, marks it as errored for any 4xx or 5xx response once the request returns.
+func clientSpan(tracer trace.Tracer, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		ctx, span := tracer.Start(r.Context(), "HTTP POST", trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+
+		res, err := next.RoundTrip(r.WithContext(ctx))
+		if err == nil && res.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, "")
+		}
+
+		return res, err
+	})
+}
+
+func TestStatusPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy StatusPolicy
+		code   int
+		want   codes.Code
+	}{
+		{name: "default 200", code: http.StatusOK, want: codes.Unset},
+		{name: "default 404", code: http.StatusNotFound, want: codes.Ok},
+		{name: "default 500", code: http.StatusInternalServerError, want: codes.Error},
+		{name: "default 503", code: http.StatusServiceUnavailable, want: codes.Error},
+		{name: "client errors 200", policy: StatusPolicy{ClientErrors: true}, code: http.StatusOK, want: codes.Unset},
+		{name: "client errors 404", policy: StatusPolicy{ClientErrors: true}, code: http.StatusNotFound, want: codes.Error},
+		{name: "client errors 500", policy: StatusPolicy{ClientErrors: true}, code: http.StatusInternalServerError, want: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := tt.policy.IsError(tt.code), tt.want == codes.Error; got != want {
+				t.Errorf("got IsError(%d) %t, want %t", tt.code, got, want)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.code)
+			}))
+			t.Cleanup(server.Close)
+
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+			client := http.Client{Transport: clientSpan(tracer, tt.policy.Transport(http.DefaultTransport))}
+
+			res, err := client.Post(server.URL, "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if got := recorder.Ended()[0].Status().Code; got != tt.want {
+				t.Errorf("got span status %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
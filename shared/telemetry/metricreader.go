@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TemporalitySelector returns the temporality the metrics are exported with, from
+// OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE:
+//
+//   - cumulative (the default) reports every instrument's running total.
+//   - delta reports the change since the last collection for counters and histograms, which
+//     some backends prefer. Up-down counters stay cumulative, as their deltas mean little.
+//   - lowmemory is delta for synchronous counters and histograms only, so the SDK doesn't have
+//     to remember the last value of every observable counter.
+//
+// It's exported so a reader created outside Init, such as a test's manual reader, can collect
+// with the same temporality as the exporter.
+func TemporalitySelector() (sdkmetric.TemporalitySelector, error) {
+	return temporalitySelector(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE"))
+}
+
+// temporalitySelector returns the selector for a temporality preference, as described by
+// TemporalitySelector.
+func temporalitySelector(preference string) (sdkmetric.TemporalitySelector, error) {
+	switch strings.ToLower(preference) {
+	case "", "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+				return metricdata.CumulativeTemporality
+			default:
+				return metricdata.DeltaTemporality
+			}
+		}, nil
+	case "lowmemory":
+		return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+			switch kind {
+			case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindHistogram:
+				return metricdata.DeltaTemporality
+			default:
+				return metricdata.CumulativeTemporality
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE: %q", preference)
+	}
+}
+
+// createMetricReader returns the periodic reader that pushes the metrics to the exporter. Like
+// the span batch processor's OTEL_BSP_* settings, how often it collects and how long each export
+// may take are set in milliseconds by OTEL_METRIC_EXPORT_INTERVAL (60000 by default) and
+// OTEL_METRIC_EXPORT_TIMEOUT (30000 by default). They're validated by LoadSettings, as the SDK
+// silently falls back to the defaults. A zero interval or timeout leaves the default.
+func createMetricReader(exporter sdkmetric.Exporter, interval, timeout time.Duration) sdkmetric.Reader {
+	var opts []sdkmetric.PeriodicReaderOption
+
+	if interval > 0 {
+		opts = append(opts, sdkmetric.WithInterval(interval))
+	}
+
+	if timeout > 0 {
+		opts = append(opts, sdkmetric.WithTimeout(timeout))
+	}
+
+	return sdkmetric.NewPeriodicReader(exporter, opts...)
+}
+
+// envMillis reads a positive duration in milliseconds from an environment variable, which is
+// zero when unset.
+func envMillis(key string) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, v)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
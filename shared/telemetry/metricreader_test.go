@@ -0,0 +1,162 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestTemporalitySelector(t *testing.T) {
+	tests := []struct {
+		name       string
+		preference string
+		wantErr    bool
+
+		// The counter and up-down counter are each added to once per collection.
+		wantCounter      metricdata.Temporality
+		wantCounterValue int64
+		wantUpDown       metricdata.Temporality
+		wantUpDownValue  int64
+	}{
+		{
+			name:             "default",
+			wantCounter:      metricdata.CumulativeTemporality,
+			wantCounterValue: 2,
+			wantUpDown:       metricdata.CumulativeTemporality,
+			wantUpDownValue:  2,
+		},
+		{
+			name:             "cumulative",
+			preference:       "cumulative",
+			wantCounter:      metricdata.CumulativeTemporality,
+			wantCounterValue: 2,
+			wantUpDown:       metricdata.CumulativeTemporality,
+			wantUpDownValue:  2,
+		},
+		{
+			name:             "delta",
+			preference:       "Delta",
+			wantCounter:      metricdata.DeltaTemporality,
+			wantCounterValue: 1,
+			wantUpDown:       metricdata.CumulativeTemporality,
+			wantUpDownValue:  2,
+		},
+		{
+			name:             "low memory",
+			preference:       "lowmemory",
+			wantCounter:      metricdata.DeltaTemporality,
+			wantCounterValue: 1,
+			wantUpDown:       metricdata.CumulativeTemporality,
+			wantUpDownValue:  2,
+		},
+		{name: "unknown", preference: "monthly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE", tt.preference)
+
+			selector, err := TemporalitySelector()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid temporality preference")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(selector))
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+			counter, err := meter.Int64Counter("checkouts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			upDown, err := meter.Int64UpDownCounter("checkouts.active")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rm metricdata.ResourceMetrics
+			for range 2 {
+				counter.Add(context.Background(), 1)
+				upDown.Add(context.Background(), 1)
+
+				if err := reader.Collect(context.Background(), &rm); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := map[string]struct {
+				temporality metricdata.Temporality
+				value       int64
+			}{
+				"checkouts":        {tt.wantCounter, tt.wantCounterValue},
+				"checkouts.active": {tt.wantUpDown, tt.wantUpDownValue},
+			}
+
+			if got := len(rm.ScopeMetrics[0].Metrics); got != len(want) {
+				t.Fatalf("got %d metrics, want %d", got, len(want))
+			}
+
+			for _, m := range rm.ScopeMetrics[0].Metrics {
+				sum := m.Data.(metricdata.Sum[int64])
+				if sum.Temporality != want[m.Name].temporality {
+					t.Errorf("got %s temporality %s, want %s", m.Name, sum.Temporality, want[m.Name].temporality)
+				}
+
+				if got := sum.DataPoints[0].Value; got != want[m.Name].value {
+					t.Errorf("got %s %d on the second collection, want %d", m.Name, got, want[m.Name].value)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSettingsMetricExport(t *testing.T) {
+	tests := []struct {
+		name         string
+		interval     string
+		timeout      string
+		wantInterval time.Duration
+		wantTimeout  time.Duration
+		wantErr      bool
+	}{
+		{name: "defaults"},
+		{name: "set", interval: "10000", timeout: "5000", wantInterval: 10 * time.Second, wantTimeout: 5 * time.Second},
+		{name: "invalid interval", interval: "10s", wantErr: true},
+		{name: "zero timeout", timeout: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", tt.interval)
+			t.Setenv("OTEL_METRIC_EXPORT_TIMEOUT", tt.timeout)
+
+			s, err := LoadSettings()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want the settings rejected")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.MetricExportInterval != tt.wantInterval || s.MetricExportTimeout != tt.wantTimeout {
+				t.Errorf("got interval %s and timeout %s, want %s and %s", s.MetricExportInterval, s.MetricExportTimeout, tt.wantInterval, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package telemetry
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Protocol is the transport and encoding the OTLP exporters send the telemetry with.
+type Protocol string
+
+const (
+	ProtocolGRPC         Protocol = "grpc"
+	ProtocolHTTPProtobuf Protocol = "http/protobuf"
+
+	// ProtocolHTTPJSON is recognised only to be rejected with a clear error. The SDK's OTLP/HTTP
+	// exporters only encode protobuf.
+	ProtocolHTTPJSON Protocol = "http/json"
+)
+
+// defaultOTLPProtocol is the protocol used when none is configured. The services have always
+// exported over gRPC, so the HTTP transport is opt-in.
+const defaultOTLPProtocol = ProtocolGRPC
+
+// OTLPProtocol resolves the OTLP protocol for a signal. The signal specific variable (e.g.
+// OTEL_EXPORTER_OTLP_TRACES_PROTOCOL) takes precedence, then OTEL_EXPORTER_OTLP_PROTOCOL, and
+// otherwise it's grpc. The value isn't validated; LoadSettings checks it.
+func OTLPProtocol(signal Signal) Protocol {
+	if protocol, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_" + string(signal) + "_PROTOCOL"); ok {
+		return Protocol(protocol)
+	}
+
+	if protocol, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_PROTOCOL"); ok {
+		return Protocol(protocol)
+	}
+
+	return defaultOTLPProtocol
+}
+
+// defaultPort is the port the collector listens on for the protocol.
+func (p Protocol) defaultPort() string {
+	if p == ProtocolGRPC {
+		return defaultOTLPPort
+	}
+
+	return defaultOTLPHTTPPort
+}
+
+// valid reports whether the protocol is one the exporters support.
+func (p Protocol) valid() bool {
+	switch p {
+	case ProtocolGRPC, ProtocolHTTPProtobuf:
+		return true
+	default:
+		return false
+	}
+}
+
+// defaultOTLPHTTPPort is used for an OTLP/HTTP endpoint without a port.
+const defaultOTLPHTTPPort = "4318"
+
+// otlpHTTPTarget is an OTLP endpoint resolved into what the OTLP/HTTP exporters need to reach it.
+type otlpHTTPTarget struct {
+	// address is the collector's host:port.
+	address string
+
+	// path is the URL path the signal is posted to, e.g. /v1/traces.
+	path string
+
+	// insecure sends the telemetry over plain HTTP rather than HTTPS.
+	insecure bool
+}
+
+// url returns the URL the telemetry is posted to.
+func (t otlpHTTPTarget) url() string {
+	scheme := "https"
+	if t.insecure {
+		scheme = "http"
+	}
+
+	return (&url.URL{Scheme: scheme, Host: t.address, Path: t.path}).String()
+}
+
+// parseOTLPHTTPEndpoint validates and normalises an OTLP/HTTP endpoint for a signal. It accepts:
+//
+//   - host:port, sent to over plain HTTP, as the collector is usually a local agent or sidecar.
+//   - http://host:port or https://host:port, optionally with the path the signal is posted to.
+//     Without a path, the signal's default path, e.g. /v1/traces, is used.
+func parseOTLPHTTPEndpoint(endpoint string, signal Signal) (otlpHTTPTarget, error) {
+	defaultPath := "/v1/" + strings.ToLower(string(signal))
+
+	if !strings.Contains(endpoint, "://") {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			return otlpHTTPTarget{}, fmt.Errorf("invalid otlp endpoint %q, expected host:port: %w", endpoint, err)
+		}
+
+		return otlpHTTPTarget{address: endpoint, path: defaultPath, insecure: true}, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return otlpHTTPTarget{}, fmt.Errorf("invalid otlp endpoint %q: %w", endpoint, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return otlpHTTPTarget{}, fmt.Errorf("invalid otlp endpoint %q: unsupported scheme %q over http", endpoint, u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return otlpHTTPTarget{}, fmt.Errorf("invalid otlp endpoint %q: missing host", endpoint)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultOTLPHTTPPort
+	}
+
+	path := u.Path
+	if path == "" || path == "/" {
+		path = defaultPath
+	}
+
+	return otlpHTTPTarget{
+		address:  net.JoinHostPort(u.Hostname(), port),
+		path:     path,
+		insecure: u.Scheme == "http",
+	}, nil
+}
@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLoadSettingsProtocols(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		traces          Protocol
+		metrics         Protocol
+		traceEndpoint   string
+		metricsEndpoint string
+		wantErr         bool
+	}{
+		{
+			name:            "default",
+			traces:          ProtocolGRPC,
+			metrics:         ProtocolGRPC,
+			traceEndpoint:   "0.0.0.0:4317",
+			metricsEndpoint: "0.0.0.0:4317",
+		},
+		{
+			name:            "http/protobuf",
+			env:             map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"},
+			traces:          ProtocolHTTPProtobuf,
+			metrics:         ProtocolHTTPProtobuf,
+			traceEndpoint:   "0.0.0.0:4318",
+			metricsEndpoint: "0.0.0.0:4318",
+		},
+		{
+			name: "signal specific protocol takes precedence",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_PROTOCOL":        "grpc",
+				"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/protobuf",
+			},
+			traces:          ProtocolHTTPProtobuf,
+			metrics:         ProtocolGRPC,
+			traceEndpoint:   "0.0.0.0:4318",
+			metricsEndpoint: "0.0.0.0:4317",
+		},
+		{
+			name:    "json",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"},
+			wantErr: true,
+		},
+		{
+			name:    "json spans",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "http/json"},
+			wantErr: true,
+		},
+		{
+			name:    "json metrics",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL": "http/json"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown protocol",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			s, err := LoadSettings()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.TracesProtocol != tt.traces || s.MetricsProtocol != tt.metrics {
+				t.Errorf("got protocols %q and %q, want %q and %q", s.TracesProtocol, s.MetricsProtocol, tt.traces, tt.metrics)
+			}
+
+			if len(s.TraceEndpoints) != 1 || s.TraceEndpoints[0] != tt.traceEndpoint {
+				t.Errorf("got trace endpoints %v, want %q", s.TraceEndpoints, tt.traceEndpoint)
+			}
+
+			if s.MetricsEndpoint != tt.metricsEndpoint {
+				t.Errorf("got metrics endpoint %q, want %q", s.MetricsEndpoint, tt.metricsEndpoint)
+			}
+		})
+	}
+}
+
+func TestParseOTLPHTTPEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{endpoint: "collector:4318", want: "http://collector:4318/v1/traces"},
+		{endpoint: "http://collector", want: "http://collector:4318/v1/traces"},
+		{endpoint: "https://collector:443/", want: "https://collector:443/v1/traces"},
+		{endpoint: "https://collector/custom/path", want: "https://collector:4318/custom/path"},
+		{endpoint: "collector", wantErr: true},
+		{endpoint: "unix:///tmp/otel.sock", wantErr: true},
+		{endpoint: "http://:4318", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			target, err := parseOTLPHTTPEndpoint(tt.endpoint, SignalTraces)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", target)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := target.url(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOTLPHTTPExporterEncoding exports a span over OTLP/HTTP and checks the request the
+// collector receives is protobuf with the configured headers.
+func TestOTLPHTTPExporterEncoding(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "x-api-key=secret%20key")
+
+	traceID, _ := trace.TraceIDFromHex("5759e988bd862e3fe1be46a994272793")
+	spanID, _ := trace.SpanIDFromHex("53995c3f42cd8ad8")
+	span := tracetest.SpanStub{
+		Name:        "Checkout",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}),
+	}.Snapshot()
+
+	type request struct {
+		path, contentType, apiKey string
+	}
+	requests := make(chan request, 1)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		requests <- request{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("x-api-key")}
+	}))
+	defer collector.Close()
+
+	exporter, err := createOLTPExporter(collector.URL, ProtocolHTTPProtobuf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = exporter.Shutdown(context.Background())
+
+	got := <-requests
+	if got.path != "/v1/traces" {
+		t.Errorf("got path %q, want /v1/traces", got.path)
+	}
+
+	if got.contentType != "application/x-protobuf" {
+		t.Errorf("got content type %q, want application/x-protobuf", got.contentType)
+	}
+
+	if got.apiKey != "secret key" {
+		t.Errorf("got x-api-key %q, want the configured header", got.apiKey)
+	}
+}
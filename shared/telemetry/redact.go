@@ -0,0 +1,130 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"shared/appattr"
+)
+
+// redactedValue replaces the value of a redacted attribute when it isn't hashed.
+const redactedValue = "[REDACTED]"
+
+// redactingExporter wraps a SpanExporter and rewrites the configured attribute keys before the
+// spans are exported. The value is either replaced outright or, when hashing, swapped for a
+// truncated SHA-256 of it, which hides the value while still letting spans with the same value
+// be grouped in the backend.
+type redactingExporter struct {
+	sdktrace.SpanExporter
+
+	keys map[attribute.Key]bool
+	hash bool
+}
+
+func newRedactingExporter(exporter sdktrace.SpanExporter, keys []string, hash bool) *redactingExporter {
+	return &redactingExporter{SpanExporter: exporter, keys: attributeKeys(keys), hash: hash}
+}
+
+// attributeKeys returns the set of attribute keys matching the configured names: each name as it
+// is, and with the services' ATTRIBUTE_PREFIX applied, so a name such as "transaction.id" matches
+// the services' own attribute however they're namespaced, as well as a semconv one.
+func attributeKeys(names []string) map[attribute.Key]bool {
+	keys := make(map[attribute.Key]bool, 2*len(names))
+	for _, name := range names {
+		keys[attribute.Key(name)] = true
+		keys[appattr.Key(name)] = true
+	}
+
+	return keys
+}
+
+func (e *redactingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		redacted[i] = e.redact(span)
+	}
+
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+// redact redacts the span's attributes and those of its events, such as an exception's message.
+func (e *redactingExporter) redact(span sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attrs := e.redactAttributes(span.Attributes())
+
+	var events []sdktrace.Event
+	for i, event := range span.Events() {
+		eventAttrs := e.redactAttributes(event.Attributes)
+		if eventAttrs == nil {
+			continue
+		}
+
+		// Only copy the events once one actually needs redacting.
+		if events == nil {
+			events = append([]sdktrace.Event(nil), span.Events()...)
+		}
+
+		events[i].Attributes = eventAttrs
+	}
+
+	if attrs == nil && events == nil {
+		return span
+	}
+
+	return redactedSpan{ReadOnlySpan: span, attributes: attrs, events: events}
+}
+
+// redactAttributes returns a copy of attrs with the configured keys redacted, or nil if none of
+// them needs redacting.
+func (e *redactingExporter) redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if !e.keys[kv.Key] {
+			continue
+		}
+
+		// Only copy the attributes once one actually needs redacting.
+		if out == nil {
+			out = append([]attribute.KeyValue(nil), attrs...)
+		}
+
+		out[i] = e.value(kv)
+	}
+
+	return out
+}
+
+func (e *redactingExporter) value(kv attribute.KeyValue) attribute.KeyValue {
+	if !e.hash {
+		return kv.Key.String(redactedValue)
+	}
+
+	sum := sha256.Sum256([]byte(kv.Value.Emit()))
+
+	return kv.Key.String("sha256:" + hex.EncodeToString(sum[:8]))
+}
+
+// redactedSpan overrides the attributes and events of the span it wraps, where they're set.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	if s.attributes == nil {
+		return s.ReadOnlySpan.Attributes()
+	}
+
+	return s.attributes
+}
+
+func (s redactedSpan) Events() []sdktrace.Event {
+	if s.events == nil {
+		return s.ReadOnlySpan.Events()
+	}
+
+	return s.events
+}
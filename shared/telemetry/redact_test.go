@@ -0,0 +1,162 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"shared/appattr"
+)
+
+// exportThrough exports the spans through the exporter wrap builds around an in-memory one,
+// returning the spans it received.
+func exportThrough(t *testing.T, wrap func(sdktrace.SpanExporter) sdktrace.SpanExporter, spans ...tracetest.SpanStub) tracetest.SpanStubs {
+	t.Helper()
+
+	memory := tracetest.NewInMemoryExporter()
+	if err := wrap(memory).ExportSpans(context.Background(), tracetest.SpanStubs(spans).Snapshots()); err != nil {
+		t.Fatal(err)
+	}
+
+	return memory.GetSpans()
+}
+
+// attributeValue returns the value of key among attrs.
+func attributeValue(attrs []attribute.KeyValue, key attribute.Key) attribute.Value {
+	set := attribute.NewSet(attrs...)
+	value, _ := set.Value(key)
+	return value
+}
+
+func TestRedactingExporter(t *testing.T) {
+	// The services' own attributes are namespaced by ATTRIBUTE_PREFIX, while semconv ones never are.
+	transactionID := appattr.Key("transaction.id")
+
+	span := tracetest.SpanStub{
+		Name: "Make Payment",
+		Attributes: []attribute.KeyValue{
+			transactionID.String("5f8a"),
+			semconv.HTTPURLKey.String("http://service-b/payment?card=4111"),
+			attribute.String("basket.size", "3"),
+		},
+		Events: []sdktrace.Event{{
+			Name:       semconv.ExceptionEventName,
+			Attributes: []attribute.KeyValue{semconv.ExceptionMessageKey.String("declined card 4111"), transactionID.String("5f8a")},
+		}},
+	}
+
+	tests := []struct {
+		name  string
+		keys  []string
+		hash  bool
+		want  map[attribute.Key]string
+		event map[attribute.Key]string
+	}{
+		{
+			name:  "custom attribute",
+			keys:  []string{"transaction.id"},
+			want:  map[attribute.Key]string{transactionID: redactedValue, semconv.HTTPURLKey: "http://service-b/payment?card=4111", "basket.size": "3"},
+			event: map[attribute.Key]string{transactionID: redactedValue, semconv.ExceptionMessageKey: "declined card 4111"},
+		},
+		{
+			name:  "semconv attribute",
+			keys:  []string{"http.url", "exception.message"},
+			want:  map[attribute.Key]string{transactionID: "5f8a", semconv.HTTPURLKey: redactedValue},
+			event: map[attribute.Key]string{semconv.ExceptionMessageKey: redactedValue},
+		},
+		{
+			name:  "hashed",
+			keys:  []string{"transaction.id"},
+			hash:  true,
+			want:  map[attribute.Key]string{transactionID: "sha256:a88d7f02ae8707e3"},
+			event: map[attribute.Key]string{transactionID: "sha256:a88d7f02ae8707e3"},
+		},
+		{
+			name:  "unmatched",
+			keys:  []string{"card.number"},
+			want:  map[attribute.Key]string{transactionID: "5f8a"},
+			event: map[attribute.Key]string{transactionID: "5f8a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exportThrough(t, func(e sdktrace.SpanExporter) sdktrace.SpanExporter {
+				return newRedactingExporter(e, tt.keys, tt.hash)
+			}, span)[0]
+
+			for key, want := range tt.want {
+				if value := attributeValue(got.Attributes, key).AsString(); value != want {
+					t.Errorf("got %s %q, want %q", key, value, want)
+				}
+			}
+
+			for key, want := range tt.event {
+				if value := attributeValue(got.Events[0].Attributes, key).AsString(); value != want {
+					t.Errorf("got event %s %q, want %q", key, value, want)
+				}
+			}
+		})
+	}
+
+	// The span handed to the exporter is left as it was.
+	if value := attributeValue(span.Attributes, transactionID).AsString(); value != "5f8a" {
+		t.Errorf("the original span's attribute was changed to %q", value)
+	}
+}
+
+func TestLoadSettingsRedaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		mode     string
+		wantKeys []string
+		wantHash bool
+	}{
+		{name: "unset"},
+		{name: "keys", keys: "transaction.id, payment.receipt.id,", wantKeys: []string{"transaction.id", "payment.receipt.id"}},
+		{name: "hashed", keys: "transaction.id", mode: "hash", wantKeys: []string{"transaction.id"}, wantHash: true},
+		{name: "unknown mode replaces", keys: "transaction.id", mode: "mask", wantKeys: []string{"transaction.id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDACTED_ATTRIBUTES", tt.keys)
+			t.Setenv("REDACTION_MODE", tt.mode)
+
+			s, err := LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(s.RedactedAttributes, tt.wantKeys) {
+				t.Errorf("got keys %q, want %q", s.RedactedAttributes, tt.wantKeys)
+			}
+
+			if s.HashRedacted != tt.wantHash {
+				t.Errorf("got hashed %t, want %t", s.HashRedacted, tt.wantHash)
+			}
+		})
+	}
+}
+
+// TestAttributeKeysWithPrefix re-runs the redaction and truncation tests with ATTRIBUTE_PREFIX set,
+// which appattr only reads once per process.
+func TestAttributeKeysWithPrefix(t *testing.T) {
+	if os.Getenv("ATTRIBUTE_PREFIX") != "" {
+		t.Skip("already running with a prefix")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^(TestRedactingExporter|TestTruncatingExporter)$", "-test.v")
+	cmd.Env = append(os.Environ(), "ATTRIBUTE_PREFIX=app.")
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("with ATTRIBUTE_PREFIX=app.: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,79 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// bufferingExporter wraps a SpanExporter and keeps the spans from failed exports in a bounded
+// in-memory buffer, rather than dropping them. The buffer is retried ahead of the next batch,
+// so once the collector is reachable again the spans from the outage are exported too. When
+// the buffer is full the oldest spans are dropped and counted.
+type bufferingExporter struct {
+	sdktrace.SpanExporter
+
+	mu       sync.Mutex
+	buffer   []sdktrace.ReadOnlySpan
+	maxSpans int
+	dropped  metric.Int64Counter
+}
+
+// newBufferingExporter wraps exporter with a buffer of up to maxSpans spans, counting the spans
+// it drops with meter.
+func newBufferingExporter(exporter sdktrace.SpanExporter, maxSpans int, meter metric.Meter) (*bufferingExporter, error) {
+	dropped, err := meter.Int64Counter(
+		"otel.exporter.spans.dropped",
+		metric.WithDescription("Spans dropped because the export retry buffer was full."),
+		metric.WithUnit("{span}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dropped spans counter: %w", err)
+	}
+
+	return &bufferingExporter{SpanExporter: exporter, maxSpans: maxSpans, dropped: dropped}, nil
+}
+
+func (e *bufferingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pending := append(e.buffer, spans...)
+	e.buffer = nil
+
+	if err := e.SpanExporter.ExportSpans(ctx, pending); err != nil {
+		e.retain(ctx, pending)
+		return err
+	}
+
+	return nil
+}
+
+// retain buffers spans for the next export, dropping the oldest once the buffer is full.
+func (e *bufferingExporter) retain(ctx context.Context, spans []sdktrace.ReadOnlySpan) {
+	if overflow := len(spans) - e.maxSpans; overflow > 0 {
+		e.dropped.Add(ctx, int64(overflow))
+		spans = spans[overflow:]
+	}
+
+	e.buffer = spans
+}
+
+func (e *bufferingExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.buffer
+	e.buffer = nil
+	e.mu.Unlock()
+
+	// Make a last attempt to export anything still buffered before shutting down.
+	if len(pending) > 0 {
+		if err := e.SpanExporter.ExportSpans(ctx, pending); err != nil {
+			e.dropped.Add(ctx, int64(len(pending)))
+		}
+	}
+
+	return e.SpanExporter.Shutdown(ctx)
+}
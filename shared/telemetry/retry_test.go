@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// flakyExporter fails its exports while down, otherwise exporting to the in-memory exporter.
+type flakyExporter struct {
+	*tracetest.InMemoryExporter
+	down bool
+}
+
+func (e *flakyExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if e.down {
+		return errors.New("collector unavailable")
+	}
+
+	return e.InMemoryExporter.ExportSpans(ctx, spans)
+}
+
+// Shutdown keeps the exported spans, which the in-memory exporter would reset.
+func (e *flakyExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestBufferingExporter(t *testing.T) {
+	// batch is a batch of spans to export, while the collector is up or down.
+	type batch struct {
+		spans []string
+		down  bool
+	}
+
+	tests := []struct {
+		name        string
+		maxSpans    int
+		batches     []batch
+		shutdown    bool
+		downAtEnd   bool
+		wantSpans   []string
+		wantDropped int64
+	}{
+		{
+			name:      "no failures",
+			maxSpans:  10,
+			batches:   []batch{{spans: []string{"a"}}, {spans: []string{"b"}}},
+			wantSpans: []string{"a", "b"},
+		},
+		{
+			name:      "failure then recovery",
+			maxSpans:  10,
+			batches:   []batch{{spans: []string{"a", "b"}, down: true}, {spans: []string{"c"}, down: true}, {spans: []string{"d"}}},
+			wantSpans: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:        "overflow drops the oldest",
+			maxSpans:    2,
+			batches:     []batch{{spans: []string{"a", "b"}, down: true}, {spans: []string{"c"}, down: true}, {spans: []string{"d"}}},
+			wantSpans:   []string{"b", "c", "d"},
+			wantDropped: 1,
+		},
+		{
+			name:      "flushed on shutdown",
+			maxSpans:  10,
+			batches:   []batch{{spans: []string{"a"}, down: true}},
+			shutdown:  true,
+			wantSpans: []string{"a"},
+		},
+		{
+			name:        "dropped when still down at shutdown",
+			maxSpans:    10,
+			batches:     []batch{{spans: []string{"a", "b"}, down: true}},
+			shutdown:    true,
+			downAtEnd:   true,
+			wantDropped: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+			flaky := &flakyExporter{InMemoryExporter: tracetest.NewInMemoryExporter()}
+			exporter, err := newBufferingExporter(flaky, tt.maxSpans, meter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			for _, b := range tt.batches {
+				flaky.down = b.down
+
+				var spans []sdktrace.ReadOnlySpan
+				for _, name := range b.spans {
+					spans = append(spans, tracetest.SpanStub{Name: name}.Snapshot())
+				}
+
+				if err := exporter.ExportSpans(ctx, spans); (err != nil) != b.down {
+					t.Fatalf("got error %v exporting %v, want error %t", err, b.spans, b.down)
+				}
+			}
+
+			if tt.shutdown {
+				flaky.down = tt.downAtEnd
+				if err := exporter.Shutdown(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var names []string
+			for _, span := range flaky.GetSpans() {
+				names = append(names, span.Name)
+			}
+
+			if !slices.Equal(names, tt.wantSpans) {
+				t.Errorf("got spans %v exported, want %v", names, tt.wantSpans)
+			}
+
+			dropped := counterTotal(t, reader, "otel.exporter.spans.dropped")
+			if dropped != tt.wantDropped {
+				t.Errorf("got %d spans dropped, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
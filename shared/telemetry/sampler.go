@@ -0,0 +1,201 @@
+package telemetry
+
+import (
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// samplingDecisionKey records which sampler decided to sample a span, to help debug why a
+// trace does or doesn't appear.
+func samplingDecisionKey() attribute.Key {
+	return appattr.Key("sampling.decision")
+}
+
+// The sources of a sampling decision.
+const (
+	// decisionParent follows the sampling decision of the span's parent.
+	decisionParent = "parent"
+
+	// decisionAlways samples every root span.
+	decisionAlways = "always"
+
+	// decisionForced samples a trace whose root span matches the TargetSampler's target.
+	decisionForced = "forced"
+
+	// decisionStartup samples one of the first root spans after the process started.
+	decisionStartup = "startup"
+
+	// decisionSynthetic samples a fraction of the root spans of synthetic traffic.
+	decisionSynthetic = "synthetic"
+)
+
+// TargetSampler force-samples any trace whose root span's start attributes, or the baggage the
+// request arrived with, carry a target key/value pair set at runtime, e.g. basket.id=123. This
+// approximates tail sampling at the head, so a specific transaction can be captured on demand
+// even when only a fraction of traces are sampled. Only what's known when the root span starts
+// can match, so a value such as a query parameter has to be carried into the baggage first, as
+// middleware.QueryBaggage does.
+//
+// The decision is only made for root spans. Every other span, and any root span that doesn't
+// match, is left to the wrapped sampler, whose children follow their parent, so a trace is
+// either captured whole or not at all.
+type TargetSampler struct {
+	base   sdktrace.Sampler
+	target atomic.Pointer[attribute.KeyValue]
+}
+
+var _ sdktrace.Sampler = (*TargetSampler)(nil)
+
+func newTargetSampler(base sdktrace.Sampler) *TargetSampler {
+	return &TargetSampler{base: base}
+}
+
+// SetTarget force-samples traces where key has value. The key is an attribute as the services
+// name it, e.g. basket.id, and matches it with or without the ATTRIBUTE_PREFIX namespace, or a
+// baggage member of the same name. It is safe to call while spans are being started.
+func (s *TargetSampler) SetTarget(key, value string) {
+	kv := attribute.String(key, value)
+	s.target.Store(&kv)
+}
+
+// ClearTarget stops force-sampling.
+func (s *TargetSampler) ClearTarget() {
+	s.target.Store(nil)
+}
+
+// Target returns the current target, and false if there isn't one.
+func (s *TargetSampler) Target() (attribute.KeyValue, bool) {
+	target := s.target.Load()
+	if target == nil {
+		return attribute.KeyValue{}, false
+	}
+
+	return *target, true
+}
+
+func (s *TargetSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		return s.base.ShouldSample(p)
+	}
+
+	if target, ok := s.Target(); ok && matches(p, target) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Attributes: []attribute.KeyValue{samplingDecisionKey().String(decisionForced)},
+		}
+	}
+
+	return s.base.ShouldSample(p)
+}
+
+func (s *TargetSampler) Description() string {
+	return "TargetSampler{" + s.base.Description() + "}"
+}
+
+func matches(p sdktrace.SamplingParameters, target attribute.KeyValue) bool {
+	prefixed := appattr.Key(string(target.Key))
+
+	for _, kv := range p.Attributes {
+		if (kv.Key == target.Key || kv.Key == prefixed) && kv.Value.Emit() == target.Value.AsString() {
+			return true
+		}
+	}
+
+	member := baggage.FromContext(p.ParentContext).Member(string(target.Key))
+
+	return member.Key() != "" && member.Value() == target.Value.AsString()
+}
+
+// decisionSampler records on each span whether its sampling decision followed its parent or
+// was made by the root sampler, which is named by root.
+type decisionSampler struct {
+	base sdktrace.Sampler
+	root string
+}
+
+var _ sdktrace.Sampler = decisionSampler{}
+
+func (s decisionSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.base.ShouldSample(p)
+
+	source := s.root
+	if trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		source = decisionParent
+	}
+
+	result.Attributes = append(result.Attributes, samplingDecisionKey().String(source))
+
+	return result
+}
+
+func (s decisionSampler) Description() string {
+	return s.base.Description()
+}
+
+// startupSampler samples the first n root spans started by the process, whatever the wrapped
+// sampler decides, so a fresh deploy always produces a trace to smoke-test it with. Every other
+// span is left to the wrapped sampler.
+type startupSampler struct {
+	base      sdktrace.Sampler
+	remaining atomic.Int64
+}
+
+var _ sdktrace.Sampler = (*startupSampler)(nil)
+
+func newStartupSampler(base sdktrace.Sampler, n int64) *startupSampler {
+	s := &startupSampler{base: base}
+	s.remaining.Store(n)
+
+	return s
+}
+
+func (s *startupSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	// The counter is only decremented while it's positive, so it can't wrap around however many
+	// spans are started.
+	if !trace.SpanContextFromContext(p.ParentContext).IsValid() && s.remaining.Load() > 0 && s.remaining.Add(-1) >= 0 {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Attributes: []attribute.KeyValue{samplingDecisionKey().String(decisionStartup)},
+		}
+	}
+
+	return s.base.ShouldSample(p)
+}
+
+func (s *startupSampler) Description() string {
+	return "StartupSampler{" + s.base.Description() + "}"
+}
+
+// syntheticSampler samples a fraction of the root spans of synthetic traffic, such as a load test,
+// so it doesn't crowd out the real traffic in the backend. Every other span is left to the
+// wrapped sampler.
+type syntheticSampler struct {
+	base  sdktrace.Sampler
+	ratio sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = syntheticSampler{}
+
+func newSyntheticSampler(base sdktrace.Sampler, ratio float64) syntheticSampler {
+	return syntheticSampler{base: base, ratio: sdktrace.TraceIDRatioBased(ratio)}
+}
+
+func (s syntheticSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if trace.SpanContextFromContext(p.ParentContext).IsValid() || !IsSynthetic(p.ParentContext) {
+		return s.base.ShouldSample(p)
+	}
+
+	result := s.ratio.ShouldSample(p)
+	result.Attributes = append(result.Attributes, samplingDecisionKey().String(decisionSynthetic))
+
+	return result
+}
+
+func (s syntheticSampler) Description() string {
+	return "SyntheticSampler{" + s.ratio.Description() + "," + s.base.Description() + "}"
+}
@@ -0,0 +1,289 @@
+package telemetry
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"shared/appattr"
+)
+
+// sampledParent returns a context whose remote parent span was or wasn't sampled.
+func sampledParent(sampled bool) context.Context {
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: flags,
+		Remote:     true,
+	}))
+}
+
+// withBaggage returns a copy of ctx carrying the baggage member.
+func withBaggage(t *testing.T, ctx context.Context, key, value string) context.Context {
+	t.Helper()
+
+	member, err := baggage.NewMember(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func TestTargetSampler(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		attrs  []attribute.KeyValue
+		want   sdktrace.SamplingDecision
+		forced bool
+	}{
+		{
+			name:   "root with the attribute",
+			ctx:    context.Background(),
+			attrs:  []attribute.KeyValue{appattr.Key("basket.id").String("123")},
+			want:   sdktrace.RecordAndSample,
+			forced: true,
+		},
+		{
+			name:   "root with the unprefixed attribute",
+			ctx:    context.Background(),
+			attrs:  []attribute.KeyValue{attribute.String("basket.id", "123")},
+			want:   sdktrace.RecordAndSample,
+			forced: true,
+		},
+		{
+			name:   "root with the baggage",
+			ctx:    withBaggage(t, context.Background(), "basket.id", "123"),
+			want:   sdktrace.RecordAndSample,
+			forced: true,
+		},
+		{
+			name:  "root with another value",
+			ctx:   context.Background(),
+			attrs: []attribute.KeyValue{appattr.Key("basket.id").String("456")},
+			want:  sdktrace.Drop,
+		},
+		{
+			name:  "child of an unsampled parent",
+			ctx:   withBaggage(t, sampledParent(false), "basket.id", "123"),
+			attrs: []attribute.KeyValue{appattr.Key("basket.id").String("123")},
+			want:  sdktrace.Drop,
+		},
+		{
+			name: "child of a sampled parent",
+			ctx:  sampledParent(true),
+			want: sdktrace.RecordAndSample,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := newTargetSampler(sdktrace.ParentBased(sdktrace.NeverSample()))
+			sampler.SetTarget("basket.id", "123")
+
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: tt.ctx,
+				TraceID:       trace.TraceID{1},
+				Name:          "Checkout",
+				Attributes:    tt.attrs,
+			})
+
+			if result.Decision != tt.want {
+				t.Errorf("got decision %v, want %v", result.Decision, tt.want)
+			}
+
+			set := attribute.NewSet(result.Attributes...)
+			decision, _ := set.Value(samplingDecisionKey())
+			if forced := decision.AsString() == decisionForced; forced != tt.forced {
+				t.Errorf("got forced %t, want %t", forced, tt.forced)
+			}
+		})
+	}
+}
+
+func TestTargetSamplerClearTarget(t *testing.T) {
+	sampler := newTargetSampler(sdktrace.NeverSample())
+	sampler.SetTarget("basket.id", "123")
+	sampler.ClearTarget()
+
+	if _, ok := sampler.Target(); ok {
+		t.Error("got a target after clearing it")
+	}
+
+	result := sampler.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		Attributes:    []attribute.KeyValue{attribute.String("basket.id", "123")},
+	})
+	if result.Decision != sdktrace.Drop {
+		t.Errorf("got decision %v after clearing the target, want drop", result.Decision)
+	}
+}
+
+// TestTargetSamplerConcurrentUpdates changes the target while spans are being sampled. Run with
+// -race, it checks the sampler is safe to update at runtime.
+func TestTargetSamplerConcurrentUpdates(t *testing.T) {
+	sampler := newTargetSampler(sdktrace.NeverSample())
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range 100 {
+				if j%10 == 0 {
+					sampler.ClearTarget()
+					continue
+				}
+
+				sampler.SetTarget("basket.id", strconv.Itoa(i*100+j))
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for j := range 100 {
+				sampler.ShouldSample(sdktrace.SamplingParameters{
+					ParentContext: context.Background(),
+					Attributes:    []attribute.KeyValue{attribute.String("basket.id", strconv.Itoa(j))},
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestSamplingDecision checks the sampling.decision attribute names the sampler that decided,
+// with the samplers composed as Init composes them.
+func TestSamplingDecision(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		attrs   []attribute.KeyValue
+		startup int64
+		want    string
+	}{
+		{name: "root", ctx: context.Background(), want: decisionAlways},
+		{name: "child", ctx: sampledParent(true), want: decisionParent},
+		{
+			name:  "targeted root",
+			ctx:   context.Background(),
+			attrs: []attribute.KeyValue{appattr.Key("basket.id").String("123")},
+			want:  decisionForced,
+		},
+		{name: "first root after starting", ctx: context.Background(), startup: 1, want: decisionStartup},
+		{name: "synthetic root", ctx: withBaggage(t, context.Background(), SyntheticBaggageMember, "true"), want: decisionSynthetic},
+		{name: "synthetic child", ctx: withBaggage(t, sampledParent(true), SyntheticBaggageMember, "true"), want: decisionParent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root sdktrace.Sampler = newSyntheticSampler(createSampler(), 1)
+			if tt.startup > 0 {
+				root = newStartupSampler(root, tt.startup)
+			}
+
+			sampler := newTargetSampler(root)
+			sampler.SetTarget("basket.id", "123")
+
+			result := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: tt.ctx,
+				TraceID:       trace.TraceID{1},
+				Name:          "Checkout",
+				Attributes:    tt.attrs,
+			})
+
+			set := attribute.NewSet(result.Attributes...)
+			if got, _ := set.Value(samplingDecisionKey()); got.AsString() != tt.want {
+				t.Errorf("got sampling.decision %q, want %q", got.AsString(), tt.want)
+			}
+		})
+	}
+}
+
+func TestStartupSampler(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int64
+		started    int
+		concurrent bool
+		want       int
+	}{
+		{name: "disabled", started: 5},
+		{name: "first", n: 1, started: 5, want: 1},
+		{name: "first few", n: 3, started: 5, want: 3},
+		{name: "fewer started", n: 10, started: 3, want: 3},
+		{name: "concurrent", n: 10, started: 100, concurrent: true, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The children follow their root, which would otherwise never be sampled.
+			recorder := tracetest.NewSpanRecorder()
+			tracer := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(newStartupSampler(sdktrace.ParentBased(sdktrace.NeverSample()), tt.n)),
+				sdktrace.WithSpanProcessor(recorder),
+			).Tracer("test")
+
+			start := func() {
+				ctx, root := tracer.Start(context.Background(), "Checkout")
+				_, child := tracer.Start(ctx, "Payment")
+				child.End()
+				root.End()
+			}
+
+			var wg sync.WaitGroup
+			for range tt.started {
+				if !tt.concurrent {
+					start()
+					continue
+				}
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					start()
+				}()
+			}
+			wg.Wait()
+
+			var roots, children int
+			for _, span := range recorder.Ended() {
+				if span.Parent().IsValid() {
+					children++
+					continue
+				}
+
+				roots++
+				set := attribute.NewSet(span.Attributes()...)
+				if got, _ := set.Value(samplingDecisionKey()); got.AsString() != decisionStartup {
+					t.Errorf("got sampling.decision %q, want %q", got.AsString(), decisionStartup)
+				}
+			}
+
+			if roots != tt.want || children != tt.want {
+				t.Errorf("got %d roots and %d children sampled, want %d of each", roots, children, tt.want)
+			}
+		})
+	}
+}
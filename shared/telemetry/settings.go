@@ -0,0 +1,222 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings are the parts of the telemetry set by the environment, resolved by LoadSettings. The
+// OTEL_* variables the SDK reads itself, such as OTEL_BSP_SCHEDULE_DELAY, aren't included.
+type Settings struct {
+	// DeploymentEnvironment is recorded on the resource (DEPLOYMENT_ENVIRONMENT), "development"
+	// by default.
+	DeploymentEnvironment string `json:"deploymentEnvironment"`
+
+	// TraceEndpoints are the OTLP endpoints the spans are exported to, from the comma separated
+	// OTEL_EXPORTER_OTLP_TRACES_ENDPOINTS, or otherwise the one OTLPEndpoint resolves.
+	// MetricsEndpoint is where the metrics are exported to.
+	TraceEndpoints  []string `json:"traceEndpoints" config:"url"`
+	MetricsEndpoint string   `json:"metricsEndpoint" config:"url"`
+
+	// TracesProtocol and MetricsProtocol are how the spans and metrics are sent, "grpc" (the
+	// default) or "http/protobuf" (OTEL_EXPORTER_OTLP_PROTOCOL, or
+	// OTEL_EXPORTER_OTLP_TRACES_PROTOCOL and OTEL_EXPORTER_OTLP_METRICS_PROTOCOL).
+	TracesProtocol  Protocol `json:"tracesProtocol"`
+	MetricsProtocol Protocol `json:"metricsProtocol"`
+
+	// ReconnectMaxDelay bounds the wait between attempts to reconnect to a collector that went
+	// away (OTLP_RECONNECT_MAX_DELAY). Zero leaves gRPC's default of 2 minutes.
+	ReconnectMaxDelay time.Duration `json:"reconnectMaxDelay"`
+
+	// Required stops the service starting without its exporters (OTEL_REQUIRED).
+	Required bool `json:"required"`
+
+	// TraceIDFormat is the format new trace IDs are generated in (TRACE_ID_FORMAT).
+	TraceIDFormat TraceIDFormat `json:"traceIdFormat"`
+
+	// SpanProcessor is how the ended spans are passed to the exporters, "batch" or "simple"
+	// (SPAN_PROCESSOR).
+	SpanProcessor string `json:"spanProcessor"`
+
+	// SampleFirstTraces samples the first n traces the service starts (SAMPLE_FIRST_TRACES).
+	SampleFirstTraces int64 `json:"sampleFirstTraces"`
+
+	// SyntheticSampleRatio is the fraction of synthetic traffic's traces sampled
+	// (SYNTHETIC_SAMPLE_RATIO), 1 by default.
+	SyntheticSampleRatio float64 `json:"syntheticSampleRatio"`
+
+	// SpanRetryBufferSize holds on to that many spans that fail to export, to retry them
+	// (SPAN_RETRY_BUFFER_SIZE). Zero disables it.
+	SpanRetryBufferSize int `json:"spanRetryBufferSize"`
+
+	// RedactedAttributes are replaced before export, on the spans and their events, or hashed if
+	// HashRedacted (REDACTED_ATTRIBUTES and REDACTION_MODE=hash). Like AttributeTruncateKeys,
+	// they're matched both as they are and with ATTRIBUTE_PREFIX applied.
+	RedactedAttributes []string `json:"redactedAttributes"`
+	HashRedacted       bool     `json:"hashRedacted"`
+
+	// AttributeMaxLength truncates longer attribute values before export, of every key or only
+	// AttributeTruncateKeys (ATTRIBUTE_MAX_LENGTH and ATTRIBUTE_TRUNCATE_KEYS). Zero disables it.
+	AttributeMaxLength    int      `json:"attributeMaxLength"`
+	AttributeTruncateKeys []string `json:"attributeTruncateKeys"`
+
+	// XRayAnnotations are the attributes indexed as X-Ray annotations (XRAY_ANNOTATIONS).
+	XRayAnnotations []string `json:"xrayAnnotations"`
+
+	// TracesFilePath is a file every span is also written to, for cmd/replay (TRACES_FILE_PATH).
+	TracesFilePath string `json:"tracesFilePath"`
+
+	// MetricsTemporality is the temporality the metrics are exported with
+	// (OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE).
+	MetricsTemporality string `json:"metricsTemporality"`
+
+	// MetricExportInterval and MetricExportTimeout control the periodic metric reader
+	// (OTEL_METRIC_EXPORT_INTERVAL and OTEL_METRIC_EXPORT_TIMEOUT, in milliseconds). Zero
+	// leaves the SDK's default.
+	MetricExportInterval time.Duration `json:"metricExportInterval"`
+	MetricExportTimeout  time.Duration `json:"metricExportTimeout"`
+}
+
+// LoadSettings resolves the telemetry settings from the environment, applying the defaults for
+// anything that isn't set. It returns an error naming the first invalid setting.
+func LoadSettings() (Settings, error) {
+	s := Settings{
+		DeploymentEnvironment: "development",
+		TracesProtocol:        OTLPProtocol(SignalTraces),
+		MetricsProtocol:       OTLPProtocol(SignalMetrics),
+		Required:              os.Getenv("OTEL_REQUIRED") != "false",
+		TraceIDFormat:         TraceIDFormat(os.Getenv("TRACE_ID_FORMAT")),
+		SpanProcessor:         os.Getenv("SPAN_PROCESSOR"),
+		RedactedAttributes:    splitList(os.Getenv("REDACTED_ATTRIBUTES")),
+		HashRedacted:          os.Getenv("REDACTION_MODE") == "hash",
+		AttributeTruncateKeys: splitList(os.Getenv("ATTRIBUTE_TRUNCATE_KEYS")),
+		SyntheticSampleRatio:  1,
+		XRayAnnotations:       defaultXRayAnnotations,
+		TracesFilePath:        os.Getenv("TRACES_FILE_PATH"),
+		MetricsTemporality:    strings.ToLower(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE")),
+	}
+
+	if v, ok := os.LookupEnv("DEPLOYMENT_ENVIRONMENT"); ok {
+		s.DeploymentEnvironment = v
+	}
+
+	// An unknown protocol is rejected rather than ignored, so the exporters aren't silently
+	// pointed at a receiver they can't talk to.
+	if s.TracesProtocol == ProtocolHTTPJSON || s.MetricsProtocol == ProtocolHTTPJSON {
+		return Settings{}, fmt.Errorf("invalid OTLP protocol: %q, the OTLP/HTTP exporters only encode protobuf, use %q", ProtocolHTTPJSON, ProtocolHTTPProtobuf)
+	}
+
+	if !s.TracesProtocol.valid() {
+		return Settings{}, fmt.Errorf("invalid OTLP traces protocol: %q", s.TracesProtocol)
+	}
+
+	if !s.MetricsProtocol.valid() {
+		return Settings{}, fmt.Errorf("invalid OTLP metrics protocol: %q", s.MetricsProtocol)
+	}
+
+	s.TraceEndpoints = []string{OTLPEndpointFor(SignalTraces, s.TracesProtocol)}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINTS"); v != "" {
+		s.TraceEndpoints = splitList(v)
+	}
+
+	s.MetricsEndpoint = OTLPEndpointFor(SignalMetrics, s.MetricsProtocol)
+
+	if s.TraceIDFormat == "" {
+		s.TraceIDFormat = TraceIDFormatXRay
+	}
+
+	if _, err := createIDGenerator(s.TraceIDFormat); err != nil {
+		return Settings{}, err
+	}
+
+	if s.SpanProcessor == "" {
+		s.SpanProcessor = "batch"
+	}
+
+	if _, err := spanProcessorFactory(s.SpanProcessor); err != nil {
+		return Settings{}, err
+	}
+
+	if s.MetricsTemporality == "" {
+		s.MetricsTemporality = "cumulative"
+	}
+
+	if _, err := temporalitySelector(s.MetricsTemporality); err != nil {
+		return Settings{}, err
+	}
+
+	if v, ok := os.LookupEnv("SAMPLE_FIRST_TRACES"); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return Settings{}, fmt.Errorf("invalid SAMPLE_FIRST_TRACES: %q", v)
+		}
+
+		s.SampleFirstTraces = n
+	}
+
+	if v, ok := os.LookupEnv("SYNTHETIC_SAMPLE_RATIO"); ok {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return Settings{}, fmt.Errorf("invalid SYNTHETIC_SAMPLE_RATIO: %q", v)
+		}
+
+		s.SyntheticSampleRatio = ratio
+	}
+
+	for _, setting := range []struct {
+		key string
+		n   *int
+	}{
+		{"SPAN_RETRY_BUFFER_SIZE", &s.SpanRetryBufferSize},
+		{"ATTRIBUTE_MAX_LENGTH", &s.AttributeMaxLength},
+	} {
+		if v, ok := os.LookupEnv(setting.key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return Settings{}, fmt.Errorf("invalid %s: %q", setting.key, v)
+			}
+
+			*setting.n = n
+		}
+	}
+
+	if v, ok := os.LookupEnv("OTLP_RECONNECT_MAX_DELAY"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return Settings{}, fmt.Errorf("invalid OTLP_RECONNECT_MAX_DELAY: %q", v)
+		}
+
+		s.ReconnectMaxDelay = d
+	}
+
+	// Setting XRAY_ANNOTATIONS empty stops any attributes from being indexed.
+	if v, ok := os.LookupEnv("XRAY_ANNOTATIONS"); ok {
+		s.XRayAnnotations = splitList(v)
+	}
+
+	var err error
+	if s.MetricExportInterval, err = envMillis("OTEL_METRIC_EXPORT_INTERVAL"); err != nil {
+		return Settings{}, err
+	}
+
+	if s.MetricExportTimeout, err = envMillis("OTEL_METRIC_EXPORT_TIMEOUT"); err != nil {
+		return Settings{}, err
+	}
+
+	return s, nil
+}
+
+// splitList splits a comma separated list, dropping any blank items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// settingsEnv are the environment variables LoadSettings reads, besides the OTLP protocols and
+// endpoints.
+var settingsEnv = []string{
+	"DEPLOYMENT_ENVIRONMENT",
+	"OTEL_REQUIRED",
+	"TRACE_ID_FORMAT",
+	"SPAN_PROCESSOR",
+	"SAMPLE_FIRST_TRACES",
+	"SYNTHETIC_SAMPLE_RATIO",
+	"SPAN_RETRY_BUFFER_SIZE",
+	"OTLP_RECONNECT_MAX_DELAY",
+	"XRAY_ANNOTATIONS",
+	"TRACES_FILE_PATH",
+	"OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE",
+}
+
+func TestLoadSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(t *testing.T, s Settings)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, s Settings) {
+				if s.DeploymentEnvironment != "development" || !s.Required {
+					t.Errorf("got environment %q and required %t, want development and true", s.DeploymentEnvironment, s.Required)
+				}
+
+				if s.TraceIDFormat != TraceIDFormatXRay || s.SpanProcessor != "batch" || s.MetricsTemporality != "cumulative" {
+					t.Errorf("got %s trace IDs, %s span processor and %s metrics, want xray, batch and cumulative", s.TraceIDFormat, s.SpanProcessor, s.MetricsTemporality)
+				}
+
+				if s.SampleFirstTraces != 0 || s.SyntheticSampleRatio != 1 || s.SpanRetryBufferSize != 0 || s.ReconnectMaxDelay != 0 {
+					t.Errorf("got first %d traces, synthetic ratio %v, retry buffer %d and reconnect delay %s, want 0, 1, 0 and 0",
+						s.SampleFirstTraces, s.SyntheticSampleRatio, s.SpanRetryBufferSize, s.ReconnectMaxDelay)
+				}
+
+				if !slices.Equal(s.XRayAnnotations, defaultXRayAnnotations) {
+					t.Errorf("got annotations %v, want %v", s.XRayAnnotations, defaultXRayAnnotations)
+				}
+			},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"DEPLOYMENT_ENVIRONMENT":   "production",
+				"OTEL_REQUIRED":            "false",
+				"TRACE_ID_FORMAT":          "w3c",
+				"SPAN_PROCESSOR":           "simple",
+				"SAMPLE_FIRST_TRACES":      "5",
+				"SYNTHETIC_SAMPLE_RATIO":   "0.1",
+				"SPAN_RETRY_BUFFER_SIZE":   "100",
+				"OTLP_RECONNECT_MAX_DELAY": "5s",
+				"XRAY_ANNOTATIONS":         "order.id",
+				"TRACES_FILE_PATH":         "/tmp/spans.jsonl",
+				"OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE": "Delta",
+			},
+			check: func(t *testing.T, s Settings) {
+				if s.DeploymentEnvironment != "production" || s.Required {
+					t.Errorf("got environment %q and required %t, want production and false", s.DeploymentEnvironment, s.Required)
+				}
+
+				if s.TraceIDFormat != TraceIDFormatW3C || s.SpanProcessor != "simple" || s.MetricsTemporality != "delta" {
+					t.Errorf("got %s trace IDs, %s span processor and %s metrics, want w3c, simple and delta", s.TraceIDFormat, s.SpanProcessor, s.MetricsTemporality)
+				}
+
+				if s.SampleFirstTraces != 5 || s.SyntheticSampleRatio != 0.1 || s.SpanRetryBufferSize != 100 || s.ReconnectMaxDelay != 5*time.Second {
+					t.Errorf("got first %d traces, synthetic ratio %v, retry buffer %d and reconnect delay %s, want 5, 0.1, 100 and 5s",
+						s.SampleFirstTraces, s.SyntheticSampleRatio, s.SpanRetryBufferSize, s.ReconnectMaxDelay)
+				}
+
+				if !slices.Equal(s.XRayAnnotations, []string{"order.id"}) || s.TracesFilePath != "/tmp/spans.jsonl" {
+					t.Errorf("got annotations %v and traces file %q", s.XRayAnnotations, s.TracesFilePath)
+				}
+			},
+		},
+		{
+			name: "no annotations",
+			env:  map[string]string{"XRAY_ANNOTATIONS": ""},
+			check: func(t *testing.T, s Settings) {
+				if len(s.XRayAnnotations) != 0 {
+					t.Errorf("got annotations %v, want none", s.XRayAnnotations)
+				}
+			},
+		},
+		{name: "unknown trace ID format", env: map[string]string{"TRACE_ID_FORMAT": "uuid"}, wantErr: true},
+		{name: "unknown span processor", env: map[string]string{"SPAN_PROCESSOR": "eventually"}, wantErr: true},
+		{name: "unknown temporality", env: map[string]string{"OTEL_EXPORTER_OTLP_METRICS_TEMPORALITY_PREFERENCE": "sometimes"}, wantErr: true},
+		{name: "negative first traces", env: map[string]string{"SAMPLE_FIRST_TRACES": "-1"}, wantErr: true},
+		{name: "synthetic ratio above 1", env: map[string]string{"SYNTHETIC_SAMPLE_RATIO": "2"}, wantErr: true},
+		{name: "zero retry buffer", env: map[string]string{"SPAN_RETRY_BUFFER_SIZE": "0"}, wantErr: true},
+		{name: "reconnect delay without a unit", env: map[string]string{"OTLP_RECONNECT_MAX_DELAY": "5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range settingsEnv {
+				unsetenv(t, key)
+			}
+
+			for key, v := range tt.env {
+				t.Setenv(key, v)
+			}
+
+			s, err := LoadSettings()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid setting")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, s)
+		})
+	}
+}
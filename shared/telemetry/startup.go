@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartupTrace times the phases of a service's startup, such as loading the AWS config and
+// initialising the telemetry, so the cost of a cold start can be seen in a trace. It's enabled
+// with TRACE_STARTUP=true, and otherwise does nothing.
+//
+// The telemetry can't trace its own initialisation, and the AWS config is loaded before it so the
+// region can be recorded on the resource. So rather than starting spans as it goes, the trace
+// records when each phase started and ended, and creates the spans with those timestamps once
+// the telemetry is up.
+type StartupTrace struct {
+	enabled bool
+	start   time.Time
+	phases  []startupPhase
+}
+
+type startupPhase struct {
+	name       string
+	start, end time.Time
+}
+
+// NewStartupTrace starts timing the startup. It should be called as early as possible in main.
+func NewStartupTrace() *StartupTrace {
+	return &StartupTrace{enabled: os.Getenv("TRACE_STARTUP") == "true", start: time.Now()}
+}
+
+// Phase starts timing a phase of the startup. The returned func ends it.
+func (s *StartupTrace) Phase(name string) func() {
+	if !s.enabled {
+		return func() {}
+	}
+
+	start := time.Now()
+
+	return func() {
+		s.phases = append(s.phases, startupPhase{name: name, start: start, end: time.Now()})
+	}
+}
+
+// Export creates the Startup span, with a child span for each phase, using the providers, and
+// flushes them so the startup is exported before the service starts serving.
+func (s *StartupTrace) Export(ctx context.Context, p *Providers) {
+	if !s.enabled {
+		return
+	}
+
+	tracer := p.TracerProvider.Tracer("shared/telemetry")
+
+	ctx, span := tracer.Start(ctx, "Startup", trace.WithNewRoot(), trace.WithTimestamp(s.start))
+
+	for _, phase := range s.phases {
+		_, child := tracer.Start(ctx, phase.name, trace.WithTimestamp(phase.start))
+		child.End(trace.WithTimestamp(phase.end))
+	}
+
+	span.End()
+
+	_ = p.TracerProvider.ForceFlush(ctx)
+}
@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartupTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		want    []string
+	}{
+		{name: "disabled"},
+		{name: "not true", enabled: "yes"},
+		{name: "enabled", enabled: "true", want: []string{"Load AWS Config", "Init Telemetry", "Create Clients", "Startup"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRACE_STARTUP", tt.enabled)
+
+			// The spans are batched, as in the services, so they're only exported in time if Export
+			// flushes them.
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(time.Hour)))
+			t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+			startup := NewStartupTrace()
+			for _, phase := range []string{"Load AWS Config", "Init Telemetry", "Create Clients"} {
+				end := startup.Phase(phase)
+				time.Sleep(time.Millisecond)
+				end()
+			}
+
+			startup.Export(context.Background(), &Providers{TracerProvider: tp})
+
+			spans := exporter.GetSpans()
+
+			var names []string
+			for _, span := range spans {
+				names = append(names, span.Name)
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Fatalf("got spans %v, want %v", names, tt.want)
+			}
+
+			if len(spans) == 0 {
+				return
+			}
+
+			// Each phase is a child of the Startup span, timed as it ran, one after the other.
+			root := spans[len(spans)-1]
+			previousEnd := root.StartTime
+			for _, phase := range spans[:len(spans)-1] {
+				if phase.Parent.SpanID() != root.SpanContext.SpanID() {
+					t.Errorf("got %s outside the Startup span, want it a child", phase.Name)
+				}
+
+				if phase.StartTime.Before(previousEnd) || !phase.EndTime.After(phase.StartTime) {
+					t.Errorf("got %s from %s to %s, want it after %s", phase.Name, phase.StartTime, phase.EndTime, previousEnd)
+				}
+
+				previousEnd = phase.EndTime
+			}
+
+			if root.EndTime.Before(previousEnd) {
+				t.Errorf("got the Startup span ending at %s, before its last phase at %s", root.EndTime, previousEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"shared/appattr"
+)
+
+// SyntheticHeader marks a request as synthetic traffic, such as a load test or a smoke test,
+// when it's "true".
+const SyntheticHeader = "X-Synthetic"
+
+// SyntheticBaggageMember is the baggage member propagating that a trace is synthetic traffic, so
+// every service marks its spans and dashboards can exclude them.
+const SyntheticBaggageMember = "synthetic"
+
+// SyntheticKey returns the span attribute key synthetic traffic is marked with.
+func SyntheticKey() attribute.Key {
+	return appattr.Key("synthetic")
+}
+
+// IsSynthetic reports whether the baggage in ctx marks it as synthetic traffic.
+func IsSynthetic(ctx context.Context) bool {
+	return baggage.FromContext(ctx).Member(SyntheticBaggageMember).Value() == "true"
+}
+
+// syntheticSpanProcessor marks every span started in a synthetic trace as synthetic.
+type syntheticSpanProcessor struct{}
+
+var _ sdktrace.SpanProcessor = syntheticSpanProcessor{}
+
+func (syntheticSpanProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if IsSynthetic(ctx) {
+		s.SetAttributes(SyntheticKey().Bool(true))
+	}
+}
+
+func (syntheticSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (syntheticSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (syntheticSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,716 @@
+// Package telemetry configures the OpenTelemetry SDK in the same way for every service.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"google.golang.org/grpc"
+)
+
+// Config describes the service being instrumented and how its telemetry is registered.
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+
+	// Region is the cloud region the service runs in, recorded as the cloud.region resource
+	// attribute so traces can be filtered by region. It's omitted when empty.
+	Region string
+
+	// DisableGlobalRegistration stops Init from registering the TracerProvider and propagator
+	// with the global OTel API. This is useful when embedding a service in a larger binary (e.g.
+	// tests) where a global registration would clobber another setup. Callers are then
+	// responsible for passing the returned providers around explicitly.
+	DisableGlobalRegistration bool
+
+	// BaggageAttributes maps baggage member keys to span attribute keys. Each member present in
+	// a span's parent context is copied onto the span as it starts.
+	BaggageAttributes map[string]string
+
+	// MetricReaders are registered with the MeterProvider alongside the exporter's reader, e.g. a
+	// sdkmetric.NewManualReader to collect the metrics on demand in a test.
+	MetricReaders []sdkmetric.Reader
+
+	// Settings configure the exporters, sampling and processing of the telemetry. They're loaded
+	// from the environment with LoadSettings when nil.
+	Settings *Settings
+}
+
+// Providers holds the SDK providers created by Init.
+type Providers struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	Propagator     propagation.TextMapPropagator
+
+	// ErrorHandler logs and counts the errors the SDK reports in the background. It's registered
+	// with otel.SetErrorHandler unless global registration is disabled.
+	ErrorHandler otel.ErrorHandler
+
+	// ColdStart marks the first span of the service's first request or message.
+	ColdStart *ColdStart
+
+	// Sampler lets the service force-sample a specific transaction at runtime.
+	Sampler *TargetSampler
+
+	// TraceIDFormat is the format of the trace IDs generated for new traces.
+	TraceIDFormat TraceIDFormat
+
+	// The rest of the configuration Init resolved, reported by Describe.
+	resource        *resource.Resource
+	traceEndpoints  []string
+	tracesProtocol  Protocol
+	metricsEndpoint string
+	metricsProtocol Protocol
+	propagators     []string
+}
+
+// Init configures the OpenTelemetry SDK for the service described by cfg. Unless disabled in
+// the config, the providers are registered globally so that instrumentation libraries can find
+// them. The returned func gracefully shuts down the providers, flushing any telemetry data.
+func Init(cfg Config) (*Providers, func(), error) {
+	settings := cfg.Settings
+	if settings == nil {
+		loaded, err := LoadSettings()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		settings = &loaded
+	}
+
+	// A resource describes the entity that is generating the telemetry data.
+	// In our case, it describes the specific service instance.
+	// All Telemetry data will be associated with the resource that generated it.
+	res, err := createResource(cfg, settings.DeploymentEnvironment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Metrics are exported alongside traces. A periodic reader collects the metrics from
+	// every registered instrument on an interval and pushes them to the exporter. The
+	// MeterProvider is created first, so the instruments counting the span exports and SDK
+	// errors are bound to it, rather than to the global delegate, which is never replaced when
+	// global registration is disabled.
+	var meterOpts []sdkmetric.Option
+	var metricsExportedTo string
+	temporality, err := temporalitySelector(settings.MetricsTemporality)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if metricExporter, err := createOTLPMetricExporter(settings.MetricsEndpoint, settings.MetricsProtocol, temporality, settings.ReconnectMaxDelay); err == nil {
+		reader := createMetricReader(metricExporter, settings.MetricExportInterval, settings.MetricExportTimeout)
+		meterOpts = append(meterOpts, sdkmetric.WithReader(reader))
+		metricsExportedTo = settings.MetricsEndpoint
+	} else if settings.Required {
+		return nil, nil, err
+	} else {
+		slog.Warn("continuing without exporting metrics", "error", err)
+	}
+
+	for _, reader := range cfg.MetricReaders {
+		meterOpts = append(meterOpts, sdkmetric.WithReader(reader))
+	}
+
+	meterProvider := createMeterProvider(res, meterOpts...)
+	meter := meterProvider.Meter("shared/telemetry")
+
+	// Report static build metadata, and that the service is up, on every collection.
+	if err := registerBuildInfo(meter, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	// Errors the SDK can't return, such as failed background exports, are logged and counted
+	// rather than only printed. The exporters' gRPC connections reconnect by themselves once
+	// the collector is back, within OTLP_RECONNECT_MAX_DELAY if set.
+	errorHandler, err := newErrorHandler(meter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Spans are exported to every endpoint listed in OTEL_EXPORTER_OTLP_TRACES_ENDPOINTS, e.g. to
+	// dual-write to the old and new backends during a migration. Otherwise they're exported to
+	// the one endpoint.
+	//
+	// With OTEL_REQUIRED=false a service whose exporters can't be created still starts, without
+	// exporting that telemetry, rather than taking the business functionality down with it. The
+	// spans are still created, so trace context keeps propagating to the other services.
+	exporters := make([]sdktrace.SpanExporter, 0, len(settings.TraceEndpoints))
+	var exportedTo []string
+	for _, endpoint := range settings.TraceEndpoints {
+		exporter, err := createSpanExporter(endpoint, settings, meter)
+		if err != nil {
+			if settings.Required {
+				return nil, nil, err
+			}
+
+			slog.Warn("continuing without exporting spans", "endpoint", endpoint, "error", err)
+			continue
+		}
+
+		exporters = append(exporters, exporter)
+		exportedTo = append(exportedTo, endpoint)
+	}
+
+	// A sampler determines whether or a span will be sampled. You can separately
+	// configure the sampling rules for root spans and child spans. Each time a new span
+	// is created, the sampler is invoked.
+	// The target sampler lets a specific transaction be force-sampled on demand, and otherwise
+	// defers to the configured sampler. SAMPLE_FIRST_TRACES=n also samples the first n traces
+	// the service starts, so a fresh deploy always produces a trace to check, and
+	// SYNTHETIC_SAMPLE_RATIO down-samples synthetic traffic, such as a load test.
+	var root sdktrace.Sampler = createSampler()
+	if settings.SyntheticSampleRatio < 1 {
+		root = newSyntheticSampler(root, settings.SyntheticSampleRatio)
+	}
+
+	if settings.SampleFirstTraces > 0 {
+		root = newStartupSampler(root, settings.SampleFirstTraces)
+	}
+
+	sampler := newTargetSampler(root)
+
+	// Trace IDs are generated in X-Ray's format by default. TRACE_ID_FORMAT=w3c generates them
+	// randomly instead, for backends other than X-Ray.
+	idGenerator, err := createIDGenerator(settings.TraceIDFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newSpanProcessor, err := spanProcessorFactory(settings.SpanProcessor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A Trace Provider connects the instrumented code generating telemetry
+	// with the exporter by implementing the OpenTelemetry API.
+	traceProvider := createTraceProvider(res, sampler, idGenerator)
+
+	// Each exporter has its own processor, so a slow backend doesn't hold up the others.
+	// Shutting down the provider flushes them all.
+	for _, exporter := range exporters {
+		traceProvider.RegisterSpanProcessor(newSpanProcessor(exporter))
+	}
+
+	if len(cfg.BaggageAttributes) > 0 {
+		traceProvider.RegisterSpanProcessor(newBaggageSpanProcessor(cfg.BaggageAttributes))
+	}
+
+	// Mark every span of synthetic traffic, propagated in the baggage, so dashboards can exclude it.
+	traceProvider.RegisterSpanProcessor(syntheticSpanProcessor{})
+
+	// Mark the attributes to index as X-Ray annotations, e.g. XRAY_ANNOTATIONS=basket.id,transaction.id.
+	// Setting it empty stops any attributes from being marked.
+	if keys := xrayAnnotations(settings.XRayAnnotations); len(keys) > 0 {
+		traceProvider.RegisterSpanProcessor(newXRayAnnotationSpanProcessor(keys))
+	}
+
+	// Optionally capture every span to a file as newline-delimited JSON, so that a good demo
+	// run can be replayed later with cmd/replay.
+	var spanFile *os.File
+	if settings.TracesFilePath != "" {
+		var fileExporter sdktrace.SpanExporter
+		fileExporter, spanFile, err = createFileExporter(settings.TracesFilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(settings.RedactedAttributes) > 0 {
+			fileExporter = newRedactingExporter(fileExporter, settings.RedactedAttributes, settings.HashRedacted)
+		}
+
+		traceProvider.RegisterSpanProcessor(newSpanProcessor(fileExporter))
+	}
+
+	// The propagator is responsible for serialising the Trace information across
+	// program boundaries. For example injecting/extracting trace info into/from a HTTP header.
+	// Here we're registering the AWS X-Ray propagator as their format is not W3C compliant.
+	// Amazon X-Ray header format:
+	// 		X-Amzn-Trace-Id: Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1
+	// The W3C Trace Context propagator is registered too, so callers outside AWS, such as browsers,
+	// can continue their trace with a traceparent header. Each propagator's extraction replaces
+	// the previous one's when its header is present, so it's registered after X-Ray: a load
+	// balancer adds an X-Amzn-Trace-Id to every request, which would otherwise start a new trace
+	// in place of the caller's.
+	// The Baggage propagator carries any application-defined key/value pairs alongside the trace.
+	propagator := propagation.NewCompositeTextMapPropagator(xray.Propagator{}, propagation.TraceContext{}, propagation.Baggage{})
+
+	if !cfg.DisableGlobalRegistration {
+		// Register our TraceProvider instance from the SDK with the OTEL API
+		// so that libraries and other instrumented code can retrieve a TraceProvider.
+		otel.SetTracerProvider(traceProvider)
+		otel.SetMeterProvider(meterProvider)
+		otel.SetTextMapPropagator(propagator)
+		otel.SetErrorHandler(errorHandler)
+	}
+
+	// Return a func to gracefully shutdown the providers and flush any telemetry data.
+	shutdown := func() {
+		if err := traceProvider.Shutdown(context.Background()); err != nil {
+			slog.Error("error shutting down trace provider", "error", err)
+		}
+
+		if err := meterProvider.Shutdown(context.Background()); err != nil {
+			slog.Error("error shutting down meter provider", "error", err)
+		}
+
+		if spanFile != nil {
+			_ = spanFile.Close()
+		}
+	}
+
+	providers := &Providers{
+		TracerProvider: traceProvider,
+		MeterProvider:  meterProvider,
+		Propagator:     propagator,
+		ErrorHandler:   errorHandler,
+		ColdStart:      &ColdStart{},
+		Sampler:        sampler,
+		TraceIDFormat:  settings.TraceIDFormat,
+
+		resource:        res,
+		traceEndpoints:  exportedTo,
+		tracesProtocol:  settings.TracesProtocol,
+		metricsEndpoint: metricsExportedTo,
+		metricsProtocol: settings.MetricsProtocol,
+		propagators:     []string{"xray", "tracecontext", "baggage"},
+	}
+
+	return providers, shutdown, nil
+}
+
+// createResource describes the service running in the given deployment environment, which lets
+// us filter telemetry consistently across all services.
+func createResource(cfg Config, environment string) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(cfg.ServiceVersion),
+		semconv.DeploymentEnvironmentNameKey.String(environment),
+		semconv.ServiceInstanceIDKey.String(instanceID()),
+	}
+
+	if cfg.Region != "" {
+		attrs = append(attrs, semconv.CloudRegionKey.String(cfg.Region))
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, attrs...),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating otel resource: %w", err)
+	}
+
+	return res, nil
+}
+
+// instanceID identifies this replica of the service. In a container HOSTNAME is the container
+// or pod name; otherwise a random ID is generated once, so it stays the same for the lifetime
+// of the process.
+var instanceID = sync.OnceValue(newInstanceID)
+
+func newInstanceID() string {
+	if hostname := os.Getenv("HOSTNAME"); hostname != "" {
+		return hostname
+	}
+
+	return uuid.New().String()
+}
+
+// func createConsoleExporter() (sdktrace.SpanExporter, error) {
+// 	exporter, err := stdouttrace.New(
+// 		stdouttrace.WithWriter(os.Stdout),
+// 		stdouttrace.WithPrettyPrint(),
+// 	)
+
+// 	if err != nil {
+// 		return nil, fmt.Errorf("error creating console exporter: %w", err)
+// 	}
+
+// 	return exporter, nil
+// }
+
+func createFileExporter(path string) (sdktrace.SpanExporter, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening span file: %w", err)
+	}
+
+	// Without pretty printing, the stdout exporter writes one JSON encoded span per line.
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("error creating file exporter: %w", err)
+	}
+
+	return exporter, f, nil
+}
+
+func createSampler() sdktrace.Sampler {
+	// sdktrace.NeverSample()
+	// sdktrace.AlwaysSample()
+	// sdktrace.TraceIDRatioBased(0.001)
+	return decisionSampler{base: sdktrace.ParentBased(sdktrace.AlwaysSample()), root: decisionAlways}
+}
+
+// TraceIDFormat is the format trace IDs are generated in.
+type TraceIDFormat string
+
+const (
+	// TraceIDFormatXRay generates IDs that X-Ray accepts, starting with the trace's start time.
+	TraceIDFormatXRay TraceIDFormat = "xray"
+
+	// TraceIDFormatW3C generates entirely random IDs, as the W3C Trace Context recommends.
+	TraceIDFormatW3C TraceIDFormat = "w3c"
+)
+
+// createIDGenerator returns the generator of trace and span IDs in the given format. A nil
+// generator means the SDK's default, random, generator.
+func createIDGenerator(format TraceIDFormat) (sdktrace.IDGenerator, error) {
+	switch format {
+	case TraceIDFormatXRay:
+		// In OpenTelemetry, the creation of OTLP trace ID uses the W3C trace format, which generates a random unique
+		// 32-hex-character lowercase string. However, to use OpenTelemetry tracing with X-Ray, we needed to override
+		// the OTLP trace ID creation function. This is because X-Ray does not use the W3C trace format; rather, it uses
+		// a different format in which the first 8-hex-digits represents the timestamp at which the trace is generated and
+		// the remaining 24-hex-digits are randomly generated.
+		return xray.NewIDGenerator(), nil
+	case TraceIDFormatW3C:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid TRACE_ID_FORMAT: %q", format)
+	}
+}
+
+// spanProcessorFactory returns the constructor of the processor that passes the ended spans to
+// each exporter, from SPAN_PROCESSOR:
+//
+//   - batch (the default) queues the spans and exports them in batches in the background. The
+//     export never holds up the service, but spans take up to a few seconds to appear.
+//   - simple exports each span synchronously as it ends, so it appears immediately, which makes
+//     live demos and tests deterministic. Every span.End then waits on a round trip to the
+//     exporter, adding that latency to the request, so it isn't meant for production.
+func spanProcessorFactory(name string) (func(sdktrace.SpanExporter) sdktrace.SpanProcessor, error) {
+	switch name {
+	case "", "batch":
+		return func(exporter sdktrace.SpanExporter) sdktrace.SpanProcessor {
+			return sdktrace.NewBatchSpanProcessor(exporter)
+		}, nil
+	case "simple":
+		return sdktrace.NewSimpleSpanProcessor, nil
+	default:
+		return nil, fmt.Errorf("invalid SPAN_PROCESSOR: %q", name)
+	}
+}
+
+func createTraceProvider(res *resource.Resource, sampler sdktrace.Sampler, idGenerator sdktrace.IDGenerator) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	}
+
+	if idGenerator != nil {
+		opts = append(opts, sdktrace.WithIDGenerator(idGenerator))
+	}
+
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// createSpanExporter creates the exporter for one OTLP endpoint, wrapped with the configured
+// instrumentation, buffering, truncation and redaction. The wrappers' instruments are created
+// with meter.
+func createSpanExporter(endpoint string, settings *Settings, meter metric.Meter) (sdktrace.SpanExporter, error) {
+	// An exporter is responsible for emitting the telemetry data somewhere. This could
+	// be to the console, OTel Collector or straight to an external third-party backend.
+	// exporter, err := createConsoleExporter()
+	exporter, err := createOLTPExporter(endpoint, settings.TracesProtocol, settings.ReconnectMaxDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the exports made to the collector, so problems with the pipeline itself are visible.
+	if exporter, err = newInstrumentedExporter(exporter, meter); err != nil {
+		return nil, err
+	}
+
+	// Optionally hold on to spans that fail to export while the collector is unreachable, so
+	// they can be sent once it recovers.
+	if settings.SpanRetryBufferSize > 0 {
+		if exporter, err = newBufferingExporter(exporter, settings.SpanRetryBufferSize, meter); err != nil {
+			return nil, err
+		}
+	}
+
+	// Optionally truncate long attribute values, e.g. ATTRIBUTE_MAX_LENGTH=256, of every key or
+	// only those listed in ATTRIBUTE_TRUNCATE_KEYS. It's applied after the redaction, so hashed
+	// values are hashes of the whole value.
+	if settings.AttributeMaxLength > 0 {
+		exporter = newTruncatingExporter(exporter, settings.AttributeMaxLength, settings.AttributeTruncateKeys)
+	}
+
+	// Optionally redact sensitive attributes, e.g. REDACTED_ATTRIBUTES=transaction.id,payment.receipt.id.
+	// With REDACTION_MODE=hash the values are hashed rather than replaced.
+	if len(settings.RedactedAttributes) > 0 {
+		exporter = newRedactingExporter(exporter, settings.RedactedAttributes, settings.HashRedacted)
+	}
+
+	return exporter, nil
+}
+
+// createOLTPExporter creates a span exporter sending to endpoint with the given protocol:
+//
+//   - grpc dials the collector, reconnecting within reconnectMaxDelay when it goes away.
+//   - http/protobuf posts the spans with the SDK's OTLP/HTTP exporter.
+func createOLTPExporter(endpoint string, protocol Protocol, reconnectMaxDelay time.Duration) (sdktrace.SpanExporter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if protocol != ProtocolGRPC {
+		target, err := parseOTLPHTTPEndpoint(endpoint, SignalTraces)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(target.address),
+			otlptracehttp.WithURLPath(target.path),
+		}
+		if target.insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new otlp http trace exporter: %w", err)
+		}
+
+		return exporter, nil
+	}
+
+	target, err := parseOTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := append(target.dialOpts, reconnectDialOptions(reconnectMaxDelay)...)
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(target.address),
+		otlptracegrpc.WithDialOption(append(dialOpts, grpc.WithBlock())...),
+	}
+	if target.insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new otlp trace exporter: %w", err)
+	}
+
+	return exporter, nil
+}
+
+// createOTLPMetricExporter creates a metric exporter sending to endpoint over gRPC or
+// http/protobuf.
+func createOTLPMetricExporter(endpoint string, protocol Protocol, temporality sdkmetric.TemporalitySelector, reconnectMaxDelay time.Duration) (sdkmetric.Exporter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if protocol != ProtocolGRPC {
+		target, err := parseOTLPHTTPEndpoint(endpoint, SignalMetrics)
+		if err != nil {
+			return nil, err
+		}
+
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithTemporalitySelector(temporality),
+			otlpmetrichttp.WithEndpoint(target.address),
+			otlpmetrichttp.WithURLPath(target.path),
+		}
+		if target.insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+
+		exporter, err := otlpmetrichttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new otlp http metric exporter: %w", err)
+		}
+
+		return exporter, nil
+	}
+
+	target, err := parseOTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	dialOpts := append(target.dialOpts, reconnectDialOptions(reconnectMaxDelay)...)
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithTemporalitySelector(temporality),
+		otlpmetricgrpc.WithEndpoint(target.address),
+		otlpmetricgrpc.WithDialOption(append(dialOpts, grpc.WithBlock())...),
+	}
+	if target.insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new otlp metric exporter: %w", err)
+	}
+
+	return exporter, nil
+}
+
+// Signal names a telemetry signal, as used in the signal specific OTLP environment variables.
+type Signal string
+
+const (
+	SignalTraces  Signal = "TRACES"
+	SignalMetrics Signal = "METRICS"
+	SignalLogs    Signal = "LOGS"
+)
+
+const (
+	// defaultOTLPHost is where the collector is expected when no endpoint is configured for a
+	// signal.
+	defaultOTLPHost = "0.0.0.0"
+
+	// ecsOTLPHost is where the ADOT collector sidecar listens in an ECS task. Containers in a
+	// task share a network namespace, so the sidecar is reachable on localhost.
+	ecsOTLPHost = "localhost"
+)
+
+// OTLPEndpoint resolves the OTLP endpoint for a signal, sent to with the protocol OTLPProtocol
+// resolves for it.
+func OTLPEndpoint(signal Signal) string {
+	return OTLPEndpointFor(signal, OTLPProtocol(signal))
+}
+
+// OTLPEndpointFor resolves the OTLP endpoint for a signal sent with the given protocol. The
+// signal specific variable (e.g. OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) takes precedence, then
+// OTEL_EXPORTER_OTLP_ENDPOINT. If neither is set and the service is running in ECS, the ADOT
+// sidecar's endpoint is used, and the default only applies when nothing else matches. The
+// sidecar and default endpoints use the protocol's port, 4317 for gRPC and 4318 for HTTP.
+func OTLPEndpointFor(signal Signal, protocol Protocol) string {
+	if endpoint, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_" + string(signal) + "_ENDPOINT"); ok {
+		return endpoint
+	}
+
+	if endpoint, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_ENDPOINT"); ok {
+		return endpoint
+	}
+
+	if runningInECS() {
+		return net.JoinHostPort(ecsOTLPHost, protocol.defaultPort())
+	}
+
+	return net.JoinHostPort(defaultOTLPHost, protocol.defaultPort())
+}
+
+// runningInECS reports whether the ECS agent has injected the task metadata endpoint.
+func runningInECS() bool {
+	return os.Getenv("ECS_CONTAINER_METADATA_URI_V4") != "" || os.Getenv("ECS_CONTAINER_METADATA_URI") != ""
+}
+
+// otlpTarget is an OTLP endpoint resolved into what the gRPC exporters need to dial it.
+type otlpTarget struct {
+	// address is the gRPC target, host:port.
+	address string
+
+	// insecure disables TLS on the connection.
+	insecure bool
+
+	// dialOpts are any extra dial options the endpoint needs.
+	dialOpts []grpc.DialOption
+}
+
+// defaultOTLPPort is used for a gRPC endpoint URL without a port.
+const defaultOTLPPort = "4317"
+
+// parseOTLPEndpoint validates and normalises an OTLP endpoint. It accepts:
+//
+//   - host:port, dialled without TLS, as the collector is usually a local agent or sidecar.
+//   - http://host:port, also dialled without TLS. The scheme is stripped, as the gRPC exporter
+//     expects a bare host:port.
+//   - https://host:port, dialled with TLS.
+//   - unix:///path/to/sock, dialled over a Unix domain socket, which avoids the TCP overhead
+//     when the collector runs as a sidecar.
+func parseOTLPEndpoint(endpoint string) (otlpTarget, error) {
+	if path, ok := strings.CutPrefix(endpoint, "unix://"); ok {
+		dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+
+		// The dialer ignores the address, so the passthrough resolver is used to stop gRPC trying
+		// to resolve the socket path as a hostname.
+		return otlpTarget{
+			address:  "passthrough:///localhost",
+			insecure: true,
+			dialOpts: []grpc.DialOption{grpc.WithContextDialer(dialer)},
+		}, nil
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			return otlpTarget{}, fmt.Errorf("invalid otlp endpoint %q, expected host:port: %w", endpoint, err)
+		}
+
+		return otlpTarget{address: endpoint, insecure: true}, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return otlpTarget{}, fmt.Errorf("invalid otlp endpoint %q: %w", endpoint, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return otlpTarget{}, fmt.Errorf("invalid otlp endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return otlpTarget{}, fmt.Errorf("invalid otlp endpoint %q: missing host", endpoint)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultOTLPPort
+	}
+
+	return otlpTarget{
+		address:  net.JoinHostPort(u.Hostname(), port),
+		insecure: u.Scheme == "http",
+	}, nil
+}
+
+func createMeterProvider(res *resource.Resource, opts ...sdkmetric.Option) *sdkmetric.MeterProvider {
+	return sdkmetric.NewMeterProvider(append([]sdkmetric.Option{sdkmetric.WithResource(res)}, opts...)...)
+}
@@ -0,0 +1,767 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// resourceValue returns the value of the resource's attribute with the given key.
+func resourceValue(res *resource.Resource, key attribute.Key) (string, bool) {
+	v, ok := res.Set().Value(key)
+	return v.AsString(), ok
+}
+
+func TestDeploymentEnvironment(t *testing.T) {
+	tests := []struct {
+		name string
+		env  *string
+		want string
+	}{
+		{name: "unset", want: "development"},
+		{name: "set", env: ptr("production"), want: "production"},
+		{name: "empty", env: ptr(""), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env == nil {
+				unsetenv(t, "DEPLOYMENT_ENVIRONMENT")
+			} else {
+				t.Setenv("DEPLOYMENT_ENVIRONMENT", *tt.env)
+			}
+
+			settings, err := LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := createResource(Config{ServiceName: "service-b"}, settings.DeploymentEnvironment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := resourceValue(res, semconv.DeploymentEnvironmentNameKey); got != tt.want {
+				t.Errorf("got %s %q, want %q", semconv.DeploymentEnvironmentNameKey, got, tt.want)
+			}
+
+			if _, ok := resourceValue(res, "environment"); ok {
+				t.Error("got the raw environment attribute, want only the semconv key")
+			}
+		})
+	}
+}
+
+// unsetenv unsets the environment variable for the rest of the test.
+func unsetenv(t *testing.T, key string) {
+	t.Helper()
+
+	// t.Setenv restores the variable's value after the test.
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// initForTest initialises the SDK with the settings from the environment, without any span
+// exporters, shutting it down at the end of the test.
+func initForTest(t *testing.T, cfg Config) *Providers {
+	t.Helper()
+
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings.TraceEndpoints = nil
+	cfg.Settings = &settings
+
+	providers, shutdown, err := Init(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(shutdown)
+
+	return providers
+}
+
+func TestInitReturnsProviders(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	providers := initForTest(t, Config{
+		ServiceName:               "service-a",
+		DisableGlobalRegistration: true,
+		MetricReaders:             []sdkmetric.Reader{reader},
+	})
+
+	// Spans started with the returned TracerProvider reach its processors.
+	recorder := tracetest.NewSpanRecorder()
+	providers.TracerProvider.RegisterSpanProcessor(recorder)
+
+	_, span := providers.TracerProvider.Tracer("test").Start(context.Background(), "checkout")
+	span.End()
+
+	if ended := recorder.Ended(); len(ended) != 1 || ended[0].Name() != "checkout" {
+		t.Errorf("got %d spans recorded, want the checkout span", len(ended))
+	}
+
+	// Instruments created with the returned MeterProvider are collected by its readers.
+	counter, err := providers.MeterProvider.Meter("test").Int64Counter("checkouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(context.Background(), 1)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			found = found || m.Name == "checkouts"
+		}
+	}
+
+	if !found {
+		t.Error("the checkouts counter wasn't collected")
+	}
+
+	if got, _ := resourceValue(rm.Resource, semconv.ServiceNameKey); got != "service-a" {
+		t.Errorf("got service.name %q, want service-a", got)
+	}
+}
+
+func TestTraceIDFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		want      TraceIDFormat
+		wantEpoch bool
+		wantErr   bool
+	}{
+		{name: "default", want: TraceIDFormatXRay, wantEpoch: true},
+		{name: "xray", format: "xray", want: TraceIDFormatXRay, wantEpoch: true},
+		{name: "w3c", format: "w3c", want: TraceIDFormatW3C},
+		{name: "unknown", format: "b3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRACE_ID_FORMAT", tt.format)
+
+			if tt.wantErr {
+				if _, err := LoadSettings(); err == nil {
+					t.Fatal("got no error, want an invalid TRACE_ID_FORMAT")
+				}
+
+				return
+			}
+
+			providers := initForTest(t, Config{ServiceName: "service-a", DisableGlobalRegistration: true})
+			if providers.TraceIDFormat != tt.want {
+				t.Errorf("got trace ID format %q, want %q", providers.TraceIDFormat, tt.want)
+			}
+
+			before := time.Now().Unix()
+			_, span := providers.TracerProvider.Tracer("test").Start(context.Background(), "checkout")
+			span.End()
+			after := time.Now().Unix()
+
+			// An X-Ray trace ID starts with the epoch second the trace started in, while a W3C one is
+			// random throughout.
+			id := span.SpanContext().TraceID()
+			epoch := int64(id[0])<<24 | int64(id[1])<<16 | int64(id[2])<<8 | int64(id[3])
+			if got := epoch >= before && epoch <= after; got != tt.wantEpoch {
+				t.Errorf("got trace ID %s starting with the time %t, want %t", id, got, tt.wantEpoch)
+			}
+		})
+	}
+}
+
+func TestSpanProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		processor     string
+		wantImmediate bool
+		wantErr       bool
+	}{
+		{name: "default"},
+		{name: "batch", processor: "batch"},
+		{name: "simple", processor: "simple", wantImmediate: true},
+		{name: "unknown", processor: "sync", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SPAN_PROCESSOR", tt.processor)
+
+			settings, err := LoadSettings()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid SPAN_PROCESSOR")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			newSpanProcessor, err := spanProcessorFactory(settings.SpanProcessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(newSpanProcessor(exporter)))
+			t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+			_, span := tp.Tracer("test").Start(context.Background(), "checkout")
+			span.End()
+
+			if got := len(exporter.GetSpans()) == 1; got != tt.wantImmediate {
+				t.Errorf("got the span exported as it ended %t, want %t", got, tt.wantImmediate)
+			}
+
+			// Either way, the span is exported by the time the provider is flushed.
+			if err := tp.ForceFlush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(exporter.GetSpans()); got != 1 {
+				t.Errorf("got %d spans exported after a flush, want 1", got)
+			}
+		})
+	}
+}
+
+func TestInitGlobalRegistration(t *testing.T) {
+	tests := []struct {
+		name       string
+		disable    bool
+		wantGlobal bool
+	}{
+		{name: "registered by default", wantGlobal: true},
+		{name: "disabled", disable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previousTP, previousProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+			previousMP := otel.GetMeterProvider()
+			t.Cleanup(func() {
+				otel.SetTracerProvider(previousTP)
+				otel.SetTextMapPropagator(previousProp)
+				otel.SetMeterProvider(previousMP)
+			})
+
+			// Providers registered by another test, which mustn't be clobbered when disabled.
+			other := sdktrace.NewTracerProvider()
+			otel.SetTracerProvider(other)
+			otel.SetTextMapPropagator(propagation.TraceContext{})
+
+			providers := initForTest(t, Config{ServiceName: "service-a", DisableGlobalRegistration: tt.disable})
+
+			gotGlobal := otel.GetTracerProvider() == trace.TracerProvider(providers.TracerProvider)
+			if gotGlobal != tt.wantGlobal {
+				t.Errorf("got the TracerProvider registered globally %t, want %t", gotGlobal, tt.wantGlobal)
+			}
+
+			if !tt.wantGlobal && otel.GetTracerProvider() != trace.TracerProvider(other) {
+				t.Error("the global TracerProvider was replaced")
+			}
+
+			// Only the propagator Init registers injects the X-Ray trace header.
+			if gotProp := slices.Contains(otel.GetTextMapPropagator().Fields(), "X-Amzn-Trace-Id"); gotProp != tt.wantGlobal {
+				t.Errorf("got the propagator registered globally %t, want %t", gotProp, tt.wantGlobal)
+			}
+		})
+	}
+}
+
+func TestParseOTLPEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint     string
+		wantAddress  string
+		wantInsecure bool
+		wantDialer   bool
+		wantErr      bool
+	}{
+		{endpoint: "collector:4317", wantAddress: "collector:4317", wantInsecure: true},
+		{endpoint: "http://collector", wantAddress: "collector:4317", wantInsecure: true},
+		{endpoint: "https://collector:443", wantAddress: "collector:443"},
+		{endpoint: "unix:///var/run/otel.sock", wantAddress: "passthrough:///localhost", wantInsecure: true, wantDialer: true},
+		{endpoint: "collector", wantErr: true},
+		{endpoint: "ftp://collector:4317", wantErr: true},
+		{endpoint: "http://:4317", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			target, err := parseOTLPEndpoint(tt.endpoint)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", target)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if target.address != tt.wantAddress {
+				t.Errorf("got address %q, want %q", target.address, tt.wantAddress)
+			}
+
+			if target.insecure != tt.wantInsecure {
+				t.Errorf("got insecure %t, want %t", target.insecure, tt.wantInsecure)
+			}
+
+			if got := len(target.dialOpts) > 0; got != tt.wantDialer {
+				t.Errorf("got custom dialer %t, want %t", got, tt.wantDialer)
+			}
+		})
+	}
+}
+
+// TestOTLPEndpointDialsUnixSocket checks a unix:// endpoint is dialled over the socket.
+func TestOTLPEndpointDialsUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "otel.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			close(accepted)
+			_ = conn.Close()
+		}
+	}()
+
+	target, err := parseOTLPEndpoint("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.NewClient(target.address, append(target.dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	conn.Connect()
+
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no connection on the socket")
+	}
+}
+
+// traceCollector is a gRPC OTLP trace endpoint counting the spans exported to it.
+type traceCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mu    sync.Mutex
+	spans int
+}
+
+func (c *traceCollector) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans += len(ss.Spans)
+		}
+	}
+
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+// exported returns the number of spans exported to the collector so far.
+func (c *traceCollector) exported() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.spans
+}
+
+// startTraceCollector starts a plaintext gRPC trace collector, returning it and its address.
+func startTraceCollector(t *testing.T) (*traceCollector, string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &traceCollector{}
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, collector)
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+
+	return collector, ln.Addr().String()
+}
+
+// TestOTLPExporterEndpointForms checks a gRPC exporter reaches a plaintext collector whether its
+// endpoint is given as a bare host:port or as an http URL.
+func TestOTLPExporterEndpointForms(t *testing.T) {
+	collector, address := startTraceCollector(t)
+
+	tests := []struct {
+		name     string
+		endpoint string
+	}{
+		{name: "host and port", endpoint: address},
+		{name: "http url", endpoint: "http://" + address},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter, err := createOLTPExporter(tt.endpoint, ProtocolGRPC, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = exporter.Shutdown(context.Background()) })
+
+			before := collector.exported()
+
+			spans := tracetest.SpanStubs{{Name: "checkout"}}.Snapshots()
+			if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := collector.exported() - before; got != 1 {
+				t.Errorf("got %d spans exported to %s, want 1", got, tt.endpoint)
+			}
+		})
+	}
+}
+
+func TestInitTraceEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		collectors int
+	}{
+		{name: "one endpoint", collectors: 1},
+		{name: "dual-write", collectors: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var collectors []*traceCollector
+			var endpoints []string
+			for range tt.collectors {
+				collector, address := startTraceCollector(t)
+				collectors = append(collectors, collector)
+				endpoints = append(endpoints, address)
+			}
+
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "grpc")
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINTS", strings.Join(endpoints, ", "))
+
+			settings, err := LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			providers, shutdown, err := Init(Config{
+				ServiceName:               "service-a",
+				DisableGlobalRegistration: true,
+				MetricReaders:             []sdkmetric.Reader{sdkmetric.NewManualReader()},
+				Settings:                  &settings,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, span := providers.TracerProvider.Tracer("test").Start(context.Background(), "checkout")
+			span.End()
+
+			// Shutting down flushes the spans to every endpoint.
+			shutdown()
+
+			for i, collector := range collectors {
+				if got := collector.exported(); got != 1 {
+					t.Errorf("got %d spans exported to %s, want 1", got, endpoints[i])
+				}
+			}
+		})
+	}
+}
+
+// TestInitRequired checks that a service whose exporters can't be created fails to start when
+// telemetry is required, and otherwise starts without exporting, still creating spans.
+func TestInitRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		required string
+		wantErr  bool
+	}{
+		{name: "required by default", wantErr: true},
+		{name: "required", required: "true", wantErr: true},
+		{name: "optional", required: "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.required != "" {
+				t.Setenv("OTEL_REQUIRED", tt.required)
+			}
+
+			// Neither exporter can be created for an endpoint without a port.
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "collector")
+
+			settings, err := LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			providers, shutdown, err := Init(Config{
+				ServiceName:               "service-a",
+				DisableGlobalRegistration: true,
+				Settings:                  &settings,
+			})
+			if tt.wantErr {
+				if err == nil {
+					shutdown()
+					t.Fatal("got no error, want the service to fail to start")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(shutdown)
+
+			// The spans are still created, so trace context keeps propagating.
+			_, span := providers.TracerProvider.Tracer("test").Start(context.Background(), "checkout")
+			span.End()
+
+			if !span.SpanContext().IsValid() {
+				t.Error("got an invalid span context, want spans still created")
+			}
+		})
+	}
+}
+
+func TestServiceInstanceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		want     string
+	}{
+		{name: "hostname", hostname: "service-c-7d9f8", want: "service-c-7d9f8"},
+		// Without a hostname, a UUID is generated.
+		{name: "generated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOSTNAME", tt.hostname)
+
+			previous := instanceID
+			instanceID = sync.OnceValue(newInstanceID)
+			t.Cleanup(func() { instanceID = previous })
+
+			var ids []string
+			for range 2 {
+				res, err := createResource(Config{ServiceName: "service-c"}, "test")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				id, ok := resourceValue(res, semconv.ServiceInstanceIDKey)
+				if !ok {
+					t.Fatalf("got no %s attribute", semconv.ServiceInstanceIDKey)
+				}
+
+				ids = append(ids, id)
+
+				// The ID is fixed for the life of the process, even if the environment changes.
+				t.Setenv("HOSTNAME", "changed")
+			}
+
+			switch {
+			case tt.want == "" && uuid.Validate(ids[0]) != nil:
+				t.Errorf("got %s %q, want a UUID", semconv.ServiceInstanceIDKey, ids[0])
+			case tt.want != "" && ids[0] != tt.want:
+				t.Errorf("got %s %q, want %q", semconv.ServiceInstanceIDKey, ids[0], tt.want)
+			}
+
+			if ids[0] != ids[1] {
+				t.Errorf("got %s %q then %q, want it stable", semconv.ServiceInstanceIDKey, ids[0], ids[1])
+			}
+		})
+	}
+}
+
+func TestOTLPEndpointFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		signal   Signal
+		protocol Protocol
+		want     string
+	}{
+		{name: "default grpc", signal: SignalTraces, protocol: ProtocolGRPC, want: "0.0.0.0:4317"},
+		{name: "default http", signal: SignalMetrics, protocol: ProtocolHTTPProtobuf, want: "0.0.0.0:4318"},
+		{
+			name:     "generic",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4317"},
+			signal:   SignalLogs,
+			protocol: ProtocolGRPC,
+			want:     "collector:4317",
+		},
+		{
+			name:     "signal specific",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT": "metrics:4317"},
+			signal:   SignalMetrics,
+			protocol: ProtocolGRPC,
+			want:     "metrics:4317",
+		},
+		{
+			name: "signal specific takes precedence",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "collector:4317",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "traces:4317",
+			},
+			signal:   SignalTraces,
+			protocol: ProtocolGRPC,
+			want:     "traces:4317",
+		},
+		{
+			name: "another signal's endpoint doesn't apply",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "collector:4317",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "traces:4317",
+			},
+			signal:   SignalMetrics,
+			protocol: ProtocolGRPC,
+			want:     "collector:4317",
+		},
+		{
+			name:     "another signal's endpoint doesn't replace the default",
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT": "logs:4317"},
+			signal:   SignalTraces,
+			protocol: ProtocolGRPC,
+			want:     "0.0.0.0:4317",
+		},
+		{
+			name:     "ecs sidecar",
+			env:      map[string]string{"ECS_CONTAINER_METADATA_URI_V4": "http://169.254.170.2/v4/task"},
+			signal:   SignalTraces,
+			protocol: ProtocolHTTPProtobuf,
+			want:     "localhost:4318",
+		},
+		{
+			name:     "ecs sidecar over grpc",
+			env:      map[string]string{"ECS_CONTAINER_METADATA_URI": "http://169.254.170.2/v3/task"},
+			signal:   SignalMetrics,
+			protocol: ProtocolGRPC,
+			want:     "localhost:4317",
+		},
+		{
+			name: "signal specific endpoint takes precedence over the ecs sidecar",
+			env: map[string]string{
+				"ECS_CONTAINER_METADATA_URI_V4":       "http://169.254.170.2/v4/task",
+				"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT": "metrics:4317",
+			},
+			signal:   SignalMetrics,
+			protocol: ProtocolGRPC,
+			want:     "metrics:4317",
+		},
+		{
+			name: "configured endpoint takes precedence over the ecs sidecar",
+			env: map[string]string{
+				"ECS_CONTAINER_METADATA_URI_V4": "http://169.254.170.2/v4/task",
+				"OTEL_EXPORTER_OTLP_ENDPOINT":   "collector:4317",
+			},
+			signal:   SignalTraces,
+			protocol: ProtocolGRPC,
+			want:     "collector:4317",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+				"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT",
+				"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT",
+				"ECS_CONTAINER_METADATA_URI_V4",
+				"ECS_CONTAINER_METADATA_URI",
+			} {
+				unsetenv(t, key)
+			}
+
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			if got := OTLPEndpointFor(tt.signal, tt.protocol); got != tt.want {
+				t.Errorf("got endpoint %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		region string
+	}{
+		{name: "set", region: "eu-west-1"},
+		{name: "unset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := createResource(Config{ServiceName: "service-c", Region: tt.region}, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := resourceValue(res, semconv.CloudRegionKey)
+			if ok != (tt.region != "") || got != tt.region {
+				t.Errorf("got %s %q (present %t), want %q", semconv.CloudRegionKey, got, ok, tt.region)
+			}
+		})
+	}
+}
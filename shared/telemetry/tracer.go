@@ -0,0 +1,22 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName returns the instrumentation scope name for a component of a service, in the form
+// "<service>/<component>", e.g. "service-c/sqs". An empty component names the service itself.
+func ScopeName(service, component string) string {
+	if component == "" {
+		return service
+	}
+
+	return service + "/" + component
+}
+
+// Tracer returns a tracer from the global TracerProvider scoped to a component of a service,
+// so the spans it creates carry the component in their instrumentation scope.
+func Tracer(service, component string, opts ...trace.TracerOption) trace.Tracer {
+	return otel.GetTracerProvider().Tracer(ScopeName(service, component), opts...)
+}
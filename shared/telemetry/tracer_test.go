@@ -0,0 +1,22 @@
+package telemetry
+
+import "testing"
+
+func TestScopeName(t *testing.T) {
+	tests := []struct {
+		name      string
+		component string
+		want      string
+	}{
+		{name: "service", want: "service-c"},
+		{name: "component", component: "sqs", want: "service-c/sqs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScopeName("service-c", tt.component); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// truncatedMarker is appended to a truncated attribute value, so it's obvious in the backend
+// that the value was cut short.
+const truncatedMarker = "…[truncated]"
+
+// truncatingExporter wraps a SpanExporter and truncates string attribute values longer than
+// maxLength bytes, such as SQS receipt handles or message payloads, before the spans are
+// exported. Unlike the SDK's attribute value length limit, it can be applied to specific keys
+// only, and marks the values it truncates.
+type truncatingExporter struct {
+	sdktrace.SpanExporter
+
+	maxLength int
+
+	// keys are the attribute keys truncated. Every key is when it's empty.
+	keys map[attribute.Key]bool
+}
+
+func newTruncatingExporter(exporter sdktrace.SpanExporter, maxLength int, keys []string) *truncatingExporter {
+	e := &truncatingExporter{SpanExporter: exporter, maxLength: maxLength}
+	if len(keys) > 0 {
+		e.keys = attributeKeys(keys)
+	}
+
+	return e
+}
+
+func (e *truncatingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	truncated := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		truncated[i] = e.truncate(span)
+	}
+
+	return e.SpanExporter.ExportSpans(ctx, truncated)
+}
+
+func (e *truncatingExporter) truncate(span sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attrs := span.Attributes()
+
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		if kv.Value.Type() != attribute.STRING || len(kv.Value.AsString()) <= e.maxLength {
+			continue
+		}
+
+		if len(e.keys) > 0 && !e.keys[kv.Key] {
+			continue
+		}
+
+		// Only copy the attributes once one actually needs truncating.
+		if out == nil {
+			out = append([]attribute.KeyValue(nil), attrs...)
+		}
+
+		out[i] = kv.Key.String(truncateString(kv.Value.AsString(), e.maxLength) + truncatedMarker)
+	}
+
+	if out == nil {
+		return span
+	}
+
+	return redactedSpan{ReadOnlySpan: span, attributes: out}
+}
+
+// truncateString cuts s to at most n bytes, without splitting a multi-byte character.
+func truncateString(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
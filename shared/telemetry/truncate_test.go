@@ -0,0 +1,135 @@
+package telemetry
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"shared/appattr"
+)
+
+func TestTruncatingExporter(t *testing.T) {
+	payload := appattr.Key("message.payload")
+	long := strings.Repeat("x", 20)
+
+	span := tracetest.SpanStub{
+		Name: "Process Message",
+		Attributes: []attribute.KeyValue{
+			payload.String(long),
+			attribute.String("messaging.receipt_handle", long),
+			attribute.String("short", "abc"),
+			attribute.Int("count", 12345678),
+		},
+	}
+
+	tests := []struct {
+		name      string
+		maxLength int
+		keys      []string
+		want      map[attribute.Key]string
+	}{
+		{
+			name:      "every key",
+			maxLength: 10,
+			want: map[attribute.Key]string{
+				payload:                    "xxxxxxxxxx" + truncatedMarker,
+				"messaging.receipt_handle": "xxxxxxxxxx" + truncatedMarker,
+				"short":                    "abc",
+			},
+		},
+		{
+			name:      "configured keys",
+			maxLength: 10,
+			keys:      []string{"message.payload"},
+			want:      map[attribute.Key]string{payload: "xxxxxxxxxx" + truncatedMarker, "messaging.receipt_handle": long},
+		},
+		{
+			name:      "at the limit",
+			maxLength: 20,
+			want:      map[attribute.Key]string{payload: long, "messaging.receipt_handle": long, "short": "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exportThrough(t, func(e sdktrace.SpanExporter) sdktrace.SpanExporter {
+				return newTruncatingExporter(e, tt.maxLength, tt.keys)
+			}, span)[0]
+
+			for key, want := range tt.want {
+				if value := attributeValue(got.Attributes, key).AsString(); value != want {
+					t.Errorf("got %s %q, want %q", key, value, want)
+				}
+			}
+
+			if count := attributeValue(got.Attributes, "count").AsInt64(); count != 12345678 {
+				t.Errorf("got count %d, want it untouched", count)
+			}
+		})
+	}
+}
+
+func TestLoadSettingsTruncation(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength string
+		keys      string
+		wantMax   int
+		wantKeys  []string
+		wantErr   bool
+	}{
+		{name: "disabled"},
+		{name: "every key", maxLength: "256", wantMax: 256},
+		{name: "configured keys", maxLength: "256", keys: "message.payload, messaging.receipt_handle", wantMax: 256, wantKeys: []string{"message.payload", "messaging.receipt_handle"}},
+		{name: "zero", maxLength: "0", wantErr: true},
+		{name: "not a number", maxLength: "long", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.maxLength != "" {
+				t.Setenv("ATTRIBUTE_MAX_LENGTH", tt.maxLength)
+			}
+			t.Setenv("ATTRIBUTE_TRUNCATE_KEYS", tt.keys)
+
+			s, err := LoadSettings()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error, want an invalid ATTRIBUTE_MAX_LENGTH")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.AttributeMaxLength != tt.wantMax || !slices.Equal(s.AttributeTruncateKeys, tt.wantKeys) {
+				t.Errorf("got max length %d of %v, want %d of %v", s.AttributeMaxLength, s.AttributeTruncateKeys, tt.wantMax, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "abcdef", n: 3, want: "abc"},
+		{s: "añb", n: 2, want: "a"},
+		{s: "añb", n: 3, want: "añ"},
+		{s: "€€", n: 1, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncateString(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateString(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// UserAgentBaggageMember is the baggage member carrying the user agent of the client that
+// started the trace, so every service can attribute its work back to the type of client.
+const UserAgentBaggageMember = "user_agent"
+
+// UserAgentKey is the span attribute the originating user agent is recorded as.
+const UserAgentKey = attribute.Key("http.user_agent")
+
+// UserAgentBaggageAttributes copies the propagated user agent onto every span as it starts. It's
+// meant for Config.BaggageAttributes.
+var UserAgentBaggageAttributes = map[string]string{UserAgentBaggageMember: string(UserAgentKey)}
+
+// ContextWithUserAgent returns a copy of ctx whose baggage carries the user agent. The context is
+// returned unchanged if the user agent is empty.
+func ContextWithUserAgent(ctx context.Context, userAgent string) context.Context {
+	if userAgent == "" {
+		return ctx
+	}
+
+	// The raw member is percent-encoded when propagated, as user agents contain characters
+	// baggage values can't.
+	member, err := baggage.NewMemberRaw(UserAgentBaggageMember, userAgent)
+	if err != nil {
+		return ctx
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+
+	return baggage.ContextWithBaggage(ctx, bag)
+}
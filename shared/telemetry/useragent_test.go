@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestUserAgentPropagation checks the user agent added to the baggage by the producer is
+// recorded on the consumer's span, once the baggage has been carried across the boundary.
+func TestUserAgentPropagation(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+	}{
+		{name: "browser", userAgent: "Mozilla/5.0 (X11; Linux x86_64) Gecko/20100101 Firefox/131.0"},
+		{name: "curl", userAgent: "curl/8.0"},
+		{name: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The producer carries the baggage in the message, e.g. as an SQS message attribute.
+			carrier := propagation.MapCarrier{}
+			propagation.Baggage{}.Inject(ContextWithUserAgent(context.Background(), tt.userAgent), carrier)
+
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSpanProcessor(newBaggageSpanProcessor(UserAgentBaggageAttributes)),
+				sdktrace.WithSpanProcessor(recorder),
+			)
+
+			ctx := propagation.Baggage{}.Extract(context.Background(), carrier)
+			_, span := tp.Tracer("test").Start(ctx, "Process Message", trace.WithSpanKind(trace.SpanKindConsumer))
+			span.End()
+
+			got := attributeValue(recorder.Ended()[0].Attributes(), UserAgentKey)
+			if got.AsString() != tt.userAgent {
+				t.Errorf("got %s %q, want %q", UserAgentKey, got.AsString(), tt.userAgent)
+			}
+		})
+	}
+}
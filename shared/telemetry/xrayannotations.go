@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"shared/appattr"
+)
+
+// xrayAnnotationsKey is the span attribute the collector's awsxray exporter reads to decide
+// which of a span's attributes to send to X-Ray as annotations. Annotations are indexed and can
+// be searched in the X-Ray console, whereas every other attribute is sent as metadata.
+//
+// This relies on the collector's awsxray exporter; any attributes listed in its
+// indexed_attributes config are indexed as well, and index_all_attributes indexes them all.
+const xrayAnnotationsKey = attribute.Key("aws.xray.annotations")
+
+// defaultXRayAnnotations are the attributes indexed when XRAY_ANNOTATIONS isn't set, so a
+// checkout can be found in the X-Ray console by its basket or transaction.
+var defaultXRayAnnotations = []string{"basket.id", "transaction.id"}
+
+// xrayAnnotations returns the keys of the attributes to index in X-Ray, from their names. The
+// names are namespaced like any other custom attribute.
+func xrayAnnotations(names []string) []string {
+	var keys []string
+	for _, name := range names {
+		keys = append(keys, string(appattr.Key(name)))
+	}
+
+	return keys
+}
+
+// xrayAnnotationSpanProcessor marks the configured attributes as X-Ray annotations on every
+// span. The attributes don't need to be set yet, as the exporter only indexes those present
+// when the span is exported.
+type xrayAnnotationSpanProcessor struct {
+	annotations attribute.KeyValue
+}
+
+var _ sdktrace.SpanProcessor = xrayAnnotationSpanProcessor{}
+
+func newXRayAnnotationSpanProcessor(keys []string) xrayAnnotationSpanProcessor {
+	return xrayAnnotationSpanProcessor{annotations: xrayAnnotationsKey.StringSlice(keys)}
+}
+
+func (p xrayAnnotationSpanProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	s.SetAttributes(p.annotations)
+}
+
+func (xrayAnnotationSpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (xrayAnnotationSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (xrayAnnotationSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestXRayAnnotations(t *testing.T) {
+	tests := []struct {
+		name string
+		env  *string
+		want []string
+	}{
+		{name: "default", want: []string{"basket.id", "transaction.id"}},
+		{name: "configured", env: ptr("order.id, customer.tier"), want: []string{"order.id", "customer.tier"}},
+		{name: "disabled", env: ptr("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XRAY_ANNOTATIONS", "")
+			if tt.env == nil {
+				os.Unsetenv("XRAY_ANNOTATIONS")
+			} else {
+				t.Setenv("XRAY_ANNOTATIONS", *tt.env)
+			}
+
+			settings, err := LoadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The processor is only registered when there are annotations, as Init does.
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			if keys := xrayAnnotations(settings.XRayAnnotations); len(keys) > 0 {
+				tp.RegisterSpanProcessor(newXRayAnnotationSpanProcessor(keys))
+			}
+
+			_, span := tp.Tracer("test").Start(context.Background(), "checkout")
+			span.End()
+
+			got := attributeValue(recorder.Ended()[0].Attributes(), xrayAnnotationsKey).AsStringSlice()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %s %q, want %q", xrayAnnotationsKey, got, tt.want)
+			}
+		})
+	}
+}
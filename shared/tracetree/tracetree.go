@@ -0,0 +1,308 @@
+// Package tracetree reconstructs the tree of a trace from its finished spans, so tests can assert
+// the trace's shape. The spans can come from several services' exporters, so a trace propagated
+// between them, over HTTP or SQS, can be checked as a whole. A trace's shape can also be locked in
+// with a golden file, which the tests' -update flag rewrites.
+package tracetree
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var update = flag.Bool("update", false, "write the trace shapes compared by tracetree.Golden to their golden files")
+
+// Node is a span in the tree of a trace, identified by its name.
+type Node struct {
+	Name     string
+	Children []Node
+}
+
+// N returns the node of a span with the given name and children, for writing out the expected
+// tree of a trace.
+func N(name string, children ...Node) Node {
+	return Node{Name: name, Children: children}
+}
+
+// String renders the node and its descendants one per line, each indented under its parent.
+// Siblings are sorted, as the order spans end in isn't meaningful.
+func (n Node) String() string {
+	var b strings.Builder
+	n.render(&b, 0)
+
+	return b.String()
+}
+
+func (n Node) render(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(n.Name)
+	b.WriteByte('\n')
+
+	children := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		var cb strings.Builder
+		child.render(&cb, depth+1)
+		children[i] = cb.String()
+	}
+
+	slices.Sort(children)
+
+	for _, child := range children {
+		b.WriteString(child)
+	}
+}
+
+// Build returns the trees of the spans, given by one or more exporters. Each span whose parent
+// isn't among them is the root of a tree.
+func Build(spans ...[]sdktrace.ReadOnlySpan) []Node {
+	byID := make(map[trace.SpanID]bool)
+	children := make(map[trace.SpanID][]sdktrace.ReadOnlySpan)
+
+	for _, exported := range spans {
+		for _, span := range exported {
+			byID[span.SpanContext().SpanID()] = true
+		}
+	}
+
+	var roots []sdktrace.ReadOnlySpan
+	for _, exported := range spans {
+		for _, span := range exported {
+			parent := span.Parent()
+			if !parent.IsValid() || !byID[parent.SpanID()] {
+				roots = append(roots, span)
+				continue
+			}
+
+			children[parent.SpanID()] = append(children[parent.SpanID()], span)
+		}
+	}
+
+	var build func(span sdktrace.ReadOnlySpan) Node
+	build = func(span sdktrace.ReadOnlySpan) Node {
+		node := Node{Name: span.Name()}
+		for _, child := range children[span.SpanContext().SpanID()] {
+			node.Children = append(node.Children, build(child))
+		}
+
+		return node
+	}
+
+	nodes := make([]Node, len(roots))
+	for i, root := range roots {
+		nodes[i] = build(root)
+	}
+
+	return nodes
+}
+
+// Diff compares the tree of the trace in the spans with want, returning a line by line diff,
+// prefixed "-" for what's missing from the trace and "+" for what's unexpected, or "" if they
+// match.
+//
+// Only the spans named in want are compared. Any others, such as the HTTP client spans of the
+// instrumentation, are skipped over: their children are compared as the children of their
+// nearest named ancestor. So want needn't spell out every span, but each span it names has to be
+// a descendant of its parent in want.
+func Diff(want Node, spans ...[]sdktrace.ReadOnlySpan) string {
+	names := make(map[string]bool)
+	want.walk(func(n Node) { names[n.Name] = true })
+
+	var got []Node
+	for _, root := range Build(spans...) {
+		got = append(got, root.only(names)...)
+	}
+
+	// A recorder may hold other traces too, such as the startup's, so it's the tree rooted at
+	// the span named like want's root that's compared.
+	for _, root := range got {
+		if root.String() == want.String() {
+			return ""
+		}
+	}
+
+	var rendered strings.Builder
+	for _, root := range got {
+		if root.Name == want.Name {
+			return diffLines(want.String(), root.String())
+		}
+
+		rendered.WriteString(root.String())
+	}
+
+	return diffLines(want.String(), rendered.String())
+}
+
+// Assert fails the test, showing the diff, if the tree of the trace in the spans doesn't match
+// want, as compared by Diff.
+func Assert(t testing.TB, want Node, spans ...[]sdktrace.ReadOnlySpan) {
+	t.Helper()
+
+	if diff := Diff(want, spans...); diff != "" {
+		t.Errorf("trace hierarchy mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Shape renders the trees of the spans for a golden file: the name, kind and attribute keys of
+// each span, one per line, indented under its parent. The attributes in values are rendered with
+// their values; the others, such as IDs, timings and ports, vary from one run to the next.
+func Shape(values []attribute.Key, spans ...[]sdktrace.ReadOnlySpan) string {
+	rendered := make(map[trace.SpanID]string)
+	for _, exported := range spans {
+		for _, span := range exported {
+			rendered[span.SpanContext().SpanID()] = describe(span, values)
+		}
+	}
+
+	// The spans' descriptions stand in for their names, so the trees render them instead.
+	var named [][]sdktrace.ReadOnlySpan
+	for _, exported := range spans {
+		described := make([]sdktrace.ReadOnlySpan, len(exported))
+		for i, span := range exported {
+			described[i] = describedSpan{span, rendered[span.SpanContext().SpanID()]}
+		}
+
+		named = append(named, described)
+	}
+
+	roots := Build(named...)
+
+	trees := make([]string, len(roots))
+	for i, root := range roots {
+		trees[i] = root.String()
+	}
+
+	slices.Sort(trees)
+
+	return strings.Join(trees, "")
+}
+
+// describedSpan is a span named with its description.
+type describedSpan struct {
+	sdktrace.ReadOnlySpan
+	description string
+}
+
+func (s describedSpan) Name() string {
+	return s.description
+}
+
+func describe(span sdktrace.ReadOnlySpan, values []attribute.Key) string {
+	attrs := make([]string, 0, len(span.Attributes()))
+	for _, kv := range span.Attributes() {
+		if slices.Contains(values, kv.Key) {
+			attrs = append(attrs, string(kv.Key)+"="+kv.Value.Emit())
+		} else {
+			attrs = append(attrs, string(kv.Key))
+		}
+	}
+
+	slices.Sort(attrs)
+
+	return strings.Join(append([]string{span.Name(), "(" + span.SpanKind().String() + ")"}, attrs...), " ")
+}
+
+// Golden fails the test, showing a diff, if the shape of a trace rendered by Shape differs from
+// the golden file at path. Run the test with -update to write the shape to the file instead, once
+// the change to the trace is intended.
+func Golden(t testing.TB, path string, shape string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(shape), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading golden file, run the test with -update to create it: %v", err)
+	}
+
+	if string(want) != shape {
+		t.Errorf("trace shape differs from %s (-want +got):\n%s\nRun the test with -update if the change is intended.", path, diffLines(string(want), shape))
+	}
+}
+
+func (n Node) walk(fn func(Node)) {
+	fn(n)
+
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
+// only returns the tree with the spans not in names removed, their children taking their place.
+func (n Node) only(names map[string]bool) []Node {
+	var children []Node
+	for _, child := range n.Children {
+		children = append(children, child.only(names)...)
+	}
+
+	if !names[n.Name] {
+		return children
+	}
+
+	return []Node{{Name: n.Name, Children: children}}
+}
+
+// diffLines returns the lines of want and got, marking those only in want with "-" and those only
+// in got with "+", using their longest common subsequence.
+func diffLines(want, got string) string {
+	a, b := lines(want), lines(got)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+
+	return out.String()
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
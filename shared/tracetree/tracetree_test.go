@@ -0,0 +1,218 @@
+package tracetree
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// service records the spans of one service, as its in-memory exporter would.
+type service struct {
+	tracer trace.Tracer
+	spans  *tracetest.SpanRecorder
+}
+
+func newService(t *testing.T, name string) *service {
+	t.Helper()
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	return &service{tracer: tp.Tracer(name), spans: spans}
+}
+
+// span starts and ends a span, calling fn within it.
+func (s *service) span(ctx context.Context, name string, kind trace.SpanKind, fn func(ctx context.Context)) {
+	ctx, span := s.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	defer span.End()
+
+	if fn != nil {
+		fn(ctx)
+	}
+}
+
+// checkout records a checkout's trace across the three services, propagated over HTTP with the
+// W3C trace context and over SQS with the X-Ray trace header, like the demo. broken drops the
+// trace context at the named hop.
+func checkout(t *testing.T, broken string) (a, b, c *service) {
+	t.Helper()
+
+	a, b, c = newService(t, "service-a"), newService(t, "service-b"), newService(t, "service-c")
+
+	header := http.Header{}
+	a.span(context.Background(), "GET /checkout", trace.SpanKindServer, func(ctx context.Context) {
+		a.span(ctx, "Make Payment", trace.SpanKindInternal, func(ctx context.Context) {
+			a.span(ctx, "HTTP POST", trace.SpanKindClient, func(ctx context.Context) {
+				if broken != "http" {
+					propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+				}
+			})
+		})
+	})
+
+	message := propagation.MapCarrier{}
+	paymentCtx := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+	b.span(paymentCtx, "POST /payment", trace.SpanKindServer, func(ctx context.Context) {
+		b.span(ctx, "Process Payment", trace.SpanKindInternal, nil)
+		b.span(ctx, "SQS.SendMessage", trace.SpanKindClient, func(ctx context.Context) {
+			if broken != "sqs" {
+				xray.Propagator{}.Inject(ctx, message)
+			}
+		})
+	})
+
+	messageCtx := xray.Propagator{}.Extract(context.Background(), message)
+	c.span(messageCtx, "Process Message", trace.SpanKindConsumer, func(ctx context.Context) {
+		c.span(ctx, "Write Record", trace.SpanKindClient, nil)
+		c.span(ctx, "Concurrent Work", trace.SpanKindInternal, func(ctx context.Context) {
+			c.span(ctx, "Downstream Requests", trace.SpanKindInternal, func(ctx context.Context) {
+				c.span(ctx, "HTTP GET", trace.SpanKindClient, nil)
+			})
+			c.span(ctx, "Write Object", trace.SpanKindClient, nil)
+		})
+	})
+
+	return a, b, c
+}
+
+// checkoutTree is the hierarchy of a checkout's trace: checkout → make payment → process
+// payment, then over SQS → process message → {dynamo, s3, downstream}.
+var checkoutTree = N("GET /checkout",
+	N("Make Payment",
+		N("POST /payment",
+			N("Process Payment"),
+			N("SQS.SendMessage",
+				N("Process Message",
+					N("Write Record"),
+					N("Downstream Requests"),
+					N("Write Object"),
+				),
+			),
+		),
+	),
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		broken   string
+		want     Node
+		wantDiff []string
+	}{
+		{name: "propagated end to end", want: checkoutTree},
+		{
+			name:   "propagation over HTTP broken",
+			broken: "http",
+			want:   checkoutTree,
+			wantDiff: []string{
+				"-     POST /payment",
+				"-       Process Payment",
+				"-       SQS.SendMessage",
+			},
+		},
+		{
+			name:   "propagation over SQS broken",
+			broken: "sqs",
+			want:   checkoutTree,
+			wantDiff: []string{
+				"  GET /checkout",
+				"-         Process Message",
+				"-           Write Record",
+			},
+		},
+		{
+			name: "span missing",
+			want: N("GET /checkout", N("Make Payment", N("Validate Basket"))),
+			wantDiff: []string{
+				"  GET /checkout",
+				"    Make Payment",
+				"-     Validate Basket",
+			},
+		},
+		{
+			name: "span under the wrong parent",
+			want: N("Process Message", N("Write Record", N("Write Object"))),
+			wantDiff: []string{
+				"  Process Message",
+				"+   Write Object",
+				"    Write Record",
+				"-     Write Object",
+			},
+		},
+		{
+			name:     "root missing",
+			want:     N("GET /orders"),
+			wantDiff: []string{"- GET /orders"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b, c := checkout(t, tt.broken)
+
+			diff := Diff(tt.want, a.spans.Ended(), b.spans.Ended(), c.spans.Ended())
+			if len(tt.wantDiff) == 0 {
+				if diff != "" {
+					t.Errorf("Diff() =\n%s\nwant no diff", diff)
+				}
+				return
+			}
+
+			for _, line := range tt.wantDiff {
+				if !strings.Contains(diff, line+"\n") {
+					t.Errorf("Diff() =\n%s\nwant it to contain %q", diff, line)
+				}
+			}
+		})
+	}
+}
+
+func TestBuild(t *testing.T) {
+	a, b, c := checkout(t, "")
+
+	// Each service's spans on their own are a tree, rooted where the trace entered the service.
+	for _, tt := range []struct {
+		spans []sdktrace.ReadOnlySpan
+		want  string
+	}{
+		{a.spans.Ended(), "GET /checkout\n  Make Payment\n    HTTP POST\n"},
+		{b.spans.Ended(), "POST /payment\n  Process Payment\n  SQS.SendMessage\n"},
+	} {
+		roots := Build(tt.spans)
+		if len(roots) != 1 || roots[0].String() != tt.want {
+			t.Errorf("Build() = %v, want %q", roots, tt.want)
+		}
+	}
+
+	if roots := Build(a.spans.Ended(), b.spans.Ended(), c.spans.Ended()); len(roots) != 1 {
+		t.Errorf("Build() of every service = %d roots, want 1", len(roots))
+	}
+}
+
+func TestShape(t *testing.T) {
+	a, b, c := checkout(t, "")
+
+	Golden(t, filepath.Join("testdata", "checkout.golden"), Shape(nil, a.spans.Ended(), b.spans.Ended(), c.spans.Ended()))
+
+	s := newService(t, "service-b")
+	_, span := s.tracer.Start(context.Background(), "Process Payment", trace.WithAttributes(
+		attribute.String("payment.currency", "GBP"),
+		attribute.String("transaction.id", "0b7a1c"),
+	))
+	span.End()
+
+	want := "Process Payment (internal) payment.currency=GBP transaction.id\n"
+	if got := Shape([]attribute.Key{"payment.currency"}, s.spans.Ended()); got != want {
+		t.Errorf("Shape() = %q, want %q", got, want)
+	}
+}